@@ -24,8 +24,10 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package skrafl
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"slices"
 	"strings"
 )
 
@@ -38,15 +40,77 @@ type Bag struct {
 	// Contents is a list of pointers into the Tiles array,
 	// corresponding to the current contents of the bag
 	Contents []*Tile
+	// forced is a list of letters that will be drawn next,
+	// in order, instead of random tiles. This is used when
+	// replaying games.
+	forced []rune
+	// rng draws from src, the random source used to draw tiles.
+	// If nil, the (automatically seeded) global source is used.
+	// A Bag, like the Game that owns it, is not safe
+	// for concurrent use.
+	rng *rand.Rand
+	src *bagSource
+}
+
+// bagSource is the random source of a Bag. It has a known seed and
+// counts the values that it has produced, so that a clone of the Bag
+// can reproduce its state, or derive an independent source from it,
+// without drawing from it.
+type bagSource struct {
+	rand.Source
+	seed  int64
+	count uint64
+}
+
+// newBagSource returns a fresh bagSource with the given seed
+func newBagSource(seed int64) *bagSource {
+	return &bagSource{Source: rand.NewSource(seed), seed: seed}
+}
+
+// Int63 returns the next value from the source
+func (src *bagSource) Int63() int64 {
+	src.count++
+	return src.Source.Int63()
+}
+
+// Seed reseeds the source
+func (src *bagSource) Seed(seed int64) {
+	src.Source.Seed(seed)
+	src.seed, src.count = seed, 0
+}
+
+// copy returns a source in the same state as this one, which
+// produces the same values from now on
+func (src *bagSource) copy() *bagSource {
+	c := newBagSource(src.seed)
+	for c.count < src.count {
+		c.Int63()
+	}
+	return c
+}
+
+// derive returns a source that is independent of this one, with a
+// seed computed from its seed and count (by the SplitMix64 finalizer),
+// so that sources derived at the same point are the same
+func (src *bagSource) derive() *bagSource {
+	z := uint64(src.seed) + (src.count+1)*0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return newBagSource(int64(z ^ (z >> 31)))
 }
 
 // TileSet is a static list of tiles, used as a prototype
 // to copy new Bags from
 type TileSet struct {
+	// A descriptive name of the tile set, such as "en" or "is"
+	Name   string
 	Tiles  []Tile
 	Scores map[rune]int
 	// The initial size of the bag (before tiles are drawn)
 	Size int
+	// The default leave values used to evaluate exchanges,
+	// which can be replaced by a custom LeaveTable
+	Leaves LeaveTable
 }
 
 // initTileSet makes a complete tile set, given a scoring map
@@ -54,14 +118,21 @@ type TileSet struct {
 func initTileSet(scores map[rune]int, tiles map[rune]int) *TileSet {
 	// Count the tiles in the tile set
 	numTiles := 0
-	for _, count := range tiles {
+	letters := make([]rune, 0, len(tiles))
+	for letter, count := range tiles {
 		numTiles += count
+		letters = append(letters, letter)
 	}
+	// Assign the tiles in alphabetical order, so that the
+	// order of a fresh bag does not depend on map iteration
+	// and seeded draws are reproducible
+	slices.Sort(letters)
 	// Make a tile slice/array to hold the entire tile set
 	tileSet := make([]Tile, numTiles)
 	// Assign each tile in the tile set
 	i := 0
-	for letter, count := range tiles {
+	for _, letter := range letters {
+		count := tiles[letter]
 		score := scores[letter]
 		for j := 0; j < count; j++ {
 			t := &tileSet[i]
@@ -77,6 +148,125 @@ func initTileSet(scores map[rune]int, tiles map[rune]int) *TileSet {
 	return &TileSet{Tiles: tileSet, Scores: scores, Size: numTiles}
 }
 
+// NewTileSet makes a custom tile set, given a scoring map and a map
+// of letters and their associated counts, with '?' denoting a blank
+// tile. Every letter in the counts map must have a score, and the
+// counts map must contain the blank tile; a tile set without blanks
+// is allowed by explicitly setting the count of '?' to 0.
+func NewTileSet(scores map[rune]int, counts map[rune]int) (*TileSet, error) {
+	if _, ok := counts['?']; !ok {
+		return nil, fmt.Errorf("the tile set has no blank tiles")
+	}
+	numTiles := 0
+	for letter, count := range counts {
+		if count < 0 {
+			return nil, fmt.Errorf("negative count for letter '%c'", letter)
+		}
+		score, ok := scores[letter]
+		if !ok && count > 0 {
+			return nil, fmt.Errorf("letter '%c' has no score", letter)
+		}
+		if score < 0 {
+			return nil, fmt.Errorf("negative score for letter '%c'", letter)
+		}
+		numTiles += count
+	}
+	if numTiles < 2*RackSize {
+		return nil, fmt.Errorf("the tile set must have at least %v tiles", 2*RackSize)
+	}
+	// Copy the maps, so that later changes by the caller
+	// do not affect the tile set
+	scoresCopy := make(map[rune]int, len(scores))
+	for letter, score := range scores {
+		scoresCopy[letter] = score
+	}
+	countsCopy := make(map[rune]int, len(counts))
+	for letter, count := range counts {
+		if count > 0 {
+			countsCopy[letter] = count
+		}
+	}
+	return initTileSet(scoresCopy, countsCopy), nil
+}
+
+// The bounds on the number of tiles in a tile set loaded from JSON
+const (
+	minJsonTileSetSize = 20
+	maxJsonTileSetSize = 200
+)
+
+// tileSetJson is the JSON representation of a tile set, where the
+// keys of the maps are single letters, with "?" denoting a blank tile
+type tileSetJson struct {
+	Name   string         `json:"name"`
+	Scores map[string]int `json:"scores"`
+	Counts map[string]int `json:"counts"`
+}
+
+// runeMap converts a JSON map keyed by single letters
+// to a map keyed by runes
+func runeMap(m map[string]int) (map[rune]int, error) {
+	result := make(map[rune]int, len(m))
+	for key, value := range m {
+		letters := []rune(key)
+		if len(letters) != 1 {
+			return nil, fmt.Errorf("invalid letter '%v'", key)
+		}
+		result[letters[0]] = value
+	}
+	return result, nil
+}
+
+// NewTileSetFromJSON makes a custom tile set from a JSON object such as
+// {"name": "kids", "scores": {"a": 1, ...}, "counts": {"a": 9, ...}},
+// where the blank tile is denoted by "?". The same rules apply as in
+// NewTileSet(), and in addition the tile set must have between 20 and
+// 200 tiles.
+func NewTileSetFromJSON(data []byte) (*TileSet, error) {
+	var tsj tileSetJson
+	if err := json.Unmarshal(data, &tsj); err != nil {
+		return nil, err
+	}
+	scores, err := runeMap(tsj.Scores)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := runeMap(tsj.Counts)
+	if err != nil {
+		return nil, err
+	}
+	numTiles := 0
+	for _, count := range counts {
+		numTiles += count
+	}
+	if numTiles < minJsonTileSetSize || numTiles > maxJsonTileSetSize {
+		return nil, fmt.Errorf(
+			"the tile set has %v tiles, but must have between %v and %v",
+			numTiles, minJsonTileSetSize, maxJsonTileSetSize,
+		)
+	}
+	tileSet, err := NewTileSet(scores, counts)
+	if err != nil {
+		return nil, err
+	}
+	tileSet.Name = tsj.Name
+	return tileSet, nil
+}
+
+// Validate checks that every letter in the tile set, other than
+// the blank, is found in the given alphabet, typically that of the
+// dictionary that the tile set is to be used with
+func (tileSet *TileSet) Validate(alphabet *Alphabet) error {
+	for _, tile := range tileSet.Tiles {
+		if tile.Letter != '?' && !alphabet.Contains(tile.Letter) {
+			return fmt.Errorf(
+				"letter '%c' of tile set %q is not in the alphabet", tile.Letter, tileSet.Name,
+			)
+		}
+	}
+	return nil
+}
+
 // initNewIcelandicTileSet creates the "new" Icelandic
 // tile set (as defined by Skraflfélag Íslands) as a fresh array
 // (slice) of tiles with the correct number of each letter,
@@ -105,7 +295,10 @@ func initNewIcelandicTileSet() *TileSet {
 		'æ': 2, 'ö': 1, '?': 2,
 	}
 
-	return initTileSet(scores, tiles)
+	tileSet := initTileSet(scores, tiles)
+	tileSet.Name = "is"
+	tileSet.Leaves = IcelandicLeaveTable
+	return tileSet
 }
 
 // NewIcelandicTileSet is the new standard Icelandic tile set
@@ -134,7 +327,9 @@ func initPolishTileSet() *TileSet {
 		'ź': 1, 'ż': 1, '?': 2,
 	}
 
-	return initTileSet(scores, tiles)
+	tileSet := initTileSet(scores, tiles)
+	tileSet.Name = "pl"
+	return tileSet
 }
 
 // PolishTileSet is the standard Polish tile set
@@ -163,7 +358,9 @@ func initNorwegianTileSet() *TileSet {
 		'å': 2, '?': 2,
 	}
 
-	return initTileSet(scores, tiles)
+	tileSet := initTileSet(scores, tiles)
+	tileSet.Name = "no"
+	return tileSet
 }
 
 // NorwegianTileSet is the new Norwegian tile set
@@ -192,7 +389,10 @@ func initEnglishTileSet() *TileSet {
 		'z': 1,
 	}
 
-	return initTileSet(scores, tiles)
+	tileSet := initTileSet(scores, tiles)
+	tileSet.Name = "en"
+	tileSet.Leaves = EnglishLeaveTable
+	return tileSet
 }
 
 // EnglishTileSet is the (old) standard English tile set
@@ -221,17 +421,29 @@ func initNewEnglishTileSet() *TileSet {
 		'q': 1, '?': 2, // Blank tiles
 	}
 
-	return initTileSet(scores, tiles)
+	tileSet := initTileSet(scores, tiles)
+	tileSet.Name = "en_explo"
+	tileSet.Leaves = EnglishLeaveTable
+	return tileSet
 }
 
 // NewEnglishTileSet is the Explo English tile set
 var NewEnglishTileSet = initNewEnglishTileSet()
 
-// Initialize a bag from a tile set and return a reference to it
-func makeBag(tileSet *TileSet) *Bag {
+// Initialize a bag from a tile set and return a reference to it.
+// Tiles are drawn using a source of the bag's own, seeded from the
+// given random source, or if it is nil, from the global one. Each bag
+// thus has its own source, so that concurrent games do not contend
+// for the lock of the global source.
+func makeBag(tileSet *TileSet, source rand.Source) *Bag {
 	// Make a fresh array for the bag and copy the tile set to it
 	bag := &Bag{}
-	bag.Tiles = []Tile(tileSet.Tiles)
+	if source != nil {
+		bag.Seed(source.Int63())
+	} else {
+		bag.Seed(rand.Int63())
+	}
+	bag.Tiles = slices.Clone(tileSet.Tiles)
 	// Create an array of tile pointers as the initial contents of the bag
 	bag.Contents = make([]*Tile, len(bag.Tiles))
 	for i := range bag.Contents {
@@ -241,11 +453,64 @@ func makeBag(tileSet *TileSet) *Bag {
 	return bag
 }
 
+// Contains returns true if the tile set has
+// tiles with the given letter
 func (tileSet *TileSet) Contains(letter rune) bool {
-	_, ok := tileSet.Scores[letter]
+	_, ok := tileSet.Score(letter)
 	return ok
 }
 
+// Score returns the score of a tile with the given letter,
+// or (0, false) if the letter is not in the tile set
+func (tileSet *TileSet) Score(letter rune) (int, bool) {
+	score, ok := tileSet.Scores[letter]
+	return score, ok
+}
+
+// TotalScore returns the sum of the scores of all tiles
+// in the tile set, with blank tiles counting as 0
+func (tileSet *TileSet) TotalScore() int {
+	total := 0
+	for _, tile := range tileSet.Tiles {
+		if tile.Letter != '?' {
+			total += tile.Score
+		}
+	}
+	return total
+}
+
+// Seed makes the Bag draw its tiles from a local random
+// source with the given seed, making the draws reproducible
+func (bag *Bag) Seed(seed int64) {
+	bag.setSource(newBagSource(seed))
+}
+
+// setSource makes the Bag draw its tiles from the given source
+func (bag *Bag) setSource(src *bagSource) {
+	bag.src = src
+	bag.rng = rand.New(src)
+}
+
+// derivedRng returns a random number generator whose source is
+// derived from the state of the Bag's source, without drawing from
+// it, or seeded from the global source if the Bag has none
+func (bag *Bag) derivedRng() *rand.Rand {
+	if bag.src != nil {
+		return rand.New(bag.src.derive())
+	}
+	return rand.New(rand.NewSource(rand.Int63()))
+}
+
+// intn returns a random number in [0, n) from the
+// random source of the Bag, or from the global one if
+// the Bag has none
+func (bag *Bag) intn(n int) int {
+	if bag.rng != nil {
+		return bag.rng.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
 // DrawTile pops one tile from the (randomized) bag
 // and returns it
 func (bag *Bag) DrawTile() *Tile {
@@ -254,8 +519,14 @@ func (bag *Bag) DrawTile() *Tile {
 		// No tiles left in the bag
 		return nil
 	}
+	if len(bag.forced) > 0 {
+		// Draw the next tile in the forced sequence
+		letter := bag.forced[0]
+		bag.forced = bag.forced[1:]
+		return bag.DrawTileByLetter(letter)
+	}
 	// Find a random tile in the bag and return it
-	i := rand.Intn(tileCount)
+	i := bag.intn(tileCount)
 	tile := bag.Contents[i]
 	bag.Contents = append(bag.Contents[:i], bag.Contents[i+1:]...)
 	return tile
@@ -280,14 +551,34 @@ func (bag *Bag) DrawTileByLetter(letter rune) *Tile {
 	return tile
 }
 
-// ReturnTile returns a previously drawn Tile to the Bag
+// ReturnTile returns a previously drawn Tile to the Bag.
+// Any meaning assigned to a blank tile, and the player
+// that played the tile, are cleared, so that the tile is
+// fresh when it is drawn again.
 func (bag *Bag) ReturnTile(tile *Tile) {
 	if bag == nil {
 		return
 	}
+	tile.Meaning = tile.Letter
+	tile.PlayedBy = 0
 	bag.Contents = append(bag.Contents, tile)
 }
 
+// removeTile removes a particular Tile from the Bag,
+// returning false if it is not found there
+func (bag *Bag) removeTile(tile *Tile) bool {
+	if bag == nil {
+		return false
+	}
+	for i, t := range bag.Contents {
+		if t == tile {
+			bag.Contents = append(bag.Contents[:i], bag.Contents[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // String returns a string representation of a Bag
 func (bag *Bag) String() string {
 	if bag == nil {
@@ -314,8 +605,28 @@ func (bag *Bag) TileCount() int {
 	return len(bag.Contents)
 }
 
+// Distribution returns the tiles in a Bag as a map of
+// letters ('?' for blank tiles) to counts
+func (bag *Bag) Distribution() map[rune]int {
+	distribution := make(map[rune]int)
+	if bag == nil {
+		return distribution
+	}
+	for _, tile := range bag.Contents {
+		distribution[tile.Letter]++
+	}
+	return distribution
+}
+
 // ExchangeAllowed returns true if there are at least RackSize
 // tiles left in the bag, thus allowing exchange of tiles
 func (bag *Bag) ExchangeAllowed() bool {
-	return bag.TileCount() >= RackSize
+	return bag.ExchangeAllowedFor(RackSize)
+}
+
+// ExchangeAllowedFor returns true if there are at least rackSize
+// tiles left in the bag, i.e. a full rack in a game with racks
+// of the given size, thus allowing exchange of tiles
+func (bag *Bag) ExchangeAllowedFor(rackSize int) bool {
+	return bag.TileCount() >= rackSize
 }
@@ -24,15 +24,21 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package skrafl
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"unicode"
 )
 
 const zero = int('0')
 
-// BoardSize is the size of the Board
+// BoardSize is the size of a standard Board
 const BoardSize = 15
 
+// MaxBoardSize is the size of the largest Board type
+const MaxBoardSize = 21
+
 // Word multiplication factors on a standard board
 var WORD_MULTIPLIERS_STANDARD = [BoardSize]string{
 	"311111131111113",
@@ -109,27 +115,148 @@ var LETTER_MULTIPLIERS_EXPLO = [BoardSize]string{
 	"111211111121111",
 }
 
+// Word multiplication factors on a mini (11x11) board
+var WORD_MULTIPLIERS_MINI = []string{
+	"31111311113",
+	"12111111121",
+	"11211111211",
+	"11111111111",
+	"11111111111",
+	"31111211113",
+	"11111111111",
+	"11111111111",
+	"11211111211",
+	"12111111121",
+	"31111311113",
+}
+
+// Letter multiplication factors on a mini (11x11) board
+var LETTER_MULTIPLIERS_MINI = []string{
+	"11121112111",
+	"11111311111",
+	"11112121111",
+	"21131113112",
+	"11212121211",
+	"13111111131",
+	"11212121211",
+	"21131113112",
+	"11112121111",
+	"11111311111",
+	"11121112111",
+}
+
+// Word multiplication factors on a super (21x21) board
+var WORD_MULTIPLIERS_SUPER = []string{
+	"311111111131111111113",
+	"121111111111111111121",
+	"112111111111111111211",
+	"111211111111111112111",
+	"111121111111111121111",
+	"111112111111111211111",
+	"111111111111111111111",
+	"111111111111111111111",
+	"111111111111111111111",
+	"111111111111111111111",
+	"311111111121111111113",
+	"111111111111111111111",
+	"111111111111111111111",
+	"111111111111111111111",
+	"111111111111111111111",
+	"111112111111111211111",
+	"111121111111111121111",
+	"111211111111111112111",
+	"112111111111111111211",
+	"121111111111111111121",
+	"311111111131111111113",
+}
+
+// Letter multiplication factors on a super (21x21) board
+var LETTER_MULTIPLIERS_SUPER = []string{
+	"111211111111111112111",
+	"111111311111113111111",
+	"111111112111211111111",
+	"211111111121111111112",
+	"111111111111111111111",
+	"111111111111111111111",
+	"131111311131113111131",
+	"111111111212111111111",
+	"112111112111211111211",
+	"111111121111121111111",
+	"111211311111113112111",
+	"111111121111121111111",
+	"112111112111211111211",
+	"111111111212111111111",
+	"131111311131113111131",
+	"111111111111111111111",
+	"111111111111111111111",
+	"211111111121111111112",
+	"111111112111211111111",
+	"111111311111113111111",
+	"111211111111111112111",
+}
+
+// boardLayout describes the size, the start square and the
+// multiplication factors of a board type
+type boardLayout struct {
+	size              int
+	start             Coordinate
+	wordMultipliers   []string
+	letterMultipliers []string
+}
+
+// boardLayouts maps board type names to their layouts
+var boardLayouts = map[string]*boardLayout{
+	"standard": {
+		BoardSize, Coordinate{7, 7}, // H8
+		WORD_MULTIPLIERS_STANDARD[:], LETTER_MULTIPLIERS_STANDARD[:],
+	},
+	"explo": {
+		BoardSize, Coordinate{3, 3}, // D4
+		WORD_MULTIPLIERS_EXPLO[:], LETTER_MULTIPLIERS_EXPLO[:],
+	},
+	"mini": {
+		11, Coordinate{5, 5}, // F6
+		WORD_MULTIPLIERS_MINI, LETTER_MULTIPLIERS_MINI,
+	},
+	"super": {
+		MaxBoardSize, Coordinate{10, 10}, // K11
+		WORD_MULTIPLIERS_SUPER, LETTER_MULTIPLIERS_SUPER,
+	},
+}
+
+// IsValidBoardType returns true if the given board type is known
+func IsValidBoardType(boardType string) bool {
+	_, ok := boardLayouts[boardType]
+	return ok
+}
+
 // colIds are the column identifiers of a board
-var colIds = [BoardSize]string{
+var colIds = [MaxBoardSize]string{
 	"1", "2", "3", "4", "5",
 	"6", "7", "8", "9", "10",
 	"11", "12", "13", "14", "15",
+	"16", "17", "18", "19", "20",
+	"21",
 }
 
 // rowIds are the row identifiers of a board
-var rowIds = [BoardSize]string{
+var rowIds = [MaxBoardSize]string{
 	"A", "B", "C", "D", "E",
 	"F", "G", "H", "I", "J",
 	"K", "L", "M", "N", "O",
+	"P", "Q", "R", "S", "T",
+	"U",
 }
 
 // Board represents the board as a matrix of Squares,
 // and caches an adjacency matrix for each Square,
 // consisting of pointers to adjacent Squares
 type Board struct {
-	Type      string // 'standard' or 'explo'
-	Squares   [BoardSize][BoardSize]Square
-	Adjacents [BoardSize][BoardSize]AdjSquares
+	Type string // 'standard', 'explo', 'mini' or 'super'
+	// The number of rows and columns on the board
+	Size      int
+	Squares   [MaxBoardSize][MaxBoardSize]Square
+	Adjacents [MaxBoardSize][MaxBoardSize]AdjSquares
 	// The number of tiles on the board
 	NumTiles int
 }
@@ -159,8 +286,8 @@ type Square struct {
 	Tile             *Tile
 	LetterMultiplier int
 	WordMultiplier   int
-	Row              int // Board row 0..14, or -1 if rack square
-	Col              int // Board column 0..14, or rack square 0..6
+	Row              int // Board row 0..Size-1, or -1 if rack square
+	Col              int // Board column 0..Size-1, or rack square 0..6
 }
 
 // String represents a Square as a string. An empty
@@ -188,11 +315,13 @@ func (tile *Tile) String() string {
 
 // Return the coordinate of the start square for this board type
 func (board *Board) StartSquare() Coordinate {
-	if board == nil || board.Type == "standard" {
-		return Coordinate{7, 7} // H8
-	} else {
-		return Coordinate{3, 3} // D4
+	if board == nil {
+		return boardLayouts["standard"].start
+	}
+	if layout, ok := boardLayouts[board.Type]; ok {
+		return layout.start
 	}
+	return Coordinate{3, 3} // D4
 }
 
 // Return true if the board has a tile in the start square
@@ -204,8 +333,8 @@ func (board *Board) HasStartTile() bool {
 
 // Sq returns a pointer to a Board square
 func (board *Board) Sq(row, col int) *Square {
-	if board == nil || row < 0 || row >= BoardSize ||
-		col < 0 || col >= BoardSize {
+	if board == nil || row < 0 || row >= board.Size ||
+		col < 0 || col >= board.Size {
 		return nil
 	}
 	return &board.Squares[row][col]
@@ -213,13 +342,59 @@ func (board *Board) Sq(row, col int) *Square {
 
 // TileAt returns a pointer to the Tile in a given Square
 func (board *Board) TileAt(row, col int) *Tile {
-	if board == nil || row < 0 || row >= BoardSize ||
-		col < 0 || col >= BoardSize {
+	if board == nil || row < 0 || row >= board.Size ||
+		col < 0 || col >= board.Size {
 		return nil
 	}
 	return board.Squares[row][col].Tile
 }
 
+// isPremium returns true if the square has a letter
+// or word multiplier
+func (square *Square) isPremium() bool {
+	return square.LetterMultiplier > 1 || square.WordMultiplier > 1
+}
+
+// PremiumUsed returns true if the square at the given coordinate
+// is a premium square, i.e. one with a letter or word multiplier,
+// whose multiplier has been consumed by a tile placed on it
+func (board *Board) PremiumUsed(row, col int) bool {
+	sq := board.Sq(row, col)
+	return sq != nil && sq.Tile != nil && sq.isPremium()
+}
+
+// ActivePremiums returns the coordinates of all premium squares
+// that are still empty, and whose multipliers can thus still be
+// used, in row-major order
+func (board *Board) ActivePremiums() []Coordinate {
+	var result []Coordinate
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			if sq := board.Sq(row, col); sq.Tile == nil && sq.isPremium() {
+				result = append(result, Coordinate{row, col})
+			}
+		}
+	}
+	return result
+}
+
+// Multipliers returns the word and letter multipliers of the
+// board's squares, as matrices indexed by row and column
+func (board *Board) Multipliers() (word, letter [][]int) {
+	word = make([][]int, board.Size)
+	letter = make([][]int, board.Size)
+	for row := 0; row < board.Size; row++ {
+		word[row] = make([]int, board.Size)
+		letter[row] = make([]int, board.Size)
+		for col := 0; col < board.Size; col++ {
+			sq := board.Sq(row, col)
+			word[row][col] = sq.WordMultiplier
+			letter[row][col] = sq.LetterMultiplier
+		}
+	}
+	return word, letter
+}
+
 // Place a tile in a board square, if it is empty
 func (board *Board) PlaceTile(row, col int, tile *Tile) bool {
 	sq := board.Sq(row, col)
@@ -231,19 +406,32 @@ func (board *Board) PlaceTile(row, col int, tile *Tile) bool {
 	return true
 }
 
+// RemoveTile removes the tile from a board square and returns it,
+// or returns nil if the square is empty
+func (board *Board) RemoveTile(row, col int) *Tile {
+	sq := board.Sq(row, col)
+	if sq == nil || sq.Tile == nil {
+		return nil
+	}
+	tile := sq.Tile
+	sq.Tile = nil
+	board.NumTiles--
+	return tile
+}
+
 // String represents a Board as a string
 func (board *Board) String() string {
 	var sb strings.Builder
 	sb.WriteString("  ")
-	for i := 0; i < BoardSize; i++ {
+	for i := 0; i < board.Size; i++ {
 		// Print the column id right-justified in a 2-character field,
 		// plus a space, making the column 3 characters wide
 		sb.WriteString(fmt.Sprintf("%2s ", colIds[i]))
 	}
 	sb.WriteString("\n")
-	for i := 0; i < BoardSize; i++ {
+	for i := 0; i < board.Size; i++ {
 		sb.WriteString(fmt.Sprintf("%s ", rowIds[i]))
-		for j := 0; j < BoardSize; j++ {
+		for j := 0; j < board.Size; j++ {
 			sb.WriteString(fmt.Sprintf(" %v ", board.Sq(i, j)))
 		}
 		sb.WriteString("\n")
@@ -251,6 +439,351 @@ func (board *Board) String() string {
 	return sb.String()
 }
 
+// ToStrings represents the tiles on a Board as a list of row strings,
+// where '.' is an empty square, a lowercase letter is a normal tile and
+// an uppercase letter is a blank tile with that (lowercase) meaning
+func (board *Board) ToStrings() []string {
+	rows := make([]string, board.Size)
+	for row := 0; row < board.Size; row++ {
+		var sb strings.Builder
+		for col := 0; col < board.Size; col++ {
+			sb.WriteRune(tileRune(board.TileAt(row, col)))
+		}
+		rows[row] = sb.String()
+	}
+	return rows
+}
+
+// tileRune returns the rune that represents a tile in ToStrings():
+// '.' for no tile, the letter of a normal tile and the uppercase
+// meaning of a blank tile
+func tileRune(tile *Tile) rune {
+	switch {
+	case tile == nil:
+		return '.'
+	case tile.Letter == '?':
+		return unicode.ToUpper(tile.Meaning)
+	default:
+		return tile.Letter
+	}
+}
+
+// SquareChange describes a change in the contents of a board square,
+// with Before and After in the format of ToStrings(), i.e. '.' for an
+// empty square and an uppercase letter for a blank tile
+type SquareChange struct {
+	Row    int
+	Col    int
+	Before rune
+	After  rune
+}
+
+// squareChangeJson is the compact JSON form of a SquareChange
+type squareChangeJson struct {
+	Row    int    `json:"r"`
+	Col    int    `json:"c"`
+	Before string `json:"b"`
+	After  string `json:"a"`
+}
+
+// MarshalJSON returns the compact JSON form of a SquareChange,
+// e.g. {"r":7,"c":8,"b":".","a":"X"}
+func (change SquareChange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(squareChangeJson{
+		Row:    change.Row,
+		Col:    change.Col,
+		Before: string(change.Before),
+		After:  string(change.After),
+	})
+}
+
+// UnmarshalJSON decodes a SquareChange from its compact JSON form
+func (change *SquareChange) UnmarshalJSON(data []byte) error {
+	var j squareChangeJson
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	before, after := []rune(j.Before), []rune(j.After)
+	if len(before) != 1 || len(after) != 1 {
+		return fmt.Errorf("invalid square change: %v", string(data))
+	}
+	*change = SquareChange{Row: j.Row, Col: j.Col, Before: before[0], After: after[0]}
+	return nil
+}
+
+// Diff returns the changes that turn the contents of the Board into
+// those of another Board of the same type, in row and column order.
+// Blank tiles are compared by their meaning. An error is returned
+// if the boards are of different types.
+func (board *Board) Diff(other *Board) ([]SquareChange, error) {
+	if other == nil || board.Type != other.Type || board.Size != other.Size {
+		return nil, fmt.Errorf("cannot compare boards of different types")
+	}
+	var changes []SquareChange
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			before := tileRune(board.TileAt(row, col))
+			after := tileRune(other.TileAt(row, col))
+			if before != after {
+				changes = append(changes, SquareChange{row, col, before, after})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Validate checks whether the tiles on the Board form a legal
+// position: the start square is covered, all tiles are connected
+// to it, and every maximal horizontal and vertical run of two or
+// more tiles is a word in the dictionary. It returns the validity
+// and the words that are not found in the dictionary, each once,
+// the horizontal ones before the vertical ones. An empty board is valid.
+func (board *Board) Validate(dawg *Dawg) (bool, []string) {
+	invalid := make([]string, 0)
+	if board.NumTiles == 0 {
+		return true, invalid
+	}
+	// Check that the start square is covered and that all
+	// tiles can be reached from it
+	start := board.StartSquare()
+	connected := 0
+	if board.TileAt(start.Row, start.Col) != nil {
+		connected = len(board.tileGroup(start, make(map[Coordinate]bool)))
+	}
+	// A single tile does not form a word, and is thus not
+	// a legal position either
+	valid := connected == board.NumTiles && connected > 1
+	// Check all words of two or more letters
+	board.forEachRun(func(word []rune, squares []Coordinate) {
+		if !dawg.FindRaw(string(word)) {
+			valid = false
+			if !slices.Contains(invalid, string(word)) {
+				invalid = append(invalid, string(word))
+			}
+		}
+	})
+	return valid, invalid
+}
+
+// tileGroup returns the coordinates of the tiles that are connected
+// to the tile at the given coordinate, including itself, using a
+// flood fill. The coordinates are marked in the visited map, and
+// tiles that are already marked there are not included.
+func (board *Board) tileGroup(coord Coordinate, visited map[Coordinate]bool) []Coordinate {
+	group := make([]Coordinate, 0)
+	stack := []Coordinate{coord}
+	visited[coord] = true
+	for len(stack) > 0 {
+		coord := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		group = append(group, coord)
+		for _, next := range []Coordinate{
+			{coord.Row - 1, coord.Col}, {coord.Row + 1, coord.Col},
+			{coord.Row, coord.Col - 1}, {coord.Row, coord.Col + 1},
+		} {
+			if !visited[next] && board.TileAt(next.Row, next.Col) != nil {
+				visited[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	return group
+}
+
+// forEachRun calls f with the letters and squares of every maximal
+// horizontal and vertical run of two or more tiles on the Board,
+// the horizontal ones before the vertical ones. The slices are
+// reused between calls.
+func (board *Board) forEachRun(f func(word []rune, squares []Coordinate)) {
+	word := make([]rune, 0, board.Size)
+	squares := make([]Coordinate, 0, board.Size)
+	flush := func() {
+		if len(word) > 1 {
+			f(word, squares)
+		}
+		word, squares = word[:0], squares[:0]
+	}
+	for _, horizontal := range []bool{true, false} {
+		for i := 0; i < board.Size; i++ {
+			for j := 0; j < board.Size; j++ {
+				coord := Coordinate{i, j}
+				if !horizontal {
+					coord = Coordinate{j, i}
+				}
+				tile := board.TileAt(coord.Row, coord.Col)
+				if tile == nil {
+					flush()
+					continue
+				}
+				word = append(word, tile.Meaning)
+				squares = append(squares, coord)
+			}
+			flush()
+		}
+	}
+}
+
+// BoardIssueKind identifies the kind of a problem with
+// the tiles on a Board, cf. Board.Audit()
+type BoardIssueKind string
+
+const (
+	// Disconnected means that a group of tiles is not connected
+	// to the start square
+	Disconnected BoardIssueKind = "Disconnected"
+	// UnknownWord means that a run of two or more tiles does not
+	// form a word in the dictionary
+	UnknownWord BoardIssueKind = "UnknownWord"
+	// TooManyTiles means that there are more tiles of a letter on
+	// the board than there are in the tile set
+	TooManyTiles BoardIssueKind = "TooManyTiles"
+)
+
+// BoardIssue describes a problem with the tiles on a Board,
+// which makes the position unreachable in a real game
+type BoardIssue struct {
+	Kind BoardIssueKind `json:"kind"`
+	// A human-readable description of the issue
+	Message string `json:"message"`
+	// The squares of the tiles concerned, such as "H8",
+	// if the Kind is Disconnected or UnknownWord
+	Squares []string `json:"squares,omitempty"`
+	// The word that is not in the dictionary, if the Kind is UnknownWord
+	Word string `json:"word,omitempty"`
+	// The letter of the tiles concerned, if the Kind is TooManyTiles,
+	// with '?' standing for blank tiles
+	Letter string `json:"letter,omitempty"`
+}
+
+// Audit checks whether the tiles on the Board could have been laid
+// down in a real game, and returns a list of the issues found, which
+// is empty if there are none. The issues are, in order: groups of
+// tiles that are not connected to the start square (all tiles, if the
+// start square is empty), runs of two or more tiles that are not words
+// in the dictionary, and letters having more tiles on the board than
+// in the tile set. The tile counts are not checked if tileSet is nil.
+func (board *Board) Audit(dawg *Dawg, tileSet *TileSet) []BoardIssue {
+	issues := make([]BoardIssue, 0)
+	squareNames := func(coords []Coordinate) []string {
+		names := make([]string, len(coords))
+		for i, coord := range coords {
+			names[i] = squareName(coord)
+		}
+		return names
+	}
+	// Mark the tiles connected to the start square as visited,
+	// and then find the groups of tiles that remain unvisited
+	visited := make(map[Coordinate]bool)
+	start := board.StartSquare()
+	if board.TileAt(start.Row, start.Col) != nil {
+		board.tileGroup(start, visited)
+	}
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			coord := Coordinate{row, col}
+			if visited[coord] || board.TileAt(row, col) == nil {
+				continue
+			}
+			group := board.tileGroup(coord, visited)
+			issues = append(issues, BoardIssue{
+				Kind: Disconnected,
+				Message: fmt.Sprintf("The tile group at %v is not connected to the start square",
+					squareName(coord)),
+				Squares: squareNames(group),
+			})
+		}
+	}
+	board.forEachRun(func(word []rune, squares []Coordinate) {
+		if !dawg.FindRaw(string(word)) {
+			issues = append(issues, BoardIssue{
+				Kind:    UnknownWord,
+				Message: fmt.Sprintf("The word '%v' at %v is not in the dictionary", string(word), squareName(squares[0])),
+				Squares: squareNames(squares),
+				Word:    string(word),
+			})
+		}
+	})
+	if tileSet != nil {
+		available := make(map[rune]int)
+		for _, tile := range tileSet.Tiles {
+			available[tile.Letter]++
+		}
+		onBoard := make(map[rune]int)
+		letters := make([]rune, 0)
+		for row := 0; row < board.Size; row++ {
+			for col := 0; col < board.Size; col++ {
+				if tile := board.TileAt(row, col); tile != nil {
+					if onBoard[tile.Letter] == available[tile.Letter] {
+						// One more than are available: report this letter
+						letters = append(letters, tile.Letter)
+					}
+					onBoard[tile.Letter]++
+				}
+			}
+		}
+		for _, letter := range letters {
+			issues = append(issues, BoardIssue{
+				Kind: TooManyTiles,
+				Message: fmt.Sprintf("There are %v '%c' tiles on the board, but only %v in the tile set",
+					onBoard[letter], letter, available[letter]),
+				Letter: string(letter),
+			})
+		}
+	}
+	return issues
+}
+
+// clearTiles removes all tiles from a Board
+func (board *Board) clearTiles() {
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			board.Sq(row, col).Tile = nil
+		}
+	}
+	board.NumTiles = 0
+}
+
+// FromStrings replaces the tiles on a Board with those in a list of
+// row strings, in the format returned by ToStrings(), using the scores
+// of the given tile set. A space is also accepted as an empty square.
+// An error is returned if the number or length of the rows does not
+// match the board size, or if a letter is not in the tile set; the
+// Board is then left empty.
+func (board *Board) FromStrings(rows []string, tileSet *TileSet) error {
+	board.clearTiles()
+	if len(rows) != board.Size {
+		return fmt.Errorf("the board must have %v rows", board.Size)
+	}
+	for r, rowString := range rows {
+		row := []rune(rowString)
+		if len(row) != board.Size {
+			board.clearTiles()
+			return fmt.Errorf("row #%v must be %v characters long", r, board.Size)
+		}
+		for c, letter := range row {
+			if letter == '.' || letter == ' ' {
+				continue
+			}
+			tile := &Tile{Letter: letter, Meaning: letter}
+			if unicode.IsUpper(letter) {
+				// Uppercase letters represent blank tiles that
+				// have been assigned a letter; these have
+				// lowercase meanings and a score of 0
+				tile.Letter = '?'
+				tile.Meaning = unicode.ToLower(letter)
+			}
+			score, ok := tileSet.Score(tile.Letter)
+			if !ok || !tileSet.Contains(tile.Meaning) {
+				board.clearTiles()
+				return fmt.Errorf("invalid letter '%c' at %v,%v", letter, r, c)
+			}
+			tile.Score = score
+			board.PlaceTile(r, c, tile)
+		}
+	}
+	return nil
+}
+
 // NumAdjacentTiles returns the number of tiles on the
 // Board that are adjacent to the given coordinate
 func (board *Board) NumAdjacentTiles(row, col int) int {
@@ -267,13 +800,13 @@ func (board *Board) NumAdjacentTiles(row, col int) int {
 // Fragment returns a list of the tiles that extend from the square
 // at row, col in the direction specified (ABOVE/BELOW/LEFT/RIGHT).
 func (board *Board) Fragment(row, col int, direction int) []*Tile {
-	if row < 0 || col < 0 || row >= BoardSize || col >= BoardSize {
+	if row < 0 || col < 0 || row >= board.Size || col >= board.Size {
 		return nil
 	}
 	if direction < ABOVE || direction > BELOW {
 		return nil
 	}
-	frag := make([]*Tile, 0, BoardSize-1)
+	frag := make([]*Tile, 0, board.Size-1)
 	for {
 		sq := board.Adjacents[row][col][direction]
 		if sq == nil || sq.Tile == nil {
@@ -370,37 +903,35 @@ func (board *Board) CrossWords(row, col int, horizontal bool) (left, right []run
 
 // Init initializes an empty board
 func (board *Board) Init(boardType string) {
-	// Select the correct multipliers for the board type
-	var letterMultipliers *[BoardSize]string
-	var wordMultipliers *[BoardSize]string
-	if boardType == "standard" {
-		letterMultipliers = &LETTER_MULTIPLIERS_STANDARD
-		wordMultipliers = &WORD_MULTIPLIERS_STANDARD
-	} else if boardType == "explo" {
-		letterMultipliers = &LETTER_MULTIPLIERS_EXPLO
-		wordMultipliers = &WORD_MULTIPLIERS_EXPLO
-	} else {
+	// Select the correct layout for the board type
+	layout, ok := boardLayouts[boardType]
+	if !ok {
 		panic(fmt.Sprintf("Unknown board type: %s", boardType))
 	}
 	board.Type = boardType
-	for i := 0; i < BoardSize; i++ {
-		for j := 0; j < BoardSize; j++ {
+	board.Size = layout.size
+	for i := 0; i < board.Size; i++ {
+		for j := 0; j < board.Size; j++ {
 			sq := board.Sq(i, j)
 			sq.Row = i
 			sq.Col = j
-			sq.LetterMultiplier = int(letterMultipliers[i][j]) - zero
-			sq.WordMultiplier = int(wordMultipliers[i][j]) - zero
+			sq.LetterMultiplier = int(layout.letterMultipliers[i][j]) - zero
+			sq.WordMultiplier = int(layout.wordMultipliers[i][j]) - zero
 		}
 	}
-	// Initialize the cached matrix of adjacent square lists
-	for row := 0; row < BoardSize; row++ {
-		for col := 0; col < BoardSize; col++ {
+	board.initAdjacents()
+}
+
+// initAdjacents initializes the cached matrix of adjacent square lists
+func (board *Board) initAdjacents() {
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
 			var adj = &board.Adjacents[row][col]
 			if row > 0 {
 				// Square above
 				adj[ABOVE] = board.Sq(row-1, col)
 			}
-			if row < BoardSize-1 {
+			if row < board.Size-1 {
 				// Square below
 				adj[BELOW] = board.Sq(row+1, col)
 			}
@@ -408,7 +939,7 @@ func (board *Board) Init(boardType string) {
 				// Square to the left
 				adj[LEFT] = board.Sq(row, col-1)
 			}
-			if col < BoardSize-1 {
+			if col < board.Size-1 {
 				// Square to the right
 				adj[RIGHT] = board.Sq(row, col+1)
 			}
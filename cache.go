@@ -0,0 +1,457 @@
+// cache.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements the sharded caches used by each Dawg
+// to speed up concurrent move generation: a cache of decoded
+// graph nodes and an LRU cache of cross-check bitmap sets.
+// It also implements the optional MoveCache, which caches the
+// complete move lists of game positions.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// The caches are split into 1 << cacheShardBits shards, each
+// with its own lock, so that the goroutines of concurrent move
+// generation seldom contend for the same lock
+const cacheShardBits = 4
+const cacheShards = 1 << cacheShardBits
+
+// DefaultCrossCacheSize is the default total number of
+// cross-check patterns kept in each Dawg's cache
+const DefaultCrossCacheSize = 2048
+
+// CacheStats contains usage statistics for a cache
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Size is the number of entries currently in the cache
+	Size int
+}
+
+// DawgCacheStats contains usage statistics for the
+// caches of a Dawg, as returned from Dawg.Stats()
+type DawgCacheStats struct {
+	CrossSets CacheStats
+	Nodes     CacheStats
+}
+
+// add accumulates the statistics of a cache shard
+func (cs *CacheStats) add(hits, misses, evictions uint64, size int) {
+	cs.Hits += hits
+	cs.Misses += misses
+	cs.Evictions += evictions
+	cs.Size += size
+}
+
+// crossCacheShard is a single shard of a crossCache
+type crossCacheShard struct {
+	mux       sync.Mutex
+	lru       *simplelru.LRU
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// crossCache encapsulates a sharded LRU cached map of
+// cross-set matching patterns ("af?a") to bitmapped sets
+type crossCache struct {
+	shards [cacheShards]crossCacheShard
+}
+
+// Init initalizes an empty crossCache with the given
+// total size, which is divided evenly between the shards
+func (cc *crossCache) Init(size int) {
+	shardSize := (size + cacheShards - 1) / cacheShards
+	if shardSize < 1 {
+		shardSize = 1
+	}
+	for i := range cc.shards {
+		shard := &cc.shards[i]
+		shard.mux.Lock()
+		// The eviction callback is invoked from lru.Add(),
+		// i.e. while the shard lock is held
+		shard.lru, _ = simplelru.NewLRU(shardSize, func(key, value interface{}) {
+			shard.evictions++
+		})
+		shard.hits, shard.misses, shard.evictions = 0, 0, 0
+		shard.mux.Unlock()
+	}
+}
+
+// shard returns the shard that holds the given key,
+// selected by its 32-bit FNV-1a hash
+func (cc *crossCache) shard(key string) *crossCacheShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return &cc.shards[hash%cacheShards]
+}
+
+// Lookup returns a bitmap set corresponding to a matching
+// pattern key. If the key is found in the cache, it is
+// returned immediately. Otherwise, the given fetchFunc() is
+// called to calculate the associated bitmap set before storing
+// it in the cache. The calculation is done without holding
+// the shard lock, so two goroutines may occasionally both
+// calculate the same set, which is harmless.
+func (cc *crossCache) Lookup(key string, fetchFunc func(string) uint) uint {
+	shard := cc.shard(key)
+	shard.mux.Lock()
+	if bitMap, ok := shard.lru.Get(key); ok {
+		shard.hits++
+		shard.mux.Unlock()
+		return bitMap.(uint)
+	}
+	shard.misses++
+	shard.mux.Unlock()
+	bitMap := fetchFunc(key)
+	shard.mux.Lock()
+	shard.lru.Add(key, bitMap)
+	shard.mux.Unlock()
+	return bitMap
+}
+
+// Stats returns the accumulated statistics of all shards
+func (cc *crossCache) Stats() CacheStats {
+	var stats CacheStats
+	for i := range cc.shards {
+		shard := &cc.shards[i]
+		shard.mux.Lock()
+		stats.add(shard.hits, shard.misses, shard.evictions, shard.lru.Len())
+		shard.mux.Unlock()
+	}
+	return stats
+}
+
+// nodeCacheShard is a single shard of a nodeCache
+type nodeCacheShard struct {
+	// nodes maps node offsets to their decoded edges. Since
+	// entries are never modified or removed once stored, a
+	// sync.Map allows lookups of cached nodes without locking.
+	nodes sync.Map
+	// size is the number of nodes stored in the shard, including
+	// those whose storage is underway, so that the limit is
+	// never exceeded
+	size   atomic.Int64
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// nodeCacheShards is a set of nodeCache shards, replaced
+// as a whole when the cache is (re)initialized
+type nodeCacheShards struct {
+	shards [cacheShards]nodeCacheShard
+	// limit is the maximum number of nodes in each shard,
+	// or 0 if unlimited
+	limit int64
+}
+
+// nodeCache is a sharded map of Dawg node offsets to their
+// decoded edges. Nodes are never evicted, but once a shard
+// reaches its limit (if any), further nodes are decoded on
+// every visit instead of being stored. Lookups of cached
+// nodes are lock-free; only the storing of newly decoded
+// nodes synchronizes, within the sync.Map of a shard.
+type nodeCache struct {
+	table atomic.Pointer[nodeCacheShards]
+}
+
+// Init initializes an empty nodeCache, holding at most limit
+// nodes in total, or an unlimited number if limit is 0
+func (nc *nodeCache) Init(limit int) {
+	table := &nodeCacheShards{}
+	if limit > 0 {
+		table.limit = int64((limit + cacheShards - 1) / cacheShards)
+	}
+	nc.table.Store(table)
+}
+
+// shard returns the shard that holds the given node offset.
+// Offsets are byte positions of variable-length nodes, so we
+// use Fibonacci hashing to spread them evenly.
+func (table *nodeCacheShards) shard(offset uint32) *nodeCacheShard {
+	return &table.shards[(offset*2654435769)>>(32-cacheShardBits)]
+}
+
+// Lookup returns the decoded edges of the node at the given
+// offset, calling decodeFunc() and caching its result if the
+// node has not been visited before
+func (nc *nodeCache) Lookup(offset uint32, decodeFunc func(uint32) navStates) *navStates {
+	table := nc.table.Load()
+	shard := table.shard(offset)
+	if result, ok := shard.nodes.Load(offset); ok {
+		shard.hits.Add(1)
+		return result.(*navStates)
+	}
+	shard.misses.Add(1)
+	states := decodeFunc(offset)
+	// Reserve room for the node before storing it
+	if n := shard.size.Add(1); table.limit > 0 && n > table.limit {
+		shard.size.Add(-1)
+		return &states
+	}
+	result, loaded := shard.nodes.LoadOrStore(offset, &states)
+	if loaded {
+		// Another goroutine got here first
+		shard.size.Add(-1)
+	}
+	return result.(*navStates)
+}
+
+// Stats returns the accumulated statistics of all shards
+func (nc *nodeCache) Stats() CacheStats {
+	var stats CacheStats
+	table := nc.table.Load()
+	for i := range table.shards {
+		shard := &table.shards[i]
+		stats.add(shard.hits.Load(), shard.misses.Load(), 0, int(shard.size.Load()))
+	}
+	return stats
+}
+
+// SetCrossCacheSize sets the total number of cross-check
+// patterns kept in the Dawg's LRU cache, which is
+// DefaultCrossCacheSize by default. The cache is emptied
+// and its statistics reset.
+func (dawg *Dawg) SetCrossCacheSize(size int) {
+	dawg.crossCache.Init(size)
+}
+
+// SetNodeCacheLimit sets the maximum number of decoded nodes
+// kept in the Dawg's node cache, where 0 (the default) means
+// no limit. The cache is emptied and its statistics reset.
+func (dawg *Dawg) SetNodeCacheLimit(limit int) {
+	dawg.nodeCache.Init(limit)
+}
+
+// Stats returns usage statistics for the Dawg's caches
+func (dawg *Dawg) Stats() DawgCacheStats {
+	return DawgCacheStats{
+		CrossSets: dawg.crossCache.Stats(),
+		Nodes:     dawg.nodeCache.Stats(),
+	}
+}
+
+// MoveCache is an LRU cache of the sorted move lists of game
+// positions, keyed by a signature of the board, the rack and the
+// dictionary and tile set in use, cf. GenerateMovesCached().
+// A MoveCache is safe for concurrent use.
+type MoveCache struct {
+	mux    sync.Mutex
+	lru    *simplelru.LRU
+	hits   uint64
+	misses uint64
+}
+
+// NewMoveCache returns a fresh MoveCache holding
+// the move lists of up to size positions
+func NewMoveCache(size int) *MoveCache {
+	cache := &MoveCache{}
+	cache.lru, _ = simplelru.NewLRU(max(size, 1), nil)
+	return cache
+}
+
+// Stats returns usage statistics for the MoveCache
+func (cache *MoveCache) Stats() CacheStats {
+	cache.mux.Lock()
+	defer cache.mux.Unlock()
+	return CacheStats{Hits: cache.hits, Misses: cache.misses, Size: cache.lru.Len()}
+}
+
+// signature returns a hash that identifies the GameState for the
+// purpose of move generation: the dictionary and tile set (i.e. the
+// locale), the bingo bonus, the board type and contents, including
+// the meanings of blank tiles, and the tiles in the rack, regardless
+// of their order
+func (state *GameState) signature() [sha256.Size]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%p %p %v %v %v %v|", state.Dawg, state.TileSet,
+		state.Board.Type, state.RackSize(), scoringRules(state.Rules).BingoBonus,
+		LeaveKey(state.Rack.AsRunes()))
+	buf := make([]rune, 0, 2*state.Board.Size)
+	for row := 0; row < state.Board.Size; row++ {
+		buf = buf[:0]
+		for col := 0; col < state.Board.Size; col++ {
+			if tile := state.Board.TileAt(row, col); tile != nil {
+				buf = append(buf, tile.Letter, tile.Meaning)
+			} else {
+				buf = append(buf, '.', '.')
+			}
+		}
+		h.Write([]byte(string(buf)))
+	}
+	var sig [sha256.Size]byte
+	h.Sum(sig[:0])
+	return sig
+}
+
+// GenerateMovesCached returns the valid tile moves in the GameState,
+// sorted in descending order by score, as GenerateMoves() would
+// generate them. If the cache contains the move list of an identical
+// position, it is returned without generating the moves again;
+// otherwise the moves are generated and stored in the cache. The
+// moves are shared between callers and should not be modified.
+// If cache is nil, the moves are simply generated and sorted.
+func (state *GameState) GenerateMovesCached(cache *MoveCache) []Move {
+	moves, _ := cache.lookup(state, func() ([]Move, error) {
+		return state.GenerateMoves(), nil
+	})
+	return moves
+}
+
+// lookup returns the sorted move list of the GameState from the
+// cache, or calls generate() to generate it and stores it in the
+// cache, unless generate() returns an error, in which case the moves
+// may be incomplete. If cache is nil, the moves are simply generated
+// and sorted.
+func (cache *MoveCache) lookup(state *GameState, generate func() ([]Move, error)) ([]Move, error) {
+	if cache == nil {
+		moves, err := generate()
+		sort.Sort(byScore{state, moves})
+		return moves, err
+	}
+	sig := state.signature()
+	cache.mux.Lock()
+	if moves, ok := cache.lru.Get(sig); ok {
+		cache.hits++
+		cache.mux.Unlock()
+		return slices.Clone(moves.([]Move)), nil
+	}
+	cache.misses++
+	cache.mux.Unlock()
+	// Generate the moves without holding the lock
+	moves, err := generate()
+	sort.Sort(byScore{state, moves})
+	if err != nil {
+		return moves, err
+	}
+	cache.mux.Lock()
+	cache.lru.Add(sig, moves)
+	cache.mux.Unlock()
+	return slices.Clone(moves), nil
+}
+
+// openingCache is the MoveCache used for opening positions,
+// i.e. empty boards, or nil if they are not cached
+var openingCache atomic.Pointer[MoveCache]
+
+// SetOpeningCacheSize enables caching of the move lists of opening
+// positions, i.e. of empty boards, by GenerateMoves() and its
+// variants. As the opening moves depend only on the rack, the
+// dictionary and the board type, the cache is shared by all games in
+// the process, holding the move lists of up to size such positions.
+// Any previously cached move lists are discarded. A size of zero
+// (the default) disables the cache.
+func SetOpeningCacheSize(size int) {
+	if size <= 0 {
+		openingCache.Store(nil)
+	} else {
+		openingCache.Store(NewMoveCache(size))
+	}
+}
+
+// OpeningCacheStats returns usage statistics for the opening
+// move cache, which are all zero if the cache is disabled
+func OpeningCacheStats() CacheStats {
+	if cache := openingCache.Load(); cache != nil {
+		return cache.Stats()
+	}
+	return CacheStats{}
+}
+
+// DefaultOpeningBookSize is the number of racks whose best opening
+// moves are kept in an OpeningBook made by BuildOpeningBook()
+const DefaultOpeningBookSize = 4096
+
+// OpeningBook holds the best, i.e. highest-scoring, opening moves on
+// an empty board for racks of tiles from a given tile set, with a
+// given dictionary. Since there are far too many racks to precompute
+// the moves of all of them, the book is populated lazily as racks are
+// looked up, and keeps the moves of a bounded number of racks, keyed
+// by the board type and the tiles of the rack regardless of their
+// order. An OpeningBook is safe for concurrent use, and its copies
+// share the same moves.
+type OpeningBook struct {
+	Dawg    *Dawg
+	TileSet *TileSet
+	// The book is a MoveCache of single-move lists
+	moves *MoveCache
+}
+
+// BuildOpeningBook returns an empty OpeningBook for the given
+// dictionary and tile set, holding the best opening moves of
+// up to DefaultOpeningBookSize racks
+func BuildOpeningBook(dawg *Dawg, tileSet *TileSet) OpeningBook {
+	return OpeningBook{
+		Dawg:    dawg,
+		TileSet: tileSet,
+		moves:   NewMoveCache(DefaultOpeningBookSize),
+	}
+}
+
+// Lookup returns the best opening move for the rack in the GameState,
+// generating it and storing it in the book if the rack has not been
+// looked up before. It returns nil if the board is not empty, if the
+// state uses a different dictionary or tile set than the book, or if
+// no valid move can be made with the rack.
+func (book OpeningBook) Lookup(state *GameState) Move {
+	if state.Board.NumTiles != 0 || state.Dawg != book.Dawg || state.TileSet != book.TileSet {
+		return nil
+	}
+	moves, _ := book.moves.lookup(state, func() ([]Move, error) {
+		moves := state.GenerateMoves()
+		sort.Sort(byScore{state, moves})
+		return moves[:min(len(moves), 1)], nil
+	})
+	if len(moves) == 0 {
+		return nil
+	}
+	return moves[0]
+}
+
+// BestMove returns the best opening move for the given rack on an
+// empty board of the given type, cf. Lookup(), or nil if there is
+// no valid move or the rack contains letters not in the tile set
+func (book OpeningBook) BestMove(boardType string, rack string) Move {
+	r := NewRack([]rune(rack), book.TileSet)
+	if r == nil {
+		return nil
+	}
+	return book.Lookup(NewState(book.Dawg, book.TileSet, NewBoard(boardType), r, false))
+}
+
+// Stats returns usage statistics for the OpeningBook
+func (book OpeningBook) Stats() CacheStats {
+	return book.moves.Stats()
+}
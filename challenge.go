@@ -0,0 +1,158 @@
+// challenge.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements challenges of words played in a Game,
+// according to the Game's ChallengeMode.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"fmt"
+)
+
+// ChallengeMode determines how words that are not in the
+// dictionary are handled in a Game
+type ChallengeMode int
+
+const (
+	// VoidInvalid means that tile moves forming invalid words
+	// are rejected outright, so there is nothing to challenge
+	VoidInvalid ChallengeMode = iota
+	// DoubleChallenge means that any word can be played, but it
+	// can be challenged by the opponent. If the challenge is upheld,
+	// the move is taken back and the player loses the turn. If not,
+	// the challenger loses the next turn. Invalid words that are not
+	// challenged stay on the board.
+	DoubleChallenge
+	// SingleChallenge is like DoubleChallenge, except that there
+	// is no penalty for an unsuccessful challenge
+	SingleChallenge
+)
+
+// SetChallengeMode sets the ChallengeMode of the Game. Words formed by
+// tile moves are only validated when they are made in VoidInvalid mode.
+func (game *Game) SetChallengeMode(mode ChallengeMode) {
+	game.ChallengeMode = mode
+	game.ValidateWords = mode == VoidInvalid
+}
+
+// ChallengeResult describes the outcome of a challenge
+type ChallengeResult struct {
+	// Whether the challenge was upheld, i.e. the move was taken back
+	Upheld bool
+	// The words formed by the move that are not in the dictionary
+	InvalidWords []string
+	// The points deducted from the challenger for an
+	// unsuccessful challenge, if any
+	Penalty int
+}
+
+// lastMoveIndex returns the index of the last move in the MoveList,
+// skipping the final adjustments if the game is over, or -1 if
+// no move has been made
+func (game *Game) lastMoveIndex() int {
+	last := len(game.MoveList) - 1
+	for last >= 0 {
+		if _, ok := game.MoveList[last].Move.(*FinalMove); !ok {
+			break
+		}
+		last--
+	}
+	return last
+}
+
+// ChallengeLastMove lets the challenger, who must be the opponent of
+// the player who made the last move, challenge that move, which must
+// be a TileMove. The words formed by the move are checked against the
+// Dawg. If any of them is invalid, the challenge is upheld: the move is
+// taken back and replaced by a VoidMove, so that the player loses the
+// turn. Otherwise, in DoubleChallenge mode, the challenger is penalized
+// by the game's ChallengePenalty in points, or, if that is zero, loses
+// the turn, i.e. a pass is made on the challenger's behalf.
+// An error is returned if there is no move that can be challenged.
+func (game *Game) ChallengeLastMove(challenger int) (ChallengeResult, error) {
+	var result ChallengeResult
+	if game == nil {
+		return result, fmt.Errorf("no game")
+	}
+	if game.ChallengeMode == VoidInvalid {
+		return result, fmt.Errorf("words are validated when played, so there is nothing to challenge")
+	}
+	last := game.lastMoveIndex()
+	if last < 0 {
+		return result, fmt.Errorf("no move to challenge")
+	}
+	item := game.MoveList[last]
+	move, ok := item.Move.(*TileMove)
+	if !ok {
+		return result, fmt.Errorf("the last move is not a tile move")
+	}
+	if challenger != 1-last%2 {
+		return result, fmt.Errorf("player %v cannot challenge the last move", challenger)
+	}
+	if item.Challenged {
+		return result, fmt.Errorf("the last move has already been challenged")
+	}
+	// Take the move back and check the words that it forms
+	if !game.UndoLastMove() {
+		return result, fmt.Errorf("unable to take back the move")
+	}
+	result.InvalidWords = move.InvalidWords(&game.Board, game.Dawg)
+	if len(result.InvalidWords) > 0 {
+		// Invalid word: the player loses the turn
+		result.Upheld = true
+		game.ApplyValid(NewVoidMove(move))
+		return result, nil
+	}
+	// The move was valid: make it again, drawing
+	// the same tiles from the bag as before
+	game.Bag.forced = []rune(item.Drawn)
+	game.ApplyValid(move)
+	game.Bag.forced = nil
+	item = game.MoveList[game.lastMoveIndex()]
+	item.Challenged = true
+	if game.ChallengeMode == DoubleChallenge {
+		if game.ChallengePenalty > 0 {
+			// The challenger loses points
+			result.Penalty = game.ChallengePenalty
+			item.ChallengePenalty = result.Penalty
+			game.Scores[challenger] -= result.Penalty
+		} else if !game.IsOver() {
+			// The challenger loses the turn
+			game.ApplyValid(NewPassMove())
+		}
+	}
+	return result, nil
+}
+
+// Challenge challenges the last move in the Game on behalf of the
+// opponent of the player who made it, cf. ChallengeLastMove().
+// Returns true if the challenge was upheld. In VoidInvalid mode,
+// or if the last move was not a TileMove, there is nothing to
+// challenge and false is returned.
+func (game *Game) Challenge() (upheld bool) {
+	if game == nil {
+		return false
+	}
+	challenger := 1 - game.lastMoveIndex()%2
+	result, err := game.ChallengeLastMove(challenger)
+	return err == nil && result.Upheld
+}
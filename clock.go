@@ -0,0 +1,112 @@
+// clock.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements an optional game clock, tracking the
+// time used by each player in a timed Game.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"time"
+)
+
+// ClockOvertimePenalty configures the point penalty for a player
+// who uses more than Limit of time in a Game. PointsPerMinute are
+// deducted for each minute, or part of a minute, over the limit.
+// A zero Limit means that no penalty is applied.
+type ClockOvertimePenalty struct {
+	Limit           time.Duration
+	PointsPerMinute int
+}
+
+// Clock tracks the time used by each player in a Game.
+// A Game only has a Clock if one has been set with SetClock().
+type Clock struct {
+	// Elapsed is the time used so far by each player
+	Elapsed [2]time.Duration
+	// Penalty is applied to the final score of a player who
+	// has exceeded its time limit
+	Penalty ClockOvertimePenalty
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+	// The player whose turn is being timed, and when it started
+	player    int
+	turnStart time.Time
+	running   bool
+}
+
+// SetClock starts tracking the time used by each player in the Game,
+// with the given overtime penalty. It returns the new Clock.
+func (game *Game) SetClock(penalty ClockOvertimePenalty) *Clock {
+	game.Clock = &Clock{Penalty: penalty}
+	return game.Clock
+}
+
+// now returns the current time of the Clock
+func (clock *Clock) now() time.Time {
+	if clock.Now != nil {
+		return clock.Now()
+	}
+	return time.Now()
+}
+
+// StartTurn starts timing the turn of the player to move, ending
+// the previous turn first if it is still being timed.
+// It does nothing if the Game has no Clock.
+func (game *Game) StartTurn() {
+	clock := game.Clock
+	if clock == nil {
+		return
+	}
+	game.EndTurn()
+	clock.player = game.PlayerToMove()
+	clock.turnStart = clock.now()
+	clock.running = true
+}
+
+// EndTurn stops timing the current turn and adds its duration to the
+// time used by the player whose turn it was. It does nothing if the
+// Game has no Clock or no turn is being timed. The turn is ended
+// automatically when a move ends the Game.
+func (game *Game) EndTurn() {
+	clock := game.Clock
+	if clock == nil || !clock.running {
+		return
+	}
+	clock.Elapsed[clock.player] += clock.now().Sub(clock.turnStart)
+	clock.running = false
+}
+
+// OvertimePenalty returns the number of points to be deducted
+// from the final score of the given player for exceeding
+// the time limit, if any
+func (clock *Clock) OvertimePenalty(player int) int {
+	if clock == nil || clock.Penalty.Limit <= 0 {
+		return 0
+	}
+	over := clock.Elapsed[player] - clock.Penalty.Limit
+	if over <= 0 {
+		return 0
+	}
+	// Round up to the next full minute
+	minutes := int((over + time.Minute - 1) / time.Minute)
+	return minutes * clock.Penalty.PointsPerMinute
+}
@@ -27,17 +27,20 @@ package skrafl
 import (
 	"embed"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/bits"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
-
-	"github.com/hashicorp/golang-lru/simplelru"
+	"unicode"
+	"unicode/utf8"
 )
 
-// Point to the DAWG file resources in the dicts directory
-//
-//go:embed dicts/*.bin.dawg
-var dawgFS embed.FS
-
 // IcelandicAlphabet contains the Icelandic letters as they are indexed
 // in the compressed binary DAWG. Note that the Icelandic alphabet does
 // not contain 'c', 'q', w' or 'z'.
@@ -59,20 +62,30 @@ const NorwegianAlphabet = "aäbcdefghijklmnoöpqrstuüvwxyzæøå"
 // as indices into the alphabet string (below).
 // The Coding map translates these indices to the actual
 // letters.
-// The iterNodeCache map is built on the fly, when
+// The nodeCache is built on the fly, when
 // each Dawg node is traversed for the first time.
 // In practice, many nodes will never be traversed.
+// A Dawg is safe for concurrent use, so a single instance
+// can be shared by all games in a process.
 type Dawg struct {
-	// The byte buffer containing the compressed DAWG
+	// The byte buffer containing the compressed DAWG. For the
+	// built-in dictionaries, it is loaded on first use, cf. bytes()
 	b []byte
+	// If load is not nil, it is called once, on first use,
+	// to obtain the byte buffer
+	load     func() []byte
+	loadOnce sync.Once
 	// A mapping from alphabet indices, eventually having
 	// the high bit (0x80) set to indicate finality, to rune slices
 	coding Coding
 	// The alphabet used by the DAWG vocabulary
 	alphabet Alphabet
-	// mux protects the iterNodeCache
-	mux           sync.Mutex
-	iterNodeCache map[uint32]*navStates
+	// nodeCache maps node offsets to their decoded edges
+	nodeCache nodeCache
+	// mux protects the wordCount, i.e. the number of words
+	// in the Dawg, or zero if not yet counted, cf. WordCount()
+	mux       sync.Mutex
+	wordCount int
 	// crossCache is a cached map of matching patterns
 	// to bitmap sets of allowed characters
 	crossCache crossCache
@@ -144,11 +157,115 @@ func (a *Alphabet) Member(r rune, set uint) bool {
 	return (set & a.bitMap[r]) != 0
 }
 
+// Contains returns true if the rune is a letter of the Alphabet
+func (a *Alphabet) Contains(r rune) bool {
+	_, ok := a.bitMap[r]
+	return ok
+}
+
+// MembersOf returns the runes in a bit map set, in alphabet order
+func (a *Alphabet) MembersOf(set uint) []rune {
+	letters := make([]rune, 0, len(a.asRunes))
+	for _, r := range a.asRunes {
+		if set&a.bitMap[r] != 0 {
+			letters = append(letters, r)
+		}
+	}
+	return letters
+}
+
 // Length returns the number of runes in the Alphabet
 func (a *Alphabet) Length() int {
 	return len(a.asRunes)
 }
 
+// compositions maps a combining mark to pairs of a lowercase base
+// letter and the precomposed letter that it forms with the mark,
+// covering the accented letters of the supported alphabets
+var compositions = map[rune]string{
+	'\u0300': "aàeèoò",               // Grave
+	'\u0301': "aáeéiíoóuúyýcćnńsśzź", // Acute
+	'\u0302': "aâeêoô",               // Circumflex
+	'\u0307': "zż",                   // Dot above
+	'\u0308': "aäoöuü",               // Diaeresis
+	'\u030A': "aå",                   // Ring above
+	'\u0328': "aąeę",                 // Ogonek
+}
+
+// compose returns the precomposed letter formed by a base letter,
+// in either case, and a combining mark, or false if there is none
+func compose(base, mark rune) (rune, bool) {
+	lower := unicode.ToLower(base)
+	pairs := []rune(compositions[mark])
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == lower {
+			if lower != base {
+				return unicode.ToUpper(pairs[i+1]), true
+			}
+			return pairs[i+1], true
+		}
+	}
+	return 0, false
+}
+
+// normalizeForLocale converts a string to Unicode NFC form as far
+// as the letters of the supported locales are concerned, i.e. it
+// composes a letter followed by a combining mark, such as 'a' and
+// a combining ring above, into a single rune, such as 'å'. The
+// case of the letters is not changed.
+func normalizeForLocale(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool {
+		_, ok := compositions[r]
+		return ok
+	}) {
+		// The common case: nothing to compose
+		return s
+	}
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		if n := len(runes); n > 0 {
+			if composed, ok := compose(runes[n-1], r); ok {
+				runes[n-1] = composed
+				continue
+			}
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
+
+// Normalize converts a word to the form in which words are stored
+// in a Dawg with this Alphabet: lowercase, with combining marks
+// composed with the preceding letter, as in Unicode NFC. An error
+// is returned if the result contains a rune that is not a letter
+// of the Alphabet.
+func (a *Alphabet) Normalize(word string) (string, error) {
+	return a.normalize(word, "")
+}
+
+// normalize works like Normalize, but also allows the runes
+// in the wildcards string, such as '?' and '*' in patterns
+func (a *Alphabet) normalize(word string, wildcards string) (string, error) {
+	normal := true
+	for _, r := range word {
+		if !a.Contains(r) && !strings.ContainsRune(wildcards, r) {
+			normal = false
+			break
+		}
+	}
+	if normal {
+		// The common case: nothing to do
+		return word, nil
+	}
+	word = strings.ToLower(normalizeForLocale(word))
+	for _, r := range word {
+		if !a.Contains(r) && !strings.ContainsRune(wildcards, r) {
+			return "", fmt.Errorf("'%c' is not a letter of the alphabet", r)
+		}
+	}
+	return word, nil
+}
+
 // navState holds a navigation state, i.e. an edge where a prefix
 // leads to a nextNode
 type navState struct {
@@ -161,23 +278,28 @@ type navStates []navState
 
 // iterNode is an internal function that returns a list of
 // prefixes and associated next node offsets. We calculate
-// this list only once, and then cache it in the Dawg instance.
+// this list only once, and then cache it in the Dawg instance
+// (unless the cache is full, cf. SetNodeCacheLimit()).
 func (dawg *Dawg) iterNode(offset uint32) *navStates {
-	// Start by looking for this offset in the cached map.
-	// We must lock the shared iterNodeCache object since
-	// we're reading it and possibly updating it.
-	// However, in the great majority of cases, the lock
-	// will be held for a very short time only.
-	dawg.mux.Lock()
-	defer dawg.mux.Unlock()
-	if result, ok := dawg.iterNodeCache[offset]; ok {
-		// Found: return it
-		return result
-	}
-	// This node has not been previously iterated:
-	// create the iteration data, cache them and return them
-	originalOffset := offset
-	b := dawg.b
+	return dawg.nodeCache.Lookup(offset, dawg.decodeNode)
+}
+
+// bytes returns the byte buffer containing the compressed DAWG,
+// loading it first if that has not been done already. All reads
+// from the buffer follow a call to decodeNode(), which calls this.
+func (dawg *Dawg) bytes() []byte {
+	if dawg.load != nil {
+		dawg.loadOnce.Do(func() {
+			dawg.b = dawg.load()
+		})
+	}
+	return dawg.b
+}
+
+// decodeNode returns the list of prefixes and associated next
+// node offsets of the node at the given offset, without caching it
+func (dawg *Dawg) decodeNode(offset uint32) navStates {
+	b := dawg.bytes()
 	coding := &dawg.coding
 	numEdges := int(b[offset] & 0x7f)
 	offset++
@@ -208,8 +330,7 @@ func (dawg *Dawg) iterNode(offset uint32) *navStates {
 			offset += 4
 		}
 	}
-	dawg.iterNodeCache[originalOffset] = &result
-	return &result
+	return result
 }
 
 // Init reads the Dawg into memory (TODO: or memory-maps it)
@@ -218,6 +339,13 @@ func (dawg *Dawg) Init(fs embed.FS, fileName string, alphabet string) error {
 	if err != nil {
 		return err
 	}
+	dawg.initFromBytes(data, alphabet)
+	return nil
+}
+
+// initFromBytes initializes the Dawg from a byte buffer containing
+// the compressed DAWG, using the given alphabet
+func (dawg *Dawg) initFromBytes(data []byte, alphabet string) {
 	dawg.b = data
 	// Create the alphabet decoding map
 	dawg.coding = make(Coding)
@@ -238,65 +366,495 @@ func (dawg *Dawg) Init(fs embed.FS, fileName string, alphabet string) error {
 		dawg.coding[iHigh][1] = '|'
 		i++
 	}
-	// Create the iteration node cache
-	dawg.iterNodeCache = make(map[uint32]*navStates)
+	// Create the iteration node cache, without a limit
+	dawg.nodeCache.Init(0)
 	// Initialize the cache of cross-check match sets
-	dawg.crossCache.Init(2048)
+	dawg.crossCache.Init(DefaultCrossCacheSize)
+}
+
+// validate checks the structure of the Dawg's byte buffer, by
+// visiting every node in the graph and verifying that its edges,
+// letter codes and node offsets are within bounds. This is done for
+// externally supplied DAWG files, which may be truncated or corrupt.
+func (dawg *Dawg) validate() error {
+	b := dawg.bytes()
+	size := uint32(len(b))
+	if size == 0 {
+		return errors.New("DAWG is empty")
+	}
+	truncated := errors.New("DAWG is truncated")
+	visited := make(map[uint32]bool)
+	stack := []uint32{0}
+	for len(stack) > 0 {
+		offset := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[offset] {
+			continue
+		}
+		visited[offset] = true
+		numEdges := int(b[offset] & 0x7f)
+		offset++
+		for i := 0; i < numEdges; i++ {
+			if offset >= size {
+				return truncated
+			}
+			lenByte := b[offset]
+			offset++
+			if lenByte&0x40 != 0 {
+				// Single-rune prefix
+				if _, ok := dawg.coding[lenByte&0x3f]; !ok {
+					return fmt.Errorf("DAWG contains an invalid letter code at offset %v", offset-1)
+				}
+			} else {
+				// Multi-rune prefix
+				lenPrefix := uint32(lenByte & 0x3f)
+				if lenPrefix == 0 {
+					return fmt.Errorf("DAWG contains an empty prefix at offset %v", offset-1)
+				}
+				if offset+lenPrefix > size {
+					return truncated
+				}
+				for j := offset; j < offset+lenPrefix; j++ {
+					if _, ok := dawg.coding[b[j]]; !ok {
+						return fmt.Errorf("DAWG contains an invalid letter code at offset %v", j)
+					}
+				}
+				offset += lenPrefix
+			}
+			if b[offset-1]&0x80 == 0 {
+				// Not a final state: there is a next node
+				if offset+4 > size {
+					return truncated
+				}
+				nextNode := binary.LittleEndian.Uint32(b[offset : offset+4])
+				if nextNode == 0 || nextNode >= size {
+					return fmt.Errorf("DAWG contains an invalid node offset at %v", offset)
+				}
+				stack = append(stack, nextNode)
+				offset += 4
+			}
+		}
+	}
 	return nil
 }
 
+// LoadDawgFromBytes makes a Dawg from a byte buffer containing a
+// compressed binary DAWG, in the same format as the .bin.dawg files
+// in the dicts directory. The alphabet must be the same one that was
+// used to build the DAWG. An error is returned if the alphabet does not
+// fit in a bit map or if the DAWG is corrupt. The Dawg refers to the
+// buffer, which must not be modified afterwards.
+func LoadDawgFromBytes(b []byte, alphabet string) (*Dawg, error) {
+	if alphabet == "" {
+		return nil, errors.New("alphabet is empty")
+	}
+	if n := utf8.RuneCountInString(alphabet); n > bits.UintSize || n > 0x40 {
+		return nil, fmt.Errorf("alphabet has too many letters (%v)", n)
+	}
+	dawg := &Dawg{}
+	dawg.initFromBytes(b, alphabet)
+	if err := dawg.validate(); err != nil {
+		return nil, err
+	}
+	return dawg, nil
+}
+
+// LoadDawg reads a compressed binary DAWG from the file
+// at the given path, cf. LoadDawgFromBytes()
+func LoadDawg(path string, alphabet string) (*Dawg, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDawgFromBytes(data, alphabet)
+}
+
+// NewDawgFromReader reads a compressed binary DAWG from
+// the given reader, cf. LoadDawgFromBytes()
+func NewDawgFromReader(r io.Reader, alphabet string) (*Dawg, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDawgFromBytes(data, alphabet)
+}
+
+// NewDawgFromFile reads a compressed binary DAWG from the
+// file at the given path. It is equivalent to LoadDawg().
+func NewDawgFromFile(path string, alphabet string) (*Dawg, error) {
+	return LoadDawg(path, alphabet)
+}
+
+// NewDawgFromMappedFile works like NewDawgFromFile(), but maps the
+// file into memory instead of reading it, where the platform supports
+// it, so that the operating system can share its pages between
+// processes and page them in and out as needed. The mapping lasts
+// for the lifetime of the process. If the file cannot be mapped,
+// it is read in full.
+func NewDawgFromMappedFile(path string, alphabet string) (*Dawg, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return LoadDawgFromBytes(data, alphabet)
+}
+
 // Navigate performs a navigation through the DAWG under the
 // control of a Navigator
 func (dawg *Dawg) Navigate(navigator Navigator) {
-	var nav Navigation
-	nav.Go(dawg, navigator)
+	dawg.navigate(navigator, false, nil)
 }
 
 // NavigateResumable performs a resumable navigation through the DAWG under the
 // control of a Navigator
 func (dawg *Dawg) NavigateResumable(navigator Navigator) {
-	var nav Navigation
-	nav.isResumable = true
+	dawg.navigate(navigator, true, nil)
+}
+
+// navigate performs a navigation through the DAWG, optionally
+// resumable, adding the number of nodes visited to the given
+// counters if they are not nil
+func (dawg *Dawg) navigate(navigator Navigator, resumable bool, counters *genCounters) {
+	nav := Navigation{isResumable: resumable, counters: counters}
 	nav.Go(dawg, navigator)
 }
 
 // Resume resumes a navigation through the DAWG under the
 // control of a Navigator, from a previously saved state
 func (dawg *Dawg) Resume(navigator Navigator, state *navState, matched []rune) {
-	var nav Navigation
+	dawg.resume(navigator, state, matched, nil)
+}
+
+// resume works like Resume(), adding the number of nodes visited
+// to the given counters if they are not nil
+func (dawg *Dawg) resume(navigator Navigator, state *navState, matched []rune, counters *genCounters) {
+	nav := Navigation{counters: counters}
 	nav.Resume(dawg, navigator, state, matched)
 }
 
+// Alphabet returns the Alphabet of the Dawg
+func (dawg *Dawg) Alphabet() *Alphabet {
+	return &dawg.alphabet
+}
+
 // Find attempts to find a word in a DAWG, returning true if
-// found or false if not.
+// found or false if not. The word is normalized first, so that
+// it may be in upper or mixed case, or in decomposed Unicode form,
+// cf. Alphabet.Normalize().
 func (dawg *Dawg) Find(word string) bool {
+	word, err := dawg.alphabet.Normalize(word)
+	if err != nil {
+		return false
+	}
+	return dawg.FindRaw(word)
+}
+
+// FindRaw works like Find(), but without normalizing the word,
+// which must therefore be in lowercase and NFC form already.
+// This is the variant to use in move generation and validation.
+func (dawg *Dawg) FindRaw(word string) bool {
 	var fn FindNavigator
 	fn.Init(word)
 	dawg.Navigate(&fn)
 	return fn.found
 }
 
+// walk performs a depth-first traversal of the Dawg from the node at
+// the given offset, calling visit for each complete word that starts
+// with the given prefix. The word passed to visit is only valid during
+// the call. Returns false if visit returned false, ending the traversal.
+func (dawg *Dawg) walk(offset uint32, matched []rune, prefix []rune, visit func(word []rune) bool) bool {
+	for _, state := range dawg.decodeNode(offset) {
+		word := matched
+		onPrefix := true
+		for j := 0; j < len(state.prefix); j++ {
+			letter := state.prefix[j]
+			if n := len(word); n < len(prefix) && prefix[n] != letter {
+				// This edge leads away from the prefix
+				onPrefix = false
+				break
+			}
+			word = append(word, letter)
+			// Have we just completed an entire word? This is the case
+			// if the letter is followed by a '|' within the edge prefix,
+			// or if it is the last letter of the edge and there is no
+			// next node or the next node is marked with a final bit
+			final := false
+			if j+1 < len(state.prefix) {
+				if state.prefix[j+1] == '|' {
+					final = true
+					j++
+				}
+			} else {
+				final = state.nextNode == 0 || dawg.bytes()[state.nextNode]&0x80 != 0
+			}
+			if final && len(word) >= len(prefix) && !visit(word) {
+				return false
+			}
+		}
+		if onPrefix && state.nextNode != 0 {
+			if !dawg.walk(state.nextNode, word, prefix, visit) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Iterate walks the Dawg depth-first, calling the callback for every
+// word in it, until the callback returns false
+func (dawg *Dawg) Iterate(callback func(word string) bool) {
+	dawg.walk(0, []rune{}, []rune{}, func(word []rune) bool {
+		return callback(string(word))
+	})
+}
+
+// WordsWithPrefix returns the words in the Dawg that start with the
+// given prefix, including the prefix itself if it is a word, up to
+// the given limit. If limit is zero or negative, all such words are
+// returned.
+func (dawg *Dawg) WordsWithPrefix(prefix string, limit int) []string {
+	words := make([]string, 0)
+	dawg.walk(0, []rune{}, []rune(prefix), func(word []rune) bool {
+		words = append(words, string(word))
+		return limit <= 0 || len(words) < limit
+	})
+	return words
+}
+
+// WordCount returns the number of words in the Dawg. It is counted
+// on the first call, which traverses the entire graph, and cached.
+func (dawg *Dawg) WordCount() int {
+	dawg.mux.Lock()
+	count := dawg.wordCount
+	dawg.mux.Unlock()
+	if count > 0 {
+		return count
+	}
+	// Count the words without holding the lock, since the
+	// traversal can take a while
+	dawg.walk(0, []rune{}, []rune{}, func(word []rune) bool {
+		count++
+		return true
+	})
+	dawg.mux.Lock()
+	dawg.wordCount = count
+	dawg.mux.Unlock()
+	return count
+}
+
 // Permute finds all permutations of the given rack,
 // returning them as a list (slice) of strings.
-// The rack may contain '?' wildcards/blanks.
+// The rack may contain '?' wildcards/blanks, and is normalized
+// as in Find().
 func (dawg *Dawg) Permute(rack string, minLen int) []string {
+	rack, err := dawg.alphabet.normalize(rack, "?")
+	if err != nil {
+		return []string{}
+	}
 	var pn PermutationNavigator
 	pn.Init(rack, minLen)
 	dawg.Navigate(&pn)
 	return pn.results
 }
 
-// Match returns all words in the Dawg that match a
-// given pattern string, which can include '?' wildcards/blanks.
+// Anagrams returns all words of exactly the given length that can
+// be formed from the tiles of the rack, which may contain '?'
+// wildcards/blanks, as a list (slice) of strings. The rack is
+// normalized as in Find().
+func (dawg *Dawg) Anagrams(rack string, exactLen int) []string {
+	rack, err := dawg.alphabet.normalize(rack, "?")
+	if err != nil || exactLen <= 0 {
+		return []string{}
+	}
+	var pn PermutationNavigator
+	pn.Init(rack, exactLen)
+	pn.maxLen = exactLen
+	dawg.Navigate(&pn)
+	return pn.results
+}
+
+// RackStats contains statistics about the words that
+// can be formed from the tiles of a rack
+type RackStats struct {
+	// The number of words that use all the tiles of a full rack
+	Bingos int `json:"bingos"`
+	// The number of words of two or more letters
+	Words int `json:"words"`
+	// The number of words of each length, indexed by length
+	ByLength []int `json:"by_length"`
+	// The longest word, or the first one alphabetically
+	// if there are several of the same length
+	Longest string `json:"longest"`
+}
+
+// RackStats returns statistics about the words that can be formed
+// from the given rack, which may contain '?' wildcards/blanks.
+// The statistics are collected in a single navigation of the Dawg.
+func (dawg *Dawg) RackStats(rack string) RackStats {
+	var rn RackStatsNavigator
+	rn.Init(rack, 2)
+	rn.stats.ByLength = make([]int, utf8.RuneCountInString(rack)+1)
+	dawg.Navigate(&rn)
+	return rn.stats
+}
+
+// hasAnagram returns true if there is a word in the
+// Dawg that uses all the letters of the given rack
+func (dawg *Dawg) hasAnagram(rack []rune) bool {
+	stats := dawg.RackStats(string(rack))
+	return len(rack) >= 2 && stats.ByLength[len(rack)] > 0
+}
+
+// The maximum number of distinct draws to enumerate in
+// BingoProbability(), and the number of draws sampled otherwise
+const (
+	maxEnumeratedDraws = 2000
+	numSampledDraws    = 2000
+)
+
+// BingoProbability estimates the probability that drawing the given
+// number of tiles from the bag into the partial rack results in a rack
+// whose tiles all form a single word, i.e. a bingo if the rack is full.
+// If the number of distinct draws is small, they are enumerated and
+// the probability is exact; otherwise, draws are sampled at random.
+// The samples come from a random source derived from the state of the
+// bag's source, so that the estimate can be reproduced by seeding the
+// bag (cf. Bag.Seed()), but the bag's source is not drawn from, and
+// subsequent draws from the bag are not affected.
+func (dawg *Dawg) BingoProbability(partialRack string, bag *Bag, draws int) float64 {
+	partial := []rune(partialRack)
+	draws = min(draws, bag.TileCount())
+	if draws <= 0 {
+		if dawg.hasAnagram(partial) {
+			return 1.0
+		}
+		return 0.0
+	}
+	// Count the tiles of each letter in the bag
+	counts := make(map[rune]int)
+	letters := make([]rune, 0)
+	for _, tile := range bag.Contents {
+		if counts[tile.Letter] == 0 {
+			letters = append(letters, tile.Letter)
+		}
+		counts[tile.Letter]++
+	}
+	cache := make(map[string]bool)
+	isBingo := func(drawn []rune) bool {
+		key := LeaveKey(append(slices.Clone(partial), drawn...))
+		bingo, ok := cache[key]
+		if !ok {
+			bingo = dawg.hasAnagram([]rune(key))
+			cache[key] = bingo
+		}
+		return bingo
+	}
+	// Count the distinct draws, i.e. multisets of letters, stopping
+	// if there are more than can reasonably be enumerated
+	var countDraws func(ix, left int) int
+	countDraws = func(ix, left int) int {
+		if left == 0 {
+			return 1
+		}
+		if ix >= len(letters) {
+			return 0
+		}
+		total := 0
+		for k := 0; k <= min(left, counts[letters[ix]]) && total <= maxEnumeratedDraws; k++ {
+			total += countDraws(ix+1, left-k)
+		}
+		return total
+	}
+	if countDraws(0, draws) <= maxEnumeratedDraws {
+		// Enumerate the distinct draws, each one weighted by the
+		// number of ways in which it can be drawn from the bag
+		var probability float64
+		drawn := make([]rune, 0, draws)
+		var enumerate func(ix, left int, ways float64)
+		enumerate = func(ix, left int, ways float64) {
+			if left == 0 {
+				if isBingo(drawn) {
+					probability += ways
+				}
+				return
+			}
+			if ix >= len(letters) {
+				return
+			}
+			letter, n := letters[ix], counts[letters[ix]]
+			for k := 0; k <= min(left, n); k++ {
+				enumerate(ix+1, left-k, ways*binomial(n, k))
+				drawn = append(drawn, letter)
+			}
+			drawn = drawn[:len(drawn)-min(left, n)-1]
+		}
+		enumerate(0, draws, 1.0)
+		return probability / binomial(bag.TileCount(), draws)
+	}
+	// Too many distinct draws: sample them instead
+	tiles := make([]rune, len(bag.Contents))
+	for i, tile := range bag.Contents {
+		tiles[i] = tile.Letter
+	}
+	rng := bag.derivedRng()
+	hits := 0
+	for i := 0; i < numSampledDraws; i++ {
+		// Partial Fisher-Yates shuffle of the first draws tiles
+		for j := 0; j < draws; j++ {
+			k := j + rng.Intn(len(tiles)-j)
+			tiles[j], tiles[k] = tiles[k], tiles[j]
+		}
+		if isBingo(tiles[:draws]) {
+			hits++
+		}
+	}
+	return float64(hits) / numSampledDraws
+}
+
+// binomial returns the binomial coefficient n choose k
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 0; i < k; i++ {
+		result = result * float64(n-i) / float64(i+1)
+	}
+	return result
+}
+
+// Match returns all words in the Dawg that match a given pattern
+// string, which can include '?' wildcards/blanks, each matching a
+// single letter, and '*' wildcards, each matching zero or more letters.
+// For instance, "str*" matches all words starting with "str".
+// The pattern is normalized as in Find().
 func (dawg *Dawg) Match(pattern string) []string {
+	pattern, err := dawg.alphabet.normalize(pattern, "?*")
+	if err != nil {
+		return []string{}
+	}
 	var mn MatchNavigator
 	mn.Init([]rune(pattern))
 	dawg.Navigate(&mn)
 	return mn.results
 }
 
+// MatchWithLimit works like Match(), but only returns words where
+// at most maxWildcards letters are matched by '?' or '*' wildcards.
+// A negative maxWildcards means that there is no limit.
+func (dawg *Dawg) MatchWithLimit(pattern string, maxWildcards int) []string {
+	pattern, err := dawg.alphabet.normalize(pattern, "?*")
+	if err != nil {
+		return []string{}
+	}
+	var mn MatchNavigator
+	mn.InitWithLimit([]rune(pattern), maxWildcards)
+	dawg.Navigate(&mn)
+	return mn.results
+}
+
 // MatchRunes returns all words in the Dawg that match a
-// given pattern, which can include '?' wildcards/blanks.
+// given pattern, which can include '?' and '*' wildcards, cf. Match().
 func (dawg *Dawg) MatchRunes(pattern []rune) []string {
 	var mn MatchNavigator
 	mn.Init(pattern)
@@ -304,97 +862,213 @@ func (dawg *Dawg) MatchRunes(pattern []rune) []string {
 	return mn.results
 }
 
+// WordsOfLength returns all words of the given length in the Dawg,
+// in alphabetical order. The navigation is pruned at that length, so
+// short lengths are cheap, but for long lengths most of the graph is
+// traversed. To cap the number of results, navigate the Dawg with a
+// LengthNavigator initialized with a limit.
+func (dawg *Dawg) WordsOfLength(n int) []string {
+	if n <= 0 {
+		return []string{}
+	}
+	var ln LengthNavigator
+	ln.Init(n, 0)
+	dawg.Navigate(&ln)
+	return ln.results
+}
+
+// WordsContaining returns all words in the Dawg that contain each of
+// the given letters, as many times as it occurs in the list, in
+// alphabetical order. For instance, the words using a 'q' but no 'u'
+// can be found by filtering the words containing 'q'. This traverses
+// the entire graph, which is expensive for large dictionaries; to cap
+// the number of results, navigate the Dawg with a ContainingNavigator
+// initialized with a limit.
+func (dawg *Dawg) WordsContaining(letters []rune) []string {
+	var cn ContainingNavigator
+	cn.Init(letters, 0)
+	dawg.Navigate(&cn)
+	return cn.results
+}
+
 // CrossSet calculates a bit-mapped set of allowed letters
 // in a cross-check set, given a left/top and right/bottom
 // string that intersects the square being checked.
 func (dawg *Dawg) CrossSet(left, right []rune) uint {
-	lenLeft := len(left)
 	key := string(left) + "?" + string(right)
 	fetchFunc := func(key string) uint {
-		alphabetLength := dawg.alphabet.Length()
-		// We ask the DAWG to find all words consisting of the
-		// left cross word + wildcard + right cross word,
-		// for instance 'f?lt' if the left word is 'f' and the
-		// right one is 'lt' - yielding the result set
-		// { 'falt', 'filt', fúlt' }, which we convert to the
-		// legal cross set of [ 'a', 'i', 'ú' ] and intersect
-		// that with the rack
-		matches := dawg.Match(key)
-		// Collect the 'middle' letters (the ones standing in
-		// for the wildcard)
-		runes := make([]rune, 0, alphabetLength)
-		for _, match := range matches {
-			rMatch := []rune(match)
-			runes = append(runes, rMatch[lenLeft])
-		}
-		// Return the resulting bitmapped set
-		return dawg.alphabet.MakeSet(runes)
+		return dawg.matchSet(key, len(left))
 	}
 	return dawg.crossCache.Lookup(key, fetchFunc)
 }
 
-// crossCache encapsulates a simple LRU cached map of
-// cross-set matching patterns ("af?a") to bitmapped sets
-type crossCache struct {
-	mux sync.Mutex
-	lru *simplelru.LRU
+// matchSet returns a bit-mapped set of the letters that can stand
+// in for the single wildcard, at the given index, in the pattern
+func (dawg *Dawg) matchSet(pattern string, index int) uint {
+	// We ask the DAWG to find all words consisting of the
+	// left cross word + wildcard + right cross word,
+	// for instance 'f?lt' if the left word is 'f' and the
+	// right one is 'lt' - yielding the result set
+	// { 'falt', 'filt', fúlt' }, which we convert to the
+	// legal cross set of [ 'a', 'i', 'ú' ] and intersect
+	// that with the rack
+	matches := dawg.Match(pattern)
+	// Collect the 'middle' letters (the ones standing in
+	// for the wildcard)
+	runes := make([]rune, 0, dawg.alphabet.Length())
+	for _, match := range matches {
+		rMatch := []rune(match)
+		runes = append(runes, rMatch[index])
+	}
+	// Return the resulting bitmapped set
+	return dawg.alphabet.MakeSet(runes)
 }
 
-// Init initalizes an empty crossCache
-func (cc *crossCache) Init(size int) {
-	cc.lru, _ = simplelru.NewLRU(size, nil)
+// BackHooks returns the letters, in alphabet order, that can be
+// appended to the given word to form another word in the Dawg.
+// Unlike CrossSet(), this does not go through the cross-check
+// cache, so that one-off lookups do not evict the entries that
+// move generation needs.
+func (dawg *Dawg) BackHooks(word string) []rune {
+	word, err := dawg.alphabet.Normalize(word)
+	if err != nil {
+		return []rune{}
+	}
+	return dawg.alphabet.MembersOf(dawg.matchSet(word+"?", len([]rune(word))))
 }
 
-// Lookup returns a bitmap set corresponding to a matching
-// pattern key. If the key is found in the cache, it is
-// returned immediately. Otherwise, the given fetchFunc() is
-// called to calculate the associated bitmap set before storing
-// it in the cache.
-func (cc *crossCache) Lookup(key string, fetchFunc func(string) uint) uint {
-	cc.mux.Lock()
-	defer cc.mux.Unlock()
-	if bitMap, ok := cc.lru.Get(key); ok {
-		return bitMap.(uint)
+// FrontHooks returns the letters, in alphabet order, that can be
+// prepended to the given word to form another word in the Dawg.
+// As the Dawg is not indexed in reverse, this entails following
+// the word's path from every initial letter, i.e. the cost is up
+// to one lookup per letter in the alphabet. As with BackHooks(),
+// the result is not cached.
+func (dawg *Dawg) FrontHooks(word string) []rune {
+	word, err := dawg.alphabet.Normalize(word)
+	if err != nil {
+		return []rune{}
 	}
-	bitMap := fetchFunc(key)
-	cc.lru.Add(key, bitMap)
-	return bitMap
+	return dawg.alphabet.MembersOf(dawg.matchSet("?"+word, 0))
 }
 
-// makeDawg initializes a Dawg instance and loads its contents
-// from a binary file located in the same directory as the
-// skrafl module
+// makeDawg initializes a Dawg instance for one of the built-in
+// dictionaries, embedded in the skrafl module. Its contents are
+// only loaded on first use, so that processes do not pay for
+// dictionaries that they never use. If the dictionary file is
+// not embedded, as when building with the skrafl_slim tag
+// (cf. dicts_slim.go), nil is returned.
 func makeDawg(fileName string, alphabet string) *Dawg {
+	path := filepath.Join("dicts", fileName)
+	if _, err := fs.Stat(dawgFS, path); err != nil {
+		return nil
+	}
 	dawg := &Dawg{}
-	// There should be a better way to do this?
-	err := dawg.Init(dawgFS, fileName, alphabet)
-	if err != nil {
-		panic(err)
+	dawg.initFromBytes(nil, alphabet)
+	dawg.load = func() []byte {
+		data, err := dawgFS.ReadFile(path)
+		if err != nil {
+			// Should not happen, as the file is embedded
+			panic(err)
+		}
+		return data
 	}
 	return dawg
 }
 
 // IcelandicDictionary is a Dawg instance containing the Icelandic
 // dictionary, as derived from the BÍN database
-// (Beygingarlýsing íslensks nútímamáls)
+// (Beygingarlýsing íslensks nútímamáls).
+//
+// It is nil if the dictionary is excluded from the build.
+//
+// Deprecated: Use GetIcelandicDictionary(). The dictionary is
+// loaded on first use in either case.
 var IcelandicDictionary = makeDawg("ordalisti.bin.dawg", IcelandicAlphabet)
 
 // OtcwlDictionary is a Dawg instance containing the word list
 // used in the U.S.
+//
+// Deprecated: Use GetOtcwlDictionary(). The dictionary is
+// loaded on first use in either case.
 var OtcwlDictionary = makeDawg("otcwl2014.bin.dawg", EnglishAlphabet)
 
 // SowpodsDictionary is a Dawg instance containing the word list
 // used in the U.K. and other English speaking countries besides the U.S.
+//
+// Deprecated: Use GetSowpodsDictionary(). The dictionary is
+// loaded on first use in either case.
 var SowpodsDictionary = makeDawg("sowpods.bin.dawg", EnglishAlphabet)
 
 // OspsDictionary is a Dawg instance containing the
 // word list used for Polish.
+//
+// It is nil if the dictionary is excluded from the build.
+//
+// Deprecated: Use GetOspsDictionary(). The dictionary is
+// loaded on first use in either case.
 var OspsDictionary = makeDawg("osps37.bin.dawg", PolishAlphabet)
 
 // NorwegianBokmålDictionary is a Dawg instance containing the
 // word list used for Norwegian (Bokmål).
+//
+// It is nil if the dictionary is excluded from the build.
+//
+// Deprecated: Use GetNorwegianBokmålDictionary(). The dictionary is
+// loaded on first use in either case.
 var NorwegianBokmålDictionary = makeDawg("nsf2023.bin.dawg", NorwegianAlphabet)
 
 // NorwegianNynorskDictionary is a Dawg instance containing the
 // word list used for Norwegian (Nynorsk).
+//
+// Deprecated: Use GetNorwegianNynorskDictionary(). The dictionary is
+// loaded on first use in either case.
 var NorwegianNynorskDictionary = makeDawg("nynorsk2024.bin.dawg", NorwegianAlphabet)
+
+// loaded loads the contents of a built-in dictionary, if that has
+// not been done already, and returns it. A nil dictionary, i.e. one
+// that is excluded from the build, is returned as is.
+func loaded(dawg *Dawg) *Dawg {
+	if dawg != nil {
+		dawg.bytes()
+	}
+	return dawg
+}
+
+// GetIcelandicDictionary returns the Icelandic dictionary,
+// loading it if that has not been done already, or nil if it
+// is excluded from the build
+func GetIcelandicDictionary() *Dawg {
+	return loaded(IcelandicDictionary)
+}
+
+// GetOtcwlDictionary returns the U.S. English dictionary,
+// loading it if that has not been done already
+func GetOtcwlDictionary() *Dawg {
+	return loaded(OtcwlDictionary)
+}
+
+// GetSowpodsDictionary returns the U.K. English dictionary,
+// loading it if that has not been done already
+func GetSowpodsDictionary() *Dawg {
+	return loaded(SowpodsDictionary)
+}
+
+// GetOspsDictionary returns the Polish dictionary,
+// loading it if that has not been done already, or nil if it
+// is excluded from the build
+func GetOspsDictionary() *Dawg {
+	return loaded(OspsDictionary)
+}
+
+// GetNorwegianBokmålDictionary returns the Norwegian (Bokmål)
+// dictionary, loading it if that has not been done already, or
+// nil if it is excluded from the build
+func GetNorwegianBokmålDictionary() *Dawg {
+	return loaded(NorwegianBokmålDictionary)
+}
+
+// GetNorwegianNynorskDictionary returns the Norwegian (Nynorsk)
+// dictionary, loading it if that has not been done already
+func GetNorwegianNynorskDictionary() *Dawg {
+	return loaded(NorwegianNynorskDictionary)
+}
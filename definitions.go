@@ -0,0 +1,125 @@
+// definitions.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements an optional hook for looking up word
+// definitions, which are included in /wordcheck responses.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"sync"
+	"time"
+)
+
+// DefinitionProvider looks up the definition (or lemma) of a word
+// in a given locale, for instance from an external dictionary service.
+// Lookup returns false if there is no definition for the word.
+// It may be called concurrently from several goroutines.
+type DefinitionProvider interface {
+	Lookup(locale, word string) (string, bool)
+}
+
+// MapDefinitionProvider is a DefinitionProvider backed by an
+// in-memory map of locales to maps of words to definitions
+type MapDefinitionProvider map[string]map[string]string
+
+// Lookup returns the definition of a word in a locale, if found
+func (provider MapDefinitionProvider) Lookup(locale, word string) (string, bool) {
+	def, ok := provider[locale][word]
+	return def, ok
+}
+
+// The registered DefinitionProvider, if any
+var definitionProvider = struct {
+	sync.RWMutex
+	provider DefinitionProvider
+}{}
+
+// RegisterDefinitionProvider sets the DefinitionProvider used for
+// /wordcheck requests that ask for definitions. A nil provider
+// removes the current one.
+func RegisterDefinitionProvider(provider DefinitionProvider) {
+	definitionProvider.Lock()
+	defer definitionProvider.Unlock()
+	definitionProvider.provider = provider
+}
+
+// MaxDefinitionWorkers is the maximum number of concurrent calls
+// to the DefinitionProvider for a single request
+const MaxDefinitionWorkers = 4
+
+// DefinitionTimeout is the maximum time spent waiting for the
+// DefinitionProvider in a single request. Definitions that have
+// not been found by then are returned as empty strings.
+var DefinitionTimeout = 2 * time.Second
+
+// lookupDefinitions looks up the definitions of the given words,
+// each of which is looked up only once, using a bounded number of
+// concurrent calls to the registered DefinitionProvider. It returns
+// a map of words to definitions, with an empty string for words that
+// have no definition or whose lookup did not finish in time.
+func lookupDefinitions(locale string, words []string) map[string]string {
+	defs := make(map[string]string, len(words))
+	unique := make([]string, 0, len(words))
+	for _, word := range words {
+		if _, ok := defs[word]; !ok {
+			defs[word] = ""
+			unique = append(unique, word)
+		}
+	}
+	definitionProvider.RLock()
+	provider := definitionProvider.provider
+	definitionProvider.RUnlock()
+	if provider == nil || len(unique) == 0 {
+		return defs
+	}
+	type result struct {
+		word, def string
+	}
+	// Both channels are large enough for the workers never to block,
+	// even after we have stopped waiting for them
+	jobs := make(chan string, len(unique))
+	for _, word := range unique {
+		jobs <- word
+	}
+	close(jobs)
+	results := make(chan result, len(unique))
+	for i := 0; i < min(MaxDefinitionWorkers, len(unique)); i++ {
+		go func() {
+			for word := range jobs {
+				def, _ := provider.Lookup(locale, word)
+				results <- result{word, def}
+			}
+		}()
+	}
+	timeout := time.NewTimer(DefinitionTimeout)
+	defer timeout.Stop()
+	for range unique {
+		select {
+		case r := <-results:
+			defs[r.word] = r.def
+		case <-timeout.C:
+			// The provider is too slow: make do with what we have
+			return defs
+		}
+	}
+	return defs
+}
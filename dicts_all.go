@@ -0,0 +1,34 @@
+//go:build !skrafl_slim
+
+// dicts_all.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file embeds all the built-in dictionaries. Build with
+// the skrafl_slim tag to leave out the larger ones (cf. dicts_slim.go).
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import "embed"
+
+// Point to the DAWG file resources in the dicts directory
+//
+//go:embed dicts/*.bin.dawg
+var dawgFS embed.FS
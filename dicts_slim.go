@@ -0,0 +1,37 @@
+//go:build skrafl_slim
+
+// dicts_slim.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file embeds only the smaller built-in dictionaries, for
+// slimmer binaries. The Icelandic, Polish and Norwegian (Bokmål)
+// dictionaries are left out: their Dawg variables are nil, and
+// requests for their locales fail with a descriptive error
+// (cf. LocaleRegistry.Resolve()).
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import "embed"
+
+// Point to the DAWG file resources in the dicts directory
+//
+//go:embed dicts/otcwl2014.bin.dawg dicts/sowpods.bin.dawg dicts/nynorsk2024.bin.dawg
+var dawgFS embed.FS
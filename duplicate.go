@@ -0,0 +1,265 @@
+// duplicate.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements the DuplicateGame class, for games
+// in the Duplicate mode. There, both players see the same board
+// and the same rack in each round, and each player scores the move
+// that they submit. The board then advances with the
+// top-scoring move, and a new rack is dealt for the next round.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxRedeals is the number of times that an unplayable rack
+// is returned to the bag and redrawn before the game is over
+const maxRedeals = 10
+
+// DuplicateRound is an entry in the Rounds list of a DuplicateGame
+type DuplicateRound struct {
+	// The shared rack of the round
+	Rack string
+	// The moves submitted by the players; a player
+	// that passed has a *PassMove here
+	Submitted [2]Move
+	// The score awarded to each player for the round
+	Scores [2]int
+	// The move that was applied to the board
+	Played Move
+	// The score of the move that was applied to the board
+	PlayedScore int
+}
+
+// DuplicateGame is a container for an in-progress game
+// in the Duplicate mode, having a Board, a Bag and a single
+// Rack that is shared by the two players
+type DuplicateGame struct {
+	PlayerNames [2]string
+	// The cumulative scores of the players
+	Scores [2]int
+	Board  Board
+	// The rack that both players play from in the current round
+	Rack    Rack
+	Bag     *Bag
+	Dawg    *Dawg
+	TileSet *TileSet
+	// The rounds played so far
+	Rounds []*DuplicateRound
+	// If PlayBestMove is true, the board advances with the
+	// engine's best move in each round instead of with the
+	// top-scoring move submitted by the players
+	PlayBestMove bool
+	// The moves submitted in the current round
+	submitted [2]Move
+	// The valid moves for the current rack, sorted by score
+	moves []Move
+}
+
+// NewDuplicateGame instantiates a new DuplicateGame with the
+// dictionary and TileSet registered for the given locale in the
+// Locales registry, or those of the DefaultLocale if the locale is
+// not found there, and returns a reference to it
+func NewDuplicateGame(locale string, boardType string, options GameOptions) *DuplicateGame {
+	dawg, tileSet := decodeLocale(locale, boardType)
+	if dawg == nil {
+		return nil
+	}
+	game := &DuplicateGame{}
+	game.Init(boardType, tileSet, dawg, options)
+	return game
+}
+
+// Init initializes a new DuplicateGame with a fresh bag copied
+// from the given tile set, and deals the rack of the first round
+func (game *DuplicateGame) Init(boardType string, tileSet *TileSet, dawg *Dawg, options GameOptions) {
+	game.Board.Init(boardType)
+	game.Rack.InitWithSize(options.rackSize())
+	game.TileSet = tileSet
+	game.Dawg = dawg
+	game.Bag = makeBag(tileSet, options.RandSource)
+	game.Rounds = make([]*DuplicateRound, 0, 30)
+	game.deal()
+}
+
+// SetPlayerNames sets the names of the two players
+func (game *DuplicateGame) SetPlayerNames(player0, player1 string) {
+	game.PlayerNames = [2]string{player0, player1}
+}
+
+// State returns a new GameState instance describing the board
+// and the shared rack of the current round, so that a robot
+// player can decide on a move
+func (game *DuplicateGame) State() *GameState {
+	// Exchanges are not allowed in the Duplicate mode
+	return NewState(game.Dawg, game.TileSet, &game.Board, &game.Rack, true)
+}
+
+// deal fills the shared rack from the bag and generates the valid
+// moves for it. If there are none, the rack is returned to the bag
+// and redrawn, as long as the bag has tiles to offer.
+func (game *DuplicateGame) deal() {
+	for i := 0; ; i++ {
+		game.Rack.Fill(game.Bag)
+		state := game.State()
+		game.moves = state.GenerateMoves()
+		if len(game.moves) > 0 || game.Bag.TileCount() == 0 || i >= maxRedeals {
+			sort.Sort(byScore{state, game.moves})
+			return
+		}
+		game.Rack.ReturnToBag(game.Bag)
+	}
+}
+
+// IsOver returns true if the game is over, i.e. the bag
+// is exhausted and the shared rack is unplayable
+func (game *DuplicateGame) IsOver() bool {
+	return len(game.moves) == 0
+}
+
+// Submit records the move of the given player in the current round.
+// The move must be a valid *TileMove, using tiles from the shared rack,
+// or a *PassMove. Once both players have submitted their moves, the
+// round is finished: the players are scored, the board advances
+// and the rack for the next round is dealt.
+func (game *DuplicateGame) Submit(player int, move Move) error {
+	if game.IsOver() {
+		return fmt.Errorf("the game is over")
+	}
+	if player < 0 || player > 1 {
+		return fmt.Errorf("invalid player %v", player)
+	}
+	if game.submitted[player] != nil {
+		return fmt.Errorf("player %v has already submitted a move", player)
+	}
+	switch m := move.(type) {
+	case *PassMove:
+	case *TileMove:
+		if !game.inRack(m) {
+			return fmt.Errorf("move uses tiles that are not in the rack")
+		}
+		if !m.isValid(&game.Board, game.TileSet, game.Dawg, game.Rack.Size()) {
+			return fmt.Errorf("invalid move")
+		}
+	default:
+		return fmt.Errorf("only tile moves and passes are allowed")
+	}
+	game.submitted[player] = move
+	if game.submitted[0] != nil && game.submitted[1] != nil {
+		game.finishRound()
+	}
+	return nil
+}
+
+// inRack returns true if the tiles of the move are all
+// found in the shared rack
+func (game *DuplicateGame) inRack(move *TileMove) bool {
+	_, missing := move.missingTile(game.Rack.AsRunes())
+	return !missing
+}
+
+// finishRound scores the submitted moves, applies the move of the
+// round to the board and deals the rack of the next round
+func (game *DuplicateGame) finishRound() {
+	state := game.State()
+	round := &DuplicateRound{
+		Rack:      game.Rack.String(),
+		Submitted: game.submitted,
+	}
+	for player, move := range game.submitted {
+		round.Scores[player] = move.Score(state)
+		game.Scores[player] += round.Scores[player]
+	}
+	// Find the move that the board advances with: the top-scoring
+	// submitted tile move, with ties going to the first player,
+	// unless the engine's best move is requested. If both players
+	// passed, the engine's best move is played regardless.
+	var played *TileMove
+	for player, move := range game.submitted {
+		if tileMove, ok := move.(*TileMove); ok {
+			if played == nil || round.Scores[player] > played.Score(state) {
+				played = tileMove
+			}
+		}
+	}
+	if played == nil || game.PlayBestMove {
+		played = game.moves[0].(*TileMove)
+	}
+	round.Played = played
+	round.PlayedScore = played.Score(state)
+	game.place(played)
+	game.Rounds = append(game.Rounds, round)
+	game.submitted = [2]Move{}
+	game.deal()
+}
+
+// place moves the tiles of a validated tile move
+// from the shared rack to the board
+func (game *DuplicateGame) place(move *TileMove) {
+	for coord, cover := range move.Covers {
+		tile := game.Rack.FindTile(cover.Letter)
+		if tile == nil {
+			// Should never happen, as the move has been validated
+			panic(fmt.Sprintf("Rack does not contain tile: %c", cover.Letter))
+		}
+		if cover.Letter == '?' {
+			tile.Meaning = cover.Meaning
+		} else {
+			tile.Meaning = cover.Letter
+		}
+		game.Rack.RemoveTile(tile)
+		game.Board.PlaceTile(coord.Row, coord.Col, tile)
+	}
+}
+
+// String returns a string representation of a DuplicateGame
+func (game *DuplicateGame) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%v (%v : %v) %v\n",
+		game.PlayerNames[0],
+		game.Scores[0],
+		game.Scores[1],
+		game.PlayerNames[1],
+	))
+	sb.WriteString(fmt.Sprintf("%v\n", &game.Board))
+	sb.WriteString(fmt.Sprintf("Rack: %v\n", &game.Rack))
+	sb.WriteString(fmt.Sprintf("Bag: %v\n", game.Bag))
+	// Show the rounds played, if any
+	if len(game.Rounds) > 0 {
+		sb.WriteString("Rounds:\n")
+		for i, round := range game.Rounds {
+			sb.WriteString(fmt.Sprintf("  %2d: %v %v (%v) | (%v) %v / %v (%v)\n",
+				i+1,
+				round.Rack,
+				round.Played,
+				round.PlayedScore,
+				round.Scores[0],
+				round.Submitted[0],
+				round.Submitted[1],
+				round.Scores[1],
+			))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,275 @@
+// endgame.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements an endgame solver, which searches for
+// the best move once the bag is empty and the game has thus
+// become one of perfect information, as well as a robot
+// that uses it.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// EndgameSolver finds the best move for the player to move when the
+// bag is empty, and both racks are therefore known. It performs an
+// alpha-beta search over alternating tile moves and passes, maximizing
+// the final score differential, including the adjustments for the
+// tiles left in the racks when the game is over. The search is
+// iteratively deepened until the game tree is exhausted, or MaxDepth
+// plies or MaxDuration is reached. An EndgameSolver may be used
+// concurrently, as each call to Solve() has its own search state.
+type EndgameSolver struct {
+	// The maximum search depth in plies, or 0 for no limit
+	MaxDepth int
+	// The maximum time to spend on the search, or 0 for no limit.
+	// The search to a depth of one ply is always completed.
+	MaxDuration time.Duration
+	// The maximum number of tile moves considered in each position,
+	// or 0 for no limit. The highest scoring moves are considered,
+	// along with a pass. With a limit, the best move may be missed.
+	MaxMoves int
+}
+
+// endgameSearch is the state of a single endgame search
+type endgameSearch struct {
+	// A copy of the game, on which moves are made and undone
+	game     *Game
+	maxMoves int
+	deadline time.Time
+	// Whether the deadline applies, i.e. whether
+	// the first iteration has been completed
+	timed bool
+	// Whether the search was aborted because the deadline passed
+	aborted bool
+	// Whether the search reached its maximum depth before the
+	// game was over in some line, so that a deeper search
+	// could give a different result
+	cutoff bool
+}
+
+// rackValue returns the sum of the scores of the tiles in a rack
+func rackValue(rack *Rack) int {
+	value := 0
+	for _, sq := range rack.Slots {
+		if sq.Tile != nil {
+			value += sq.Tile.Score
+		}
+	}
+	return value
+}
+
+// evaluate returns the score differential from the point of view of
+// the given player, if the game were to end with the racks as they
+// are, i.e. each player being awarded the tile scores left in the
+// opponent's rack. This is the exact outcome if both players pass
+// until the game is over, and otherwise an estimate.
+func (search *endgameSearch) evaluate(player int) int {
+	game := search.game
+	return game.Scores[player] - game.Scores[1-player] +
+		rackValue(&game.Racks[1-player]) - rackValue(&game.Racks[player])
+}
+
+// orderedMoves returns the moves available to the player to move,
+// i.e. the valid tile moves in descending order of score, up to
+// the maximum number of moves if any, followed by a pass
+func (search *endgameSearch) orderedMoves() []Move {
+	state := search.game.State()
+	moves := state.GenerateMoves()
+	sort.Sort(byScore{state, moves})
+	if search.maxMoves > 0 && len(moves) > search.maxMoves {
+		moves = moves[:search.maxMoves]
+	}
+	return append(moves, NewPassMove())
+}
+
+// timeUp returns true, and marks the search as aborted,
+// if the deadline has passed
+func (search *endgameSearch) timeUp() bool {
+	if search.timed && !search.deadline.IsZero() && time.Now().After(search.deadline) {
+		search.aborted = true
+	}
+	return search.aborted
+}
+
+// search returns the value of the current position from the point of
+// view of the given player, who is to move, searching to the given
+// depth. If passed is true, the previous move was a pass.
+func (search *endgameSearch) search(player, depth, alpha, beta int, passed bool) int {
+	game := search.game
+	if game.IsOver() {
+		return game.Scores[player] - game.Scores[1-player]
+	}
+	if depth == 0 {
+		search.cutoff = true
+		return search.evaluate(player)
+	}
+	if search.timeUp() {
+		return 0
+	}
+	best := math.MinInt
+	for _, move := range search.orderedMoves() {
+		value := search.value(move, player, depth, alpha, beta, passed)
+		if search.aborted {
+			return 0
+		}
+		best = max(best, value)
+		alpha = max(alpha, best)
+		if alpha >= beta {
+			break
+		}
+	}
+	return best
+}
+
+// value returns the value of making the given move in the current
+// position, from the point of view of the given player, who is to move
+func (search *endgameSearch) value(move Move, player, depth, alpha, beta int, passed bool) int {
+	_, pass := move.(*PassMove)
+	if pass && passed {
+		// Both players have passed in a row: there is no point in
+		// searching further, since passing again will not improve
+		// the position of either player
+		return search.evaluate(player)
+	}
+	search.game.ApplyValid(move)
+	value := -search.search(1-player, depth-1, -beta, -alpha, pass)
+	search.game.UndoLastMove()
+	return value
+}
+
+// Solve returns the best move for the player to move in the game,
+// and the final score differential, from the point of view of that
+// player, that results if both players play their best moves from
+// then on. The game itself is not modified. If the game is over or
+// the bag is not empty, Solve returns a nil move.
+func (solver *EndgameSolver) Solve(game *Game) (Move, int) {
+	if game == nil || game.IsOver() || game.Bag.TileCount() > 0 {
+		return nil, 0
+	}
+	search := &endgameSearch{game: game.Clone(), maxMoves: solver.MaxMoves}
+	// The clock does not run while searching
+	search.game.Clock = nil
+	if solver.MaxDuration > 0 {
+		search.deadline = time.Now().Add(solver.MaxDuration)
+	}
+	player := search.game.PlayerToMove()
+	moves := search.orderedMoves()
+	// Each tile move uses at least one tile, and two passes in a row
+	// end the search, so this depth is enough to exhaust the game tree
+	maxDepth := 2*(len(game.Racks[0].AsRunes())+len(game.Racks[1].AsRunes())) + 2
+	if solver.MaxDepth > 0 {
+		maxDepth = min(maxDepth, solver.MaxDepth)
+	}
+	var bestMove Move
+	bestValue := 0
+	for depth := 1; depth <= maxDepth; depth++ {
+		search.cutoff = false
+		move, value := moves[0], math.MinInt
+		alpha := math.MinInt + 1
+		for _, m := range moves {
+			v := search.value(m, player, depth, alpha, math.MaxInt, false)
+			if search.aborted {
+				break
+			}
+			if v > value {
+				move, value = m, v
+				alpha = max(alpha, v)
+			}
+		}
+		if search.aborted {
+			break
+		}
+		bestMove, bestValue = move, value
+		if !search.cutoff {
+			// The game tree was exhausted
+			break
+		}
+		// Search the best move first at the next depth
+		ix := slices.Index(moves, move)
+		copy(moves[1:ix+1], moves[0:ix])
+		moves[0] = move
+		search.timed = true
+	}
+	return bestMove, bestValue
+}
+
+// SolveEndgame returns the best move for the player to move in a game
+// where the bag is empty, and the resulting final score differential
+// from the point of view of that player, searching for at most the
+// given duration (0 meaning no limit), cf. EndgameSolver
+func SolveEndgame(game *Game, maxDuration time.Duration) (Move, int) {
+	solver := &EndgameSolver{MaxDuration: maxDuration}
+	return solver.Solve(game)
+}
+
+// EndgameMovesPerPly is the number of tile moves that
+// Game.SolveEndgame() considers in each position
+const EndgameMovesPerPly = 20
+
+// SolveEndgame returns the best move for the player to move in the
+// Game, where the bag is empty, and the resulting final score
+// differential from the point of view of that player. Unlike the
+// package-level SolveEndgame(), which limits the search by time, the
+// search is at most maxPlies plies deep (0 meaning no limit), and
+// considers the EndgameMovesPerPly highest scoring tile moves in each
+// position, cf. EndgameSolver. The Game itself is not modified.
+func (game *Game) SolveEndgame(maxPlies int) (Move, int) {
+	solver := &EndgameSolver{MaxDepth: maxPlies, MaxMoves: EndgameMovesPerPly}
+	return solver.Solve(game)
+}
+
+// EndgameAwareRobot plays as a HighScoreRobot until the bag is empty,
+// and then picks its moves using an EndgameSolver. The solver needs
+// to know the opponent's rack, which is deduced from the unseen tiles
+// in the GameState (cf. Game.State()); if the state does not carry
+// them, the robot keeps playing as a HighScoreRobot.
+type EndgameAwareRobot struct {
+	Solver EndgameSolver
+}
+
+// NewEndgameAwareRobot returns a fresh instance of an EndgameAwareRobot,
+// spending at most the given duration (0 meaning no limit) on each
+// endgame move
+func NewEndgameAwareRobot(maxDuration time.Duration) *RobotWrapper {
+	return &RobotWrapper{Robot: &EndgameAwareRobot{
+		Solver: EndgameSolver{MaxDuration: maxDuration},
+	}}
+}
+
+// PickMove for an EndgameAwareRobot selects the move found by the
+// EndgameSolver if the bag is empty, and otherwise the highest
+// scoring move, or an exchange move, or a pass move as a last resort
+func (robot *EndgameAwareRobot) PickMove(state *GameState, moves []Move) Move {
+	// The opponent's rack is always full while there are tiles
+	// in the bag, so the bag is empty if the unseen tiles fit in a rack
+	if len(state.Unseen) == 0 || len(state.Unseen) > state.RackSize() {
+		return (&HighScoreRobot{}).PickMove(state, moves)
+	}
+	if move, _ := robot.Solver.Solve(gameFromState(state, state.Unseen)); move != nil {
+		return move
+	}
+	return (&HighScoreRobot{}).PickMove(state, moves)
+}
@@ -0,0 +1,164 @@
+// exchange.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements the generation and evaluation of
+// exchange moves, based on the leaves that they result in.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"sort"
+)
+
+// EnglishLeaveTable contains default single-tile leave values
+// for the English tile sets
+var EnglishLeaveTable = LeaveTable{
+	"a": 1.0, "b": -2.0, "c": 0.5, "d": 0.5, "e": 3.0,
+	"f": -2.0, "g": -2.5, "h": 1.0, "i": -0.5, "j": -1.5,
+	"k": -1.5, "l": -0.5, "m": 0.5, "n": 0.0, "o": -1.0,
+	"p": -0.5, "q": -7.0, "r": 1.5, "s": 8.0, "t": 0.0,
+	"u": -3.5, "v": -5.5, "w": -4.0, "x": 3.5, "y": -0.5,
+	"z": 5.0, "?": 25.0,
+}
+
+// IcelandicLeaveTable contains default single-tile leave values
+// for the new Icelandic tile set
+var IcelandicLeaveTable = LeaveTable{
+	"a": 2.0, "á": -1.0, "b": -3.0, "d": -3.0, "ð": 1.0,
+	"e": 0.0, "é": -4.0, "f": -1.0, "g": 0.0, "h": -1.0,
+	"i": 1.5, "í": -3.0, "j": -3.0, "k": 0.5, "l": 1.0,
+	"m": 0.5, "n": 2.0, "o": -3.0, "ó": -1.0, "p": -3.0,
+	"r": 2.0, "s": 2.5, "t": 1.5, "u": 0.5, "ú": -3.0,
+	"v": -3.0, "x": -5.0, "y": -3.0, "ý": -3.0, "þ": -3.0,
+	"æ": -2.0, "ö": -3.0, "?": 20.0,
+}
+
+// ExchangeOption describes a possible exchange of tiles,
+// along with the leave that it results in and the value
+// of that leave
+type ExchangeOption struct {
+	Letters string  `json:"exchange"`
+	Leave   string  `json:"leave"`
+	Value   float64 `json:"value"`
+}
+
+// GenerateExchangeMoves returns all distinct exchange moves that are
+// possible with the current rack, i.e. one for each distinct non-empty
+// subset of its tiles. If an exchange is not allowed, an empty list
+// is returned.
+func (state *GameState) GenerateExchangeMoves() []Move {
+	moves := make([]Move, 0)
+	if state.exchangeForbidden {
+		return moves
+	}
+	rack := state.Rack.AsRunes()
+	seen := make(map[string]bool)
+	for mask := 1; mask < 1<<len(rack); mask++ {
+		letters := make([]rune, 0, len(rack))
+		for i, letter := range rack {
+			if mask&(1<<i) != 0 {
+				letters = append(letters, letter)
+			}
+		}
+		// Racks with duplicate tiles yield fewer distinct exchanges
+		key := LeaveKey(letters)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		moves = append(moves, NewExchangeMove(string(letters)))
+	}
+	return moves
+}
+
+// maxPartialExchange is the largest number of tiles in the partial
+// exchanges proposed by GenerateExchanges()
+const maxPartialExchange = 3
+
+// GenerateExchanges returns a limited set of candidate exchanges for
+// the current rack: every distinct subset of up to maxPartialExchange
+// tiles, which keeps most of the rack, plus an exchange of the whole
+// rack. With a 7-tile rack, this yields at most 64 candidates,
+// ordered by the number of tiles exchanged. If an exchange is not
+// allowed, an empty list is returned.
+func (state *GameState) GenerateExchanges() []*ExchangeMove {
+	exchanges := make([]*ExchangeMove, 0)
+	if state.exchangeForbidden {
+		return exchanges
+	}
+	rack := state.Rack.AsRunes()
+	seen := make(map[string]bool)
+	var subsets func(start int, letters []rune, size int)
+	subsets = func(start int, letters []rune, size int) {
+		if len(letters) == size {
+			// Racks with duplicate tiles yield fewer distinct exchanges
+			if key := LeaveKey(letters); !seen[key] {
+				seen[key] = true
+				exchanges = append(exchanges, NewExchangeMove(string(letters)))
+			}
+			return
+		}
+		for i := start; i < len(rack); i++ {
+			subsets(i+1, append(letters, rack[i]), size)
+		}
+	}
+	for size := 1; size <= maxPartialExchange && size <= len(rack); size++ {
+		subsets(0, make([]rune, 0, size), size)
+	}
+	if len(rack) > maxPartialExchange {
+		exchanges = append(exchanges, NewExchangeMove(string(rack)))
+	}
+	return exchanges
+}
+
+// RankExchangeMoves returns the possible exchanges with the current
+// rack, sorted in descending order by the value of the resulting
+// leave, as looked up in the given LeaveTable. If leaves is nil,
+// the default LeaveTable of the tile set is used.
+func (state *GameState) RankExchangeMoves(leaves LeaveTable) []ExchangeOption {
+	if leaves == nil {
+		leaves = state.TileSet.Leaves
+	}
+	rack := state.Rack.AsRunes()
+	moves := state.GenerateExchangeMoves()
+	options := make([]ExchangeOption, len(moves))
+	for i, move := range moves {
+		leave := moveLeave(rack, move)
+		options[i] = ExchangeOption{
+			Letters: move.(*ExchangeMove).Letters,
+			Leave:   string(leave),
+			Value:   leaves.Value(leave),
+		}
+	}
+	sort.Slice(options, func(i, j int) bool {
+		if options[i].Value != options[j].Value {
+			return options[i].Value > options[j].Value
+		}
+		// Prefer exchanging fewer tiles, then alphabetic order,
+		// to make the ranking deterministic
+		li, lj := len([]rune(options[i].Letters)), len([]rune(options[j].Letters))
+		if li != lj {
+			return li < lj
+		}
+		return options[i].Letters < options[j].Letters
+	})
+	return options
+}
@@ -0,0 +1,388 @@
+// gaddag.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements a GADDAG word graph and an alternative
+// move generator that uses it.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+/*
+
+A GADDAG, as described by Steven A. Gordon in "A Faster Scrabble Move
+Generation Algorithm" (Software - Practice and Experience, 1994),
+stores each word in every one of its "split" forms: for a word
+w = xy (where x is non-empty), the path REV(x) ^ y is stored,
+with ^ being a separator. This allows move generation to start at
+an anchor square and extend leftwards, followed by a switch of
+direction and extension rightwards, without having to precompute
+left parts as the Appel & Jacobson algorithm does.
+
+The Gaddag here is a plain (unminimized) trie, which is simple
+and fast to build but can be large. It is therefore practical to
+build it from restricted word lists, for instance all words that
+can be formed from the letters in a rack plus those on the board,
+cf. NewGaddagFromDawg() and NewGaddagFromState().
+
+The generated move lists are identical to those returned by
+GameState.GenerateMoves(), given the same vocabulary.
+
+*/
+
+package skrafl
+
+// GaddagSeparator separates the reversed prefix from the
+// suffix in a Gaddag path
+const GaddagSeparator = '^'
+
+// Gaddag is a word graph supporting bidirectional move
+// generation from anchor squares
+type Gaddag struct {
+	root *gaddagNode
+	// The number of nodes in the graph
+	numNodes int
+	// The number of words stored in the graph
+	numWords int
+}
+
+// gaddagNode is a node in the Gaddag. It is final if the path
+// leading to it represents a complete word.
+type gaddagNode struct {
+	final bool
+	edges []gaddagEdge
+}
+
+// gaddagEdge is an outgoing edge from a gaddagNode, labeled
+// with a single letter (or the GaddagSeparator)
+type gaddagEdge struct {
+	letter rune
+	next   *gaddagNode
+}
+
+// child returns the node reached via the edge with the given
+// letter, or nil if there is no such edge
+func (node *gaddagNode) child(letter rune) *gaddagNode {
+	for i := range node.edges {
+		if node.edges[i].letter == letter {
+			return node.edges[i].next
+		}
+	}
+	return nil
+}
+
+// NewGaddag builds a Gaddag from a list of words
+func NewGaddag(words []string) *Gaddag {
+	gaddag := &Gaddag{root: &gaddagNode{}, numNodes: 1}
+	for _, word := range words {
+		gaddag.Add(word)
+	}
+	return gaddag
+}
+
+// NewGaddagFromDawg builds a Gaddag containing the words in the
+// given Dawg that can be formed from the given letters, where
+// '?' stands for any letter. Note that an empty letters string
+// results in an empty Gaddag.
+func NewGaddagFromDawg(dawg *Dawg, letters string) *Gaddag {
+	if letters == "" {
+		return NewGaddag(nil)
+	}
+	return NewGaddag(dawg.Permute(letters, 2))
+}
+
+// NewGaddagFromState builds a Gaddag containing the words in the Dawg
+// of the GameState that can be formed from the letters in its rack
+// and on its board, i.e. all the words that GenerateMovesGaddag()
+// needs to find the same moves as GenerateMoves()
+func NewGaddagFromState(state *GameState) *Gaddag {
+	letters := state.Rack.AsRunes()
+	for row := 0; row < state.Board.Size; row++ {
+		for col := 0; col < state.Board.Size; col++ {
+			if tile := state.Board.TileAt(row, col); tile != nil {
+				letters = append(letters, tile.Meaning)
+			}
+		}
+	}
+	return NewGaddagFromDawg(state.Dawg, string(letters))
+}
+
+// insert adds a single path to the Gaddag, marking its last
+// node as final
+func (gaddag *Gaddag) insert(path []rune) {
+	node := gaddag.root
+	for _, letter := range path {
+		next := node.child(letter)
+		if next == nil {
+			next = &gaddagNode{}
+			node.edges = append(node.edges, gaddagEdge{letter, next})
+			gaddag.numNodes++
+		}
+		node = next
+	}
+	node.final = true
+}
+
+// Add adds a word to the Gaddag, in all its split forms
+func (gaddag *Gaddag) Add(word string) {
+	runes := []rune(word)
+	n := len(runes)
+	if n == 0 {
+		return
+	}
+	path := make([]rune, 0, n+1)
+	// The reversed word, without a separator
+	for i := n - 1; i >= 0; i-- {
+		path = append(path, runes[i])
+	}
+	gaddag.insert(path)
+	// The reversed prefixes, followed by a separator
+	// and the rest of the word
+	for split := 1; split < n; split++ {
+		path = path[:0]
+		for i := split - 1; i >= 0; i-- {
+			path = append(path, runes[i])
+		}
+		path = append(path, GaddagSeparator)
+		path = append(path, runes[split:]...)
+		gaddag.insert(path)
+	}
+	gaddag.numWords++
+}
+
+// Find returns true if the given word is in the Gaddag
+func (gaddag *Gaddag) Find(word string) bool {
+	runes := []rune(word)
+	node := gaddag.root
+	for i := len(runes) - 1; i >= 0 && node != nil; i-- {
+		node = node.child(runes[i])
+	}
+	return node != nil && node.final && len(runes) > 0
+}
+
+// NumWords returns the number of words stored in the Gaddag
+func (gaddag *Gaddag) NumWords() int {
+	return gaddag.numWords
+}
+
+// NumNodes returns the number of nodes in the Gaddag
+func (gaddag *Gaddag) NumNodes() int {
+	return gaddag.numNodes
+}
+
+// gaddagGenerator finds all legal moves that have a particular
+// anchor square as their leftmost covered anchor, within an Axis.
+// It first extends leftwards from the anchor, and then switches
+// direction and extends rightwards, as the Gaddag paths allow.
+type gaddagGenerator struct {
+	axis   *Axis
+	anchor int
+	rack   []rune
+	// The letters laid down (or already on the board)
+	// along the axis
+	letters [MaxBoardSize]rune
+	// The list of valid tile moves found
+	moves []Move
+}
+
+// takeTile returns the rack tile to use for the given letter,
+// preferring a normal tile over a blank, or zero if there
+// is no usable tile in the rack
+func (gg *gaddagGenerator) takeTile(letter rune) rune {
+	if ContainsRune(gg.rack, letter) {
+		return letter
+	}
+	if ContainsRune(gg.rack, '?') {
+		return '?'
+	}
+	return 0
+}
+
+// extendLeft covers the square at index, which is at or to the
+// left of the anchor, following the edges of the given node
+func (gg *gaddagGenerator) extendLeft(index int, node *gaddagNode) {
+	if tile := gg.axis.sq[index].Tile; tile != nil {
+		// There is a tile in the square: must match it exactly
+		if next := node.child(tile.Meaning); next != nil {
+			gg.letters[index] = tile.Meaning
+			gg.goOnLeft(index, next)
+		}
+		return
+	}
+	rack := gg.rack
+	for _, edge := range node.edges {
+		if edge.letter == GaddagSeparator || !gg.axis.Allows(index, edge.letter) {
+			continue
+		}
+		tile := gg.takeTile(edge.letter)
+		if tile == 0 {
+			continue
+		}
+		gg.rack = RemoveRune(rack, tile)
+		gg.letters[index] = edge.letter
+		gg.goOnLeft(index, edge.next)
+		gg.rack = rack
+	}
+}
+
+// goOnLeft is called after a letter has been placed at index,
+// on the anchor or to its left. It records a move if a complete
+// word has been formed, and continues the navigation leftwards,
+// and/or switches direction to continue rightwards.
+func (gg *gaddagGenerator) goOnLeft(index int, node *gaddagNode) {
+	axis := gg.axis
+	leftEmpty := index == 0 || axis.sq[index-1].Tile == nil
+	if node.final && leftEmpty &&
+		(gg.anchor+1 >= axis.size || axis.sq[gg.anchor+1].Tile == nil) {
+		// A complete word, ending at the anchor
+		gg.accept(index, gg.anchor)
+	}
+	if index > 0 {
+		// Continue leftwards, over tiles already on the board, or
+		// into open squares that are not anchors (moves that cover
+		// those are found when processing the other anchors)
+		left := index - 1
+		if axis.sq[left].Tile != nil ||
+			(len(gg.rack) > 0 && !axis.IsAnchor(left) && axis.IsOpen(left)) {
+			gg.extendLeft(left, node)
+		}
+	}
+	if leftEmpty && gg.anchor+1 < axis.size {
+		// Switch direction and continue to the right of the anchor
+		if next := node.child(GaddagSeparator); next != nil {
+			gg.extendRight(gg.anchor+1, index, next)
+		}
+	}
+}
+
+// extendRight covers the square at index, which is to the
+// right of the anchor, following the edges of the given node
+func (gg *gaddagGenerator) extendRight(index int, start int, node *gaddagNode) {
+	if tile := gg.axis.sq[index].Tile; tile != nil {
+		// There is a tile in the square: must match it exactly
+		if next := node.child(tile.Meaning); next != nil {
+			gg.letters[index] = tile.Meaning
+			gg.goOnRight(index, start, next)
+		}
+		return
+	}
+	if len(gg.rack) == 0 {
+		return
+	}
+	rack := gg.rack
+	for _, edge := range node.edges {
+		if edge.letter == GaddagSeparator || !gg.axis.Allows(index, edge.letter) {
+			continue
+		}
+		tile := gg.takeTile(edge.letter)
+		if tile == 0 {
+			continue
+		}
+		gg.rack = RemoveRune(rack, tile)
+		gg.letters[index] = edge.letter
+		gg.goOnRight(index, start, edge.next)
+		gg.rack = rack
+	}
+}
+
+// goOnRight is called after a letter has been placed at index,
+// to the right of the anchor. It records a move if a complete word
+// has been formed, and continues the navigation rightwards.
+func (gg *gaddagGenerator) goOnRight(index int, start int, node *gaddagNode) {
+	rightEmpty := index+1 >= gg.axis.size || gg.axis.sq[index+1].Tile == nil
+	if node.final && rightEmpty {
+		gg.accept(start, index)
+	}
+	if index+1 < gg.axis.size {
+		gg.extendRight(index+1, start, node)
+	}
+}
+
+// accept creates a TileMove for the word spanning the squares
+// from start to end (inclusive) and adds it to the move list
+func (gg *gaddagGenerator) accept(start, end int) {
+	if end-start < 1 {
+		// Less than 2 letters long: not a legal tile move
+		return
+	}
+	covers := make(Covers)
+	// Assign rack tiles to the covered squares from left to right,
+	// using blank tiles only where normal tiles are not available,
+	// in the same way as the ExtendRightNavigator does
+	rack := MakeRackTiles(gg.axis.rack)
+	for i := start; i <= end; i++ {
+		sq := gg.axis.sq[i]
+		if sq.Tile == nil {
+			meaning := gg.letters[i]
+			letter := meaning
+			if rack.ContainsTile(meaning) {
+				rack.RemoveTile(meaning)
+			} else {
+				// Must be using a blank tile
+				letter = '?'
+				rack.RemoveTile('?')
+			}
+			covers[Coordinate{sq.Row, sq.Col}] = Cover{letter, meaning}
+		}
+	}
+	// No need to validate robot-generated tile moves
+	tileMove := NewUncheckedTileMove(gg.axis.state.Board, covers)
+	gg.axis.scoreMove(tileMove, start, end)
+	gg.moves = append(gg.moves, tileMove)
+}
+
+// GenerateMovesGaddag returns a list of all legal moves along this Axis,
+// using the given Gaddag
+func (axis *Axis) GenerateMovesGaddag(gaddag *Gaddag) []Move {
+	moves := make([]Move, 0)
+	for i := 0; i < axis.size; i++ {
+		if !axis.IsAnchor(i) || axis.crossCheck[i] == 0 {
+			// Not an anchor, or no tile from the rack can be placed here
+			continue
+		}
+		gg := gaddagGenerator{axis: axis, anchor: i, rack: axis.rack}
+		gg.extendLeft(i, gaddag.root)
+		moves = append(moves, gg.moves...)
+	}
+	return moves
+}
+
+// GenerateMovesGaddag returns a list of all legal moves in the
+// GameState, in the same way as GenerateMoves(), but using the given
+// Gaddag instead of the left part/extend right navigation of the Dawg.
+// The Dawg is still used for cross-checks.
+func (state *GameState) GenerateMovesGaddag(gaddag *Gaddag) []Move {
+	rack := state.Rack.AsRunes()
+	rackSet := state.Dawg.alphabet.MakeSet(rack)
+	size := state.Board.Size
+	// Result channel containing up to size*2 move lists
+	resultMoves := make(chan []Move, size*2)
+	kickOffAxis := func(index int, horizontal bool) {
+		var axis Axis
+		axis.Init(state, rackSet, index, horizontal)
+		resultMoves <- axis.GenerateMovesGaddag(gaddag)
+	}
+	for i := 0; i < size; i++ {
+		go kickOffAxis(i, true)  // Horizontal
+		go kickOffAxis(i, false) // Vertical
+	}
+	moves := make([]Move, 0, 256)
+	for i := 0; i < size*2; i++ {
+		moves = append(moves, (<-resultMoves)...)
+	}
+	return moves
+}
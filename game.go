@@ -24,14 +24,19 @@ package skrafl
 
 import (
 	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
 	"strings"
+	"unicode"
 )
 
 // Game is a container for an in-progress game between
 // two players, having a Board and two Racks, as well
 // as a Bag and a list of Moves made so far. We also keep
 // track of the number of Tiles that have been placed on
-// the Board.
+// the Board. A Game is not safe for concurrent use; use
+// Clone() to give another goroutine its own copy.
 type Game struct {
 	PlayerNames [2]string
 	Scores      [2]int
@@ -50,20 +55,96 @@ type Game struct {
 	// Whether to validate words formed by tile moves in
 	// the game
 	ValidateWords bool
+	// How invalid words are handled, cf. SetChallengeMode()
+	ChallengeMode ChallengeMode
+	// The points deducted from a player who unsuccessfully challenges
+	// a move in DoubleChallenge mode. If zero, the challenger loses
+	// the turn instead.
+	ChallengePenalty int
+	// The locale of the game, identifying its dictionary
+	// and tile set (cf. Locales)
+	Locale string
+	// Whether a player has resigned or lost on time,
+	// and if so, which player, cf. ResignMove
+	Resigned bool
+	Resigner int
+	// The game clock, if the game is timed, cf. SetClock()
+	Clock *Clock
+	// The number of slots in each player's rack, cf. GameOptions
+	RackSize int
+	// The scoring rules of the game, or nil if the
+	// DefaultScoringRules apply, cf. GameOptions
+	Rules *ScoringRules
 }
 
+// ScoringRules contains the rules for scoring that
+// vary between game variants
+type ScoringRules struct {
+	// The number of extra points awarded for laying down
+	// all the tiles of a full rack in a single move
+	BingoBonus int `json:"bingo_bonus"`
+	// If true, a player who finishes the game by emptying the rack
+	// is awarded double the tile scores left in the opponent's rack;
+	// otherwise, they are awarded only once
+	FinalRackDoubling bool `json:"final_rack_doubling"`
+}
+
+// DefaultScoringRules are the scoring rules used
+// unless a game specifies other rules
+var DefaultScoringRules = ScoringRules{
+	BingoBonus:        BingoBonus,
+	FinalRackDoubling: true,
+}
+
+// scoringRules returns the given scoring rules,
+// or the DefaultScoringRules if rules is nil
+func scoringRules(rules *ScoringRules) *ScoringRules {
+	if rules == nil {
+		return &DefaultScoringRules
+	}
+	return rules
+}
+
+// OverReason describes why a Game is over
+type OverReason int
+
+const (
+	// NotOver means that the game is still in progress
+	NotOver OverReason = iota
+	// RackEmpty means that a player finished the game
+	// by emptying the rack when the bag was empty
+	RackEmpty
+	// SixZeroMoves means that six consecutive
+	// zero-point moves were made
+	SixZeroMoves
+	// Resignation means that a player resigned
+	Resignation
+	// TimeForfeit means that a player lost on time
+	TimeForfeit
+)
+
 // GameState contains the bare minimum of information
 // that is needed for a robot player to decide on a move
-// in a Game.
+// in a Game. Moves can be generated concurrently from the
+// same GameState, as long as its board and rack are not
+// modified in the meantime.
 type GameState struct {
 	Dawg    *Dawg
 	TileSet *TileSet
 	Board   *Board
 	// The rack of the player whose move it is
 	Rack *Rack
-	// If there are fewer than RackSize tiles in the bag,
+	// If there are fewer tiles in the bag than fit in a rack,
 	// an exchange move is not allowed
 	exchangeForbidden bool
+	// The tiles that the player to move cannot see, i.e. the
+	// tiles in the bag and in the opponent's rack, with '?' denoting
+	// a blank tile. This is optional and may be nil; it is needed
+	// by robots that simulate the opponent's response, such as SimRobot.
+	Unseen []rune
+	// The scoring rules of the game, or nil if the
+	// DefaultScoringRules apply
+	Rules *ScoringRules
 }
 
 // MoveItem is an entry in the MoveList of a Game.
@@ -72,17 +153,65 @@ type GameState struct {
 type MoveItem struct {
 	RackBefore string
 	Move       Move
+	// The score awarded for the move
+	Score int
+	// The following information allows the move to be undone:
+	// the tiles in the player's rack slots before the move,
+	// and the number of consecutive zero-point moves before it
+	RackTiles    []*Tile
+	NumPassMoves int
+	// The letters of the tiles drawn from the bag as a result
+	// of the move, in order, allowing the game to be replayed
+	Drawn string
+	// Whether the move was unsuccessfully challenged, and the
+	// points deducted from the challenger as a result, cf.
+	// ChallengeLastMove()
+	Challenged       bool
+	ChallengePenalty int
+}
+
+// GameOptions contains optional settings for a new Game
+type GameOptions struct {
+	// RandSource seeds the random source used to draw tiles from
+	// the bag. If nil, the (automatically seeded) global source is
+	// used. Note that a rand.Source is not safe for concurrent use,
+	// so it should not be shared between games.
+	RandSource rand.Source
+	// RackSize is the number of slots in each player's rack.
+	// If zero, the standard RackSize of 7 is used.
+	RackSize int
+	// Rules are the scoring rules of the game.
+	// If nil, the DefaultScoringRules are used.
+	Rules *ScoringRules
+}
+
+// rackSize returns the rack size given by the options,
+// or the default RackSize if none is given
+func (options GameOptions) rackSize() int {
+	if options.RackSize > 0 {
+		return options.RackSize
+	}
+	return RackSize
 }
 
 // Init initializes a new game with a fresh bag copied
 // from the given tile set, and draws the player racks
 // from the bag
 func (game *Game) Init(boardType string, tileSet *TileSet, dawg *Dawg) {
+	game.InitWithOptions(boardType, tileSet, dawg, GameOptions{})
+}
+
+// InitWithOptions initializes a new game as Init does, using the
+// given options. Two games initialized with the same tile set and
+// identically seeded random sources draw identical tiles.
+func (game *Game) InitWithOptions(boardType string, tileSet *TileSet, dawg *Dawg, options GameOptions) {
 	game.Board.Init(boardType)
-	game.Racks[0].Init()
-	game.Racks[1].Init()
+	game.RackSize = options.rackSize()
+	game.Rules = options.Rules
+	game.Racks[0].InitWithSize(game.RackSize)
+	game.Racks[1].InitWithSize(game.RackSize)
 	game.TileSet = tileSet
-	game.Bag = makeBag(tileSet)
+	game.Bag = makeBag(tileSet, options.RandSource)
 	game.Racks[0].Fill(game.Bag)
 	game.Racks[1].Fill(game.Bag)
 	// Initial capacity for 30 moves
@@ -92,51 +221,98 @@ func (game *Game) Init(boardType string, tileSet *TileSet, dawg *Dawg) {
 	game.ValidateWords = true
 }
 
+// Seed seeds the random source of the game's Bag, so that the
+// tiles drawn from it are reproducible. If no moves have been made,
+// the racks are returned to the bag, which is restored to its initial
+// order, and then redrawn; two fresh games with the same tile set and
+// seed are thus identical, and stay so if the same moves are made.
+func (game *Game) Seed(seed int64) {
+	game.Bag.Seed(seed)
+	if len(game.MoveList) > 0 || game.Board.NumTiles > 0 {
+		return
+	}
+	game.Racks[0].ReturnToBag(game.Bag)
+	game.Racks[1].ReturnToBag(game.Bag)
+	for i := range game.Bag.Contents {
+		game.Bag.Contents[i] = &game.Bag.Tiles[i]
+	}
+	game.Racks[0].Fill(game.Bag)
+	game.Racks[1].Fill(game.Bag)
+}
+
 // NewIcelandicGame instantiates a new Game with the Icelandic TileSet
 // and returns a reference to it
 func NewIcelandicGame(boardType string) *Game {
+	return NewIcelandicGameWithOptions(boardType, GameOptions{})
+}
+
+// NewIcelandicGameWithOptions instantiates a new Game as NewIcelandicGame
+// does, using the given options
+func NewIcelandicGameWithOptions(boardType string, options GameOptions) *Game {
 	if IcelandicDictionary == nil {
 		// Unable to read Icelandic DAWG
 		return nil
 	}
 	game := &Game{}
-	game.Init(boardType, NewIcelandicTileSet, IcelandicDictionary)
+	game.InitWithOptions(boardType, NewIcelandicTileSet, IcelandicDictionary, options)
+	game.Locale = "is"
 	return game
 }
 
 // NewOspsGame instantiates a new Game with the Polish TileSet
 // and returns a reference to it
 func NewOspsGame(boardType string) *Game {
+	return NewOspsGameWithOptions(boardType, GameOptions{})
+}
+
+// NewOspsGameWithOptions instantiates a new Game as NewOspsGame
+// does, using the given options
+func NewOspsGameWithOptions(boardType string, options GameOptions) *Game {
 	if OspsDictionary == nil {
 		// Unable to read Polish (OSPS37) DAWG
 		return nil
 	}
 	game := &Game{}
-	game.Init(boardType, PolishTileSet, OspsDictionary)
+	game.InitWithOptions(boardType, PolishTileSet, OspsDictionary, options)
+	game.Locale = "pl"
 	return game
 }
 
 // NewNorwegianBokmålGame instantiates a new Game with the
 // Norwegian (Bokmål) TileSet and returns a reference to it
 func NewNorwegianBokmålGame(boardType string) *Game {
+	return NewNorwegianBokmålGameWithOptions(boardType, GameOptions{})
+}
+
+// NewNorwegianBokmålGameWithOptions instantiates a new Game as NewNorwegianBokmålGame
+// does, using the given options
+func NewNorwegianBokmålGameWithOptions(boardType string, options GameOptions) *Game {
 	if NorwegianBokmålDictionary == nil {
 		// Unable to read Norwegian (Bokmål) DAWG
 		return nil
 	}
 	game := &Game{}
-	game.Init(boardType, NorwegianTileSet, NorwegianBokmålDictionary)
+	game.InitWithOptions(boardType, NorwegianTileSet, NorwegianBokmålDictionary, options)
+	game.Locale = "nb"
 	return game
 }
 
 // NewNorwegianNynorskGame instantiates a new Game with the
 // Norwegian (Nynorsk) TileSet and returns a reference to it
 func NewNorwegianNynorskGame(boardType string) *Game {
+	return NewNorwegianNynorskGameWithOptions(boardType, GameOptions{})
+}
+
+// NewNorwegianNynorskGameWithOptions instantiates a new Game as NewNorwegianNynorskGame
+// does, using the given options
+func NewNorwegianNynorskGameWithOptions(boardType string, options GameOptions) *Game {
 	if NorwegianNynorskDictionary == nil {
 		// Unable to read Norwegian (Nynorsk) DAWG
 		return nil
 	}
 	game := &Game{}
-	game.Init(boardType, NorwegianTileSet, NorwegianNynorskDictionary)
+	game.InitWithOptions(boardType, NorwegianTileSet, NorwegianNynorskDictionary, options)
+	game.Locale = "nn"
 	return game
 }
 
@@ -144,6 +320,12 @@ func NewNorwegianNynorskGame(boardType string) *Game {
 // English ('standard' board type) or New English ('explo' board type)
 // TileSet, and returns a reference to it
 func NewOtcwlGame(boardType string) *Game {
+	return NewOtcwlGameWithOptions(boardType, GameOptions{})
+}
+
+// NewOtcwlGameWithOptions instantiates a new Game as NewOtcwlGame
+// does, using the given options
+func NewOtcwlGameWithOptions(boardType string, options GameOptions) *Game {
 	if OtcwlDictionary == nil {
 		// Unable to read OTCWL2014 DAWG
 		return nil
@@ -155,7 +337,8 @@ func NewOtcwlGame(boardType string) *Game {
 	} else {
 		tileSet = EnglishTileSet
 	}
-	game.Init(boardType, tileSet, OtcwlDictionary)
+	game.InitWithOptions(boardType, tileSet, OtcwlDictionary, options)
+	game.Locale = "en_US"
 	return game
 }
 
@@ -163,6 +346,12 @@ func NewOtcwlGame(boardType string) *Game {
 // English ('standard' board type) or New English ('explo' board type)
 // TileSet, and returns a reference to it
 func NewSowpodsGame(boardType string) *Game {
+	return NewSowpodsGameWithOptions(boardType, GameOptions{})
+}
+
+// NewSowpodsGameWithOptions instantiates a new Game as NewSowpodsGame
+// does, using the given options
+func NewSowpodsGameWithOptions(boardType string, options GameOptions) *Game {
 	if SowpodsDictionary == nil {
 		// Unable to read SOWPODS DAWG
 		return nil
@@ -174,10 +363,59 @@ func NewSowpodsGame(boardType string) *Game {
 	} else {
 		tileSet = EnglishTileSet
 	}
-	game.Init(boardType, tileSet, SowpodsDictionary)
+	game.InitWithOptions(boardType, tileSet, SowpodsDictionary, options)
+	game.Locale = "en"
+	return game
+}
+
+// NewGameForLocale instantiates a new Game with the dictionary and
+// TileSet registered for the given locale in the Locales registry,
+// or those of its fallback locale or the DefaultLocale if the locale
+// is not found there (cf. LocaleRegistry.Resolve()), and returns a
+// reference to it. It returns nil if the locale's dictionary is
+// excluded from the build.
+func NewGameForLocale(locale string, boardType string) *Game {
+	return NewGameForLocaleWithOptions(locale, boardType, GameOptions{})
+}
+
+// NewGameForLocaleWithOptions instantiates a new Game as NewGameForLocale
+// does, using the given options
+func NewGameForLocaleWithOptions(locale string, boardType string, options GameOptions) *Game {
+	dawg, tileSet := decodeLocale(locale, boardType)
+	if dawg == nil {
+		return nil
+	}
+	game := &Game{}
+	game.InitWithOptions(boardType, tileSet, dawg, options)
+	game.Locale = locale
 	return game
 }
 
+// NewCustomGame instantiates a new Game with the given board type,
+// dictionary and tile set, which can be made with NewTileSet().
+// The game has no locale, so its serialized form cannot be
+// deserialized using the standard dictionaries.
+func NewCustomGame(boardType string, dawg *Dawg, tileSet *TileSet) (*Game, error) {
+	return NewCustomGameWithOptions(boardType, dawg, tileSet, GameOptions{})
+}
+
+// NewCustomGameWithOptions instantiates a new Game as NewCustomGame
+// does, using the given options
+func NewCustomGameWithOptions(boardType string, dawg *Dawg, tileSet *TileSet, options GameOptions) (*Game, error) {
+	if !IsValidBoardType(boardType) {
+		return nil, fmt.Errorf("unknown board type '%v'", boardType)
+	}
+	if dawg == nil {
+		return nil, fmt.Errorf("no dictionary given")
+	}
+	if tileSet == nil || tileSet.Size < 2*options.rackSize() {
+		return nil, fmt.Errorf("invalid tile set")
+	}
+	game := &Game{}
+	game.InitWithOptions(boardType, tileSet, dawg, options)
+	return game, nil
+}
+
 func NewState(dawg *Dawg, tileSet *TileSet, board *Board, rack *Rack, exchangeForbidden bool) *GameState {
 	return &GameState{
 		Dawg:              dawg,
@@ -188,18 +426,203 @@ func NewState(dawg *Dawg, tileSet *TileSet, board *Board, rack *Rack, exchangeFo
 	}
 }
 
+// RackSize returns the number of slots in the rack of the player
+// to move, or the default RackSize if the state has no rack
+func (state *GameState) RackSize() int {
+	if state.Rack == nil {
+		return RackSize
+	}
+	return state.Rack.Size()
+}
+
 // State returns a new GameState instance describing the state of the
 // game in a minimal manner so that a robot player can decide on a move
 func (game *Game) State() *GameState {
 	player := game.PlayerToMove()
-	exchangeForbidden := game.Bag.TileCount() < RackSize
-	return NewState(
+	exchangeForbidden := !game.Bag.ExchangeAllowedFor(game.RackSize)
+	state := NewState(
 		game.Dawg,
 		game.TileSet,
 		&game.Board,
 		&game.Racks[player],
 		exchangeForbidden,
 	)
+	unseen := game.Racks[1-player].AsRunes()
+	for _, tile := range game.Bag.Contents {
+		unseen = append(unseen, tile.Letter)
+	}
+	state.Unseen = unseen
+	state.Rules = game.Rules
+	return state
+}
+
+// UnseenTiles returns the tiles that the given player cannot see, i.e.
+// the tiles in the bag and in the opponent's rack, as a map of letters
+// ('?' for blank tiles) to counts. This is the pool from which the
+// opponent's rack and the player's future draws come. In a normal
+// game, it equals the tile set minus the tiles on the board and in
+// the player's own rack; it also reflects SetBagContents().
+func (game *Game) UnseenTiles(forPlayer int) map[rune]int {
+	unseen := game.Bag.Distribution()
+	for _, letter := range game.Racks[1-forPlayer].AsRunes() {
+		unseen[letter]++
+	}
+	return unseen
+}
+
+// DealPlausibleRack returns a rack for the opponent of the given player,
+// dealt at random from the tiles that the player cannot see, cf.
+// UnseenTiles(). This allows the opponent's rack to be modeled, e.g. in
+// simulations, without peeking at the actual rack. The rack is filled
+// up to the game's rack size, or with all the unseen tiles if there
+// are fewer. If rng is nil, the global random source is used. The
+// racks and the bag of the game are not modified.
+func (game *Game) DealPlausibleRack(forOpponentOf int, rng *rand.Rand) *Rack {
+	unseen := game.UnseenTiles(forOpponentOf)
+	// Sort the pool, so that the deal depends only on the random source
+	letters := make([]rune, 0, len(unseen))
+	for letter := range unseen {
+		letters = append(letters, letter)
+	}
+	slices.Sort(letters)
+	pool := make([]rune, 0, 2*len(letters))
+	for _, letter := range letters {
+		for i := 0; i < unseen[letter]; i++ {
+			pool = append(pool, letter)
+		}
+	}
+	shuffle := rand.Shuffle
+	if rng != nil {
+		shuffle = rng.Shuffle
+	}
+	shuffle(len(pool), func(i, j int) {
+		pool[i], pool[j] = pool[j], pool[i]
+	})
+	return NewRackWithSize(game.RackSize, pool[:min(game.RackSize, len(pool))], game.TileSet)
+}
+
+// LastMoveChanges returns the board squares changed by the last move
+// in the game, in row and column order, or nil if the last move was
+// not a tile move. Apart from the final adjustments when the game is
+// over, this is the Diff() between the board before and after the move.
+func (game *Game) LastMoveChanges() []SquareChange {
+	last := game.lastMoveIndex()
+	if last < 0 {
+		return nil
+	}
+	move, ok := game.MoveList[last].Move.(*TileMove)
+	if !ok {
+		return nil
+	}
+	changes := make([]SquareChange, 0, len(move.Covers))
+	for coord := range move.Covers {
+		changes = append(changes, SquareChange{
+			Row:    coord.Row,
+			Col:    coord.Col,
+			Before: '.',
+			After:  tileRune(game.Board.TileAt(coord.Row, coord.Col)),
+		})
+	}
+	slices.SortFunc(changes, func(a, b SquareChange) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+		return a.Col - b.Col
+	})
+	return changes
+}
+
+// Clone returns a deep copy of the Game, with its own board, racks,
+// bag and tiles, so that moves can be made in the copy without
+// affecting the original. The order of the tiles in the bag is
+// preserved. The clone draws its tiles from a random source of its
+// own, derived from the state of the original's source without
+// drawing from it: the draws of the original are unchanged, those of
+// the clone are independent of them, and clones made at the same
+// point of a seeded game draw the same tiles. The Dawg and TileSet
+// are shared, as are the moves in the move list, since they are not
+// modified once made.
+func (game *Game) Clone() *Game {
+	return game.clone(false)
+}
+
+// CloneWithSameDraws returns a deep copy of the Game, as Clone()
+// does, except that the clone draws the same tiles as the original
+// would. The original's random source is copied, not drawn from.
+func (game *Game) CloneWithSameDraws() *Game {
+	return game.clone(true)
+}
+
+// clone returns a deep copy of the Game, whose bag has a copy of the
+// original's random source if sameDraws is true, or otherwise a
+// source derived from it
+func (game *Game) clone(sameDraws bool) *Game {
+	clone := *game
+	// Copy the tiles, mapping each original tile to its copy
+	clone.Bag = &Bag{
+		Tiles:    slices.Clone(game.Bag.Tiles),
+		Contents: make([]*Tile, len(game.Bag.Contents)),
+		forced:   slices.Clone(game.Bag.forced),
+	}
+	if game.Bag.src != nil {
+		if sameDraws {
+			clone.Bag.setSource(game.Bag.src.copy())
+		} else {
+			clone.Bag.setSource(game.Bag.src.derive())
+		}
+	}
+	tileMap := make(map[*Tile]*Tile, len(game.Bag.Tiles))
+	for i := range game.Bag.Tiles {
+		tileMap[&game.Bag.Tiles[i]] = &clone.Bag.Tiles[i]
+	}
+	copyTile := func(tile *Tile) *Tile {
+		if tile == nil {
+			return nil
+		}
+		if t, ok := tileMap[tile]; ok {
+			return t
+		}
+		// A tile that does not belong to the bag
+		t := *tile
+		tileMap[tile] = &t
+		return &t
+	}
+	for i, tile := range game.Bag.Contents {
+		clone.Bag.Contents[i] = copyTile(tile)
+	}
+	// The board was copied by value, but its tiles and its
+	// adjacency matrix must refer to the copy
+	board := &clone.Board
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			sq := board.Sq(row, col)
+			sq.Tile = copyTile(sq.Tile)
+		}
+	}
+	board.initAdjacents()
+	for player := range clone.Racks {
+		rack := &clone.Racks[player]
+		rack.Slots = slices.Clone(rack.Slots)
+		for i := range rack.Slots {
+			rack.Slots[i].Tile = copyTile(rack.Slots[i].Tile)
+		}
+		rack.Content.Tiles = maps.Clone(rack.Content.Tiles)
+		rack.Emptied = slices.Clone(rack.Emptied)
+	}
+	clone.MoveList = make([]*MoveItem, len(game.MoveList), cap(game.MoveList))
+	for i, item := range game.MoveList {
+		itemCopy := *item
+		itemCopy.RackTiles = make([]*Tile, len(item.RackTiles))
+		for slot, tile := range item.RackTiles {
+			itemCopy.RackTiles[slot] = copyTile(tile)
+		}
+		clone.MoveList[i] = &itemCopy
+	}
+	if game.Clock != nil {
+		clock := *game.Clock
+		clone.Clock = &clock
+	}
+	return &clone
 }
 
 // TileAt is a convenience function for returning the Tile at
@@ -218,18 +641,19 @@ func (game *Game) PlayTile(tile *Tile, row, col int) bool {
 		// No such square or already occupied
 		return false
 	}
+	if tile.Letter != '?' {
+		tile.Meaning = tile.Letter
+	}
+	if !game.Dawg.alphabet.Contains(tile.Meaning) {
+		// Tile must have an associated meaning when played,
+		// which must be a letter of the game's alphabet
+		return false
+	}
 	playerToMove := game.PlayerToMove()
 	if !game.Racks[playerToMove].RemoveTile(tile) {
 		// This tile isn't in the rack
 		return false
 	}
-	if tile.Meaning == '?' {
-		// Tile must have an associated meaning when played
-		return false
-	}
-	if tile.Letter != '?' {
-		tile.Meaning = tile.Letter
-	}
 	tile.PlayedBy = playerToMove
 	return game.Board.PlaceTile(row, col, tile)
 }
@@ -240,12 +664,43 @@ func (game *Game) TilesOnBoard() int {
 	return game.Board.NumTiles
 }
 
+// RemainingTileScore returns the sum of the scores of the tiles
+// that are not yet on the board, i.e. the tiles in the bag and
+// in both racks, with blank tiles counting as 0
+func (game *Game) RemainingTileScore() int {
+	total := 0
+	addTile := func(tile *Tile) {
+		if tile != nil && tile.Letter != '?' {
+			total += tile.Score
+		}
+	}
+	for _, tile := range game.Bag.Contents {
+		addTile(tile)
+	}
+	for i := range game.Racks {
+		for _, sq := range game.Racks[i].Slots {
+			addTile(sq.Tile)
+		}
+	}
+	return total
+}
+
 // SetPlayerNames sets the names of the two players
 func (game *Game) SetPlayerNames(player0, player1 string) {
 	game.PlayerNames[0] = player0
 	game.PlayerNames[1] = player1
 }
 
+// RackLayout returns the letters of the tiles in the given player's
+// rack, in slot order, with 0 for empty slots, so that a client can
+// render the rack as the player has arranged it
+func (game *Game) RackLayout(player int) []rune {
+	if player < 0 || player > 1 {
+		return nil
+	}
+	return game.Racks[player].Layout()
+}
+
 // PlayerToMove returns 0 or 1 depending on which player's move it is
 func (game *Game) PlayerToMove() int {
 	return len(game.MoveList) % 2
@@ -263,7 +718,7 @@ func (game *Game) ForceRack(player int, letters string) bool {
 	}
 	rack := &game.Racks[player]
 	// Return all tiles from the Rack to the Bag
-	for i := 0; i < RackSize; i++ {
+	for i := range rack.Slots {
 		if tile := rack.Slots[i].Tile; tile != nil {
 			if !rack.RemoveTile(tile) {
 				// Weird, should not happen
@@ -276,25 +731,102 @@ func (game *Game) ForceRack(player int, letters string) bool {
 	return rack.FillByLetters(game.Bag, []rune(letters))
 }
 
+// SetBagContents replaces the contents of the bag with exactly the
+// tiles given by letters ('?' for blank tiles), which must be found
+// among the tiles of the tile set that are neither on the board nor
+// in the racks. Tiles that are not put in the bag are out of the game.
+// This complements ForceRack() when setting up specific positions,
+// e.g. for puzzles and tests. An error is returned, and the bag is
+// left unchanged, if a letter is not in the tile set or there are
+// not enough tiles of a letter available.
+func (game *Game) SetBagContents(letters string) error {
+	// Collect the tiles that are in play, on the board or in the racks
+	inPlay := make(map[*Tile]bool)
+	available := make(map[rune]int)
+	for _, tile := range game.TileSet.Tiles {
+		available[tile.Letter]++
+	}
+	for row := 0; row < game.Board.Size; row++ {
+		for col := 0; col < game.Board.Size; col++ {
+			if tile := game.Board.TileAt(row, col); tile != nil {
+				inPlay[tile] = true
+				available[tile.Letter]--
+			}
+		}
+	}
+	for player := range game.Racks {
+		for _, sq := range game.Racks[player].Slots {
+			if sq.Tile != nil {
+				inPlay[sq.Tile] = true
+				available[sq.Tile.Letter]--
+			}
+		}
+	}
+	// Check the requested letters against the available tiles
+	for _, letter := range letters {
+		if !game.TileSet.Contains(letter) {
+			return fmt.Errorf("letter '%c' is not in the tile set", letter)
+		}
+		if available[letter]--; available[letter] < 0 {
+			return fmt.Errorf("not enough '%c' tiles available", letter)
+		}
+	}
+	// Pick the tiles from those that are not in play
+	contents := make([]*Tile, 0, len(letters))
+	picked := make(map[*Tile]bool)
+	for _, letter := range letters {
+		for i := range game.Bag.Tiles {
+			tile := &game.Bag.Tiles[i]
+			if tile.Letter == letter && !inPlay[tile] && !picked[tile] {
+				picked[tile] = true
+				tile.Meaning = tile.Letter
+				tile.PlayedBy = 0
+				contents = append(contents, tile)
+				break
+			}
+		}
+	}
+	if len(contents) != len([]rune(letters)) {
+		// The bag does not hold all the tiles of the tile set,
+		// as in games that are reconstructed from a GameState
+		return fmt.Errorf("unable to find the tiles in the bag")
+	}
+	game.Bag.Contents = contents
+	game.Bag.forced = nil
+	return nil
+}
+
 // MakePassMove appends a pass move to the Game's move list
 func (game *Game) MakePassMove() bool {
 	return game.Apply(NewPassMove())
 }
 
+// Resign makes the player whose move it is resign the game,
+// cf. ResignMove. Returns false if the game is already over.
+func (game *Game) Resign() bool {
+	return game.Apply(NewResignMove())
+}
+
 // MakeTileMove creates a tile move and appends it to the Game's move list
 func (game *Game) MakeTileMove(row, col int, horizontal bool, tiles []*Tile) bool {
 	// Basic sanity checks
-	if row < 0 || row >= BoardSize || col < 0 || col >= BoardSize ||
-		len(tiles) < 1 || len(tiles) > RackSize {
+	size := game.Board.Size
+	if row < 0 || row >= size || col < 0 || col >= size ||
+		len(tiles) < 1 || len(tiles) > game.RackSize {
 		return false
 	}
-	// Check that the played tiles are actually in the player's rack
+	// Check that the played tiles are actually in the player's rack,
+	// and that no tile is played twice
 	rack := &game.Racks[game.PlayerToMove()]
-	for _, tile := range tiles {
+	for i, tile := range tiles {
 		if !rack.HasTile(tile) {
 			// This tile isn't in the player's rack
 			return false
 		}
+		if slices.Contains(tiles[:i], tile) {
+			// The same tile appears more than once
+			return false
+		}
 	}
 	// A tile move must start at an empty square
 	if game.TileAt(row, col) != nil {
@@ -308,7 +840,7 @@ func (game *Game) MakeTileMove(row, col int, horizontal bool, tiles []*Tile) boo
 	}
 	covers := make(Covers)
 	for _, tile := range tiles {
-		if row >= BoardSize || col >= BoardSize {
+		if row >= size || col >= size {
 			// Gone off the board
 			return false
 		}
@@ -316,7 +848,7 @@ func (game *Game) MakeTileMove(row, col int, horizontal bool, tiles []*Tile) boo
 			// Occupied square: try the next one
 			row += rowInc
 			col += colInc
-			if row >= BoardSize || col >= BoardSize {
+			if row >= size || col >= size {
 				// Gone off the edge of the board
 				return false
 			}
@@ -335,6 +867,124 @@ func (game *Game) MakeTileMove(row, col int, horizontal bool, tiles []*Tile) boo
 	return game.Apply(move)
 }
 
+// ParseMove parses a move typed by a human player, for the player
+// whose move it is. The move can be "PASS", "EXCH" followed by the
+// letters to exchange (with '?' for a blank tile), or a coordinate as
+// returned by TileMove.Coordinate() followed by a word, for instance
+// "H8 hello". Tiles that are already on the board are included in the
+// word, or written as '.'. Uppercase letters within a word denote blank
+// tiles and their meanings, as in "H8 heLlo", unless the entire word is
+// in uppercase, which is taken as all normal tiles. A blank tile can
+// also be written as '?' followed by its meaning, as in TileMove.String().
+// The tiles must be in the player's rack. The move is not validated
+// further; call Apply() to do that and make the move.
+func (game *Game) ParseMove(s string) (Move, error) {
+	rack := game.Racks[game.PlayerToMove()].AsRunes()
+	return parseMove(s, &game.Board, rack, game.ValidateWords)
+}
+
+// ParseMove parses a move as Game.ParseMove() does, given the
+// board and rack of the GameState. Words formed by a tile move
+// are validated when it is checked, cf. IsValidTileMove().
+func (state *GameState) ParseMove(s string) (Move, error) {
+	return parseMove(s, state.Board, state.Rack.AsRunes(), true)
+}
+
+// parseMove parses a move typed by a human player, cf. Game.ParseMove(),
+// given the board and the tiles in the player's rack
+func parseMove(s string, board *Board, rack []rune, validateWords bool) (Move, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty move")
+	}
+	// Remove the given tiles from a copy of the rack,
+	// returning false if any of them is missing
+	takeFromRack := func(letters []rune) bool {
+		remaining := rack
+		for _, letter := range letters {
+			if !ContainsRune(remaining, letter) {
+				return false
+			}
+			remaining = RemoveRune(remaining, letter)
+		}
+		return true
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "PASS":
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("a pass move takes no letters")
+		}
+		return NewPassMove(), nil
+	case "EXCH":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("an exchange move needs the letters to exchange")
+		}
+		letters := strings.ToLower(fields[1])
+		if !takeFromRack([]rune(letters)) {
+			return nil, fmt.Errorf("the letters '%v' are not in the rack", letters)
+		}
+		return NewExchangeMove(letters), nil
+	}
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("a tile move needs a coordinate and a word")
+	}
+	row, col, horizontal, ok := parseCoordinate(fields[0])
+	if !ok || board.Sq(row, col) == nil {
+		return nil, fmt.Errorf("invalid coordinate '%v'", fields[0])
+	}
+	word := []rune(fields[1])
+	allUpper := strings.ToUpper(fields[1]) == fields[1]
+	covers := make(Covers)
+	letters := make([]rune, 0, len(rack))
+	for i := 0; i < len(word); i++ {
+		letter, blank := word[i], false
+		if letter == '?' && i+1 < len(word) {
+			// A blank tile, followed by its meaning
+			i++
+			letter, blank = word[i], true
+		} else if unicode.IsUpper(letter) && !allUpper {
+			blank = true
+		}
+		meaning := unicode.ToLower(letter)
+		sq := board.Sq(row, col)
+		if sq == nil {
+			return nil, fmt.Errorf("the word '%v' does not fit on the board", fields[1])
+		}
+		if sq.Tile != nil {
+			// A tile that is already on the board
+			if letter != '.' && meaning != sq.Tile.Meaning {
+				return nil, fmt.Errorf(
+					"'%c' does not match the tile at %v%v",
+					letter, rowIds[row], colIds[col],
+				)
+			}
+		} else if letter == '.' {
+			return nil, fmt.Errorf("no tile at %v%v", rowIds[row], colIds[col])
+		} else if blank {
+			covers[Coordinate{row, col}] = Cover{'?', meaning}
+			letters = append(letters, '?')
+		} else {
+			covers[Coordinate{row, col}] = Cover{meaning, meaning}
+			letters = append(letters, meaning)
+		}
+		if horizontal {
+			col++
+		} else {
+			row++
+		}
+	}
+	if len(covers) == 0 {
+		return nil, fmt.Errorf("the move does not place any tiles")
+	}
+	if !takeFromRack(letters) {
+		return nil, fmt.Errorf("the tiles '%v' are not in the rack", string(letters))
+	}
+	if validateWords {
+		return NewTileMove(board, covers), nil
+	}
+	return NewUncheckedTileMove(board, covers), nil
+}
+
 // ApplyValid applies an already validated Move to a Game,
 // appends it to the move list, replenishes the player's Rack
 // if needed, and updates scores.
@@ -348,59 +998,183 @@ func (game *Game) ApplyValid(move Move) bool {
 	playerToMove := game.PlayerToMove()
 	rack := &game.Racks[playerToMove]
 	rackBefore := rack.AsString()
+	rackTiles := rack.tiles()
+	numPassMoves := game.NumPassMoves
+	// Score the move before applying it, while the squares that it
+	// covers are still empty. The state is built once per move, and
+	// also serves to score the final moves, which only need its tile set.
+	state := game.State()
+	score := move.Score(state)
 	if !move.Apply(game) {
 		// Not valid! Should not happen...
 		return false
 	}
-	// Update the scores and append to the move list
-	game.acceptMove(rackBefore, move)
-	// Replenish the player's rack, as needed
+	// Update the scores and append to the move list,
+	// remembering what we need to undo the move
+	item := game.acceptMove(rackBefore, move, score)
+	item.RackTiles = rackTiles
+	item.NumPassMoves = numPassMoves
+	// Replenish the player's rack, as needed. If the bag runs out,
+	// the player continues with a partial rack, and the game is over
+	// once a move empties the rack (cf. IsOver()).
+	// The slots emptied by the move are refilled first, so that the
+	// other tiles stay in their slots; any slots that were empty
+	// before the move are then filled as well.
+	rack.FillPreservingOrder(game.Bag)
 	rack.Fill(game.Bag)
-	if game.IsOver() {
+	// Note which tiles were drawn from the bag
+	drawn := make([]rune, 0, game.RackSize)
+	for _, sq := range rack.Slots {
+		if sq.Tile != nil && !slices.Contains(rackTiles, sq.Tile) {
+			drawn = append(drawn, sq.Tile.Letter)
+		}
+	}
+	item.Drawn = string(drawn)
+	if game.Resigned {
+		// The resigning player loses the value of the remaining
+		// tiles, while the opponent's score is unchanged
+		game.EndTurn()
+		rackThis := game.Racks[playerToMove].AsString()
+		rackOpp := game.Racks[1-playerToMove].AsString()
+		finalOpp := game.finalMove(1-playerToMove, "", 1)
+		game.acceptMove(rackOpp, finalOpp, finalOpp.Score(state))
+		finalThis := game.finalMove(playerToMove, rackThis, -1)
+		game.acceptMove(rackThis, finalThis, finalThis.Score(state))
+	} else if game.IsOver() {
 		// The game is now over: add the FinalMoves
+		game.EndTurn()
 		rackThis := game.Racks[playerToMove].AsString()
 		rackOpp := game.Racks[1-playerToMove].AsString()
 		var multiplyFactor = 2
-		if len(rackThis) > 0 {
+		if len(rackThis) > 0 || !scoringRules(game.Rules).FinalRackDoubling {
 			// The game is not finishing by the final player
-			// completing his rack: both players then get the
+			// completing his rack, or the rules don't double
+			// the rack leave: both players then get the
 			// opponent's remaining tile scores
 			multiplyFactor = 1
 		}
 		// Add a final move for the opponent
 		// (which in most cases yields zero points, since
 		// the finishing player has no tiles left)
-		finalOpp := NewFinalMove(rackThis, multiplyFactor)
-		game.acceptMove(rackOpp, finalOpp)
+		finalOpp := game.finalMove(1-playerToMove, rackThis, multiplyFactor)
+		game.acceptMove(rackOpp, finalOpp, finalOpp.Score(state))
 		// Add a final move for the finishing player
 		// (which in most cases yields double the tile scores
 		// of the opponent's rack)
-		finalThis := NewFinalMove(rackOpp, multiplyFactor)
-		game.acceptMove(rackThis, finalThis)
+		finalThis := game.finalMove(playerToMove, rackOpp, multiplyFactor)
+		game.acceptMove(rackThis, finalThis, finalThis.Score(state))
 	}
 	return true
 }
 
-// acceptMove updates the scores and appends a given Move
-// to the Game's MoveList
-func (game *Game) acceptMove(rackBefore string, move Move) {
-	// Calculate the score
+// finalMove returns the FinalMove for the given player at the end
+// of the game, including the player's overtime penalty, if any
+func (game *Game) finalMove(player int, rackOpp string, multiplyFactor int) *FinalMove {
+	move := NewFinalMove(rackOpp, multiplyFactor)
+	move.TimePenalty = game.Clock.OvertimePenalty(player)
+	return move
+}
+
+// acceptMove updates the scores and appends a given Move,
+// with its score, to the Game's MoveList, returning the new MoveItem
+func (game *Game) acceptMove(rackBefore string, move Move, score int) *MoveItem {
 	if game == nil || move == nil {
-		return
+		return nil
 	}
-	score := move.Score(game.State())
 	// Update the player's score
 	game.Scores[game.PlayerToMove()] += score
 	// Append to the move list
-	moveItem := &MoveItem{RackBefore: rackBefore, Move: move}
+	moveItem := &MoveItem{
+		RackBefore:   rackBefore,
+		Move:         move,
+		Score:        score,
+		NumPassMoves: game.NumPassMoves,
+	}
 	game.MoveList = append(game.MoveList, moveItem)
+	return moveItem
+}
+
+// popMove removes the last MoveItem from the Game's MoveList,
+// subtracts its score and restores the count of consecutive
+// zero-point moves. It returns the removed MoveItem.
+func (game *Game) popMove() *MoveItem {
+	last := len(game.MoveList) - 1
+	item := game.MoveList[last]
+	game.MoveList = game.MoveList[0:last]
+	game.Scores[game.PlayerToMove()] -= item.Score
+	// Give the challenger back the points lost in an
+	// unsuccessful challenge of the move, if any
+	game.Scores[1-game.PlayerToMove()] += item.ChallengePenalty
+	game.NumPassMoves = item.NumPassMoves
+	return item
+}
+
+// UndoLastMove takes back the last move made in the Game. Tiles
+// laid down on the board are returned to the player's rack, tiles
+// drawn from the bag are returned to it, and the scores are restored.
+// If the last move ended the game, the final adjustments are undone
+// as well. Returns false if there is no move to undo.
+func (game *Game) UndoLastMove() bool {
+	if game == nil {
+		return false
+	}
+	// Remove the final adjustment moves, if the game is over
+	for len(game.MoveList) > 0 {
+		if _, ok := game.MoveList[len(game.MoveList)-1].Move.(*FinalMove); !ok {
+			break
+		}
+		game.popMove()
+	}
+	if len(game.MoveList) == 0 {
+		// Nothing to undo
+		return false
+	}
+	item := game.popMove()
+	if _, ok := item.Move.(*ResignMove); ok {
+		game.Resigned = false
+		game.Resigner = 0
+	}
+	rack := &game.Racks[game.PlayerToMove()]
+	if tileMove, ok := item.Move.(*TileMove); ok {
+		// Lift the tiles of the move off the board
+		for coord := range tileMove.Covers {
+			if tile := game.Board.RemoveTile(coord.Row, coord.Col); tile != nil {
+				tile.Meaning = tile.Letter
+				tile.PlayedBy = 0
+			}
+		}
+	}
+	// Tiles that were in the rack before the move, and are
+	// now in the bag, were exchanged: take them out again
+	for _, tile := range item.RackTiles {
+		if tile != nil && !rack.HasTile(tile) {
+			game.Bag.removeTile(tile)
+		}
+	}
+	// Tiles that are now in the rack but were not before the move
+	// were drawn from the bag: return them to it
+	for _, sq := range rack.Slots {
+		if sq.Tile != nil && !slices.Contains(item.RackTiles, sq.Tile) {
+			game.Bag.ReturnTile(sq.Tile)
+		}
+	}
+	rack.setTiles(item.RackTiles)
+	return true
 }
 
-// Apply applies a move to the game, after validating it
+// Apply applies a move to the game, after validating it.
+// No moves can be applied once the game is over.
 func (game *Game) Apply(move Move) bool {
 	if game == nil || move == nil {
 		return false
 	}
+	if n := len(game.MoveList); n > 0 {
+		if _, ok := game.MoveList[n-1].Move.(*FinalMove); ok {
+			// The game is over and the final adjustments
+			// have been made: no more moves
+			return false
+		}
+	}
 	if !move.IsValid(game) {
 		// Not valid!
 		return false
@@ -408,6 +1182,30 @@ func (game *Game) Apply(move Move) bool {
 	return game.ApplyValid(move)
 }
 
+// ValidateMove returns nil if the move can be applied to the game by
+// the player to move, or otherwise a MoveError describing why not.
+// In addition to the checks made by Apply(), the tiles of a tile move
+// must be in the player's rack. As in Apply(), the words formed by a
+// tile move are only checked if its ValidateWords field is set.
+func (game *Game) ValidateMove(move Move) *MoveError {
+	if game == nil || move == nil {
+		return newMoveError(InvalidMove, "no move")
+	}
+	if game.IsOver() {
+		return newMoveError(GameOver, "the game is over")
+	}
+	switch m := move.(type) {
+	case *TileMove:
+		return game.State().ValidateTileMove(m)
+	case *ExchangeMove:
+		return m.validate(game)
+	}
+	if !move.IsValid(game) {
+		return newMoveError(InvalidMove, "the move is not valid")
+	}
+	return nil
+}
+
 // IsOver returns true if the Game is over after the last
 // move played
 func (game *Game) IsOver() bool {
@@ -416,7 +1214,9 @@ func (game *Game) IsOver() bool {
 		// No moves yet: cannot be over
 		return false
 	}
-	// TODO: Check for resignation
+	if game.Resigned {
+		return true
+	}
 	if game.NumPassMoves == 6 {
 		// Six consecutive zero-point moves
 		// (e.g. three rounds of passes) finish the game
@@ -427,6 +1227,50 @@ func (game *Game) IsOver() bool {
 	return game.Racks[lastPlayer].IsEmpty()
 }
 
+// OverReason returns the reason why the Game is over,
+// or NotOver if it is still in progress
+func (game *Game) OverReason() OverReason {
+	if !game.IsOver() {
+		return NotOver
+	}
+	if game.Resigned {
+		// Find the ResignMove, skipping the final adjustments
+		for i := len(game.MoveList) - 1; i >= 0; i-- {
+			if move, ok := game.MoveList[i].Move.(*ResignMove); ok {
+				if move.TimeForfeit {
+					return TimeForfeit
+				}
+				break
+			}
+		}
+		return Resignation
+	}
+	if game.NumPassMoves == 6 {
+		return SixZeroMoves
+	}
+	return RackEmpty
+}
+
+// Winner returns the index of the player who won the Game, and true,
+// or false if the game is still in progress or ended in a draw.
+// A player who resigned or lost on time never wins, regardless
+// of the scores.
+func (game *Game) Winner() (int, bool) {
+	if !game.IsOver() {
+		return 0, false
+	}
+	if game.Resigned {
+		return 1 - game.Resigner, true
+	}
+	switch {
+	case game.Scores[0] > game.Scores[1]:
+		return 0, true
+	case game.Scores[1] > game.Scores[0]:
+		return 1, true
+	}
+	return 0, false
+}
+
 // String returns a string representation of a Game
 func (game *Game) String() string {
 	var sb strings.Builder
@@ -446,12 +1290,16 @@ func (game *Game) String() string {
 		sb.WriteString("Moves:\n")
 		for i, item := range game.MoveList {
 			m := item.Move
+			desc := fmt.Sprint(m)
+			if item.Challenged {
+				desc += " (challenged)"
+			}
 			if i%2 == 0 {
 				// Left side player
-				sb.WriteString(fmt.Sprintf("  %2d: (%v) %v", (i/2)+1, m.Score(state), m))
+				sb.WriteString(fmt.Sprintf("  %2d: (%v) %v", (i/2)+1, m.Score(state), desc))
 			} else {
 				// Right side player
-				sb.WriteString(fmt.Sprintf(" / %v (%v)\n", m, m.Score(state)))
+				sb.WriteString(fmt.Sprintf(" / %v (%v)\n", desc, m.Score(state)))
 			}
 		}
 		if len(game.MoveList)%2 == 1 {
@@ -0,0 +1,457 @@
+// gcg.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements reading and writing of game records
+// in the GCG format.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+/*
+
+A GCG file contains pragmas, such as "#player1 nick Full Name", and
+one line per move, of the form ">nick: RACK COORD WORD +score total".
+Uppercase letters in words denote normal tiles and lowercase letters
+denote blank tiles, while '?' denotes a blank tile in a rack. Tiles
+that are already on the board are shown as themselves or as '.'.
+Exchanges are written as "-LETTERS" (or "-N" if the exchanged tiles
+are not known), passes as "-", and phonies that have been withdrawn
+after a challenge as "--".
+
+Coordinates follow the convention of TileMove.Coordinate(): rows are
+identified by letters and columns by numbers, and a coordinate starting
+with a row letter ("H8") denotes a horizontal move while one starting
+with a column number ("8H") denotes a vertical move. This is the
+transpose of the convention in most GCG files, which number the rows
+and letter the columns, but since the boards are symmetric, the moves
+and their scores are the same.
+
+*/
+
+package skrafl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parseGCGTileMove creates a TileMove from a GCG coordinate and
+// word, walking from the start coordinate in the direction of the
+// move and distinguishing between new tiles and tiles that are
+// already on the board. If validateWords is true, the words formed
+// by the move are checked against the dictionary when it is validated.
+func parseGCGTileMove(board *Board, coord, word string, validateWords bool) (*TileMove, error) {
+	row, col, horizontal, ok := parseCoordinate(coord)
+	if !ok {
+		return nil, fmt.Errorf("invalid coordinate '%v'", coord)
+	}
+	covers := make(Covers)
+	inParens := false
+	for _, letter := range word {
+		switch letter {
+		case '(':
+			inParens = true
+			continue
+		case ')':
+			inParens = false
+			continue
+		}
+		sq := board.Sq(row, col)
+		if sq == nil {
+			return nil, fmt.Errorf("word '%v' does not fit on the board", word)
+		}
+		if sq.Tile != nil {
+			// Playing through a tile that is already on the board
+			if letter != '.' && unicode.ToLower(letter) != sq.Tile.Meaning {
+				return nil, fmt.Errorf(
+					"letter '%c' does not match the tile on the board at %v%v",
+					letter, rowIds[row], colIds[col],
+				)
+			}
+		} else if letter == '.' || inParens {
+			return nil, fmt.Errorf(
+				"no tile on the board at %v%v", rowIds[row], colIds[col],
+			)
+		} else if unicode.IsLower(letter) {
+			// Lowercase letters denote blank tiles
+			covers[Coordinate{row, col}] = Cover{'?', letter}
+		} else {
+			letter = unicode.ToLower(letter)
+			covers[Coordinate{row, col}] = Cover{letter, letter}
+		}
+		if horizontal {
+			col++
+		} else {
+			row++
+		}
+	}
+	if len(covers) == 0 {
+		return nil, fmt.Errorf("word '%v' does not cover any square", word)
+	}
+	if validateWords {
+		return NewTileMove(board, covers), nil
+	}
+	return NewUncheckedTileMove(board, covers), nil
+}
+
+// ParseMoveNotation parses a move in GCG notation for the player whose
+// move it is in the game, as parseGCGMove() describes. Note that blank
+// tiles are written in lowercase, following the GCG convention, which
+// is the opposite of the convention of Game.ParseMove(): "H4 bÍLAR"
+// here is the same move as "H4 Bílar" there. The move is not validated
+// further; call Apply() to do that and make the move.
+func ParseMoveNotation(game *Game, notation string) (Move, error) {
+	return parseGCGMove(game, notation, game.ValidateWords)
+}
+
+// parseGCGMove parses a move in GCG notation for the player whose
+// move it is in the game. The move can be "-" for a pass, "-" or "EXCH"
+// followed by the letters to exchange (with '?' for a blank tile), or a
+// coordinate as returned by TileMove.Coordinate() followed by a word,
+// for instance "H8 HELLO" or "8D PA..E". In contrast to Game.ParseMove(),
+// uppercase letters denote normal tiles and lowercase letters denote
+// blank tiles, and tiles that are already on the board are written as
+// themselves, as '.', or within parentheses. The tiles must be in the
+// player's rack. Words formed by a tile move are validated, when it
+// is checked, if validateWords is true.
+func parseGCGMove(game *Game, notation string, validateWords bool) (Move, error) {
+	fields := strings.Fields(notation)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty move")
+	}
+	rack := game.Racks[game.PlayerToMove()].AsRunes()
+	var letters string
+	switch {
+	case fields[0] == "-" && len(fields) == 1:
+		return NewPassMove(), nil
+	case strings.ToUpper(fields[0]) == "EXCH":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("an exchange move needs the letters to exchange")
+		}
+		letters = fields[1]
+	case strings.HasPrefix(fields[0], "-"):
+		if len(fields) != 1 || fields[0] == "--" {
+			return nil, fmt.Errorf("invalid exchange move '%v'", notation)
+		}
+		letters = fields[0][1:]
+	default:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("a tile move needs a coordinate and a word")
+		}
+		move, err := parseGCGTileMove(&game.Board, fields[0], fields[1], validateWords)
+		if err != nil {
+			return nil, err
+		}
+		if letter, missing := move.missingTile(rack); missing {
+			return nil, fmt.Errorf("the tile '%c' is not in the rack", letter)
+		}
+		return move, nil
+	}
+	letters = strings.ToLower(letters)
+	for _, letter := range letters {
+		if !ContainsRune(rack, letter) {
+			return nil, fmt.Errorf("the letters '%v' are not in the rack", letters)
+		}
+		rack = RemoveRune(rack, letter)
+	}
+	return NewExchangeMove(letters), nil
+}
+
+// LoadGCG reads a game record in the GCG format and replays it,
+// returning the resulting Game. The locale selects the dictionary and
+// tile set, cf. NewGameForLocale(), and the record is replayed as by
+// Game.LoadGCG().
+func LoadGCG(r io.Reader, locale string) (*Game, error) {
+	game := NewGameForLocale(locale, "standard")
+	if game == nil {
+		return nil, fmt.Errorf("unable to create a game for locale '%v'", locale)
+	}
+	if err := game.LoadGCG(r); err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+// LoadGCG reads a game record in the GCG format and replays it on the
+// Game, which must not have any moves yet. The players' racks are set
+// from the record before each move, and the score of each move, as well
+// as the running total, is checked against the score computed by the
+// engine. Withdrawn phonies are taken back and replaced by a pass.
+// Challenge bonuses, time penalties and end-of-game rack adjustments
+// in the record are not applied, as the engine applies its own
+// end-of-game rules. Errors include the number of the offending line.
+func (game *Game) LoadGCG(r io.Reader) error {
+	if len(game.MoveList) > 0 {
+		return fmt.Errorf("the game already has moves")
+	}
+	nicks := make([]string, 0, 2)
+	names := [2]string{}
+	// The running totals, which can include bonuses and penalties
+	// that are not part of the game's scores
+	var totals [2]int
+	playerOf := func(nick string) int {
+		for i, n := range nicks {
+			if n == nick {
+				return i
+			}
+		}
+		if len(nicks) < 2 {
+			nicks = append(nicks, nick)
+			return len(nicks) - 1
+		}
+		return -1
+	}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fail := func(format string, a ...interface{}) error {
+			return fmt.Errorf("line %v: %v", lineNo, fmt.Sprintf(format, a...))
+		}
+		if strings.HasPrefix(line, "#") {
+			// A pragma: we are only interested in the player names
+			fields := strings.Fields(line)
+			if fields[0] == "#player1" || fields[0] == "#player2" {
+				if len(fields) < 2 || len(nicks) >= 2 {
+					return fail("invalid player pragma")
+				}
+				player := playerOf(fields[1])
+				names[player] = strings.Join(fields[2:], " ")
+				if names[player] == "" {
+					names[player] = fields[1]
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ">") {
+			return fail("unrecognized line")
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return fail("missing player nickname")
+		}
+		player := playerOf(line[1:colon])
+		if player < 0 {
+			return fail("unknown player '%v'", line[1:colon])
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) < 3 {
+			return fail("incomplete move")
+		}
+		total, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil {
+			return fail("invalid total '%v'", fields[len(fields)-1])
+		}
+		score, err := strconv.Atoi(fields[len(fields)-2])
+		if err != nil {
+			return fail("invalid score '%v'", fields[len(fields)-2])
+		}
+		checkTotal := func() error {
+			totals[player] += score
+			if totals[player] != total {
+				return fail("total %v does not match computed total %v", total, totals[player])
+			}
+			return nil
+		}
+		rack := []rune(strings.ToLower(fields[0]))
+		switch {
+		case strings.HasPrefix(fields[0], "("):
+			// End-of-game rack adjustment: the engine applies its own
+			continue
+		case fields[1] == "(challenge)" || fields[1] == "(time)":
+			if err := checkTotal(); err != nil {
+				return err
+			}
+			continue
+		case fields[1] == "--":
+			// A phony that was challenged off: take it back
+			// and replace it with a VoidMove
+			last := len(game.MoveList) - 1
+			if player != 1-game.PlayerToMove() || last < 0 ||
+				game.MoveList[last].Score != -score {
+				return fail("no move to withdraw")
+			}
+			tileMove, ok := game.MoveList[last].Move.(*TileMove)
+			if !ok || !game.UndoLastMove() {
+				return fail("no move to withdraw")
+			}
+			if !game.ApplyValid(NewVoidMove(tileMove)) {
+				return fail("unable to withdraw move")
+			}
+			if err := checkTotal(); err != nil {
+				return err
+			}
+			continue
+		}
+		if game.IsOver() {
+			return fail("the game is already over")
+		}
+		if player != game.PlayerToMove() {
+			return fail("player '%v' is not the player to move", nicks[player])
+		}
+		// Set the rack of the player to move, after returning the
+		// opponent's tiles to the bag, to ensure that the tiles are
+		// available. The opponent's rack is refilled afterwards.
+		if len(rack) > game.RackSize {
+			return fail("rack '%v' has too many tiles", fields[0])
+		}
+		game.ForceRack(1-player, "")
+		if !game.ForceRack(player, string(rack)) {
+			return fail("rack '%v' is not available in the bag", fields[0])
+		}
+		game.Racks[1-player].Fill(game.Bag)
+		var move Move
+		if n, err := strconv.Atoi(strings.TrimPrefix(fields[1], "-")); err == nil && fields[1][0] == '-' {
+			// An exchange where only the number of tiles is known
+			if n < 1 || n > len(rack) {
+				return fail("invalid number of exchanged tiles")
+			}
+			move = NewExchangeMove(string(rack[:n]))
+		} else {
+			// The words in a game record are not validated against the
+			// dictionary, since they may have been challenged off
+			move, err = parseGCGMove(game, strings.Join(fields[1:len(fields)-2], " "), false)
+			if err != nil {
+				return fail("%v", err)
+			}
+		}
+		if !move.IsValid(game) {
+			return fail("move '%v' is not valid", move)
+		}
+		if computed := move.Score(game.State()); computed != score {
+			return fail("score %v does not match computed score %v", score, computed)
+		}
+		if !game.ApplyValid(move) {
+			return fail("unable to apply move '%v'", move)
+		}
+		if err := checkTotal(); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	game.SetPlayerNames(names[0], names[1])
+	return nil
+}
+
+// gcgNick returns a GCG nickname for the given player,
+// based on the player's name
+func (game *Game) gcgNick(player int) string {
+	nick := strings.Join(strings.Fields(game.PlayerNames[player]), "_")
+	if nick == "" {
+		nick = fmt.Sprintf("player%v", player+1)
+	}
+	return nick
+}
+
+// gcgWord returns the word of a TileMove in GCG form, with normal
+// tiles in uppercase and blank tiles in lowercase
+func (game *Game) gcgWord(move *TileMove) string {
+	row, col, horizontal, _ := parseCoordinate(move.Coordinate())
+	var sb strings.Builder
+	for _, letter := range strings.ReplaceAll(move.Word, "?", "") {
+		blank := false
+		if cover, ok := move.Covers[Coordinate{row, col}]; ok {
+			blank = cover.Letter == '?'
+		} else if tile := game.Board.TileAt(row, col); tile != nil {
+			blank = tile.Letter == '?'
+		}
+		if blank {
+			sb.WriteRune(letter)
+		} else {
+			sb.WriteRune(unicode.ToUpper(letter))
+		}
+		if horizontal {
+			col++
+		} else {
+			row++
+		}
+	}
+	return sb.String()
+}
+
+// WriteGCG writes the Game to w in the GCG format, cf. LoadGCG()
+func (game *Game) WriteGCG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#character-encoding UTF-8\n")
+	for player := 0; player < 2; player++ {
+		fmt.Fprintf(bw, "#player%v %v %v\n",
+			player+1, game.gcgNick(player), game.PlayerNames[player])
+	}
+	var totals [2]int
+	for i, item := range game.MoveList {
+		player := i % 2
+		totals[player] += item.Score
+		rack := strings.ToUpper(item.RackBefore)
+		var desc string
+		switch move := item.Move.(type) {
+		case *TileMove:
+			desc = move.Coordinate() + " " + game.gcgWord(move)
+		case *ExchangeMove:
+			desc = "-" + strings.ToUpper(move.Letters)
+		case *PassMove:
+			desc = "-"
+		case *VoidMove:
+			// A phony that was challenged off: write it as it was
+			// played, followed by its withdrawal
+			score, _ := move.Move.knownScore()
+			fmt.Fprintf(bw, ">%v: %v %v %v %+d %v\n",
+				game.gcgNick(player), rack, move.Move.Coordinate(),
+				game.gcgWord(move.Move), score, totals[player]+score)
+			fmt.Fprintf(bw, ">%v: %v -- %+d %v\n",
+				game.gcgNick(player), rack, -score, totals[player])
+			continue
+		case *ResignMove:
+			// GCG has no notation for resignations
+			continue
+		case *FinalMove:
+			if move.TimePenalty != 0 {
+				// Write the rack adjustment, if any, followed
+				// by the time penalty on a line of its own
+				if move.OpponentRack != "" {
+					fmt.Fprintf(bw, ">%v: (%v) %+d %v\n",
+						game.gcgNick(player), strings.ToUpper(move.OpponentRack),
+						item.Score+move.TimePenalty, totals[player]+move.TimePenalty)
+				}
+				fmt.Fprintf(bw, ">%v: %v (time) %+d %v\n",
+					game.gcgNick(player), rack, -move.TimePenalty, totals[player])
+				continue
+			}
+			if move.OpponentRack == "" {
+				// No adjustment to write
+				continue
+			}
+			rack = "(" + strings.ToUpper(move.OpponentRack) + ")"
+		}
+		if desc != "" {
+			rack += " " + desc
+		}
+		fmt.Fprintf(bw, ">%v: %v %+d %v\n",
+			game.gcgNick(player), rack, item.Score, totals[player])
+	}
+	return bw.Flush()
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 
 	skrafl "github.com/vthorsteinsson/GoSkrafl"
 )
@@ -74,6 +75,22 @@ func movesHandler(w http.ResponseWriter, r *http.Request) {
 	skrafl.HandleMovesRequest(w, req)
 }
 
+func exchangeHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.ExchangeRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleExchangeRequest(w, req)
+}
+
+func bestMoveHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.BestMoveRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleBestMoveRequest(w, req)
+}
+
 func wordcheckHandler(w http.ResponseWriter, r *http.Request) {
 	var req skrafl.WordCheckRequest
 	if !validate(w, r, &req) {
@@ -82,9 +99,71 @@ func wordcheckHandler(w http.ResponseWriter, r *http.Request) {
 	skrafl.HandleWordCheckRequest(w, req)
 }
 
+func hintsHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.MovesRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleHintsRequest(w, req)
+}
+
+func analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.AnalyzeRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleAnalyzeRequest(w, req)
+}
+
+func anagramHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.AnagramRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleAnagramRequest(w, req)
+}
+
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.ValidateRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleValidateRequest(w, req)
+}
+
+func applyHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.ApplyRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleApplyRequest(w, req)
+}
+
+func checkHandler(w http.ResponseWriter, r *http.Request) {
+	var req skrafl.CheckRequest
+	if !validate(w, r, &req) {
+		return
+	}
+	skrafl.HandleCheckRequest(w, req)
+}
+
+// preloadLocales returns the locales whose dictionaries are loaded
+// by the warmup handler, from the comma-separated PRELOAD_LOCALES
+// environment variable, or all the built-in locales by default
+func preloadLocales() []string {
+	if locales := os.Getenv("PRELOAD_LOCALES"); locales != "" {
+		return strings.Split(locales, ",")
+	}
+	return []string{"en_US", "en", "is", "pl", "nb", "nn"}
+}
+
 func warmupHandler(w http.ResponseWriter, r *http.Request) {
-	// No concrete action required
 	log.Println("Warmup request received")
+	// Load the dictionaries up front, so that the first
+	// requests don't have to wait for them
+	if err := skrafl.PreloadLocales(preloadLocales()); err != nil {
+		log.Printf("Warmup: %v", err)
+	}
 }
 
 func main() {
@@ -100,7 +179,15 @@ func main() {
 	http.HandleFunc("/_ah/warmup", warmupHandler)
 	// Set up the actual service handlers
 	http.HandleFunc("/moves", movesHandler)
+	http.HandleFunc("/exchange-analysis", exchangeHandler)
+	http.HandleFunc("/bestmove", bestMoveHandler)
 	http.HandleFunc("/wordcheck", wordcheckHandler)
+	http.HandleFunc("/hints", hintsHandler)
+	http.HandleFunc("/analyze", analyzeHandler)
+	http.HandleFunc("/validate", validateHandler)
+	http.HandleFunc("/apply", applyHandler)
+	http.HandleFunc("/riddle/check", checkHandler)
+	http.HandleFunc("/anagram", anagramHandler)
 	// Establish the port number to listen on, defaulting to 8080
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,121 @@
+// leave.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements the evaluation of rack leaves, i.e. the
+// tiles that remain in a player's rack after a move.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"strings"
+)
+
+// LeaveEvaluator is an interface for evaluating rack leaves.
+// A higher value means a more desirable leave.
+type LeaveEvaluator interface {
+	Evaluate(leave []rune) float64
+}
+
+// StaticLeaveEvaluator evaluates a leave by summing the values of
+// its tiles, as looked up in a LeaveTable, and deducting penalties
+// for an imbalance between vowels and consonants and for duplicate
+// tiles. Blank tiles count neither as vowels nor as consonants.
+type StaticLeaveEvaluator struct {
+	Values LeaveTable
+	// The vowels of the alphabet
+	Vowels string
+	// The penalty for each vowel or consonant in excess of the
+	// other kind, beyond a difference of one
+	BalancePenalty float64
+	// The penalty for each duplicate of a tile in the leave
+	DuplicatePenalty float64
+}
+
+// EnglishLeaveEvaluator is the default StaticLeaveEvaluator
+// for the English tile sets
+var EnglishLeaveEvaluator = &StaticLeaveEvaluator{
+	Values:           EnglishLeaveTable,
+	Vowels:           "aeiou",
+	BalancePenalty:   3.0,
+	DuplicatePenalty: 4.0,
+}
+
+// IcelandicLeaveEvaluator is the default StaticLeaveEvaluator
+// for the new Icelandic tile set
+var IcelandicLeaveEvaluator = &StaticLeaveEvaluator{
+	Values:           IcelandicLeaveTable,
+	Vowels:           "aáeéiíoóuúyýæö",
+	BalancePenalty:   3.0,
+	DuplicatePenalty: 3.0,
+}
+
+// leaveEvaluators maps the names of tile sets to the default
+// StaticLeaveEvaluators for them
+var leaveEvaluators = map[string]*StaticLeaveEvaluator{
+	"is": IcelandicLeaveEvaluator,
+}
+
+// LeaveEvaluatorForLocale returns the default StaticLeaveEvaluator
+// for the tile set of the given locale, as resolved by
+// Locales.Resolve(), i.e. the Icelandic one for the Icelandic
+// tile set and the English one otherwise
+func LeaveEvaluatorForLocale(locale string) *StaticLeaveEvaluator {
+	if config, err := Locales.Resolve(locale); err == nil {
+		if evaluator, ok := leaveEvaluators[config.TileSet.Name]; ok {
+			return evaluator
+		}
+	}
+	return EnglishLeaveEvaluator
+}
+
+// Evaluate returns the value of the given leave
+func (evaluator *StaticLeaveEvaluator) Evaluate(leave []rune) float64 {
+	if len(leave) == 0 {
+		return 0.0
+	}
+	value := evaluator.Values.Value(leave)
+	vowels, consonants := 0, 0
+	counts := make(map[rune]int, len(leave))
+	for _, tile := range leave {
+		counts[tile]++
+		switch {
+		case tile == '?':
+			// A blank tile can be either
+		case strings.ContainsRune(evaluator.Vowels, tile):
+			vowels++
+		default:
+			consonants++
+		}
+	}
+	imbalance := vowels - consonants
+	if imbalance < 0 {
+		imbalance = -imbalance
+	}
+	if imbalance > 1 {
+		value -= evaluator.BalancePenalty * float64(imbalance-1)
+	}
+	for _, count := range counts {
+		if count > 1 {
+			value -= evaluator.DuplicatePenalty * float64(count-1)
+		}
+	}
+	return value
+}
@@ -0,0 +1,263 @@
+// locale.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements a registry that maps locale strings
+// to dictionaries and tile sets.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is the locale used for locale strings
+// that are not found in the Locales registry
+const DefaultLocale = "en_US"
+
+// localeFallbacks maps the language part of a locale to the locale
+// whose dictionary and tile set are used if none are registered for
+// it, e.g. if its dictionary is excluded from the build
+var localeFallbacks = map[string]string{
+	// Norwegian (Nynorsk) falls back to Norwegian (Bokmål)
+	"nn": "nb",
+}
+
+// LocaleConfig is the dictionary and tile set(s) used for a locale
+type LocaleConfig struct {
+	Dawg    *Dawg
+	TileSet *TileSet
+	// ExploTileSet is the tile set used on the "explo" board.
+	// If nil, TileSet is used for all board types.
+	ExploTileSet *TileSet
+	// Aliases are additional locale strings that map to this config
+	Aliases []string
+}
+
+// TileSetFor returns the tile set to use with the given board type
+func (config *LocaleConfig) TileSetFor(boardType string) *TileSet {
+	if boardType == "explo" && config.ExploTileSet != nil {
+		return config.ExploTileSet
+	}
+	return config.TileSet
+}
+
+// LocaleRegistry maps locale strings, such as "is" or "en_US",
+// to LocaleConfigs. It is safe for concurrent use.
+type LocaleRegistry struct {
+	sync.RWMutex
+	locales map[string]LocaleConfig
+	// excluded maps built-in locales whose dictionaries are
+	// excluded from the build to the names of their languages
+	excluded map[string]string
+}
+
+// NewLocaleRegistry returns a new, empty LocaleRegistry
+func NewLocaleRegistry() *LocaleRegistry {
+	return &LocaleRegistry{
+		locales:  make(map[string]LocaleConfig),
+		excluded: make(map[string]string),
+	}
+}
+
+// Register associates a LocaleConfig with a locale and its aliases,
+// replacing any previous registration. Registering a config without
+// a Dawg or a TileSet removes the locale and its aliases. An error is
+// returned, and nothing is registered, if a tile set contains letters
+// that are not in the alphabet of the Dawg.
+func (registry *LocaleRegistry) Register(locale string, config LocaleConfig) error {
+	if config.Dawg != nil {
+		for _, tileSet := range []*TileSet{config.TileSet, config.ExploTileSet} {
+			if tileSet == nil {
+				continue
+			}
+			if err := tileSet.Validate(&config.Dawg.alphabet); err != nil {
+				return fmt.Errorf("locale %q: %w", locale, err)
+			}
+		}
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, l := range append([]string{locale}, config.Aliases...) {
+		if config.Dawg == nil || config.TileSet == nil {
+			delete(registry.locales, l)
+		} else {
+			registry.locales[l] = config
+		}
+	}
+	return nil
+}
+
+// Lookup returns the LocaleConfig registered for the given locale,
+// or for its language part (e.g. "de" for "de_AT" or "de-AT").
+// The boolean result is false if neither is registered.
+func (registry *LocaleRegistry) Lookup(locale string) (LocaleConfig, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	if config, ok := registry.locales[locale]; ok {
+		return config, true
+	}
+	if ix := strings.IndexAny(locale, "_-"); ix > 0 {
+		if config, ok := registry.locales[locale[0:ix]]; ok {
+			return config, true
+		}
+	}
+	return LocaleConfig{}, false
+}
+
+// Resolve returns the LocaleConfig to use for the given locale: the
+// one registered for it (cf. Lookup()), or else the one registered
+// for its fallback locale, if any, with a logged warning, or else
+// that of the DefaultLocale. An error is returned if the locale is
+// a built-in one whose dictionary is excluded from the build, with
+// no fallback available.
+func (registry *LocaleRegistry) Resolve(locale string) (LocaleConfig, error) {
+	if config, ok := registry.Lookup(locale); ok {
+		return config, nil
+	}
+	language := locale
+	if ix := strings.IndexAny(locale, "_-"); ix > 0 {
+		language = locale[0:ix]
+	}
+	if fallback, ok := localeFallbacks[language]; ok {
+		if config, ok := registry.Lookup(fallback); ok {
+			log.Printf("Warning: no dictionary for locale %q, falling back to %q", locale, fallback)
+			return config, nil
+		}
+	}
+	registry.RLock()
+	name, excluded := registry.excluded[locale]
+	if !excluded {
+		name, excluded = registry.excluded[language]
+	}
+	registry.RUnlock()
+	if excluded {
+		return LocaleConfig{}, fmt.Errorf(
+			"the %v dictionary for locale %q is excluded from this build", name, locale,
+		)
+	}
+	config, ok := registry.Lookup(DefaultLocale)
+	if !ok {
+		return LocaleConfig{}, fmt.Errorf("no dictionary for locale %q", locale)
+	}
+	return config, nil
+}
+
+// registerBuiltin registers the config of a built-in locale, or, if
+// its dictionary is excluded from the build, notes that instead, so
+// that Resolve() can report it
+func (registry *LocaleRegistry) registerBuiltin(locale string, name string, config LocaleConfig) {
+	if config.Dawg != nil {
+		registry.Register(locale, config)
+		return
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, l := range append([]string{locale}, config.Aliases...) {
+		registry.excluded[l] = name
+	}
+}
+
+// LookupDictionary returns the dictionary to use for the given
+// locale, as resolved by Locales.Resolve()
+func LookupDictionary(locale string) (*Dawg, error) {
+	config, err := Locales.Resolve(locale)
+	if err != nil {
+		return nil, err
+	}
+	return loaded(config.Dawg), nil
+}
+
+// newBuiltinLocales returns a LocaleRegistry containing
+// the built-in dictionaries and tile sets
+func newBuiltinLocales() *LocaleRegistry {
+	registry := NewLocaleRegistry()
+	// U.S. English, also used for an empty locale
+	registry.registerBuiltin("en_US", "U.S. English", LocaleConfig{
+		Dawg:         OtcwlDictionary,
+		TileSet:      EnglishTileSet,
+		ExploTileSet: NewEnglishTileSet,
+		Aliases:      []string{"", "en-US"},
+	})
+	// U.K. English (SOWPODS)
+	registry.registerBuiltin("en", "English", LocaleConfig{
+		Dawg:         SowpodsDictionary,
+		TileSet:      EnglishTileSet,
+		ExploTileSet: NewEnglishTileSet,
+	})
+	registry.registerBuiltin("is", "Icelandic", LocaleConfig{
+		Dawg:    IcelandicDictionary,
+		TileSet: NewIcelandicTileSet,
+	})
+	registry.registerBuiltin("pl", "Polish", LocaleConfig{
+		Dawg:    OspsDictionary,
+		TileSet: PolishTileSet,
+	})
+	// Norwegian (Bokmål), also used for generic Norwegian,
+	// e.g. "no-NO", and as a fallback for Nynorsk
+	registry.registerBuiltin("nb", "Norwegian (Bokmål)", LocaleConfig{
+		Dawg:    NorwegianBokmålDictionary,
+		TileSet: NorwegianTileSet,
+		Aliases: []string{"no"},
+	})
+	registry.registerBuiltin("nn", "Norwegian (Nynorsk)", LocaleConfig{
+		Dawg:    NorwegianNynorskDictionary,
+		TileSet: NorwegianTileSet,
+	})
+	return registry
+}
+
+// Locales is the registry used to look up the dictionary and tile set
+// for a locale, e.g. by NewGameForLocale() and the HTTP server.
+// Additional locales can be registered at runtime.
+var Locales = newBuiltinLocales()
+
+// PreloadLocales loads the dictionaries of the given locales, as
+// found in the Locales registry, which are otherwise loaded on first
+// use, so that the first requests for those locales are not delayed.
+// An error is returned if a locale is not registered; the
+// dictionaries of the other locales are loaded nonetheless.
+func PreloadLocales(locales []string) error {
+	unknown := make([]string, 0)
+	for _, locale := range locales {
+		config, ok := Locales.Lookup(locale)
+		if !ok {
+			unknown = append(unknown, locale)
+			continue
+		}
+		config.Dawg.bytes()
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown locales: %v", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// RegisterDictionary associates a Dawg and a TileSet with a locale
+// (such as "de" or "de_AT") in the Locales registry, so that games
+// and requests for that locale use them. A registered locale replaces
+// any built-in one. Registering a nil Dawg removes the locale.
+// An error is returned if the tile set does not match the Dawg.
+func RegisterDictionary(locale string, dawg *Dawg, tileSet *TileSet) error {
+	return Locales.Register(locale, LocaleConfig{Dawg: dawg, TileSet: tileSet})
+}
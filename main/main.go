@@ -67,6 +67,34 @@ func movesHandler(w http.ResponseWriter, r *http.Request) {
 	skrafl.HandleMovesRequest(w, req)
 }
 
+func exchangeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.ExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleExchangeRequest(w, req)
+}
+
+func bestMoveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.BestMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleBestMoveRequest(w, req)
+}
+
 func wordcheckHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -81,16 +109,108 @@ func wordcheckHandler(w http.ResponseWriter, r *http.Request) {
 	skrafl.HandleWordCheckRequest(w, req)
 }
 
+func hintsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.MovesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleHintsRequest(w, req)
+}
+
+func analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.AnalyzeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleAnalyzeRequest(w, req)
+}
+
+func anagramHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.AnagramRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleAnagramRequest(w, req)
+}
+
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.ValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleValidateRequest(w, req)
+}
+
+func applyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.ApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleApplyRequest(w, req)
+}
+
+func checkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var req skrafl.CheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Not valid JSON
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skrafl.HandleCheckRequest(w, req)
+}
+
 func runServer() {
 	http.HandleFunc("/moves", movesHandler)
+	http.HandleFunc("/exchange-analysis", exchangeHandler)
+	http.HandleFunc("/bestmove", bestMoveHandler)
 	http.HandleFunc("/wordcheck", wordcheckHandler)
+	http.HandleFunc("/hints", hintsHandler)
+	http.HandleFunc("/analyze", analyzeHandler)
+	http.HandleFunc("/validate", validateHandler)
+	http.HandleFunc("/apply", applyHandler)
+	http.HandleFunc("/riddle/check", checkHandler)
+	http.HandleFunc("/anagram", anagramHandler)
 	http.ListenAndServe(":8080", nil)
 }
 
 func main() {
 	// Modify the following depending on the type of Game wanted
 	dict := flag.String("d", "ice", "Dictionary to use (otcwl, sowpods, osps, ice)")
-	boardType := flag.String("b", "standard", "Board type (standard, explo)")
+	boardType := flag.String("b", "standard", "Board type (standard, explo, mini, super)")
 	num := flag.Int("n", 10, "Number of games to simulate")
 	quiet := flag.Bool("q", false, "Suppress output of game state and moves")
 	server := flag.Bool("s", false, "Run as a HTTP server")
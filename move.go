@@ -25,7 +25,12 @@ package skrafl
 
 import (
 	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"unicode"
 )
 
 // Move is an interface to various types of moves
@@ -45,6 +50,108 @@ type Validatable interface {
 	ValidateWord(*Dawg) bool
 }
 
+// MoveErrorCode identifies the reason why a move is not valid,
+// cf. Game.ValidateMove()
+type MoveErrorCode string
+
+const (
+	// InvalidMove is the code of invalid moves that have no more
+	// specific code, e.g. moves of a type that cannot be made
+	InvalidMove MoveErrorCode = "InvalidMove"
+	// GameOver means that the game is already over
+	GameOver MoveErrorCode = "GameOver"
+	// InvalidTileCount means that a tile move or an exchange includes
+	// no tiles, or more tiles than fit in a rack
+	InvalidTileCount MoveErrorCode = "InvalidTileCount"
+	// OffBoard means that a tile is placed outside the board
+	OffBoard MoveErrorCode = "OffBoard"
+	// InvalidLetter means that a tile is not in the tile set, that
+	// the meaning of a blank tile is not in the alphabet, or that a
+	// tile other than a blank means something other than its letter
+	InvalidLetter MoveErrorCode = "InvalidLetter"
+	// SquareOccupied means that a tile is placed on a
+	// square that already has a tile
+	SquareOccupied MoveErrorCode = "SquareOccupied"
+	// NonLinear means that the tiles are not in a single row or column
+	NonLinear MoveErrorCode = "NonLinear"
+	// Gap means that there is an empty square between the tiles
+	Gap MoveErrorCode = "Gap"
+	// FirstMoveMustCoverStart means that the first tile move
+	// does not cover the start square
+	FirstMoveMustCoverStart MoveErrorCode = "FirstMoveMustCoverStart"
+	// NotConnected means that a tile move does not touch
+	// any of the tiles already on the board
+	NotConnected MoveErrorCode = "NotConnected"
+	// WordNotInDictionary means that the main word
+	// of a tile move is not in the dictionary
+	WordNotInDictionary MoveErrorCode = "WordNotInDictionary"
+	// CrossWordInvalid means that a cross word formed
+	// by a tile move is not in the dictionary
+	CrossWordInvalid MoveErrorCode = "CrossWordInvalid"
+	// TileNotInRack means that a tile of the move
+	// is not in the player's rack
+	TileNotInRack MoveErrorCode = "TileNotInRack"
+	// ExchangeNotAllowed means that there are too
+	// few tiles in the bag for an exchange
+	ExchangeNotAllowed MoveErrorCode = "ExchangeNotAllowed"
+)
+
+// MoveError describes why a move is not valid
+type MoveError struct {
+	Code MoveErrorCode
+	// A human-readable description of the error
+	Message string
+	// The word that is not in the dictionary, if the Code is
+	// WordNotInDictionary or CrossWordInvalid
+	Word string
+	// The square that the error concerns, if any, e.g. the
+	// first square of a cross word that is not in the dictionary
+	Row, Col int
+	// Whether Row and Col are set
+	hasSquare bool
+}
+
+// newMoveError returns a MoveError with the given
+// code and a formatted message
+func newMoveError(code MoveErrorCode, format string, args ...any) *MoveError {
+	return &MoveError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// at sets the square that the MoveError concerns
+func (err *MoveError) at(coord Coordinate) *MoveError {
+	err.Row, err.Col, err.hasSquare = coord.Row, coord.Col, true
+	return err
+}
+
+// Error returns the message of the MoveError
+func (err *MoveError) Error() string {
+	return err.Message
+}
+
+// MarshalJSON encodes a MoveError as a JSON object with the
+// fields "code" and "message", as well as "word", "row" and "col"
+// if they apply to the error
+func (err *MoveError) MarshalJSON() ([]byte, error) {
+	type moveErrorJson struct {
+		Code    MoveErrorCode `json:"code"`
+		Message string        `json:"message"`
+		Word    string        `json:"word,omitempty"`
+		Row     *int          `json:"row,omitempty"`
+		Col     *int          `json:"col,omitempty"`
+	}
+	j := moveErrorJson{Code: err.Code, Message: err.Message, Word: err.Word}
+	if err.hasSquare {
+		j.Row, j.Col = &err.Row, &err.Col
+	}
+	return json.Marshal(j)
+}
+
+// squareName returns the name of a square on the board, such as "H8",
+// with the row identifier followed by the column identifier
+func squareName(coord Coordinate) string {
+	return rowIds[coord.Row] + colIds[coord.Col]
+}
+
 // PassMove is a move that is always valid, has no effect when applied,
 // and has a score of 0
 type PassMove struct {
@@ -62,6 +169,23 @@ type ExchangeMove struct {
 type FinalMove struct {
 	OpponentRack   string
 	MultiplyFactor int
+	// The points deducted for exceeding the time limit, cf. Clock
+	TimePenalty int
+}
+
+// ResignMove is a move where the player resigns the game, or loses
+// it on time if TimeForfeit is true. It is always valid and ends the
+// game, with the resigning player losing the value of the remaining
+// tiles in the rack.
+type ResignMove struct {
+	TimeForfeit bool
+}
+
+// VoidMove is recorded in place of a TileMove that was taken back
+// after a successful challenge. Like a PassMove, it scores no points
+// and counts as a zero-point move.
+type VoidMove struct {
+	Move *TileMove
 }
 
 // TileMove represents a normal tile move by a player, where
@@ -76,12 +200,38 @@ type TileMove struct {
 	Covers       Covers
 	Horizontal   bool
 	Word         string
-	CachedScore  *int
+	// CachedScore is the precomputed score of the move, if any. The
+	// move generators set it from the cross scores of their Axis.
+	// Score() only reads it, so it must be set before the move is
+	// shared between goroutines.
+	CachedScore *int
+	// scored is the score of the move plus one once calculated by
+	// Score(), if CachedScore is not set, or zero before that. It is
+	// accessed atomically, since a move may be scored by several
+	// goroutines at once, but the move can still be copied by value.
+	scored int64
 	// If ValidateWords is true, IsValid() should check all words
 	// formed by this move against the game dictionary
 	ValidateWords bool
 }
 
+// WordScore is a word formed by a TileMove, with blank tiles
+// rendered as their meanings, together with its score
+type WordScore struct {
+	Word  string `json:"w"`
+	Score int    `json:"sc"`
+}
+
+// ScoreBreakdown splits the score of a TileMove into the main word,
+// the cross-words formed by the move and the bingo bonus, if any.
+// The Total is always equal to the score returned by TileMove.Score().
+type ScoreBreakdown struct {
+	MainWord   WordScore   `json:"main"`
+	CrossWords []WordScore `json:"cross"`
+	BingoBonus int         `json:"bingo"`
+	Total      int         `json:"total"`
+}
+
 // Coordinate stores a Board co-ordinate as as row, col tuple
 type Coordinate struct {
 	Row, Col int
@@ -98,8 +248,8 @@ type Cover struct {
 // Covers is a map of board coordinates to a tile covering
 type Covers map[Coordinate]Cover
 
-// BingoBonus is the number of extra points awarded for laying down
-// all the 7 tiles in the rack in one move
+// BingoBonus is the default number of extra points awarded for laying
+// down all the 7 tiles in the rack in one move, cf. ScoringRules
 const BingoBonus = 50
 
 // NewTileMove creates a new TileMove object with the given
@@ -134,6 +284,40 @@ func (move *TileMove) Coordinate() string {
 	return coord
 }
 
+// parseCoordinate parses a coordinate string such as "H8"
+// (horizontal) or "8H" (vertical), as returned by Coordinate(),
+// returning the row, the column and the direction, or ok=false
+// if the coordinate is invalid
+func parseCoordinate(coord string) (row, col int, horizontal bool, ok bool) {
+	coord = strings.ToUpper(coord)
+	split := strings.IndexFunc(coord, unicode.IsDigit)
+	if split < 0 {
+		return 0, 0, false, false
+	}
+	var rowId, colId string
+	if split == 0 {
+		// Starts with a column number: vertical move
+		split = strings.IndexFunc(coord, unicode.IsLetter)
+		if split < 0 {
+			return 0, 0, false, false
+		}
+		colId, rowId = coord[:split], coord[split:]
+	} else {
+		rowId, colId = coord[:split], coord[split:]
+		horizontal = true
+	}
+	row, col = -1, -1
+	for i := 0; i < MaxBoardSize; i++ {
+		if rowIds[i] == rowId {
+			row = i
+		}
+		if colIds[i] == colId {
+			col = i
+		}
+	}
+	return row, col, horizontal, row >= 0 && col >= 0
+}
+
 // Return a string description of a tile move
 // Note that blank tiles will be shown as a
 // question mark followed by their assigned meaning,
@@ -142,17 +326,81 @@ func (move *TileMove) String() string {
 	return move.Coordinate() + " " + move.Word
 }
 
+// TilesUsed returns the letters of the tiles from the given rack that
+// are used by the move, with '?' for blank tiles. A cover whose letter
+// is not in the rack is assumed to be made with a blank tile.
+func (move *TileMove) TilesUsed(rack *Rack) []rune {
+	remaining := rack.AsRunes()
+	used := make([]rune, 0, len(move.Covers))
+	for _, cover := range move.Covers {
+		letter := cover.Letter
+		if !ContainsRune(remaining, letter) {
+			letter = '?'
+		}
+		remaining = RemoveRune(remaining, letter)
+		used = append(used, letter)
+	}
+	return used
+}
+
+// coveredSquares returns the coordinates of the squares
+// covered by the move, in board order
+func (move *TileMove) coveredSquares() []Coordinate {
+	coords := make([]Coordinate, 0, len(move.Covers))
+	for coord := range move.Covers {
+		coords = append(coords, coord)
+	}
+	slices.SortFunc(coords, func(a, b Coordinate) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+		return a.Col - b.Col
+	})
+	return coords
+}
+
+// CoverJson is a square covered by a tile move, as included
+// in the JSON representation of the move, cf. TileMove.Marshal().
+// The letter of a blank tile is '?'.
+type CoverJson struct {
+	Row     int    `json:"row"`
+	Col     int    `json:"col"`
+	Letter  string `json:"letter"`
+	Meaning string `json:"meaning"`
+}
+
 func (move *TileMove) Marshal(score int) ([]byte, error) {
 	type TileJson struct {
 		Coordinate string `json:"co"`
 		Word       string `json:"w"`
 		Score      int    `json:"sc"`
+		// The rack tiles used by the move, in board order, where
+		// a blank tile is denoted by '?' followed by its meaning
+		// in uppercase, e.g. "f?Ara"
+		Tiles  string      `json:"tiles"`
+		Covers []CoverJson `json:"covers"`
 	}
 	j := TileJson{
 		Coordinate: move.Coordinate(),
 		Word:       move.Word,
 		Score:      score,
+		Covers:     make([]CoverJson, 0, len(move.Covers)),
+	}
+	var tiles strings.Builder
+	for _, coord := range move.coveredSquares() {
+		cover := move.Covers[coord]
+		tiles.WriteRune(cover.Letter)
+		if cover.Letter == '?' {
+			tiles.WriteRune(unicode.ToUpper(cover.Meaning))
+		}
+		j.Covers = append(j.Covers, CoverJson{
+			Row:     coord.Row,
+			Col:     coord.Col,
+			Letter:  string(cover.Letter),
+			Meaning: string(cover.Meaning),
+		})
 	}
+	j.Tiles = tiles.String()
 	return json.Marshal(j)
 }
 
@@ -163,7 +411,7 @@ const IllegalMoveWord = "[???]"
 // using a map of Coordinate to Cover
 func (move *TileMove) Init(board *Board, covers Covers, validateWords bool) {
 	move.Covers = covers
-	top, left := BoardSize, BoardSize
+	top, left := board.Size, board.Size
 	bottom, right := -1, -1
 	for coord := range covers {
 		if coord.Row < top {
@@ -249,30 +497,124 @@ func (move *TileMove) Init(board *Board, covers Covers, validateWords bool) {
 	move.Word = string(word)
 }
 
+// spans returns true if the given square is covered by the move, or
+// lies between its covers, i.e. is a square whose tile the move
+// plays through
+func (move *TileMove) spans(coord Coordinate) bool {
+	return coord.Row >= move.TopLeft.Row && coord.Row <= move.BottomRight.Row &&
+		coord.Col >= move.TopLeft.Col && coord.Col <= move.BottomRight.Col
+}
+
 // IsValid returns true if the TileMove is valid in the current Game
 func (move *TileMove) IsValid(game *Game) bool {
+	return move.isValid(&game.Board, game.TileSet, game.Dawg, game.RackSize)
+}
+
+// IsValidTileMove returns true if the given TileMove is valid
+// in the GameState, i.e. on its board and with its rack size
+func (state *GameState) IsValidTileMove(move *TileMove) bool {
+	return move.isValid(state.Board, state.TileSet, state.Dawg, state.RackSize())
+}
+
+// BestBlankAssignment finds the best meaning for the blank tile in the
+// given covers, which must contain exactly one blank ('?'). Each letter
+// of the alphabet is tried as the blank's meaning, and the meaning that
+// forms the highest-scoring valid move in the GameState is returned,
+// along with the score of that move. If there is no single blank in
+// the covers, or no meaning forms a valid move, (0, 0) is returned.
+// As a blank tile scores no points by itself, ties are common; they
+// go to the meaning that comes first in the alphabet. The covers are
+// not modified.
+func (state *GameState) BestBlankAssignment(covers Covers) (rune, int) {
+	var blank Coordinate
+	blanks := 0
+	for coord, cover := range covers {
+		if cover.Letter == '?' {
+			blank = coord
+			blanks++
+		}
+	}
+	if blanks != 1 {
+		return 0, 0
+	}
+	bestMeaning, bestScore := rune(0), 0
+	trial := maps.Clone(covers)
+	for _, meaning := range state.Dawg.alphabet.asRunes {
+		trial[blank] = Cover{Letter: '?', Meaning: meaning}
+		move := NewTileMove(state.Board, trial)
+		if !state.IsValidTileMove(move) {
+			continue
+		}
+		if score := move.Score(state); score > bestScore {
+			bestMeaning, bestScore = meaning, score
+		}
+	}
+	return bestMeaning, bestScore
+}
+
+// unknownLetter returns a letter in the covers of the move, or the
+// meaning of a blank tile, that is not in the given tile set, if any
+func (move *TileMove) unknownLetter(tileSet *TileSet) (rune, bool) {
+	for _, coord := range move.coveredSquares() {
+		cover := move.Covers[coord]
+		if !tileSet.Contains(cover.Letter) {
+			return cover.Letter, true
+		}
+		if !tileSet.Contains(cover.Meaning) {
+			return cover.Meaning, true
+		}
+	}
+	return 0, false
+}
+
+// isValid returns true if the TileMove is valid on the given board,
+// with the given tile set, dictionary and rack size
+func (move *TileMove) isValid(board *Board, tileSet *TileSet, dawg *Dawg, rackSize int) bool {
+	return move.validate(board, tileSet, dawg, rackSize) == nil
+}
+
+// validate returns nil if the TileMove is valid on the given board,
+// with the given tile set, dictionary and rack size, or otherwise
+// a MoveError describing why it is not. The covers are checked in
+// board order, so the error is the same each time.
+func (move *TileMove) validate(board *Board, tileSet *TileSet, dawg *Dawg, rackSize int) *MoveError {
 	// Check the validity of the move
-	if len(move.Covers) < 1 || len(move.Covers) > RackSize {
-		return false
+	if len(move.Covers) < 1 || len(move.Covers) > rackSize {
+		return newMoveError(InvalidTileCount,
+			"a move must lay down between 1 and %v tiles", rackSize)
 	}
-	board := game.Board
 	// Count the number of tiles adjacent to the covers
 	var numAdjacentTiles = 0
-	for coord := range move.Covers {
-		if coord.Row < 0 || coord.Row >= BoardSize ||
-			coord.Col < 0 || coord.Col >= BoardSize {
-			return false
+	for _, coord := range move.coveredSquares() {
+		cover := move.Covers[coord]
+		if coord.Row < 0 || coord.Row >= board.Size ||
+			coord.Col < 0 || coord.Col >= board.Size {
+			return newMoveError(OffBoard, "a tile is placed outside the board")
+		}
+		if !tileSet.Contains(cover.Letter) {
+			// The tile is not in the tile set
+			return newMoveError(InvalidLetter, "'%c' is not a valid tile", cover.Letter).
+				at(coord)
+		}
+		if !dawg.alphabet.Contains(cover.Meaning) ||
+			(cover.Letter != '?' && cover.Meaning != cover.Letter) {
+			// The meaning of the tile is not a letter of the
+			// game's alphabet, or the tile is not a blank tile
+			// and means something other than its own letter
+			return newMoveError(InvalidLetter, "'%c' is not a valid meaning of the tile '%c'",
+				cover.Meaning, cover.Letter).at(coord)
 		}
 		if board.TileAt(coord.Row, coord.Col) != nil {
 			// There is already a tile in this square
-			return false
+			return newMoveError(SquareOccupied, "the square %v is already occupied",
+				squareName(coord)).at(coord)
 		}
 		numAdjacentTiles += board.NumAdjacentTiles(coord.Row, coord.Col)
 	}
 	if move.BottomRight.Row > move.TopLeft.Row &&
 		move.BottomRight.Col > move.TopLeft.Col {
 		// Not strictly horizontal or strictly vertical
-		return false
+		return newMoveError(NonLinear, "the tiles must be in a single row or column")
 	}
 	// Check for gaps
 	if move.Horizontal {
@@ -282,7 +624,8 @@ func (move *TileMove) IsValid(game *Game) bool {
 			_, covered := move.Covers[Coordinate{row, i}]
 			if !covered && board.TileAt(row, i) == nil {
 				// There is a missing square in the covers
-				return false
+				return newMoveError(Gap, "there is a gap at %v",
+					squareName(Coordinate{row, i})).at(Coordinate{row, i})
 			}
 		}
 	} else {
@@ -292,7 +635,8 @@ func (move *TileMove) IsValid(game *Game) bool {
 			_, covered := move.Covers[Coordinate{i, col}]
 			if !covered && board.TileAt(i, col) == nil {
 				// There is a missing square in the covers
-				return false
+				return newMoveError(Gap, "there is a gap at %v",
+					squareName(Coordinate{i, col})).at(Coordinate{i, col})
 			}
 		}
 	}
@@ -300,42 +644,127 @@ func (move *TileMove) IsValid(game *Game) bool {
 	if board.NumTiles == 0 {
 		startSquare := board.StartSquare()
 		if _, covered := move.Covers[startSquare]; !covered {
-			return false
+			return newMoveError(FirstMoveMustCoverStart,
+				"the first move must cover the start square %v", squareName(startSquare)).
+				at(startSquare)
 		}
 	} else {
 		// At least one cover must touch a tile
 		// that is already on the board
 		if numAdjacentTiles == 0 {
-			return false
+			return newMoveError(NotConnected,
+				"the move must connect to the tiles already on the board")
 		}
 	}
 	if !move.ValidateWords {
 		// No need to validate the words formed by this move on the board:
-		// return true, we're done
-		return true
+		// return nil, we're done
+		return nil
 	}
 	if move.Word == IllegalMoveWord || move.Word == "" {
-		return false
+		return newMoveError(WordNotInDictionary, "the tiles do not form a word")
 	}
-	if !move.ValidateWord(game.Dawg) {
-		return false
+	if !move.ValidateWord(dawg) {
+		err := newMoveError(WordNotInDictionary,
+			"the word '%v' is not in the dictionary", move.CleanWord())
+		err.Word = move.CleanWord()
+		return err
 	}
 	// Check the cross words
-	for coord, cover := range move.Covers {
-		left, right := game.Board.CrossWords(coord.Col, coord.Row, !move.Horizontal)
-		if len(left) > 0 || len(right) > 0 {
-			// There is a cross word here: check it
-			prefix := make([]rune, 0, len(left)+len(right)+1)
-			prefix = append(prefix, left...)
-			prefix = append(prefix, cover.Meaning)
-			prefix = append(prefix, right...)
-			if !game.Dawg.Find(string(prefix)) {
-				// Not found in the dictionary
-				return false
+	var err *MoveError
+	move.forEachCrossWord(board, func(coord Coordinate, word string) bool {
+		if !dawg.FindRaw(word) {
+			// Not found in the dictionary
+			err = newMoveError(CrossWordInvalid,
+				"the cross word '%v' at %v is not in the dictionary", word, squareName(coord)).
+				at(coord)
+			err.Word = word
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// ValidateTileMove returns nil if the given TileMove can be made by the
+// player to move in the GameState, i.e. if it is valid on its board,
+// with its rack size, and its tiles are in the rack, or otherwise a
+// MoveError describing why it cannot be made
+func (state *GameState) ValidateTileMove(move *TileMove) *MoveError {
+	if letter, missing := move.missingTile(state.Rack.AsRunes()); missing {
+		return newMoveError(TileNotInRack, "the tile '%c' is not in the rack", letter)
+	}
+	return move.validate(state.Board, state.TileSet, state.Dawg, state.RackSize())
+}
+
+// missingTile returns a letter of the tiles laid down by the move that
+// is not in the given rack, taking the number of each letter into
+// account, or false if the rack contains all the tiles
+func (move *TileMove) missingTile(rack []rune) (rune, bool) {
+	tiles := MakeRackTiles(rack)
+	for _, coord := range move.coveredSquares() {
+		letter := move.Covers[coord].Letter
+		if !tiles.ContainsTile(letter) {
+			return letter, true
+		}
+		tiles.RemoveTile(letter)
+	}
+	return 0, false
+}
+
+// crossWords returns the words formed across the move, in the
+// order of the covers, given the board before the move is made
+func (move *TileMove) crossWords(board *Board) []string {
+	words := make([]string, 0, len(move.Covers))
+	move.forEachCrossWord(board, func(coord Coordinate, word string) bool {
+		words = append(words, word)
+		return true
+	})
+	return words
+}
+
+// forEachCrossWord calls visit() with the square and the word of each
+// cross word formed by the move, in the order of the covers, given the
+// board before the move is made, until visit() returns false
+func (move *TileMove) forEachCrossWord(board *Board, visit func(coord Coordinate, word string) bool) {
+	row, col := move.TopLeft.Row, move.TopLeft.Col
+	for row <= move.BottomRight.Row && col <= move.BottomRight.Col {
+		if cover, covered := move.Covers[Coordinate{row, col}]; covered {
+			left, right := board.CrossWords(row, col, !move.Horizontal)
+			if len(left) > 0 || len(right) > 0 {
+				// There is a cross word here
+				word := make([]rune, 0, len(left)+len(right)+1)
+				word = append(word, left...)
+				word = append(word, cover.Meaning)
+				word = append(word, right...)
+				if !visit(Coordinate{row, col}, string(word)) {
+					return
+				}
 			}
 		}
+		if move.Horizontal {
+			col++
+		} else {
+			row++
+		}
 	}
-	return true
+}
+
+// InvalidWords returns the words formed by the move, i.e. the main
+// word and the cross words, that are not found in the dictionary,
+// given the board before the move is made. An empty list means that
+// all the words are valid.
+func (move *TileMove) InvalidWords(board *Board, dawg *Dawg) []string {
+	invalid := make([]string, 0)
+	if move.Word == IllegalMoveWord || !move.ValidateWord(dawg) {
+		invalid = append(invalid, move.CleanWord())
+	}
+	for _, word := range move.crossWords(board) {
+		if !dawg.FindRaw(word) {
+			invalid = append(invalid, word)
+		}
+	}
+	return invalid
 }
 
 func (move *TileMove) CleanWord() string {
@@ -344,29 +773,48 @@ func (move *TileMove) CleanWord() string {
 }
 
 func (move *TileMove) ValidateWord(dawg *Dawg) bool {
-	return dawg.Find(move.CleanWord())
+	return dawg.FindRaw(move.CleanWord())
 }
 
 // Apply moves the tiles in the Covers from the player's Rack
 // to the board Squares
 func (move *TileMove) Apply(game *Game) bool {
-	// The move is assumed to have already been validated via Move.IsValid()
+	// The move is assumed to have already been validated via Move.IsValid(),
+	// which does not check the rack. Check that the rack contains all the
+	// tiles, and that they can be placed, before placing any of them, so
+	// that a failed move leaves the board and the rack untouched.
 	rack := &game.Racks[game.PlayerToMove()]
+	if _, missing := move.missingTile(rack.AsRunes()); missing {
+		return false
+	}
+	for coord, cover := range move.Covers {
+		meaning := cover.Letter
+		if meaning == '?' {
+			meaning = cover.Meaning
+		}
+		if sq := game.Board.Sq(coord.Row, coord.Col); sq == nil || sq.Tile != nil ||
+			!game.Dawg.alphabet.Contains(meaning) {
+			return false
+		}
+	}
+	rack.Emptied = nil
 	for coord, cover := range move.Covers {
 		// Find the tile in the player's rack
 		tile := rack.FindTile(cover.Letter)
 		if tile == nil {
-			// Not found: abort
+			// Should not happen, as the rack has been checked above
 			return false
 		}
+		// Note the slot that the tile leaves, so that it can
+		// be refilled without disturbing the other tiles
+		rack.markEmptied(rack.slotOf(tile))
 		if cover.Letter == '?' {
 			tile.Meaning = cover.Meaning
 		} else {
 			tile.Meaning = cover.Letter
 		}
 		if !game.PlayTile(tile, coord.Row, coord.Col) {
-			// The tile was not found in the player's rack.
-			// This is not good as the move may have been only partially applied.
+			// Should not happen, as the move has been checked above
 			return false
 		}
 	}
@@ -376,10 +824,21 @@ func (move *TileMove) Apply(game *Game) bool {
 }
 
 // Score returns the score of the TileMove, if
-// played in the given Game
+// played in the given Game.
+//
+// The scoring model is as follows. The main word is the sum of the
+// letter scores of all its tiles, where newly laid tiles are multiplied
+// by the letter multiplier of their square, and the sum is then
+// multiplied by the product of the word multipliers of the squares
+// covered by the move. Each newly laid tile that forms a cross word
+// scores that word separately: the plain scores of the tiles already
+// on the board, plus the new tile times its letter multiplier, all
+// times the word multiplier of the new tile's square. The premiums of
+// squares that were already occupied never count. Finally, the bingo
+// bonus is added if the entire rack was played.
 func (move *TileMove) Score(state *GameState) int {
-	if move.CachedScore != nil {
-		return *move.CachedScore
+	if score, ok := move.knownScore(); ok {
+		return score
 	}
 	// Cumulative letter score
 	var score = 0
@@ -410,7 +869,9 @@ func (move *TileMove) Score(state *GameState) int {
 		if cover, covered := move.Covers[Coordinate{row, col}]; covered {
 			// This square is covered by the move: apply its letter
 			// and word multipliers
-			thisScore := state.TileSet.Scores[cover.Letter] * sq.LetterMultiplier
+			// The letters of a valid move are in the tile set
+			letterScore, _ := state.TileSet.Score(cover.Letter)
+			thisScore := letterScore * sq.LetterMultiplier
 			score += thisScore
 			multiplier *= sq.WordMultiplier
 			// Add cross score, if any
@@ -442,15 +903,101 @@ func (move *TileMove) Score(state *GameState) int {
 	score *= multiplier
 	// Add cross scores
 	score += crossScore
-	if len(move.Covers) == RackSize {
+	if len(move.Covers) == state.RackSize() {
 		// The player played his entire rack: add the bingo bonus
-		score += BingoBonus
+		score += scoringRules(state.Rules).BingoBonus
 	}
-	// Only calculate the score once, then cache it
-	move.CachedScore = &score
+	// Only calculate the score once, then cache it. If another
+	// goroutine got here at the same time, it stored the same score.
+	atomic.StoreInt64(&move.scored, int64(score)+1)
 	return score
 }
 
+// knownScore returns the score of the move and true if it has been
+// precomputed or calculated, or (0, false) otherwise
+func (move *TileMove) knownScore() (int, bool) {
+	if move.CachedScore != nil {
+		return *move.CachedScore, true
+	}
+	if scored := atomic.LoadInt64(&move.scored); scored != 0 {
+		return int(scored - 1), true
+	}
+	return 0, false
+}
+
+// ScoreBreakdown returns the score of the TileMove, if played
+// in the given Game, broken down by the words that it forms
+func (move *TileMove) ScoreBreakdown(state *GameState) *ScoreBreakdown {
+	breakdown := &ScoreBreakdown{
+		CrossWords: make([]WordScore, 0, len(move.Covers)),
+	}
+	var score = 0
+	var multiplier = 1
+	var rowIncr, colIncr = 0, 0
+	var direction int
+	if move.Horizontal {
+		direction = LEFT
+		colIncr = 1
+	} else {
+		direction = ABOVE
+		rowIncr = 1
+	}
+	// This follows the same path across the board as Score()
+	row, col := move.TopLeft.Row, move.TopLeft.Col
+	for _, tile := range state.Board.Fragment(row, col, direction) {
+		score += tile.Score
+	}
+	for {
+		sq := state.Board.Sq(row, col)
+		if sq == nil {
+			break
+		}
+		if cover, covered := move.Covers[Coordinate{row, col}]; covered {
+			// The letters of a valid move are in the tile set
+			letterScore, _ := state.TileSet.Score(cover.Letter)
+			thisScore := letterScore * sq.LetterMultiplier
+			score += thisScore
+			multiplier *= sq.WordMultiplier
+			hasCrossing, csc := state.Board.CrossScore(row, col, !move.Horizontal)
+			if hasCrossing {
+				left, right := state.Board.CrossWords(row, col, !move.Horizontal)
+				breakdown.CrossWords = append(breakdown.CrossWords, WordScore{
+					Word:  string(left) + string(cover.Meaning) + string(right),
+					Score: (csc + thisScore) * sq.WordMultiplier,
+				})
+			}
+		} else {
+			score += sq.Tile.Score
+		}
+		if row >= move.BottomRight.Row && col >= move.BottomRight.Col {
+			break
+		}
+		row += rowIncr
+		col += colIncr
+	}
+	row, col = move.BottomRight.Row, move.BottomRight.Col
+	if move.Horizontal {
+		direction = RIGHT
+	} else {
+		direction = BELOW
+	}
+	for _, tile := range state.Board.Fragment(row, col, direction) {
+		score += tile.Score
+	}
+	breakdown.MainWord = WordScore{
+		Word:  move.CleanWord(),
+		Score: score * multiplier,
+	}
+	if len(move.Covers) == state.RackSize() {
+		breakdown.BingoBonus = scoringRules(state.Rules).BingoBonus
+	}
+	breakdown.Total = breakdown.MainWord.Score + breakdown.BingoBonus
+	for _, crossWord := range breakdown.CrossWords {
+		breakdown.Total += crossWord.Score
+	}
+	return breakdown
+}
+
 // NewPassMove returns a reference to a fresh PassMove
 func NewPassMove() *PassMove {
 	return &PassMove{}
@@ -506,24 +1053,32 @@ func (move *ExchangeMove) IsValid(game *Game) bool {
 	if move == nil || game == nil {
 		return false
 	}
-	if !game.Bag.ExchangeAllowed() {
+	return move.validate(game) == nil
+}
+
+// validate returns nil if the ExchangeMove is valid in the game,
+// or otherwise a MoveError describing why it is not
+func (move *ExchangeMove) validate(game *Game) *MoveError {
+	if !game.Bag.ExchangeAllowedFor(game.RackSize) {
 		// Too few tiles left in the bag
-		return false
+		return newMoveError(ExchangeNotAllowed,
+			"exchanges are not allowed when the bag has fewer than %v tiles", game.RackSize)
 	}
 	runes := []rune(move.Letters)
-	if len(runes) < 1 || len(runes) > RackSize {
-		return false
+	if len(runes) < 1 || len(runes) > game.RackSize {
+		return newMoveError(InvalidTileCount,
+			"an exchange must include between 1 and %v tiles", game.RackSize)
 	}
 	rack := game.Racks[game.PlayerToMove()].AsString()
 	for _, letter := range runes {
 		if !strings.ContainsRune(rack, letter) {
 			// This exchanged letter is not in the player's rack
-			return false
+			return newMoveError(TileNotInRack, "the tile '%c' is not in the rack", letter)
 		}
 		rack = strings.Replace(rack, string(letter), "", 1)
 	}
 	// All exchanged letters found: the move is OK
-	return true
+	return nil
 }
 
 func (move *ExchangeMove) Marshal(score int) ([]byte, error) {
@@ -544,22 +1099,25 @@ func (move *ExchangeMove) Marshal(score int) ([]byte, error) {
 // from the Bag
 func (move *ExchangeMove) Apply(game *Game) bool {
 	rack := &game.Racks[game.PlayerToMove()]
-	tiles := make([]*Tile, 0, RackSize)
-	// First, remove the exchanged tiles from the player's Rack
+	tiles := make([]*Tile, 0, game.RackSize)
+	// First, remove the exchanged tiles from the player's Rack,
+	// noting the slots that they leave
+	rack.Emptied = nil
 	for _, letter := range move.Letters {
 		tile := rack.FindTile(letter)
 		if tile == nil {
 			// Should not happen!
 			return false
 		}
+		rack.markEmptied(rack.slotOf(tile))
 		if !rack.RemoveTile(tile) {
 			// Should not happen!
 			return false
 		}
 		tiles = append(tiles, tile)
 	}
-	// Replenish the Rack from the Bag...
-	rack.Fill(game.Bag)
+	// Replenish the emptied slots from the Bag...
+	rack.FillPreservingOrder(game.Bag)
 	// ...before returning the exchanged tiles to the Bag
 	for _, tile := range tiles {
 		game.Bag.ReturnTile(tile)
@@ -609,11 +1167,110 @@ func (move *FinalMove) Marshal(score int) ([]byte, error) {
 }
 
 // Score returns the opponent's rack leave, multiplied
-// by a multiplication factor that can be 1 or 2
+// by a multiplication factor that can be 1 or 2,
+// less the time penalty, if any
 func (move *FinalMove) Score(state *GameState) int {
 	var adj = 0
 	for _, letter := range move.OpponentRack {
-		adj += state.TileSet.Scores[letter]
+		// The rack was dealt from the tile set
+		score, _ := state.TileSet.Score(letter)
+		adj += score
 	}
-	return adj * move.MultiplyFactor
+	return adj*move.MultiplyFactor - move.TimePenalty
+}
+
+// NewVoidMove returns a reference to a fresh VoidMove
+// for the given, challenged TileMove
+func NewVoidMove(move *TileMove) *VoidMove {
+	return &VoidMove{Move: move}
+}
+
+// String return a string description of the VoidMove
+func (move *VoidMove) String() string {
+	return "Void " + move.Move.String()
+}
+
+// IsValid always returns true for a VoidMove
+func (move *VoidMove) IsValid(game *Game) bool {
+	return true
+}
+
+func (move *VoidMove) Marshal(score int) ([]byte, error) {
+	type VoidJson struct {
+		Coordinate string `json:"co"`
+		Word       string `json:"w"`
+		Score      int    `json:"sc"`
+		Void       bool   `json:"void"`
+	}
+	j := VoidJson{
+		Coordinate: move.Move.Coordinate(),
+		Word:       move.Move.Word,
+		Score:      score,
+		Void:       true,
+	}
+	return json.Marshal(j)
+}
+
+// Apply always succeeds and returns true for a VoidMove
+func (move *VoidMove) Apply(game *Game) bool {
+	// Increment the number of consecutive zero-point moves
+	game.NumPassMoves++
+	return true
+}
+
+// Score is always 0 for a VoidMove
+func (move *VoidMove) Score(state *GameState) int {
+	return 0
+}
+
+// NewResignMove returns a reference to a fresh ResignMove
+func NewResignMove() *ResignMove {
+	return &ResignMove{}
+}
+
+// NewTimeForfeitMove returns a reference to a fresh ResignMove
+// for a player who has run out of time
+func NewTimeForfeitMove() *ResignMove {
+	return &ResignMove{TimeForfeit: true}
+}
+
+// String return a string description of the ResignMove
+func (move *ResignMove) String() string {
+	if move.TimeForfeit {
+		return "Time"
+	}
+	return "Resign"
+}
+
+// IsValid always returns true for a ResignMove
+func (move *ResignMove) IsValid(game *Game) bool {
+	return true
+}
+
+func (move *ResignMove) Marshal(score int) ([]byte, error) {
+	type ResignJson struct {
+		Word  string `json:"w"`
+		Score int    `json:"sc"`
+	}
+	j := ResignJson{
+		Word:  "RSGN",
+		Score: score,
+	}
+	if move.TimeForfeit {
+		j.Word = "TIME"
+	}
+	return json.Marshal(j)
+}
+
+// Apply marks the game as resigned by the player to move,
+// and always succeeds
+func (move *ResignMove) Apply(game *Game) bool {
+	game.Resigned = true
+	game.Resigner = game.PlayerToMove()
+	return true
+}
+
+// Score is always 0 for a ResignMove
+func (move *ResignMove) Score(state *GameState) int {
+	return 0
 }
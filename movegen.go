@@ -34,7 +34,8 @@ a game state, comprising a Board, a Rack, and a vocabulary word graph
 (DAWG), it returns all legal tile moves.
 
 Moves are found by examining each one-dimensional Axis of the board
-in turn, i.e. 15 rows and 15 columns for a total of 30 axes.
+in turn, i.e. 15 rows and 15 columns for a total of 30 axes on a
+standard board.
 For each Axis an array of pointers to its corresponding Board Squares
 is constructed. The cross-check set of each empty Square is calculated,
 i.e. the set of letters that form valid words by connecting with word parts
@@ -87,11 +88,20 @@ of the SCRABBLE trademark.
 
 package skrafl
 
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 // ExtendRightNavigator implements the core of the Appel-Jacobson
 // algorithm. It proceeds along an Axis, covering empty Squares with
 // Tiles from the Rack while obeying constraints from the Dawg and
 // the cross-check sets. As final nodes in the Dawg are encountered,
-// valid tile moves are generated and saved.
+// valid tile moves are generated and added to the Axis' move list.
 type ExtendRightNavigator struct {
 	axis           *Axis
 	anchor         int
@@ -100,14 +110,27 @@ type ExtendRightNavigator struct {
 	stack          []ernItem
 	lastCheck      int
 	wildcardInRack bool
-	// The list of valid tile moves found
-	moves []Move
+	// Buffer for the racks that remain as tiles are laid down.
+	// The rack of each edge being navigated is stored above the
+	// racks of the edges enclosing it, and discarded in PopEdge().
+	racks []rune
+	// Scratch buffer for the tiles of the original rack, cf. Accept()
+	tiles []rune
 }
 
 type ernItem struct {
 	rack           []rune
 	index          int
 	wildcardInRack bool
+	racksLen       int
+}
+
+// ernPool holds ExtendRightNavigators for reuse, along with
+// their stacks and buffers
+var ernPool = sync.Pool{
+	New: func() any {
+		return new(ExtendRightNavigator)
+	},
 }
 
 // Matching constants
@@ -124,9 +147,11 @@ func (ern *ExtendRightNavigator) Init(axis *Axis, anchor int, rack []rune) {
 	ern.anchor = anchor
 	ern.index = anchor
 	ern.rack = rack
+	ern.lastCheck = 0
 	ern.wildcardInRack = ContainsRune(rack, '?')
-	ern.stack = make([]ernItem, 0, RackSize)
-	ern.moves = make([]Move, 0)
+	// Reuse the stack and buffers from a previous navigation, if any
+	ern.stack = ern.stack[:0]
+	ern.racks = ern.racks[:0]
 }
 
 func (ern *ExtendRightNavigator) check(letter rune) int {
@@ -154,7 +179,7 @@ func (ern *ExtendRightNavigator) check(letter rune) int {
 			left, right := ern.axis.state.Board.CrossWords(sq.Row, sq.Col, !ern.axis.horizontal)
 			if left != "" || right != "" {
 				word := left + string(letter) + right
-				if !ern.axis.state.Dawg.Find(word) {
+				if !ern.axis.state.Dawg.FindRaw(word) {
 					panic("Cross-check violation!")
 				}
 			}
@@ -173,7 +198,7 @@ func (ern *ExtendRightNavigator) PushEdge(letter rune) bool {
 		return false
 	}
 	// Match: save our rack and our index and move into the edge
-	ern.stack = append(ern.stack, ernItem{ern.rack, ern.index, ern.wildcardInRack})
+	ern.stack = append(ern.stack, ernItem{ern.rack, ern.index, ern.wildcardInRack, len(ern.racks)})
 	return true
 }
 
@@ -184,6 +209,7 @@ func (ern *ExtendRightNavigator) PopEdge() bool {
 	last := len(ern.stack) - 1
 	sp := &ern.stack[last]
 	ern.rack, ern.index, ern.wildcardInRack = sp.rack, sp.index, sp.wildcardInRack
+	ern.racks = ern.racks[0:sp.racksLen]
 	ern.stack = ern.stack[0:last]
 	// We need to visit all outgoing edges, so return true
 	return true
@@ -196,7 +222,7 @@ func (ern *ExtendRightNavigator) Done() {
 // IsAccepting returns false if the navigator should not expect more
 // characters
 func (ern *ExtendRightNavigator) IsAccepting() bool {
-	if ern.index >= BoardSize {
+	if ern.index >= ern.axis.size {
 		// Gone off the board edge
 		return false
 	}
@@ -223,13 +249,22 @@ func (ern *ExtendRightNavigator) Accepts(letter rune) bool {
 	// it came from there
 	ern.index++
 	if match == mRackTile {
-		if ContainsRune(ern.rack, letter) {
-			// Used a normal tile
-			ern.rack = RemoveRune(ern.rack, letter)
-		} else {
+		if !ContainsRune(ern.rack, letter) {
 			// Used a blank tile
-			ern.rack = RemoveRune(ern.rack, '?')
+			letter = '?'
+		}
+		// Store the remaining rack in the racks buffer, leaving the
+		// current rack intact for when this edge is popped
+		start := len(ern.racks)
+		for i, r := range ern.rack {
+			if r == letter {
+				ern.racks = append(ern.racks, ern.rack[i+1:]...)
+				break
+			}
+			ern.racks = append(ern.racks, r)
 		}
+		end := len(ern.racks)
+		ern.rack = ern.racks[start:end:end]
 		ern.wildcardInRack = ContainsRune(ern.rack, '?')
 	}
 	return true
@@ -242,7 +277,7 @@ func (ern *ExtendRightNavigator) Accept(matched []rune, final bool, state *navSt
 		panic("ExtendRightNavigator should not be resumable")
 	}
 	if !final ||
-		(ern.index < BoardSize && ern.axis.sq[ern.index].Tile != nil) {
+		(ern.index < ern.axis.size && ern.axis.sq[ern.index].Tile != nil) {
 		// Not a complete word, or ends on an occupied square:
 		// not a legal tile move
 		return
@@ -256,25 +291,30 @@ func (ern *ExtendRightNavigator) Accept(matched []rune, final bool, state *navSt
 	covers := make(Covers)
 	// Calculate the starting index within the axis
 	start := ern.index - len(matched)
-	// The original rack
-	rack := MakeRackTiles(ern.axis.rack)
+	// The tiles of the original rack, using normal tiles before blanks
+	tiles := append(ern.tiles[:0], ern.axis.rack...)
 	for i, meaning := range matched {
 		sq := ern.axis.sq[start+i]
 		if sq.Tile == nil {
 			letter := meaning
-			if rack.ContainsTile(meaning) {
-				rack.RemoveTile(meaning)
-			} else {
+			ix := slices.Index(tiles, meaning)
+			if ix < 0 {
 				// Must be using a blank tile
 				letter = '?'
-				rack.RemoveTile('?')
+				ix = slices.Index(tiles, '?')
 			}
+			// Remove the tile, in no particular order
+			last := len(tiles) - 1
+			tiles[ix] = tiles[last]
+			tiles = tiles[:last]
 			covers[Coordinate{sq.Row, sq.Col}] = Cover{letter, meaning}
 		}
 	}
+	ern.tiles = tiles
 	// No need to validate robot-generated tile moves
 	tileMove := NewUncheckedTileMove(ern.axis.state.Board, covers)
-	ern.moves = append(ern.moves, tileMove)
+	ern.axis.scoreMove(tileMove, start, ern.index-1)
+	ern.axis.moves = append(ern.axis.moves, tileMove)
 }
 
 // Axis stores information about a row or column on the board where
@@ -287,27 +327,43 @@ type Axis struct {
 	rackSet uint
 	// The original rack, as an array of runes
 	rack []rune
+	// The number of squares on this Axis, i.e. the board size
+	size int
 	// Array of convenience pointers to the board squares on this Axis
-	sq [BoardSize]*Square
+	sq [MaxBoardSize]*Square
 	// A bitmap of the letters that are allowed on each square,
 	// intersected with the current rack
-	crossCheck [BoardSize]uint
+	crossCheck [MaxBoardSize]uint
 	// A boolean for each square indicating whether it is an anchor
 	// square
-	isAnchor [BoardSize]bool
+	isAnchor [MaxBoardSize]bool
+	// For each empty square, whether a tile placed there forms a
+	// cross-word, and if so, the sum of the scores of the tiles
+	// already on the board in the cross-word, cf. Board.CrossScore()
+	hasCross   [MaxBoardSize]bool
+	crossScore [MaxBoardSize]int
+	// The list of moves found so far, cf. generateMoves()
+	moves []Move
+	// Statistics counters, or nil if statistics are not collected
+	counters *genCounters
 }
 
-// Init initializes a fresh Axis object, associating it with a board
-// row or column
+// Init initializes an Axis object, associating it with a board
+// row or column. The Axis may have been used before, for another
+// row or column.
 func (axis *Axis) Init(state *GameState, rackSet uint, index int, horizontal bool) {
+	axis.isAnchor = [MaxBoardSize]bool{}
+	axis.hasCross = [MaxBoardSize]bool{}
+	axis.crossScore = [MaxBoardSize]int{}
 	axis.state = state
 	axis.rackSet = rackSet
 	axis.horizontal = horizontal
 	axis.rack = state.Rack.AsRunes()
 	board := state.Board
+	axis.size = board.Size
 	startSquare := board.StartSquare()
 	// Build an array of pointers to the squares on this axis
-	for i := 0; i < BoardSize; i++ {
+	for i := 0; i < axis.size; i++ {
 		if horizontal {
 			axis.sq[i] = board.Sq(index, i)
 		} else {
@@ -316,7 +372,7 @@ func (axis *Axis) Init(state *GameState, rackSet uint, index int, horizontal boo
 	}
 	// Mark all empty squares having at least one occupied
 	// adjacent square as anchors
-	for i, sq := range axis.sq {
+	for i, sq := range axis.sq[:axis.size] {
 		if sq.Tile != nil {
 			// Already have a tile here: not an anchor and no
 			// cross-check set needed
@@ -342,10 +398,41 @@ func (axis *Axis) Init(state *GameState, rackSet uint, index int, horizontal boo
 			// the rack can be placed in it due to cross-words.
 			axis.isAnchor[i] = true
 			axis.crossCheck[i] = rackSet & axis.crossSet(sq)
+			// Only squares with adjacent tiles can have cross-words
+			axis.hasCross[i], axis.crossScore[i] = board.CrossScore(sq.Row, sq.Col, !horizontal)
 		}
 	}
 }
 
+// scoreMove calculates the score of a tile move whose word spans the
+// squares from start to end (inclusive) on this Axis, in the same way
+// as TileMove.Score() but using the precomputed cross scores, and
+// caches it in the move
+func (axis *Axis) scoreMove(move *TileMove, start, end int) {
+	state := axis.state
+	score, crossScore, multiplier := 0, 0, 1
+	for i := start; i <= end; i++ {
+		sq := axis.sq[i]
+		if sq.Tile != nil {
+			// Already covered: add the letter score only
+			score += sq.Tile.Score
+			continue
+		}
+		letterScore, _ := state.TileSet.Score(move.Covers[Coordinate{sq.Row, sq.Col}].Letter)
+		thisScore := letterScore * sq.LetterMultiplier
+		score += thisScore
+		multiplier *= sq.WordMultiplier
+		if axis.hasCross[i] {
+			crossScore += (axis.crossScore[i] + thisScore) * sq.WordMultiplier
+		}
+	}
+	score = score*multiplier + crossScore
+	if len(move.Covers) == state.RackSize() {
+		score += scoringRules(state.Rules).BingoBonus
+	}
+	move.CachedScore = &score
+}
+
 func (axis *Axis) crossSet(sq *Square) uint {
 	// Check whether the cross word(s) limit the set of allowed
 	// letters in this anchor square
@@ -380,11 +467,17 @@ func (axis *Axis) Allows(index int, letter rune) bool {
 	return axis.state.Dawg.alphabet.Member(letter, axis.crossCheck[index])
 }
 
-// genMovesFromAnchor returns the available moves that use the given square
-// within the Axis as an anchor
-func (axis *Axis) genMovesFromAnchor(anchor int, maxLeft int, leftParts [][]*LeftPart) []Move {
+// genMovesFromAnchor adds the available moves that use the given square
+// within the Axis as an anchor to the Axis' move list
+func (axis *Axis) genMovesFromAnchor(anchor int, maxLeft int, leftParts [][]*LeftPart) {
 	dawg, board, rack := axis.state.Dawg, axis.state.Board, axis.rack
 	sq := axis.sq[anchor]
+	ern := ernPool.Get().(*ExtendRightNavigator)
+	defer func() {
+		// Don't keep the Axis alive while in the pool
+		ern.axis, ern.rack = nil, nil
+		ernPool.Put(ern)
+	}()
 
 	// Do we have a left part already on the board,
 	// just before this anchor?
@@ -407,31 +500,25 @@ func (axis *Axis) genMovesFromAnchor(anchor int, maxLeft int, leftParts [][]*Lef
 		// Do the DAWG navigation to find the left part
 		var lfn LeftFindNavigator
 		lfn.Init(left)
-		dawg.NavigateResumable(&lfn)
+		dawg.navigate(&lfn, true, axis.counters)
 		if lfn.state == nil {
 			// No matching prefix found: there cannot be any
 			// valid completions of the left part that is already
 			// there.
-			return nil
+			return
 		}
 		// We found a matching prefix in the graph:
 		// do an ExtendRight from that location, using the whole rack
-		var ern ExtendRightNavigator
 		ern.Init(axis, anchor, rack)
-		dawg.Resume(&ern, lfn.state, left)
-		// Return the move list accumulated by the ExtendRightNavigator
-		return ern.moves
+		dawg.resume(ern, lfn.state, left, axis.counters)
+		return
 	}
 
 	// We are not completing an existing left part
 	// Begin by extending an empty prefix to the right, i.e. placing
 	// tiles on the anchor square itself and to its right
-	moves := make([]Move, 0)
-	var ern ExtendRightNavigator
 	ern.Init(axis, anchor, rack)
-	dawg.Navigate(&ern)
-	// Collect the moves found so far
-	moves = append(moves, ern.moves...)
+	dawg.navigate(ern, false, axis.counters)
 
 	// Follow this by an effort to permute left prefixes into the
 	// open space to the left of the anchor square, if any
@@ -440,23 +527,25 @@ func (axis *Axis) genMovesFromAnchor(anchor int, maxLeft int, leftParts [][]*Lef
 		// Try all left prefixes of length leftLen
 		leftList := leftParts[leftLen-1]
 		for _, leftPart := range leftList {
-			var ern ExtendRightNavigator
 			ern.Init(axis, anchor, leftPart.rack)
-			dawg.Resume(&ern, leftPart.state, leftPart.matched)
-			moves = append(moves, ern.moves...)
+			dawg.resume(ern, leftPart.state, leftPart.matched, axis.counters)
 		}
 	}
-
-	// Return the accumulated move list
-	return moves
 }
 
 // GenerateMoves returns a list of all legal moves along this Axis
 func (axis *Axis) GenerateMoves(leftParts [][]*LeftPart) []Move {
-	moves := make([]Move, 0)
+	return axis.generateMoves(leftParts, make([]Move, 0))
+}
+
+// generateMoves appends all legal moves along this Axis to the
+// given move list, and returns it
+func (axis *Axis) generateMoves(leftParts [][]*LeftPart, moves []Move) []Move {
+	axis.moves = moves
 	lastAnchor := -1
+	anchors := int64(0)
 	// Process the anchors, one by one, from left to right
-	for i := 0; i < BoardSize; i++ {
+	for i := 0; i < axis.size; i++ {
 		if !axis.IsAnchor(i) {
 			continue
 		}
@@ -473,50 +562,319 @@ func (axis *Axis) GenerateMoves(leftParts [][]*LeftPart) []Move {
 				openCnt++
 				left--
 			}
-			moves = append(
-				moves,
-				axis.genMovesFromAnchor(i, openCnt, leftParts)...,
-			)
+			axis.genMovesFromAnchor(i, openCnt, leftParts)
+			anchors++
 		}
 		lastAnchor = i
 	}
+	if axis.counters != nil {
+		axis.counters.anchors.Add(anchors)
+	}
+	moves, axis.moves = axis.moves, nil
 	return moves
 }
 
 // GenerateMoves returns a list of all legal moves in the GameState,
 // considering the Board and the player's Rack. The generation works
-// by dividing the task into 30 sub-tasks of finding legal moves within
-// each Axis, i.e. all columns and rows of the board. These sub-tasks
-// are performed concurrently (and hopefully in parallel to some extent)
-// by 30 goroutines.
+// by dividing the task into sub-tasks of finding legal moves within
+// each Axis, i.e. all columns and rows of the board (30 on a standard
+// board). These sub-tasks are performed concurrently (and hopefully in
+// parallel to some extent) by one goroutine per Axis. On an empty
+// board, only the Axis through the start square is processed, and
+// the moves may come from the opening cache, cf. SetOpeningCacheSize().
 func (state *GameState) GenerateMoves() []Move {
+	moves, _ := state.GenerateMovesCtx(context.Background(), 0)
+	return moves
+}
+
+// GenStats contains statistics about a move generation,
+// cf. GenerateMovesWithStats(). The cross-check cache statistics
+// are those of the GameState's Dawg during the generation; they
+// include any concurrent use of the Dawg by other generations.
+type GenStats struct {
+	AnchorsProcessed int64         `json:"anchors"`
+	NodesVisited     int64         `json:"nodes"`
+	MovesGenerated   int           `json:"moves"`
+	Duration         time.Duration `json:"duration_ns"`
+	CrossCacheHits   uint64        `json:"cross_cache_hits"`
+	CrossCacheMisses uint64        `json:"cross_cache_misses"`
+}
+
+// genCounters accumulates GenStats counters from
+// concurrent move generation workers
+type genCounters struct {
+	anchors atomic.Int64
+	nodes   atomic.Int64
+}
+
+// GenerateMovesWithStats works like GenerateMoves(), and if stats
+// is not nil, fills it with statistics about the move generation
+func (state *GameState) GenerateMovesWithStats(stats *GenStats) []Move {
+	if stats == nil {
+		return state.GenerateMoves()
+	}
+	var counters genCounters
+	before := state.Dawg.crossCache.Stats()
+	start := time.Now()
+	moves, _ := state.generateMovesCtx(context.Background(), 0, &counters)
+	after := state.Dawg.crossCache.Stats()
+	*stats = GenStats{
+		AnchorsProcessed: counters.anchors.Load(),
+		NodesVisited:     counters.nodes.Load(),
+		MovesGenerated:   len(moves),
+		Duration:         time.Since(start),
+		CrossCacheHits:   after.Hits - before.Hits,
+		CrossCacheMisses: after.Misses - before.Misses,
+	}
+	return moves
+}
+
+// HintSquare describes the letters from the rack that can be placed
+// on an empty board square, as part of a horizontal or a vertical
+// move, according to the cross-checks of the square
+type HintSquare struct {
+	Row               int    `json:"row"`
+	Col               int    `json:"col"`
+	HorizontalAllowed string `json:"horizontal"`
+	VerticalAllowed   string `json:"vertical"`
+	IsAnchor          bool   `json:"anchor"`
+}
+
+// CrossCheckLetters returns a HintSquare for each square of the Board,
+// indexed by row and column. Squares that already have a tile on them
+// allow no letters. If the rack contains a blank tile, any letter that
+// is allowed by the cross-checks can be placed. Note that the cross-checks
+// only constrain the words formed across a move, so a letter that passes
+// them is not necessarily part of any valid move.
+func (state *GameState) CrossCheckLetters() [][]HintSquare {
+	alphabet := &state.Dawg.alphabet
+	rackSet := alphabet.MakeSet(state.Rack.AsRunes())
+	size := state.Board.Size
+	hints := make([][]HintSquare, size)
+	for row := 0; row < size; row++ {
+		hints[row] = make([]HintSquare, size)
+		for col := 0; col < size; col++ {
+			hints[row][col] = HintSquare{Row: row, Col: col}
+		}
+	}
+	for index := 0; index < size; index++ {
+		var horizontal, vertical Axis
+		horizontal.Init(state, rackSet, index, true)
+		vertical.Init(state, rackSet, index, false)
+		for i := 0; i < size; i++ {
+			// The horizontal axis is row index, the vertical one column index
+			if horizontal.sq[i].Tile == nil {
+				hint := &hints[index][i]
+				hint.HorizontalAllowed = string(alphabet.MembersOf(horizontal.crossCheck[i]))
+				hint.IsAnchor = hint.IsAnchor || horizontal.IsAnchor(i)
+			}
+			if vertical.sq[i].Tile == nil {
+				hint := &hints[i][index]
+				hint.VerticalAllowed = string(alphabet.MembersOf(vertical.crossCheck[i]))
+				hint.IsAnchor = hint.IsAnchor || vertical.IsAnchor(i)
+			}
+		}
+	}
+	return hints
+}
+
+// BestMoves returns the n highest-scoring legal moves in the GameState,
+// with their scores, sorted in descending order by score. If n is 0
+// or negative, all legal moves are returned. If there are no legal
+// tile moves, an empty list is returned.
+func (state *GameState) BestMoves(n int) []MoveWithScore {
+	moves, _ := state.bestMoves(n, nil, nil)
+	return moves
+}
+
+// bestMoves works like BestMoves(), collecting statistics about
+// the move generation in stats if it is not nil. If keep is not nil,
+// only the moves for which it returns true are included. The number
+// of moves included before the first n are taken is also returned.
+func (state *GameState) bestMoves(n int, stats *GenStats, keep func(Move) bool) ([]MoveWithScore, int) {
+	moves := state.GenerateMovesWithStats(stats)
+	if keep != nil {
+		kept := moves[:0]
+		for _, move := range moves {
+			if keep(move) {
+				kept = append(kept, move)
+			}
+		}
+		moves = kept
+	}
+	// Sort by descending score, breaking ties by position and word,
+	// so that the result does not depend on the order in which the
+	// concurrent move generation happened to find the moves
+	sort.Sort(byScore{state, moves})
+	total := len(moves)
+	if n > 0 && len(moves) > n {
+		moves = moves[0:n]
+	}
+	movesWithScores := make([]MoveWithScore, len(moves))
+	for i, move := range moves {
+		movesWithScores[i] = MoveWithScore{
+			Move:  move,
+			Score: move.Score(state),
+		}
+	}
+	return movesWithScores, total
+}
+
+// HasUniqueBest returns true if there is a single highest-scoring
+// legal move in the GameState, i.e. if the best move is not tied
+// with another move. It returns false if there are no legal moves.
+func (state *GameState) HasUniqueBest() bool {
+	best := state.BestMoves(2)
+	switch len(best) {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	return best[0].Score > best[1].Score
+}
+
+// GenerateMovesCtx works like GenerateMoves(), but uses at most the
+// given number of worker goroutines (or one per Axis if workers is
+// zero or negative), and stops when the context is cancelled.
+// Once cancelled, no further axes are processed and the moves found
+// so far are returned, along with the context's error. The moves
+// may then be incomplete. Workers that are in the middle of an Axis
+// finish it before exiting, without blocking.
+func (state *GameState) GenerateMovesCtx(ctx context.Context, workers int) ([]Move, error) {
+	return state.generateMovesCtx(ctx, workers, nil)
+}
+
+// generateMovesCtx works like GenerateMovesCtx(), optionally
+// collecting statistics in the given counters
+func (state *GameState) generateMovesCtx(ctx context.Context, workers int, counters *genCounters) ([]Move, error) {
+	if cache := openingCache.Load(); cache != nil && state.Board.NumTiles == 0 {
+		return cache.lookup(state, func() ([]Move, error) {
+			return state.collectMoves(ctx, workers, counters)
+		})
+	}
+	return state.collectMoves(ctx, workers, counters)
+}
+
+// collectMoves generates moves as generateMovesCtx() does,
+// without consulting the opening move cache
+func (state *GameState) collectMoves(ctx context.Context, workers int, counters *genCounters) ([]Move, error) {
+	stream := state.generateMovesStream(ctx, workers, counters)
+	// Collect the moves from the stream into a list
+	moves := make([]Move, 0, 256) // Allocate space for 256 moves
+	for {
+		select {
+		case move, ok := <-stream:
+			if !ok {
+				// The stream is closed: all axes have been processed,
+				// unless the context was cancelled
+				return moves, ctx.Err()
+			}
+			moves = append(moves, move)
+		case <-ctx.Done():
+			return moves, ctx.Err()
+		}
+	}
+}
+
+// GenerateMovesStream works like GenerateMoves(), but sends the moves
+// on the returned channel as they are generated, i.e. as each Axis
+// is completed, instead of waiting for all axes. The channel is closed
+// when all axes have been processed or the context is cancelled,
+// in which case the moves may be incomplete.
+func (state *GameState) GenerateMovesStream(ctx context.Context) <-chan Move {
+	return state.generateMovesStream(ctx, 0, nil)
+}
+
+// axisMovesHint is a running average of the number of moves found
+// on an Axis, used to size the move lists of the workers in
+// generateMovesStream()
+var axisMovesHint atomic.Int64
+
+func init() {
+	axisMovesHint.Store(64)
+}
+
+// updateAxisMovesHint adds the number of moves found on an Axis
+// to the running average in axisMovesHint. Concurrent updates may
+// be lost, which is of no consequence.
+func updateAxisMovesHint(numMoves int) {
+	hint := axisMovesHint.Load()
+	axisMovesHint.Store(hint + (int64(numMoves)-hint)/16)
+}
+
+// generateMovesStream generates moves on the axes of the board using
+// the given number of workers (or one per Axis if workers is zero or
+// negative), sending them on the returned channel, which is closed
+// when all workers have exited. If counters is not nil, statistics
+// about the generation are collected in it.
+func (state *GameState) generateMovesStream(ctx context.Context, workers int, counters *genCounters) <-chan Move {
 	rack := state.Rack.AsRunes()
 	// Generate a bit map for the letters in the rack. If the rack
 	// contains blank tiles ('?'), the bit map will have all bits set.
 	rackSet := state.Dawg.alphabet.MakeSet(rack)
-	leftParts := FindLeftParts(state.Dawg, rack)
-	// Result channel containing up to BoardSize*2 move lists
-	resultMoves := make(chan []Move, BoardSize*2)
-	// Goroutine to find moves on a particular axis
-	// (row or column)
-	kickOffAxis := func(index int, horizontal bool) {
-		var axis Axis
-		axis.Init(state, rackSet, index, horizontal)
-		// Generate a list of moves and send it on the result channel
-		resultMoves <- axis.GenerateMoves(leftParts)
+	leftParts := findLeftParts(state.Dawg, rack, counters)
+	size := state.Board.Size
+	numAxes := size * 2
+	// Channel of axes to process, identified by index,
+	// where the horizontal axes come first
+	axes := make(chan int, numAxes)
+	if state.Board.NumTiles == 0 {
+		// On an empty board, the only anchor is the start square,
+		// on the horizontal axis through it (cf. Axis.Init()).
+		// Vertical opening moves are not generated, as they mirror
+		// the horizontal ones: the premiums of all board types
+		// are symmetric about the diagonal.
+		numAxes = 1
+		axes <- state.Board.StartSquare().Row
+	} else {
+		for i := 0; i < numAxes; i++ {
+			axes <- i
+		}
 	}
-	// Start the 30 goroutines (columns and rows = 2 * BoardSize)
-	for i := 0; i < BoardSize; i++ {
-		go kickOffAxis(i, true)  // Horizontal
-		go kickOffAxis(i, false) // Vertical
+	close(axes)
+	if workers <= 0 || workers > numAxes {
+		workers = numAxes
 	}
-	// Collect move candidates from all goroutines and
-	// append them to the moves list
-	moves := make([]Move, 0, 256) // Allocate space for 256 moves
-	for i := 0; i < BoardSize*2; i++ {
-		moves = append(moves, (<-resultMoves)...)
+	// Result channel for the generated moves. The workers never block
+	// on it once the context is cancelled, even if nobody is
+	// collecting results any more.
+	stream := make(chan Move, 256)
+	// Worker goroutine to find moves on axes (rows or columns)
+	// until there are no more axes or the context is cancelled
+	var wg sync.WaitGroup
+	worker := func() {
+		defer wg.Done()
+		// Each worker reuses a single Axis and move list for all the
+		// axes that it processes
+		var axis Axis
+		moves := make([]Move, 0, axisMovesHint.Load())
+		for index := range axes {
+			if ctx.Err() != nil {
+				return
+			}
+			axis.Init(state, rackSet, index%size, index < size)
+			axis.counters = counters
+			moves = axis.generateMoves(leftParts, moves[:0])
+			updateAxisMovesHint(len(moves))
+			// Send the moves on the stream
+			for _, move := range moves {
+				select {
+				case stream <- move:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
 	}
-	// All goroutines have returned and we have a complete list
-	// of generated moves
-	return moves
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	// Close the stream when all workers have exited
+	go func() {
+		wg.Wait()
+		close(stream)
+	}()
+	return stream
 }
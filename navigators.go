@@ -29,11 +29,22 @@ package skrafl
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 // Navigator is an interface that describes behaviors that control the
-// navigation of a Dawg
+// navigation of a Dawg.
+//
+// The matched slice passed to Accept() is only valid for the duration
+// of the call, unless the navigation is resumable (in which case state
+// is not nil). A non-resumable navigation reuses a single buffer for
+// the matched letters, overwriting it as it backtracks, so navigators
+// that need to keep the matched letters must copy them, as e.g.
+// PermutationNavigator does by converting them to a string.
+// FindNavigator and ExtendRightNavigator never keep them.
 type Navigator interface {
 	IsAccepting() bool
 	Accepts(rune) bool
@@ -53,12 +64,28 @@ type Navigation struct {
 	// If the navigation doesn't require this, leave isResumable set
 	// to false for best performance.
 	isResumable bool
+	// If counters is not nil, the number of nodes visited is
+	// counted and added to it when the navigation is done
+	counters     *genCounters
+	nodesVisited int64
+}
+
+// matchedPool holds buffers for the matched letters of non-resumable
+// navigations, cf. Navigation.FromEdge()
+var matchedPool = sync.Pool{
+	New: func() any {
+		buf := make([]rune, 0, MaxBoardSize+1)
+		return &buf
+	},
 }
 
 // FromNode continues a navigation from a node in the Dawg,
 // enumerating through outgoing edges until the navigator is
 // satisfied
 func (nav *Navigation) FromNode(offset uint32, matched []rune) {
+	if nav.counters != nil {
+		nav.nodesVisited++
+	}
 	iter := nav.dawg.iterNode(offset)
 	for i := 0; i < len(*iter); i++ {
 		state := &((*iter)[i])
@@ -81,13 +108,20 @@ func (nav *Navigation) FromEdge(state *navState, alreadyMatched []rune) {
 	lenP := len(state.prefix)
 	j := 0
 	navigator := nav.navigator
-	// Copy the alreadyMatched rune slice into a new rune slice
-	var matched []rune
-	numMatched := len(alreadyMatched)
-	if numMatched > 0 {
-		matched = make([]rune, numMatched, numMatched+lenP)
-		copy(matched, alreadyMatched)
+	matched := alreadyMatched
+	if nav.isResumable {
+		// Accept() may keep the matched slice along with the navigation
+		// state, so copy the alreadyMatched rune slice into a new one
+		matched = nil
+		numMatched := len(alreadyMatched)
+		if numMatched > 0 {
+			matched = make([]rune, numMatched, numMatched+lenP)
+			copy(matched, alreadyMatched)
+		}
 	}
+	// Otherwise, append to the alreadyMatched slice in place. This only
+	// overwrites letters beyond it, which belong to edges that have
+	// already been fully navigated.
 	for j < lenP && navigator.IsAccepting() {
 		if !navigator.Accepts(state.prefix[j]) {
 			// The navigator doesn't want this prefix letter:
@@ -112,7 +146,7 @@ func (nav *Navigation) FromEdge(state *navState, alreadyMatched []rune) {
 			// The prefix is complete: if there is no next node, or if
 			// the next node is marked with a final bit, we're at a
 			// complete word boundary
-			if state.nextNode == 0 || nav.dawg.b[state.nextNode]&0x80 != 0 {
+			if state.nextNode == 0 || nav.dawg.bytes()[state.nextNode]&0x80 != 0 {
 				final = true
 			}
 		}
@@ -148,9 +182,16 @@ func (nav *Navigation) Go(dawg *Dawg, navigator Navigator) {
 	nav.navigator = navigator
 	if navigator.IsAccepting() {
 		// Leave our home harbor and set sail for the open seas
-		nav.FromNode(0, []rune{})
+		if nav.isResumable {
+			nav.FromNode(0, []rune{})
+		} else {
+			buf := matchedPool.Get().(*[]rune)
+			nav.FromNode(0, (*buf)[:0])
+			matchedPool.Put(buf)
+		}
 	}
 	navigator.Done()
+	nav.countNodes()
 }
 
 // Resume continues a navigation on the underlying Dawg
@@ -164,9 +205,28 @@ func (nav *Navigation) Resume(dawg *Dawg, navigator Navigator, state *navState,
 	nav.navigator = navigator
 	if navigator.IsAccepting() {
 		// Leave from our previously dropped buoy
-		nav.FromEdge(state, matched)
+		if nav.isResumable {
+			nav.FromEdge(state, matched)
+		} else {
+			// The matched slice may be shared, e.g. by a LeftPart
+			// that is resumed concurrently on several axes: copy
+			// it into a buffer that we can append to in place
+			buf := matchedPool.Get().(*[]rune)
+			nav.FromEdge(state, append((*buf)[:0], matched...))
+			matchedPool.Put(buf)
+		}
 	}
 	navigator.Done()
+	nav.countNodes()
+}
+
+// countNodes adds the number of nodes visited in the navigation
+// to its counters, if any
+func (nav *Navigation) countNodes() {
+	if nav.counters != nil {
+		nav.counters.nodes.Add(nav.nodesVisited)
+		nav.nodesVisited = 0
+	}
 }
 
 // FindNavigator stores the state for a plain word search in the Dawg,
@@ -238,6 +298,10 @@ type PermutationNavigator struct {
 	stack   []string
 	results []string
 	minLen  int
+	// If maxLen is positive, the navigation is pruned once
+	// that number of tiles has been consumed from the rack
+	maxLen   int
+	numTiles int
 }
 
 // Init initializes a PermutationNavigator with the word to search for
@@ -246,6 +310,7 @@ func (pn *PermutationNavigator) Init(rack string, minLen int) {
 	pn.minLen = minLen
 	pn.stack = make([]string, 0, RackSize)
 	pn.results = make([]string, 0)
+	pn.numTiles = utf8.RuneCountInString(rack)
 }
 
 // PushEdge determines whether the navigation should proceed into
@@ -277,6 +342,10 @@ func (pn *PermutationNavigator) Done() {
 // IsAccepting returns false if the navigator should not expect more
 // characters
 func (pn *PermutationNavigator) IsAccepting() bool {
+	if pn.maxLen > 0 && pn.numTiles-utf8.RuneCountInString(pn.rack) >= pn.maxLen {
+		// We've already consumed the maximum number of tiles
+		return false
+	}
 	return len(pn.rack) > 0
 }
 
@@ -309,8 +378,40 @@ func (pn *PermutationNavigator) Accept(matched []rune, final bool, state *navSta
 	}
 }
 
+// RackStatsNavigator works like a PermutationNavigator, but instead of
+// collecting the permutations of a rack, it accumulates statistics
+// about them in a RackStats instance
+type RackStatsNavigator struct {
+	PermutationNavigator
+	stats RackStats
+}
+
+// Accept is called to inform the navigator of a match and
+// whether it is a final word
+func (rn *RackStatsNavigator) Accept(matched []rune, final bool, state *navState) {
+	if !final || len(matched) < 2 {
+		return
+	}
+	length := len(matched)
+	rn.stats.Words++
+	rn.stats.ByLength[length]++
+	if length == RackSize {
+		rn.stats.Bingos++
+	}
+	// The words come out sorted alphabetically, so the first
+	// word of the greatest length is kept
+	if length > len([]rune(rn.stats.Longest)) {
+		rn.stats.Longest = string(matched)
+	}
+}
+
 // MatchNavigator stores the state for a pattern matching
-// navigation of a Dawg, and implements the Navigator interface
+// navigation of a Dawg, and implements the Navigator interface.
+// In the pattern, '?' matches exactly one letter, while '*'
+// matches zero or more letters. Other runes match themselves.
+// Patterns that contain '*', or have a limit on the number of
+// wildcard letters, are matched by tracking the set of pattern
+// positions that the letters matched so far can lead to.
 type MatchNavigator struct {
 	pattern    []rune
 	lenP       int
@@ -319,34 +420,120 @@ type MatchNavigator struct {
 	isWildcard bool
 	stack      []matchItem
 	results    []string
+	// If general is true, the pattern contains '*' or the
+	// number of letters matched by wildcards is limited
+	general bool
+	// The maximum number of letters matched by '?' or '*',
+	// or a negative number if there is no limit
+	maxWildcards int
+	// In general mode, positions[i] is the minimum number of
+	// letters matched by wildcards on the way to pattern
+	// position i, or -1 if position i cannot be reached
+	positions []int
 }
 
 type matchItem struct {
 	index      int
 	chMatch    rune
 	isWildcard bool
+	positions  []int
 }
 
 // Init initializes a MatchNavigator with the word to search for
 func (mn *MatchNavigator) Init(pattern []rune) {
+	mn.InitWithLimit(pattern, -1)
+}
+
+// InitWithLimit initializes a MatchNavigator with the word to search
+// for, allowing at most maxWildcards letters to be matched by '?' or
+// '*'. A negative maxWildcards means that there is no limit.
+func (mn *MatchNavigator) InitWithLimit(pattern []rune, maxWildcards int) {
 	// Convert the word to a list of runes
 	mn.pattern = pattern
 	mn.lenP = len(mn.pattern)
-	mn.chMatch = mn.pattern[0]
-	mn.isWildcard = mn.chMatch == '?'
 	mn.stack = make([]matchItem, 0, RackSize)
 	// The initial capacity of the results list, 16, is just
 	// a guesstimate / magic number
 	mn.results = make([]string, 0, 16)
+	mn.maxWildcards = maxWildcards
+	mn.general = maxWildcards >= 0 || slices.Contains(pattern, '*')
+	if mn.general {
+		// Start at position 0, and at any positions that can
+		// be reached from it by '*' matching zero letters
+		mn.positions = make([]int, mn.lenP+1)
+		for i := range mn.positions {
+			mn.positions[i] = -1
+		}
+		mn.positions[0] = 0
+		mn.closure(mn.positions)
+		return
+	}
+	mn.chMatch = mn.pattern[0]
+	mn.isWildcard = mn.chMatch == '?'
+}
+
+// closure extends a set of pattern positions with the positions
+// that follow a '*' matching zero letters
+func (mn *MatchNavigator) closure(positions []int) {
+	for i := 0; i < mn.lenP; i++ {
+		if positions[i] >= 0 && mn.pattern[i] == '*' {
+			if positions[i+1] < 0 || positions[i] < positions[i+1] {
+				positions[i+1] = positions[i]
+			}
+		}
+	}
+}
+
+// step returns the set of pattern positions that can be reached
+// from the current ones by matching the given letter, and whether
+// the set is nonempty
+func (mn *MatchNavigator) step(chr rune) ([]int, bool) {
+	next := make([]int, mn.lenP+1)
+	for i := range next {
+		next[i] = -1
+	}
+	reached := func(i, used int) {
+		if mn.maxWildcards >= 0 && used > mn.maxWildcards {
+			// Over the wildcard budget
+			return
+		}
+		if next[i] < 0 || used < next[i] {
+			next[i] = used
+		}
+	}
+	for i := 0; i < mn.lenP; i++ {
+		used := mn.positions[i]
+		if used < 0 {
+			continue
+		}
+		switch mn.pattern[i] {
+		case '*':
+			// The '*' matches this letter and possibly more
+			reached(i, used+1)
+		case '?':
+			reached(i+1, used+1)
+		case chr:
+			reached(i+1, used)
+		}
+	}
+	mn.closure(next)
+	return next, slices.ContainsFunc(next, func(used int) bool { return used >= 0 })
 }
 
 // PushEdge determines whether the navigation should proceed into
 // an edge having chr as its first letter
 func (mn *MatchNavigator) PushEdge(chr rune) bool {
+	if mn.general {
+		if _, ok := mn.step(chr); !ok {
+			return false
+		}
+		mn.stack = append(mn.stack, matchItem{positions: mn.positions})
+		return true
+	}
 	if chr != mn.chMatch && !mn.isWildcard {
 		return false
 	}
-	mn.stack = append(mn.stack, matchItem{mn.index, mn.chMatch, mn.isWildcard})
+	mn.stack = append(mn.stack, matchItem{mn.index, mn.chMatch, mn.isWildcard, nil})
 	return true
 }
 
@@ -356,8 +543,9 @@ func (mn *MatchNavigator) PopEdge() bool {
 	last := len(mn.stack) - 1
 	mt := &mn.stack[last]
 	mn.index, mn.chMatch, mn.isWildcard = mt.index, mt.chMatch, mt.isWildcard
+	mn.positions = mt.positions
 	mn.stack = mn.stack[0:last]
-	return mn.isWildcard
+	return mn.general || mn.isWildcard
 }
 
 // Done is called when the navigation is complete
@@ -367,12 +555,29 @@ func (mn *MatchNavigator) Done() {
 // IsAccepting returns false if the navigator should not expect more
 // characters
 func (mn *MatchNavigator) IsAccepting() bool {
+	if mn.general {
+		// We can accept more characters if we are at a
+		// position in the pattern other than its end
+		for i := 0; i < mn.lenP; i++ {
+			if mn.positions[i] >= 0 {
+				return true
+			}
+		}
+		return false
+	}
 	return mn.index < mn.lenP
 }
 
 // Accepts returns true if the navigator should accept and 'eat' the
 // given character
 func (mn *MatchNavigator) Accepts(chr rune) bool {
+	if mn.general {
+		next, ok := mn.step(chr)
+		if ok {
+			mn.positions = next
+		}
+		return ok
+	}
 	if chr != mn.chMatch && !mn.isWildcard {
 		// Not a correct next character in the word
 		return false
@@ -389,12 +594,155 @@ func (mn *MatchNavigator) Accepts(chr rune) bool {
 // Accept is called to inform the navigator of a match and
 // whether it is a final word
 func (mn *MatchNavigator) Accept(matched []rune, final bool, state *navState) {
-	if final && mn.index == mn.lenP {
+	if !final {
+		return
+	}
+	if (mn.general && mn.positions[mn.lenP] >= 0) || (!mn.general && mn.index == mn.lenP) {
 		// Entire pattern match
 		mn.results = append(mn.results, string(matched))
 	}
 }
 
+// LengthNavigator finds the words of a given length in the Dawg,
+// and implements the Navigator interface. The navigation is pruned
+// at that length, and stops once a limit on the number of results,
+// if any, has been reached.
+type LengthNavigator struct {
+	length  int
+	limit   int
+	depth   int
+	stack   []int
+	results []string
+}
+
+// Init initializes a LengthNavigator with the word length to search
+// for and the maximum number of results, or 0 for no limit
+func (ln *LengthNavigator) Init(length, limit int) {
+	ln.length = length
+	ln.limit = limit
+	ln.depth = 0
+	ln.stack = make([]int, 0, length)
+	ln.results = make([]string, 0)
+}
+
+// full returns true if the limit on the number of results has been reached
+func (ln *LengthNavigator) full() bool {
+	return ln.limit > 0 && len(ln.results) >= ln.limit
+}
+
+// PushEdge determines whether the navigation should proceed into
+// an edge having chr as its first letter
+func (ln *LengthNavigator) PushEdge(chr rune) bool {
+	ln.stack = append(ln.stack, ln.depth)
+	return true
+}
+
+// PopEdge returns false if there is no need to visit other edges
+// after this one has been traversed
+func (ln *LengthNavigator) PopEdge() bool {
+	last := len(ln.stack) - 1
+	ln.depth = ln.stack[last]
+	ln.stack = ln.stack[0:last]
+	return !ln.full()
+}
+
+// Done is called when the navigation is complete
+func (ln *LengthNavigator) Done() {
+}
+
+// IsAccepting returns false if the navigator should not expect more
+// characters
+func (ln *LengthNavigator) IsAccepting() bool {
+	return ln.depth < ln.length && !ln.full()
+}
+
+// Accepts returns true if the navigator should accept and 'eat' the
+// given character
+func (ln *LengthNavigator) Accepts(chr rune) bool {
+	ln.depth++
+	return true
+}
+
+// Accept is called to inform the navigator of a match and
+// whether it is a final word
+func (ln *LengthNavigator) Accept(matched []rune, final bool, state *navState) {
+	if final && len(matched) == ln.length && !ln.full() {
+		ln.results = append(ln.results, string(matched))
+	}
+}
+
+// ContainingNavigator finds the words in the Dawg that contain all
+// of a given list of letters, and implements the Navigator interface.
+// A letter that occurs more than once in the list must occur at least
+// as many times in a word. The navigation stops once a limit on the
+// number of results, if any, has been reached.
+type ContainingNavigator struct {
+	// The letters that the word matched so far does not yet contain
+	missing []rune
+	limit   int
+	stack   [][]rune
+	results []string
+}
+
+// Init initializes a ContainingNavigator with the letters to search
+// for and the maximum number of results, or 0 for no limit
+func (cn *ContainingNavigator) Init(letters []rune, limit int) {
+	cn.missing = letters
+	cn.limit = limit
+	cn.stack = make([][]rune, 0, RackSize)
+	cn.results = make([]string, 0)
+}
+
+// full returns true if the limit on the number of results has been reached
+func (cn *ContainingNavigator) full() bool {
+	return cn.limit > 0 && len(cn.results) >= cn.limit
+}
+
+// PushEdge determines whether the navigation should proceed into
+// an edge having chr as its first letter
+func (cn *ContainingNavigator) PushEdge(chr rune) bool {
+	cn.stack = append(cn.stack, cn.missing)
+	return true
+}
+
+// PopEdge returns false if there is no need to visit other edges
+// after this one has been traversed
+func (cn *ContainingNavigator) PopEdge() bool {
+	last := len(cn.stack) - 1
+	cn.missing = cn.stack[last]
+	cn.stack = cn.stack[0:last]
+	return !cn.full()
+}
+
+// Done is called when the navigation is complete
+func (cn *ContainingNavigator) Done() {
+}
+
+// IsAccepting returns false if the navigator should not expect more
+// characters
+func (cn *ContainingNavigator) IsAccepting() bool {
+	return !cn.full()
+}
+
+// Accepts returns true if the navigator should accept and 'eat' the
+// given character
+func (cn *ContainingNavigator) Accepts(chr rune) bool {
+	if ContainsRune(cn.missing, chr) {
+		// RemoveRune returns a new slice, leaving
+		// the one on the stack intact
+		cn.missing = RemoveRune(cn.missing, chr)
+	}
+	return true
+}
+
+// Accept is called to inform the navigator of a match and
+// whether it is a final word
+func (cn *ContainingNavigator) Accept(matched []rune, final bool, state *navState) {
+	if final && len(cn.missing) == 0 && !cn.full() {
+		cn.results = append(cn.results, string(matched))
+	}
+}
+
 // LeftFindNavigator is similar to FindNavigator, but instead of returning
 // only a bool result, it returns the full navigation state as it is when
 // the requested word prefix is found. This makes it possible to continue the
@@ -601,8 +949,14 @@ func (lpn *LeftPermutationNavigator) Accept(matched []rune, final bool, state *n
 // FindLeftParts returns all left part permutations that can be generated
 // from the given rack, grouped by length
 func FindLeftParts(dawg *Dawg, rack []rune) [][]*LeftPart {
+	return findLeftParts(dawg, rack, nil)
+}
+
+// findLeftParts works like FindLeftParts(), optionally
+// counting the nodes visited
+func findLeftParts(dawg *Dawg, rack []rune, counters *genCounters) [][]*LeftPart {
 	var lpn LeftPermutationNavigator
 	lpn.Init(rack)
-	dawg.NavigateResumable(&lpn)
+	dawg.navigate(&lpn, true, counters)
 	return lpn.leftParts
 }
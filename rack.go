@@ -24,10 +24,13 @@ package skrafl
 
 import (
 	"fmt"
+	"math/rand"
+	"slices"
 	"strings"
 )
 
-// RackSize contains the number of slots in the Rack
+// RackSize contains the default number of slots in a Rack,
+// cf. GameOptions.RackSize
 const RackSize = 7
 
 // RackTiles contains a map of tiles with their count,
@@ -38,8 +41,11 @@ type RackTiles struct {
 
 // Rack represents a player's rack of Tiles
 type Rack struct {
-	Slots   [RackSize]Square
+	Slots   []Square
 	Content RackTiles
+	// The indices of the slots emptied by the last move,
+	// in ascending order, cf. FillPreservingOrder()
+	Emptied []int
 }
 
 func MakeRackTiles(rack []rune) *RackTiles {
@@ -85,32 +91,53 @@ func (rack *Rack) AddTile(tile rune) {
 // Fill draws tiles from the bag to fill a rack.
 // Returns false if unable to fill all empty slots.
 func (rack *Rack) Fill(bag *Bag) bool {
-	for i := 0; i < RackSize; i++ {
+	for i := range rack.Slots {
 		sq := &rack.Slots[i]
 		if sq.Tile == nil {
 			// Empty slot: draw a tile from the bag
-			sq.Tile = bag.DrawTile()
-		}
-		if sq.Tile != nil {
+			if sq.Tile = bag.DrawTile(); sq.Tile == nil {
+				// The bag is empty: can't fill all empty slots.
+				// This is normal near the end of the game, when
+				// the player continues with a partial rack.
+				return false
+			}
 			// Got a new tile in the rack:
 			// increment the letter's count in the rack map
 			rack.AddTile(sq.Tile.Letter)
-		} else {
-			// Can't fill all empty slots: return false
-			return false
 		}
 	}
 	// Able to fill all empty slots
 	return true
 }
 
+// FillPreservingOrder draws tiles from the bag to fill the slots
+// that were emptied by the last move, cf. Emptied, leaving the
+// other tiles in their slots. Returns false if unable to
+// fill all of those slots.
+func (rack *Rack) FillPreservingOrder(bag *Bag) bool {
+	emptied := rack.Emptied
+	rack.Emptied = nil
+	for _, i := range emptied {
+		sq := &rack.Slots[i]
+		if sq.Tile != nil {
+			continue
+		}
+		if sq.Tile = bag.DrawTile(); sq.Tile == nil {
+			// The bag is empty
+			return false
+		}
+		rack.AddTile(sq.Tile.Letter)
+	}
+	return true
+}
+
 // FillByLetters draws tiles identified by the given
 // array of letters from the Bag to fill the Rack,
 // at least as far as possible.
 // Returns false if a tile corresponding to a letter
 // from the array is not found in the bag.
 func (rack *Rack) FillByLetters(bag *Bag, letters []rune) bool {
-	for i := 0; i < RackSize && len(letters) > 0; i++ {
+	for i := 0; i < len(rack.Slots) && len(letters) > 0; i++ {
 		sq := &rack.Slots[i]
 		if sq.Tile == nil {
 			if sq.Tile = bag.DrawTileByLetter(letters[0]); sq.Tile == nil {
@@ -119,17 +146,24 @@ func (rack *Rack) FillByLetters(bag *Bag, letters []rune) bool {
 			}
 			// Success: cut the letter from the letters array
 			letters = letters[1:]
+			// Got a new tile in the rack:
+			// increment the letter's count in the rack map
+			rack.AddTile(sq.Tile.Letter)
 		}
-		// Got a new tile in the rack:
-		// increment the letter's count in the rack map
-		rack.AddTile(sq.Tile.Letter)
 	}
 	// Could fill rack as far as possible according to the letters array
 	return true
 }
 
-// Init initializes an empty rack
+// Init initializes an empty rack with RackSize slots
 func (rack *Rack) Init() {
+	rack.InitWithSize(RackSize)
+}
+
+// InitWithSize initializes an empty rack with the given number of slots
+func (rack *Rack) InitWithSize(size int) {
+	rack.Slots = make([]Square, size)
+	rack.Content = RackTiles{}
 	// Initialize empty rack slots
 	for i := range rack.Slots {
 		sq := &rack.Slots[i]
@@ -141,9 +175,18 @@ func (rack *Rack) Init() {
 }
 
 // Create a rack containing the tiles specified in the string r,
-// with '?' denoting the blank tile
+// with '?' denoting the blank tile. The rack has RackSize slots,
+// or more if r contains more tiles.
 func NewRack(r []rune, tileSet *TileSet) *Rack {
-	rack := &Rack{}
+	return NewRackWithSize(RackSize, r, tileSet)
+}
+
+// NewRackWithSize creates a rack as NewRack does, but with the
+// given number of slots, or more if r contains more tiles.
+// Letters in decomposed Unicode form are composed first.
+func NewRackWithSize(size int, r []rune, tileSet *TileSet) *Rack {
+	r = []rune(normalizeForLocale(string(r)))
+	rack := &Rack{Slots: make([]Square, max(size, len(r)))}
 	// Initialize rack slots
 	slot := 0
 	for _, letter := range r {
@@ -153,7 +196,7 @@ func NewRack(r []rune, tileSet *TileSet) *Rack {
 		sq.LetterMultiplier = 1
 		sq.WordMultiplier = 1
 		// If tileSet does not contain the letter, return nil
-		score, ok := tileSet.Scores[letter]
+		score, ok := tileSet.Score(letter)
 		if !ok {
 			return nil
 		}
@@ -166,7 +209,7 @@ func NewRack(r []rune, tileSet *TileSet) *Rack {
 		slot++
 	}
 	// Fill in the rest of the rack, if not already full
-	for i := slot; i < RackSize; i++ {
+	for i := slot; i < len(rack.Slots); i++ {
 		sq := &rack.Slots[i]
 		sq.Row = -1
 		sq.Col = i
@@ -176,6 +219,11 @@ func NewRack(r []rune, tileSet *TileSet) *Rack {
 	return rack
 }
 
+// Size returns the number of slots in the Rack
+func (rack *Rack) Size() int {
+	return len(rack.Slots)
+}
+
 // String returns a printable string representation of a Rack
 func (rack *Rack) String() string {
 	var sb strings.Builder
@@ -187,7 +235,7 @@ func (rack *Rack) String() string {
 
 // AsRunes returns the tiles in the Rack as a list of runes
 func (rack *Rack) AsRunes() []rune {
-	runes := make([]rune, 0, RackSize)
+	runes := make([]rune, 0, len(rack.Slots))
 	for _, sq := range rack.Slots {
 		if sq.Tile != nil {
 			runes = append(runes, sq.Tile.Letter)
@@ -221,6 +269,107 @@ func (rack *Rack) HasTile(tile *Tile) bool {
 	return false
 }
 
+// tiles returns the tiles in the Rack slots, with nil
+// for empty slots
+func (rack *Rack) tiles() []*Tile {
+	tiles := make([]*Tile, len(rack.Slots))
+	for i, sq := range rack.Slots {
+		tiles[i] = sq.Tile
+	}
+	return tiles
+}
+
+// setTiles puts the given tiles into the Rack slots,
+// replacing the previous contents of the Rack
+func (rack *Rack) setTiles(tiles []*Tile) {
+	rack.Content = RackTiles{}
+	rack.Emptied = nil
+	for i, tile := range tiles {
+		rack.Slots[i].Tile = tile
+		if tile != nil {
+			rack.AddTile(tile.Letter)
+		}
+	}
+}
+
+// slotOf returns the index of the slot holding the given
+// tile, or -1 if the tile is not in the Rack
+func (rack *Rack) slotOf(tile *Tile) int {
+	for i, sq := range rack.Slots {
+		if tile != nil && sq.Tile == tile {
+			return i
+		}
+	}
+	return -1
+}
+
+// markEmptied adds slot indices to the Emptied list,
+// keeping it sorted
+func (rack *Rack) markEmptied(slots ...int) {
+	for _, i := range slots {
+		if i >= 0 && !slices.Contains(rack.Emptied, i) {
+			rack.Emptied = append(rack.Emptied, i)
+		}
+	}
+	slices.Sort(rack.Emptied)
+}
+
+// MoveTile moves the tile in one slot to another, swapping it with
+// the tile in the other slot, if any. Returns false if a slot index
+// is out of range or the first slot is empty.
+func (rack *Rack) MoveTile(fromSlot, toSlot int) bool {
+	n := len(rack.Slots)
+	if fromSlot < 0 || fromSlot >= n || toSlot < 0 || toSlot >= n ||
+		rack.Slots[fromSlot].Tile == nil {
+		return false
+	}
+	from, to := &rack.Slots[fromSlot], &rack.Slots[toSlot]
+	from.Tile, to.Tile = to.Tile, from.Tile
+	// An emptied slot moves along with the swap
+	for i, slot := range rack.Emptied {
+		if slot == toSlot {
+			rack.Emptied[i] = fromSlot
+		} else if slot == fromSlot {
+			rack.Emptied[i] = toSlot
+		}
+	}
+	slices.Sort(rack.Emptied)
+	return true
+}
+
+// Shuffle rearranges the tiles in the Rack randomly, using the
+// given random generator, or the global one if it is nil.
+// Empty slots stay where they are.
+func (rack *Rack) Shuffle(rnd *rand.Rand) {
+	slots := make([]int, 0, len(rack.Slots))
+	for i, sq := range rack.Slots {
+		if sq.Tile != nil {
+			slots = append(slots, i)
+		}
+	}
+	swap := func(i, j int) {
+		a, b := &rack.Slots[slots[i]], &rack.Slots[slots[j]]
+		a.Tile, b.Tile = b.Tile, a.Tile
+	}
+	if rnd == nil {
+		rand.Shuffle(len(slots), swap)
+	} else {
+		rnd.Shuffle(len(slots), swap)
+	}
+}
+
+// Layout returns the letters of the tiles in the Rack slots,
+// in slot order, with 0 for empty slots
+func (rack *Rack) Layout() []rune {
+	layout := make([]rune, len(rack.Slots))
+	for i, sq := range rack.Slots {
+		if sq.Tile != nil {
+			layout[i] = sq.Tile.Letter
+		}
+	}
+	return layout
+}
+
 // IsEmpty returns true if the Rack is empty
 func (rack *Rack) IsEmpty() bool {
 	if rack == nil {
@@ -257,7 +406,7 @@ func (rack *Rack) FindTiles(letters []rune) []*Tile {
 		return nil
 	}
 	result := make([]*Tile, 0, len(letters))
-	var picked [RackSize]bool
+	picked := make([]bool, len(rack.Slots))
 	for _, letter := range letters {
 		for i, sq := range rack.Slots {
 			if !picked[i] && sq.Tile != nil && sq.Tile.Letter == letter {
@@ -270,6 +419,29 @@ func (rack *Rack) FindTiles(letters []rune) []*Tile {
 	return result
 }
 
+// Contains returns true if the Rack has tiles for all the given
+// letters, counting repeated letters. A blank tile only matches
+// '?', i.e. it does not stand in for a letter that is missing.
+func (rack *Rack) Contains(letters []rune) bool {
+	return len(rack.FindTiles(letters)) == len(letters)
+}
+
+// Leave returns the letters of the tiles that remain in the Rack
+// after removing the tiles for the used letters, in sorted order
+// as in a LeaveTable key, cf. LeaveKey(). As in Contains(), a blank
+// tile is only removed for '?'. Used letters that are not in the
+// Rack are ignored.
+func (rack *Rack) Leave(used []rune) string {
+	if rack == nil {
+		return ""
+	}
+	leave := rack.AsRunes()
+	for _, letter := range used {
+		leave = RemoveRune(leave, letter)
+	}
+	return LeaveKey(leave)
+}
+
 // RemoveTile removes a tile from a Rack
 func (rack *Rack) RemoveTile(tile *Tile) bool {
 	if rack == nil || tile == nil {
@@ -297,7 +469,8 @@ func (rack *Rack) RemoveTile(tile *Tile) bool {
 	return false
 }
 
-// ReturnToBag returns the tiles in the Rack to a Bag
+// ReturnToBag returns the tiles in the Rack to a Bag,
+// clearing any meanings assigned to blank tiles
 func (rack *Rack) ReturnToBag(bag *Bag) {
 	if rack == nil || bag == nil {
 		return
@@ -328,7 +501,7 @@ func (rack *Rack) ReturnToBag(bag *Bag) {
 // for debugging and testing purposes.
 func (rack *Rack) Extract(numTiles int, meaning rune) []*Tile {
 	ex := make([]*Tile, 0, numTiles)
-	for i := 0; i < RackSize && numTiles > 0; i++ {
+	for i := 0; i < len(rack.Slots) && numTiles > 0; i++ {
 		tile := rack.Slots[i].Tile
 		if tile != nil {
 			if tile.Letter == '?' {
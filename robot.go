@@ -24,8 +24,14 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package skrafl
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"math/rand"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // Robot is an interface for automatic players that implement
@@ -38,11 +44,20 @@ type Robot interface {
 // RobotWrapper wraps a Robot implementation
 type RobotWrapper struct {
 	Robot
+	// If Book is not nil, the highest-scoring opening move is
+	// looked up in it when the board is empty, instead of asking
+	// the wrapped robot, cf. NewHighScoreRobotWithBook()
+	Book *OpeningBook
 }
 
 // GenerateMove generates a list of legal tile moves, then
 // asks the wrapped robot to pick one of them to play
 func (rw *RobotWrapper) GenerateMove(state *GameState) Move {
+	if rw.Book != nil {
+		if move := rw.Book.Lookup(state); move != nil {
+			return move
+		}
+	}
 	moves := state.GenerateMoves()
 	return rw.PickMove(state, moves)
 }
@@ -55,8 +70,13 @@ type HighScoreRobot struct {
 }
 
 // OneOfNBestRobot picks one of the N highest-scoring moves at random.
+// A robot created with a random source is not safe for concurrent
+// use, since the source is not; this applies to SimRobot as well.
 type OneOfNBestRobot struct {
 	N int
+	// rng is the random source used to pick moves. If nil,
+	// the (automatically seeded) global source is used.
+	rng *rand.Rand
 }
 
 // Implement a strategy for sorting move lists by score
@@ -75,8 +95,28 @@ func (list byScore) Swap(i, j int) {
 }
 
 func (list byScore) Less(i, j int) bool {
-	// We want descending order, so we reverse the comparison
-	return list.moves[i].Score(list.state) > list.moves[j].Score(list.state)
+	scoreI, scoreJ := list.moves[i].Score(list.state), list.moves[j].Score(list.state)
+	if scoreI != scoreJ {
+		// We want descending order, so we reverse the comparison
+		return scoreI > scoreJ
+	}
+	// Break ties between tile moves by position, direction and word,
+	// so that the order doesn't depend on the order of generation
+	moveI, okI := list.moves[i].(*TileMove)
+	moveJ, okJ := list.moves[j].(*TileMove)
+	if !okI || !okJ {
+		return okI && !okJ
+	}
+	if moveI.TopLeft != moveJ.TopLeft {
+		if moveI.TopLeft.Row != moveJ.TopLeft.Row {
+			return moveI.TopLeft.Row < moveJ.TopLeft.Row
+		}
+		return moveI.TopLeft.Col < moveJ.TopLeft.Col
+	}
+	if moveI.Horizontal != moveJ.Horizontal {
+		return moveI.Horizontal
+	}
+	return moveI.Word < moveJ.Word
 }
 
 // PickMove for a HighScoreRobot picks the highest scoring move available,
@@ -98,7 +138,13 @@ func (robot *HighScoreRobot) PickMove(state *GameState, moves []Move) Move {
 
 // NewHighScoreRobot returns a fresh instance of a HighestScoreRobot
 func NewHighScoreRobot() *RobotWrapper {
-	return &RobotWrapper{&HighScoreRobot{}}
+	return &RobotWrapper{Robot: &HighScoreRobot{}}
+}
+
+// NewHighScoreRobotWithBook returns a fresh instance of a
+// HighScoreRobot that looks up its opening moves in the given book
+func NewHighScoreRobotWithBook(book OpeningBook) *RobotWrapper {
+	return &RobotWrapper{Robot: &HighScoreRobot{}, Book: &book}
 }
 
 // PickMove for OneOfNBestRobot selects one of the N highest-scoring
@@ -112,7 +158,12 @@ func (robot *OneOfNBestRobot) PickMove(state *GameState, moves []Move) Move {
 			moves = moves[:robot.N]
 		}
 		// Pick a move by random from the remaining list
-		pick := rand.Intn(len(moves))
+		var pick int
+		if robot.rng != nil {
+			pick = robot.rng.Intn(len(moves))
+		} else {
+			pick = rand.Intn(len(moves))
+		}
 		return moves[pick]
 	}
 	// No valid tile moves
@@ -126,5 +177,278 @@ func (robot *OneOfNBestRobot) PickMove(state *GameState, moves []Move) Move {
 
 // NewOneOfNBestRobot returns a fresh instance of a OneOfNBestRobot
 func NewOneOfNBestRobot(n int) *RobotWrapper {
-	return &RobotWrapper{&OneOfNBestRobot{N: n}}
+	return &RobotWrapper{Robot: &OneOfNBestRobot{N: n}}
+}
+
+// NewOneOfNBestRobotWithSource returns a fresh instance of a
+// OneOfNBestRobot that picks its moves using the given random source
+func NewOneOfNBestRobotWithSource(n int, source rand.Source) *RobotWrapper {
+	return &RobotWrapper{Robot: &OneOfNBestRobot{N: n, rng: rand.New(source)}}
+}
+
+// LeaveTable maps rack leaves, i.e. the tiles remaining in a rack
+// after a move, to an adjustment of the move's value. The keys are
+// the leave tiles in sorted order, with '?' denoting a blank tile.
+// The table typically contains values for single tiles as well as for
+// some small combinations of tiles.
+type LeaveTable map[string]float64
+
+// LeaveKey returns the LeaveTable key for the given leave tiles
+func LeaveKey(leave []rune) string {
+	sorted := slices.Clone(leave)
+	slices.Sort(sorted)
+	return string(sorted)
+}
+
+// Value returns the value of the given rack leave. If the leave as a
+// whole is not found in the table, the values of its individual tiles
+// are summed, with 0.0 for tiles that are not found either.
+func (table LeaveTable) Value(leave []rune) float64 {
+	if len(leave) == 0 || table == nil {
+		return 0.0
+	}
+	if value, ok := table[LeaveKey(leave)]; ok {
+		return value
+	}
+	value := 0.0
+	for _, tile := range leave {
+		value += table[string(tile)]
+	}
+	return value
+}
+
+// Evaluate returns the value of the given rack leave, making
+// a LeaveTable usable as a LeaveEvaluator
+func (table LeaveTable) Evaluate(leave []rune) float64 {
+	return table.Value(leave)
+}
+
+// ReadLeaveTable reads a LeaveTable from a text source having one
+// leave per line, followed by whitespace and its value, e.g. "?s 31.5".
+// Empty lines and lines starting with '#' are ignored.
+func ReadLeaveTable(r io.Reader) (LeaveTable, error) {
+	table := make(LeaveTable)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid leave table entry on line %v", lineNo)
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid leave value on line %v: %v", lineNo, err)
+		}
+		table[LeaveKey([]rune(fields[0]))] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// moveLeave returns the tiles that remain in the rack
+// after the given move has been made
+func moveLeave(rack []rune, move Move) []rune {
+	switch m := move.(type) {
+	case *TileMove:
+		for _, cover := range m.Covers {
+			rack = RemoveRune(rack, cover.Letter)
+		}
+	case *ExchangeMove:
+		for _, letter := range m.Letters {
+			rack = RemoveRune(rack, letter)
+		}
+	}
+	return rack
+}
+
+// EquityRobot picks the move with the highest equity, i.e. the
+// move's score plus the value of the rack leave that it results in,
+// as looked up in a LeaveTable
+type EquityRobot struct {
+	Leaves LeaveTable
+}
+
+// Equity returns the score of the move plus the value of its rack leave
+func (robot *EquityRobot) Equity(state *GameState, move Move) float64 {
+	leave := moveLeave(state.Rack.AsRunes(), move)
+	return float64(move.Score(state)) + robot.Leaves.Value(leave)
+}
+
+// PickMove for an EquityRobot selects the move with the highest
+// equity, or an exchange move, or a pass move as a last resort.
+// When tile moves are available, the candidate exchanges from
+// GenerateExchanges() are also considered, with an equity equal to
+// the value of the leave that they keep; a tile move wins a tie.
+func (robot *EquityRobot) PickMove(state *GameState, moves []Move) Move {
+	if len(moves) > 0 {
+		best := moves[0]
+		bestEquity := robot.Equity(state, best)
+		for _, move := range moves[1:] {
+			if equity := robot.Equity(state, move); equity > bestEquity {
+				best, bestEquity = move, equity
+			}
+		}
+		for _, exchange := range state.GenerateExchanges() {
+			if equity := robot.Equity(state, exchange); equity > bestEquity {
+				best, bestEquity = exchange, equity
+			}
+		}
+		return best
+	}
+	// No valid tile moves
+	if options := state.RankExchangeMoves(robot.Leaves); len(options) > 0 {
+		// Exchange the tiles that result in the best leave
+		return NewExchangeMove(options[0].Letters)
+	}
+	// Exchange forbidden: Return a pass move
+	return NewPassMove()
+}
+
+// NewEquityRobot returns a fresh instance of an EquityRobot,
+// using the given LeaveTable
+func NewEquityRobot(leaves LeaveTable) *RobotWrapper {
+	return &RobotWrapper{Robot: &EquityRobot{Leaves: leaves}}
+}
+
+// BalancedRobot picks the move with the highest sum of its score and
+// the weighted value of the rack leave that it results in, as
+// evaluated by a LeaveEvaluator
+type BalancedRobot struct {
+	Evaluator   LeaveEvaluator
+	LeaveWeight float64
+}
+
+// PickMove for a BalancedRobot selects the move with the highest
+// combined value, or an exchange move, or a pass move as a last resort
+func (robot *BalancedRobot) PickMove(state *GameState, moves []Move) Move {
+	// Sort by score first, so that ties are broken deterministically
+	sort.Sort(byScore{state, moves})
+	var best Move
+	bestValue := 0.0
+	for _, move := range moves {
+		tileMove, ok := move.(*TileMove)
+		if !ok {
+			continue
+		}
+		leave := state.Rack.AsRunes()
+		for _, letter := range tileMove.TilesUsed(state.Rack) {
+			leave = RemoveRune(leave, letter)
+		}
+		value := float64(move.Score(state)) + robot.LeaveWeight*robot.Evaluator.Evaluate(leave)
+		if best == nil || value > bestValue {
+			best, bestValue = move, value
+		}
+	}
+	if best != nil {
+		return best
+	}
+	// No valid tile moves
+	if !state.exchangeForbidden {
+		// Exchange all tiles, since that is allowed
+		return NewExchangeMove(state.Rack.AsString())
+	}
+	// Exchange forbidden: Return a pass move
+	return NewPassMove()
+}
+
+// NewBalancedRobot returns a fresh instance of a BalancedRobot,
+// using the given LeaveEvaluator and leave weight
+func NewBalancedRobot(evaluator LeaveEvaluator, leaveWeight float64) *RobotWrapper {
+	return &RobotWrapper{Robot: &BalancedRobot{Evaluator: evaluator, LeaveWeight: leaveWeight}}
+}
+
+// DefensiveRobot picks, among the tile moves that score within
+// ScoreWindow points of the highest-scoring move, the one with the
+// highest score less a penalty for the premium word squares that the
+// move opens up for the opponent, cf. openedPremiumPenalty()
+type DefensiveRobot struct {
+	ScoreWindow int
+}
+
+// defensiveReach is the number of squares along a row or a column
+// within which a tile gives the opponent access to a premium square
+const defensiveReach = 4
+
+// openedPremiumPoints is the penalty for opening up a premium
+// word square, per unit of its word multiplier above one
+const openedPremiumPoints = 5
+
+// openedPremiumPenalty returns the penalty for the premium word squares
+// that a tile move opens up, i.e. the empty squares with a word
+// multiplier that are within reach of a tile placed by the move,
+// along its row or column, and that were not within reach of a tile
+// already on the board
+func openedPremiumPenalty(board *Board, move *TileMove) int {
+	penalty := 0
+	directions := [4]Coordinate{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			sq := board.Sq(row, col)
+			if sq.Tile != nil || sq.WordMultiplier < 2 {
+				continue
+			}
+			if _, covered := move.Covers[Coordinate{row, col}]; covered {
+				continue
+			}
+			opened, open := false, false
+			for _, dir := range directions {
+				for dist := 1; dist <= defensiveReach; dist++ {
+					r, c := row+dir.Row*dist, col+dir.Col*dist
+					if _, covered := move.Covers[Coordinate{r, c}]; covered {
+						opened = true
+						break
+					}
+					if s := board.Sq(r, c); s == nil || s.Tile != nil {
+						// Off the board, or already within reach
+						open = open || s != nil
+						break
+					}
+				}
+			}
+			if opened && !open {
+				penalty += (sq.WordMultiplier - 1) * openedPremiumPoints
+			}
+		}
+	}
+	return penalty
+}
+
+// PickMove for a DefensiveRobot selects the move with the best
+// score less the penalty for the premium squares that it opens up,
+// or an exchange move, or a pass move as a last resort
+func (robot *DefensiveRobot) PickMove(state *GameState, moves []Move) Move {
+	if len(moves) == 0 {
+		return (&HighScoreRobot{}).PickMove(state, moves)
+	}
+	sort.Sort(byScore{state, moves})
+	minScore := moves[0].Score(state) - robot.ScoreWindow
+	best, bestValue := moves[0], 0
+	for i, move := range moves {
+		score := move.Score(state)
+		if score < minScore {
+			break
+		}
+		value := score
+		if tileMove, ok := move.(*TileMove); ok {
+			value -= openedPremiumPenalty(state.Board, tileMove)
+		}
+		if i == 0 || value > bestValue {
+			best, bestValue = move, value
+		}
+	}
+	return best
+}
+
+// NewDefensiveRobot returns a fresh instance of a DefensiveRobot,
+// which considers the moves within the given number of points
+// of the highest-scoring move
+func NewDefensiveRobot(scoreWindow int) *RobotWrapper {
+	return &RobotWrapper{Robot: &DefensiveRobot{ScoreWindow: scoreWindow}}
 }
@@ -0,0 +1,648 @@
+// serialize.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements serialization of a complete Game
+// to and from JSON, so that games can be saved and resumed.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+)
+
+// Every Tile in a Game is found in the Tiles array of its Bag,
+// whether it is in the bag, in a rack or on the board. In the
+// serialized form, tiles are therefore referred to by their index
+// within that array, which allows the pointer identity between
+// the bag, the racks and the board to be restored.
+
+// noTile is the tile index of an empty rack slot
+const noTile = -1
+
+// tileJson is the serialized form of a Tile
+type tileJson struct {
+	Letter   string `json:"l"`
+	Meaning  string `json:"m"`
+	Score    int    `json:"s"`
+	PlayedBy int    `json:"p"`
+}
+
+// squareJson is the serialized form of an occupied board Square
+type squareJson struct {
+	Row  int `json:"r"`
+	Col  int `json:"c"`
+	Tile int `json:"t"`
+}
+
+// coverJson is the serialized form of a Cover within a TileMove
+type coverJson struct {
+	Row     int    `json:"r"`
+	Col     int    `json:"c"`
+	Letter  string `json:"l"`
+	Meaning string `json:"m"`
+}
+
+// moveItemJson is the serialized form of a MoveItem
+type moveItemJson struct {
+	RackBefore   string `json:"rack_before"`
+	Score        int    `json:"score"`
+	RackTiles    []int  `json:"rack_tiles"`
+	NumPassMoves int    `json:"num_pass_moves"`
+	Drawn        string `json:"drawn"`
+	// Set if the move was unsuccessfully challenged
+	Challenged       bool `json:"challenged,omitempty"`
+	ChallengePenalty int  `json:"challenge_penalty,omitempty"`
+	// One of "tile", "pass", "exchange", "resign", "void" or "final"
+	Type string `json:"type"`
+	// TileMove, or the TileMove of a VoidMove
+	Covers        []coverJson `json:"covers,omitempty"`
+	TopLeft       Coordinate  `json:"top_left"`
+	BottomRight   Coordinate  `json:"bottom_right"`
+	PrefixLength  int         `json:"prefix_length,omitempty"`
+	Horizontal    bool        `json:"horizontal,omitempty"`
+	Word          string      `json:"word,omitempty"`
+	ValidateWords bool        `json:"validate_words,omitempty"`
+	// ExchangeMove
+	Letters string `json:"letters,omitempty"`
+	// ResignMove
+	TimeForfeit bool `json:"time_forfeit,omitempty"`
+	// FinalMove
+	OpponentRack   string `json:"opponent_rack,omitempty"`
+	MultiplyFactor int    `json:"multiply_factor,omitempty"`
+	TimePenalty    int    `json:"time_penalty,omitempty"`
+}
+
+// gameJson is the serialized form of a Game
+type gameJson struct {
+	Locale        string         `json:"locale"`
+	BoardType     string         `json:"board_type"`
+	PlayerNames   [2]string      `json:"player_names"`
+	Scores        [2]int         `json:"scores"`
+	NumPassMoves  int            `json:"num_pass_moves"`
+	ValidateWords bool           `json:"validate_words"`
+	ChallengeMode ChallengeMode  `json:"challenge_mode"`
+	Tiles         []tileJson     `json:"tiles"`
+	Bag           []int          `json:"bag"`
+	Racks         [2][]int       `json:"racks"`
+	InitialRacks  [2]string      `json:"initial_racks"`
+	Board         []squareJson   `json:"board"`
+	Moves         []moveItemJson `json:"moves"`
+	// The penalty for an unsuccessful challenge, if any
+	ChallengePenalty int `json:"challenge_penalty,omitempty"`
+	// The rack size, if other than the default RackSize
+	RackSize int `json:"rack_size,omitempty"`
+	// The scoring rules, if other than the DefaultScoringRules
+	Rules *ScoringRules `json:"rules,omitempty"`
+}
+
+// rackSize returns the rack size of the serialized game
+func (gj *gameJson) rackSize() int {
+	return GameOptions{RackSize: gj.RackSize}.rackSize()
+}
+
+// marshalMoveItem converts a MoveItem to its serialized form,
+// using the given function to map tiles to their indices
+func marshalMoveItem(item *MoveItem, lookup func(*Tile) (int, error)) (moveItemJson, error) {
+	mj := moveItemJson{
+		RackBefore:       item.RackBefore,
+		Score:            item.Score,
+		NumPassMoves:     item.NumPassMoves,
+		Drawn:            item.Drawn,
+		Challenged:       item.Challenged,
+		ChallengePenalty: item.ChallengePenalty,
+		RackTiles:        make([]int, len(item.RackTiles)),
+	}
+	for slot, tile := range item.RackTiles {
+		mj.RackTiles[slot] = noTile
+		if tile != nil {
+			ix, err := lookup(tile)
+			if err != nil {
+				return mj, err
+			}
+			mj.RackTiles[slot] = ix
+		}
+	}
+	mj.Type = moveType(item.Move)
+	switch move := item.Move.(type) {
+	case *TileMove:
+		marshalTileMove(&mj, move)
+	case *VoidMove:
+		marshalTileMove(&mj, move.Move)
+	case *ExchangeMove:
+		mj.Letters = move.Letters
+	case *ResignMove:
+		mj.TimeForfeit = move.TimeForfeit
+	case *FinalMove:
+		mj.OpponentRack = move.OpponentRack
+		mj.MultiplyFactor = move.MultiplyFactor
+		mj.TimePenalty = move.TimePenalty
+	}
+	if mj.Type == "" {
+		return mj, fmt.Errorf("unable to serialize move of type %T", item.Move)
+	}
+	return mj, nil
+}
+
+// moveType returns the type of a move as it appears in
+// serialized move items, or "" if the type is unknown
+func moveType(move Move) string {
+	switch move.(type) {
+	case *TileMove:
+		return "tile"
+	case *VoidMove:
+		return "void"
+	case *PassMove:
+		return "pass"
+	case *ExchangeMove:
+		return "exchange"
+	case *ResignMove:
+		return "resign"
+	case *FinalMove:
+		return "final"
+	}
+	return ""
+}
+
+// marshalTileMove stores the fields of a TileMove in a serialized
+// move item, with the covers in board order so that the output is
+// deterministic. The cached score is not stored, as it could not
+// be trusted when loading; it is calculated again when needed.
+func marshalTileMove(mj *moveItemJson, move *TileMove) {
+	mj.Covers = make([]coverJson, 0, len(move.Covers))
+	for _, coord := range move.coveredSquares() {
+		cover := move.Covers[coord]
+		mj.Covers = append(mj.Covers, coverJson{
+			Row:     coord.Row,
+			Col:     coord.Col,
+			Letter:  string(cover.Letter),
+			Meaning: string(cover.Meaning),
+		})
+	}
+	mj.TopLeft = move.TopLeft
+	mj.BottomRight = move.BottomRight
+	mj.PrefixLength = move.PrefixLength
+	mj.Horizontal = move.Horizontal
+	mj.Word = move.Word
+	mj.ValidateWords = move.ValidateWords
+}
+
+// unmarshalMove converts the move within a serialized move item
+// back to a Move
+func unmarshalMove(mj *moveItemJson) (Move, error) {
+	var move Move
+	switch mj.Type {
+	case "tile", "void":
+		covers := make(Covers)
+		for _, cj := range mj.Covers {
+			letter, meaning := []rune(cj.Letter), []rune(cj.Meaning)
+			if len(letter) != 1 || len(meaning) != 1 {
+				return nil, fmt.Errorf("invalid cover at %v,%v", cj.Row, cj.Col)
+			}
+			covers[Coordinate{cj.Row, cj.Col}] = Cover{letter[0], meaning[0]}
+		}
+		tileMove := &TileMove{
+			TopLeft:       mj.TopLeft,
+			BottomRight:   mj.BottomRight,
+			PrefixLength:  mj.PrefixLength,
+			Covers:        covers,
+			Horizontal:    mj.Horizontal,
+			Word:          mj.Word,
+			ValidateWords: mj.ValidateWords,
+		}
+		if mj.Type == "void" {
+			move = NewVoidMove(tileMove)
+		} else {
+			move = tileMove
+		}
+	case "pass":
+		move = NewPassMove()
+	case "exchange":
+		move = NewExchangeMove(mj.Letters)
+	case "resign":
+		move = &ResignMove{TimeForfeit: mj.TimeForfeit}
+	case "final":
+		final := NewFinalMove(mj.OpponentRack, mj.MultiplyFactor)
+		final.TimePenalty = mj.TimePenalty
+		move = final
+	default:
+		return nil, fmt.Errorf("unknown move type '%v'", mj.Type)
+	}
+	return move, nil
+}
+
+// unmarshalMoveItem converts a serialized move item back to a MoveItem,
+// using the given tile array to resolve tile indices
+func unmarshalMoveItem(mj *moveItemJson, tiles []Tile) (*MoveItem, error) {
+	move, err := unmarshalMove(mj)
+	if err != nil {
+		return nil, err
+	}
+	item := &MoveItem{
+		RackBefore:       mj.RackBefore,
+		Move:             move,
+		Score:            mj.Score,
+		NumPassMoves:     mj.NumPassMoves,
+		Drawn:            mj.Drawn,
+		Challenged:       mj.Challenged,
+		ChallengePenalty: mj.ChallengePenalty,
+		RackTiles:        make([]*Tile, len(mj.RackTiles)),
+	}
+	for slot, ix := range mj.RackTiles {
+		if ix == noTile {
+			continue
+		}
+		if ix < 0 || ix >= len(tiles) {
+			return nil, fmt.Errorf("invalid tile index %v", ix)
+		}
+		item.RackTiles[slot] = &tiles[ix]
+	}
+	return item, nil
+}
+
+// Serialize returns a JSON representation of the complete state
+// of the Game, from which it can be restored via DeserializeGame()
+func (game *Game) Serialize() ([]byte, error) {
+	if game == nil || game.Bag == nil {
+		return nil, fmt.Errorf("cannot serialize an uninitialized game")
+	}
+	bag := game.Bag
+	// Map each tile to its index within the bag's tile array
+	index := make(map[*Tile]int, len(bag.Tiles))
+	gj := gameJson{
+		Locale:        game.Locale,
+		BoardType:     game.Board.Type,
+		PlayerNames:   game.PlayerNames,
+		Scores:        game.Scores,
+		NumPassMoves:  game.NumPassMoves,
+		ValidateWords: game.ValidateWords,
+		ChallengeMode: game.ChallengeMode,
+		Tiles:         make([]tileJson, len(bag.Tiles)),
+		Bag:           make([]int, len(bag.Contents)),
+		Board:         make([]squareJson, 0, game.Board.NumTiles),
+		Moves:         make([]moveItemJson, len(game.MoveList)),
+	}
+	gj.ChallengePenalty = game.ChallengePenalty
+	if game.RackSize != RackSize {
+		gj.RackSize = game.RackSize
+	}
+	if game.Rules != nil && *game.Rules != DefaultScoringRules {
+		gj.Rules = game.Rules
+	}
+	for i := range bag.Tiles {
+		tile := &bag.Tiles[i]
+		index[tile] = i
+		gj.Tiles[i] = tileJson{
+			Letter:   string(tile.Letter),
+			Meaning:  string(tile.Meaning),
+			Score:    tile.Score,
+			PlayedBy: tile.PlayedBy,
+		}
+	}
+	lookup := func(tile *Tile) (int, error) {
+		ix, ok := index[tile]
+		if !ok {
+			return noTile, fmt.Errorf("tile '%v' does not belong to the game's bag", tile)
+		}
+		return ix, nil
+	}
+	var err error
+	for i, tile := range bag.Contents {
+		if gj.Bag[i], err = lookup(tile); err != nil {
+			return nil, err
+		}
+	}
+	for player := 0; player < 2; player++ {
+		gj.Racks[player] = make([]int, game.Racks[player].Size())
+		for slot, sq := range game.Racks[player].Slots {
+			gj.Racks[player][slot] = noTile
+			if sq.Tile != nil {
+				if gj.Racks[player][slot], err = lookup(sq.Tile); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for row := 0; row < game.Board.Size; row++ {
+		for col := 0; col < game.Board.Size; col++ {
+			if tile := game.Board.TileAt(row, col); tile != nil {
+				ix, err := lookup(tile)
+				if err != nil {
+					return nil, err
+				}
+				gj.Board = append(gj.Board, squareJson{row, col, ix})
+			}
+		}
+	}
+	for i, item := range game.MoveList {
+		if gj.Moves[i], err = marshalMoveItem(item, lookup); err != nil {
+			return nil, err
+		}
+	}
+	gj.InitialRacks = game.InitialRacks()
+	return json.Marshal(gj)
+}
+
+// MarshalMoveList returns the move list of the Game as a JSON array,
+// e.g. for showing a timeline of the game in a client. Each element
+// contains the JSON representation of the move itself, as returned
+// by its Marshal() method, along with the index of the player who
+// made it, the player's rack before the move and the type of the
+// move, e.g. {"player":0,"rack":"aeinrst","type":"tile","co":"H8",...}
+func (game *Game) MarshalMoveList() ([]byte, error) {
+	type contextJson struct {
+		Player     int    `json:"player"`
+		RackBefore string `json:"rack"`
+		Type       string `json:"type"`
+	}
+	items := make([]json.RawMessage, len(game.MoveList))
+	for i, item := range game.MoveList {
+		context, err := json.Marshal(contextJson{
+			Player:     i % 2,
+			RackBefore: item.RackBefore,
+			Type:       moveType(item.Move),
+		})
+		if err != nil {
+			return nil, err
+		}
+		data, err := item.Move.Marshal(item.Score)
+		if err != nil {
+			return nil, err
+		}
+		// Splice the context into the move's JSON object
+		context = append(context[:len(context)-1], ',')
+		items[i] = append(context, data[1:]...)
+	}
+	return json.Marshal(items)
+}
+
+// DeserializeGame restores a Game from a JSON representation
+// previously created by Game.Serialize(). The Dawg and TileSet of
+// the game are re-linked using its locale.
+func DeserializeGame(data []byte) (*Game, error) {
+	var gj gameJson
+	if err := json.Unmarshal(data, &gj); err != nil {
+		return nil, err
+	}
+	if !IsValidBoardType(gj.BoardType) {
+		return nil, fmt.Errorf("invalid board type '%v'", gj.BoardType)
+	}
+	dawg, tileSet, err := resolveLocale(gj.Locale, gj.BoardType)
+	if err != nil {
+		return nil, err
+	}
+	game := &Game{
+		PlayerNames:   gj.PlayerNames,
+		Scores:        gj.Scores,
+		Dawg:          dawg,
+		TileSet:       tileSet,
+		NumPassMoves:  gj.NumPassMoves,
+		ValidateWords: gj.ValidateWords,
+		ChallengeMode: gj.ChallengeMode,
+		Locale:        gj.Locale,
+	}
+	game.ChallengePenalty = gj.ChallengePenalty
+	game.Board.Init(gj.BoardType)
+	game.RackSize = gj.rackSize()
+	game.Rules = gj.Rules
+	game.Racks[0].InitWithSize(game.RackSize)
+	game.Racks[1].InitWithSize(game.RackSize)
+	// Recreate the tiles of the game
+	bag := &Bag{Tiles: make([]Tile, len(gj.Tiles))}
+	bag.Seed(rand.Int63())
+	for i, tj := range gj.Tiles {
+		letter, meaning := []rune(tj.Letter), []rune(tj.Meaning)
+		if len(letter) != 1 || len(meaning) != 1 {
+			return nil, fmt.Errorf("invalid tile #%v", i)
+		}
+		bag.Tiles[i] = Tile{
+			Letter:   letter[0],
+			Meaning:  meaning[0],
+			Score:    tj.Score,
+			PlayedBy: tj.PlayedBy,
+		}
+	}
+	game.Bag = bag
+	// Each tile may only be used once
+	used := make([]bool, len(bag.Tiles))
+	tileAt := func(ix int) (*Tile, error) {
+		if ix < 0 || ix >= len(bag.Tiles) || used[ix] {
+			return nil, fmt.Errorf("invalid tile index %v", ix)
+		}
+		used[ix] = true
+		return &bag.Tiles[ix], nil
+	}
+	bag.Contents = make([]*Tile, len(gj.Bag))
+	for i, ix := range gj.Bag {
+		tile, err := tileAt(ix)
+		if err != nil {
+			return nil, err
+		}
+		bag.Contents[i] = tile
+	}
+	for player := 0; player < 2; player++ {
+		rack := &game.Racks[player]
+		if len(gj.Racks[player]) > rack.Size() {
+			return nil, fmt.Errorf("invalid rack for player %v", player)
+		}
+		for slot, ix := range gj.Racks[player] {
+			if ix == noTile {
+				continue
+			}
+			tile, err := tileAt(ix)
+			if err != nil {
+				return nil, err
+			}
+			rack.Slots[slot].Tile = tile
+			rack.AddTile(tile.Letter)
+		}
+	}
+	for _, sj := range gj.Board {
+		tile, err := tileAt(sj.Tile)
+		if err != nil {
+			return nil, err
+		}
+		if game.Board.TileAt(sj.Row, sj.Col) != nil || !game.Board.PlaceTile(sj.Row, sj.Col, tile) {
+			return nil, fmt.Errorf("invalid board square %v,%v", sj.Row, sj.Col)
+		}
+	}
+	game.MoveList = make([]*MoveItem, 0, max(30, len(gj.Moves)))
+	for i := range gj.Moves {
+		item, err := unmarshalMoveItem(&gj.Moves[i], bag.Tiles)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := item.Move.(*ResignMove); ok {
+			// Restore the resignation, cf. ResignMove.Apply()
+			game.Resigned = true
+			game.Resigner = game.PlayerToMove()
+		}
+		game.MoveList = append(game.MoveList, item)
+	}
+	if err := game.scoreMoves(); err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+// scoreMoves calculates and caches the scores of the tile moves in the
+// MoveList of a deserialized Game, by laying their tiles, as found on
+// the restored board, on an empty board in turn. The tiles of a
+// VoidMove are not laid, but it is scored as it was played. An error
+// is returned if the moves and the board do not match.
+func (game *Game) scoreMoves() error {
+	board := NewBoard(game.Board.Type)
+	rack := &Rack{}
+	rack.InitWithSize(game.RackSize)
+	state := NewState(game.Dawg, game.TileSet, board, rack, false)
+	state.Rules = game.Rules
+	for i, item := range game.MoveList {
+		var move *TileMove
+		laid := true
+		switch m := item.Move.(type) {
+		case *TileMove:
+			move = m
+		case *VoidMove:
+			// The tiles of a VoidMove were taken back
+			move, laid = m.Move, false
+		default:
+			continue
+		}
+		for coord := range move.Covers {
+			if board.TileAt(coord.Row, coord.Col) != nil {
+				return fmt.Errorf("move #%v covers an occupied square", i)
+			}
+		}
+		move.Score(state)
+		if !laid {
+			continue
+		}
+		for coord := range move.Covers {
+			tile := game.Board.TileAt(coord.Row, coord.Col)
+			if tile == nil {
+				return fmt.Errorf("move #%v has no tile at %v,%v", i, coord.Row, coord.Col)
+			}
+			board.PlaceTile(coord.Row, coord.Col, tile)
+		}
+	}
+	return nil
+}
+
+// InitialRacks returns the racks that the players had at the
+// start of the Game
+func (game *Game) InitialRacks() [2]string {
+	var racks [2]string
+	for player := 0; player < 2; player++ {
+		if player < len(game.MoveList) {
+			racks[player] = game.MoveList[player].RackBefore
+		} else {
+			racks[player] = game.Racks[player].AsString()
+		}
+	}
+	return racks
+}
+
+// ReplayGame reconstructs a Game from a JSON representation created by
+// Game.Serialize(), by starting a new game with the initial racks and
+// applying each move in turn, drawing the same tiles from the bag as
+// in the original game. The validity and score of each move are verified,
+// and a descriptive error is returned if there is any discrepancy.
+func ReplayGame(data []byte) (*Game, error) {
+	var gj gameJson
+	if err := json.Unmarshal(data, &gj); err != nil {
+		return nil, err
+	}
+	if !IsValidBoardType(gj.BoardType) {
+		return nil, fmt.Errorf("invalid board type '%v'", gj.BoardType)
+	}
+	options := GameOptions{RackSize: gj.RackSize, Rules: gj.Rules}
+	game := NewGameForLocaleWithOptions(gj.Locale, gj.BoardType, options)
+	if game == nil {
+		return nil, fmt.Errorf("unable to create a game for locale '%v'", gj.Locale)
+	}
+	game.PlayerNames = gj.PlayerNames
+	game.ValidateWords = gj.ValidateWords
+	game.ChallengeMode = gj.ChallengeMode
+	game.ChallengePenalty = gj.ChallengePenalty
+	// Start with the initial racks
+	game.Racks[0].ReturnToBag(game.Bag)
+	game.Racks[1].ReturnToBag(game.Bag)
+	for player := 0; player < 2; player++ {
+		if !game.Racks[player].FillByLetters(game.Bag, []rune(gj.InitialRacks[player])) {
+			return nil, fmt.Errorf("unable to draw initial rack '%v' for player %v",
+				gj.InitialRacks[player], player)
+		}
+	}
+	for i := range gj.Moves {
+		mj := &gj.Moves[i]
+		if mj.Type == "final" {
+			// Final moves are added automatically when the game is over
+			if i >= len(game.MoveList) {
+				return nil, fmt.Errorf("move #%v: unexpected final move", i)
+			}
+		} else {
+			if game.IsOver() {
+				return nil, fmt.Errorf("move #%v: the game is already over", i)
+			}
+			if rack := game.Racks[game.PlayerToMove()].AsString(); rack != mj.RackBefore {
+				return nil, fmt.Errorf("move #%v: rack is '%v', expected '%v'", i, rack, mj.RackBefore)
+			}
+			move, err := unmarshalMove(mj)
+			if err != nil {
+				return nil, fmt.Errorf("move #%v: %v", i, err)
+			}
+			if tileMove, ok := move.(*TileMove); ok {
+				// Recreate the tile move on the current board
+				if game.ValidateWords {
+					move = NewTileMove(&game.Board, tileMove.Covers)
+				} else {
+					move = NewUncheckedTileMove(&game.Board, tileMove.Covers)
+				}
+			}
+			// Draw the same tiles from the bag as in the original game
+			game.Bag.forced = []rune(mj.Drawn)
+			ok := game.Apply(move)
+			game.Bag.forced = nil
+			if !ok {
+				return nil, fmt.Errorf("move #%v (%v) is not valid", i, move)
+			}
+			if drawn := game.MoveList[i].Drawn; drawn != mj.Drawn {
+				return nil, fmt.Errorf("move #%v (%v): drew '%v', expected '%v'", i, move, drawn, mj.Drawn)
+			}
+			// Reapply the outcome of an unsuccessful challenge
+			game.MoveList[i].Challenged = mj.Challenged
+			game.MoveList[i].ChallengePenalty = mj.ChallengePenalty
+			game.Scores[1-i%2] -= mj.ChallengePenalty
+		}
+		if score := game.MoveList[i].Score; score != mj.Score {
+			return nil, fmt.Errorf("move #%v (%v) scored %v, expected %v",
+				i, game.MoveList[i].Move, score, mj.Score)
+		}
+	}
+	if len(game.MoveList) != len(gj.Moves) {
+		return nil, fmt.Errorf("replay resulted in %v moves, expected %v", len(game.MoveList), len(gj.Moves))
+	}
+	if game.Scores != gj.Scores {
+		return nil, fmt.Errorf("replay resulted in scores %v, expected %v", game.Scores, gj.Scores)
+	}
+	return game, nil
+}
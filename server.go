@@ -11,8 +11,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"sort"
-	"unicode"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // A class describing incoming /moves requests
@@ -22,188 +25,182 @@ type MovesRequest struct {
 	Board     []string `json:"board"`
 	Rack      string   `json:"rack"`
 	Limit     int      `json:"limit"`
+	// If Detail is true, the score breakdown of each
+	// tile move is included in the response
+	Detail bool `json:"detail"`
+	// The number of slots in the rack, if other than
+	// the default RackSize
+	RackSize int `json:"rack_size"`
+	// If Stats is true, statistics about the move
+	// generation are included in the response
+	Stats bool `json:"stats"`
+	// If Anchor is given, as a square such as "H8", only the
+	// moves that place a tile on that square are included
+	Anchor string `json:"anchor"`
+	// The following optional filters restrict the moves that are
+	// returned to those whose main word has at least MinLength and
+	// at most MaxLength letters, that cover or play through the
+	// square MustIncludeSquare, that lay down a full rack if
+	// OnlyBingos is true, and that score at least MinScore points.
+	MinLength         int         `json:"min_length"`
+	MaxLength         int         `json:"max_length"`
+	MustIncludeSquare *SquareJson `json:"must_include_square"`
+	OnlyBingos        bool        `json:"only_bingos"`
+	MinScore          int         `json:"min_score"`
+	// If Audit is true, the request is rejected if the board could
+	// not have come about in a real game, cf. Board.Audit()
+	Audit bool `json:"audit"`
+	// If Unseen is true, the counts of the tiles that the player
+	// cannot see are included in the response
+	Unseen bool `json:"unseen"`
+}
+
+// SquareJson identifies a board square in a request,
+// by 0-based row and column indices
+type SquareJson struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
 }
 
 // A kludge to be able to marshal a Move with its score
 type MoveWithScore struct {
 	json.Marshaler
-	Move  Move
-	Score int
+	Move      Move
+	Score     int
+	Breakdown *ScoreBreakdown
 }
 
 func (m *MoveWithScore) MarshalJSON() ([]byte, error) {
 	// Let the move marshal itself, but adding the score
-	return m.Move.Marshal(m.Score)
+	data, err := m.Move.Marshal(m.Score)
+	if err != nil || m.Breakdown == nil {
+		return data, err
+	}
+	// Splice the score breakdown into the move's JSON object
+	detail, err := json.Marshal(m.Breakdown)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data[:len(data)-1], `,"detail":`...)
+	data = append(data, detail...)
+	return append(data, '}'), nil
 }
 
-// The JSON response header
+// The JSON response header. Version 1.1 added the "tiles"
+// and "covers" fields of tile moves. Version 1.2 added the
+// filters of MovesRequest, which are applied before the limit;
+// Count is the total number of moves passing the filters, which
+// may exceed the number of moves returned if there is a limit.
+// Version 1.3 added the "unseen" field.
 type HeaderJson struct {
 	Version string          `json:"version"`
 	Count   int             `json:"count"`
 	Moves   []MoveWithScore `json:"moves"`
+	Stats   *GenStats       `json:"stats,omitempty"`
+	// The tiles that the player cannot see, i.e. the tiles in the
+	// bag and in the opponent's rack, as counts by letter ('?' for
+	// blank tiles), if requested
+	Unseen map[string]int `json:"unseen,omitempty"`
 }
 
-// Map a requested locale string to a dictionary and tile set
-func decodeLocale(locale string, boardType string) (*Dawg, *TileSet) {
-	// Obtain the first three characters of locale
-	locale3 := locale
-	if len(locale) > 3 {
-		locale3 = locale[0:3]
-	}
-	var dictionary string
-	if locale == "" || locale == "en_US" || locale == "en-US" {
-		// U.S. English
-		dictionary = "otcwl"
-	} else if locale == "en" || locale3 == "en_" || locale3 == "en-" {
-		// U.K. English (SOWPODS)
-		dictionary = "sowpods"
-	} else if locale == "is" || locale3 == "is_" || locale3 == "is-" {
-		// Icelandic
-		dictionary = "ice"
-	} else if locale == "pl" || locale3 == "pl_" || locale3 == "pl-" {
-		// Polish
-		dictionary = "osps"
-	} else if locale == "nb" || locale3 == "nb_" || locale3 == "nb-" {
-		// Norwegian (Bokmål)
-		dictionary = "nsf"
-	} else if locale == "nn" || locale3 == "nn_" || locale3 == "nn-" {
-		// Norwegian (Nynorsk)
-		dictionary = "nynorsk"
-	} else if locale == "no" || locale3 == "no_" || locale3 == "no-" {
-		// Generic Norwegian - we assume Bokmål
-		dictionary = "nsf"
-	} else {
-		// Default to U.S. English for other locales
-		dictionary = "otcwl"
-	}
-
-	var tileSet *TileSet
-	var dawg *Dawg
-
-	switch dictionary {
-	case "otcwl":
-		dawg = OtcwlDictionary
-		if boardType == "explo" {
-			tileSet = NewEnglishTileSet
-		} else {
-			tileSet = EnglishTileSet
-		}
-	case "sowpods":
-		dawg = SowpodsDictionary
-		if boardType == "explo" {
-			tileSet = NewEnglishTileSet
-		} else {
-			tileSet = EnglishTileSet
-		}
-	case "ice":
-		dawg = IcelandicDictionary
-		tileSet = NewIcelandicTileSet
-	case "osps":
-		dawg = OspsDictionary
-		tileSet = PolishTileSet
-	case "nsf":
-		dawg = NorwegianBokmålDictionary
-		tileSet = NorwegianTileSet
-	case "nynorsk":
-		dawg = NorwegianNynorskDictionary
-		tileSet = NorwegianTileSet
-	default:
-		// Should not happen
-		panic(fmt.Sprintf("Unknown dictionary: %v", dictionary))
+// AuditJson is the response to a MovesRequest whose board
+// fails the audit that the request asks for
+type AuditJson struct {
+	Version string       `json:"version"`
+	Issues  []BoardIssue `json:"issues"`
+}
+
+// Map a requested locale string to a dictionary and tile set,
+// as resolved by Locales.Resolve(), which defaults to U.S. English
+// for unknown locales
+func resolveLocale(locale string, boardType string) (*Dawg, *TileSet, error) {
+	config, err := Locales.Resolve(locale)
+	if err != nil {
+		return nil, nil, err
 	}
+	return config.Dawg, config.TileSetFor(boardType), nil
+}
 
+// Map a requested locale string to a dictionary and tile set, as
+// resolveLocale() does, returning a nil dictionary if the locale
+// cannot be resolved
+func decodeLocale(locale string, boardType string) (*Dawg, *TileSet) {
+	dawg, tileSet, _ := resolveLocale(locale, boardType)
 	return dawg, tileSet
 }
 
-// Handle an incoming /moves request
-func HandleMovesRequest(w http.ResponseWriter, req MovesRequest) {
+// Map a requested locale string to a dictionary and tile set, or
+// write an error response and return a nil dictionary if the
+// locale cannot be resolved
+func localeFromRequest(w http.ResponseWriter, locale string, boardType string) (*Dawg, *TileSet) {
+	dawg, tileSet, err := resolveLocale(locale, boardType)
+	if err != nil {
+		msg := fmt.Sprintf("Unsupported locale: %v.\n", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return nil, nil
+	}
+	return dawg, tileSet
+}
+
+// Create a GameState from the board, rack and locale in an incoming
+// request, or write an error response and return nil if the request
+// is invalid
+func stateFromRequest(w http.ResponseWriter, req MovesRequest) *GameState {
 	// Set the board type, dictionary and tile set
 	boardType := req.BoardType
-	if boardType != "standard" && boardType != "explo" {
-		msg := "Invalid board type. Must be 'standard' or 'explo'.\n"
+	if !IsValidBoardType(boardType) {
+		msg := "Invalid board type. Must be 'standard', 'explo', 'mini' or 'super'.\n"
 		http.Error(w, msg, http.StatusBadRequest)
-		return
+		return nil
 	}
 
 	// Map the request's locale to a dawg and a tile set
 	locale := req.Locale
-	dawg, tileSet := decodeLocale(locale, boardType)
+	dawg, tileSet := localeFromRequest(w, locale, boardType)
+	if dawg == nil {
+		return nil
+	}
 
-	rackRunes := []rune(req.Rack)
-	if len(rackRunes) == 0 || len(rackRunes) > RackSize {
+	rackSize := GameOptions{RackSize: req.RackSize}.rackSize()
+	// Clients may send letters in decomposed Unicode form:
+	// compose them, in the rack as well as on the board
+	rackRunes := []rune(normalizeForLocale(req.Rack))
+	if len(rackRunes) == 0 || len(rackRunes) > rackSize {
 		msg := "Invalid rack.\n"
 		http.Error(w, msg, http.StatusBadRequest)
-		return
+		return nil
 	}
 
-	if len(req.Board) != BoardSize {
-		msg := fmt.Sprintf("Invalid board. Must be %v rows.\n", BoardSize)
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+	rows := make([]string, len(req.Board))
+	for i, row := range req.Board {
+		rows[i] = normalizeForLocale(row)
 	}
-
 	board := NewBoard(boardType)
-	for r, rowString := range req.Board {
-		row := []rune(rowString)
-		if len(row) != BoardSize {
-			msg := fmt.Sprintf(
-				"Invalid board row (#%v). Must be %v characters long.\n",
-				r,
-				BoardSize,
-			)
-			http.Error(w, msg, http.StatusBadRequest)
-			return
-		}
-		for c, letter := range row {
-			if letter != '.' && letter != ' ' {
-				meaning := letter
-				score := 0
-				// Uppercase letters represent
-				// blank tiles that have been assigned a letter;
-				// convert these to lowercase letters and
-				// give them a score of 0
-				if unicode.IsUpper(letter) {
-					meaning = unicode.ToLower(letter)
-					letter = '?'
-				} else {
-					score = tileSet.Scores[letter]
-				}
-				if !tileSet.Contains(letter) {
-					msg := fmt.Sprintf("Invalid letter '%c' at %v,%v.\n", letter, r, c)
-					http.Error(w, msg, http.StatusBadRequest)
-					return
-				}
-				t := &Tile{
-					Letter:  letter,
-					Meaning: meaning,
-					Score:   score,
-				}
-				if ok := board.PlaceTile(r, c, t); !ok {
-					// Should not happen, and if it does, it's a serious bug,
-					// so no point in continuing
-					panic(fmt.Sprintf("Square already occupied: %v,%v", r, c))
-				}
-			}
-		}
+	if err := board.FromStrings(rows, tileSet); err != nil {
+		msg := fmt.Sprintf("Invalid board: %v.\n", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return nil
 	}
 
 	// The board must either be empty or have a tile in the start square
 	if board.NumTiles > 0 && !board.HasStartTile() {
 		msg := "The start square must be occupied.\n"
 		http.Error(w, msg, http.StatusBadRequest)
-		return
+		return nil
 	}
 
 	// Parse the incoming rack string
-	rack := NewRack(rackRunes, tileSet)
-	if rack == nil {
-		msg := "Rack contains invalid letter.\n"
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+	for _, letter := range rackRunes {
+		if !tileSet.Contains(letter) {
+			msg := fmt.Sprintf("Rack contains invalid letter '%c'.\n", letter)
+			http.Error(w, msg, http.StatusBadRequest)
+			return nil
+		}
 	}
+	rack := NewRackWithSize(rackSize, rackRunes, tileSet)
 
-	// Create a fresh GameState object, then find the valid moves
-	exchangeForbidden := tileSet.Size-board.NumTiles-2*RackSize < RackSize
+	// Create a fresh GameState object
+	exchangeForbidden := tileSet.Size-board.NumTiles-2*rackSize < rackSize
 	state := NewState(
 		dawg,
 		tileSet,
@@ -211,30 +208,756 @@ func HandleMovesRequest(w http.ResponseWriter, req MovesRequest) {
 		rack,
 		exchangeForbidden,
 	)
+	state.Unseen = unseenTiles(tileSet, board, rackRunes)
+	return state
+}
 
-	// Generate all valid moves and calculate their scores
-	moves := state.GenerateMoves()
-	movesWithScores := make([]MoveWithScore, len(moves))
-	for i, move := range moves {
-		movesWithScores[i] = MoveWithScore{
-			Move:  move,
-			Score: move.Score(state),
+// Return the tiles of the tile set that are neither on the board nor
+// in the rack, i.e. the tiles in the bag and in the opponent's rack.
+// Blank tiles on the board have the letter '?', and are thus counted
+// against the blank tiles of the tile set.
+func unseenTiles(tileSet *TileSet, board *Board, rack []rune) []rune {
+	counts := make(map[rune]int)
+	for _, tile := range tileSet.Tiles {
+		counts[tile.Letter]++
+	}
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			if tile := board.TileAt(row, col); tile != nil {
+				counts[tile.Letter]--
+			}
 		}
 	}
-	// Sort the movesWithScores list in descending order by Score
-	sort.Slice(movesWithScores, func(i, j int) bool {
-		return movesWithScores[i].Score > movesWithScores[j].Score
-	})
-	// If a limit is specified, use that as a cap on the number of moves returned
-	if req.Limit > 0 {
-		movesWithScores = movesWithScores[0:min(req.Limit, len(movesWithScores))]
+	for _, letter := range rack {
+		counts[letter]--
+	}
+	unseen := make([]rune, 0, tileSet.Size)
+	for _, tile := range tileSet.Tiles {
+		if counts[tile.Letter] > 0 {
+			counts[tile.Letter]--
+			unseen = append(unseen, tile.Letter)
+		}
+	}
+	return unseen
+}
+
+// Handle an incoming /moves request
+func HandleMovesRequest(w http.ResponseWriter, req MovesRequest) {
+	state := stateFromRequest(w, req)
+	if state == nil {
+		return
+	}
+	if req.Audit {
+		if issues := state.Board.Audit(state.Dawg, state.TileSet); len(issues) > 0 {
+			// Reject the request, listing the issues found
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(AuditJson{Version: "1.3", Issues: issues})
+			return
+		}
+	}
+
+	// Generate all valid moves, sorted in descending order by score.
+	// If a limit is specified, use that as a cap on the number of
+	// moves returned.
+	var stats *GenStats
+	if req.Stats {
+		stats = &GenStats{}
+	}
+	keep, ok := moveFilter(w, state, req)
+	if !ok {
+		return
+	}
+	movesWithScores, count := state.bestMoves(req.Limit, stats, keep)
+	if req.Detail {
+		for i := range movesWithScores {
+			if tileMove, ok := movesWithScores[i].Move.(*TileMove); ok {
+				movesWithScores[i].Breakdown = tileMove.ScoreBreakdown(state)
+			}
+		}
 	}
 
 	// Return the result as JSON, written to the http.ResponseWriter w
 	result := HeaderJson{
-		Version: "1.0",
-		Count:   len(movesWithScores),
+		Version: "1.3",
+		Count:   count,
 		Moves:   movesWithScores,
+		Stats:   stats,
+	}
+	if req.Unseen {
+		// Blank tiles on the board are counted as '?', not as the
+		// letter that they stand for, cf. unseenTiles()
+		result.Unseen = make(map[string]int)
+		for _, letter := range state.Unseen {
+			result.Unseen[string(letter)]++
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// moveFilter returns a function that returns true for the moves that
+// pass the filters in the request, i.e. its anchor square and the
+// filters added in version 1.2, or nil if the request has no filters.
+// Only tile moves can pass the filters. If a square in the request is
+// invalid, an error response is written and false is returned.
+func moveFilter(w http.ResponseWriter, state *GameState, req MovesRequest) (func(Move) bool, bool) {
+	filters := make([]func(*TileMove) bool, 0)
+	if req.Anchor != "" {
+		row, col, _, ok := parseCoordinate(req.Anchor)
+		if !ok || state.Board.Sq(row, col) == nil {
+			msg := fmt.Sprintf("Invalid anchor square '%v'.\n", req.Anchor)
+			http.Error(w, msg, http.StatusBadRequest)
+			return nil, false
+		}
+		filters = append(filters, func(move *TileMove) bool {
+			_, covered := move.Covers[Coordinate{row, col}]
+			return covered
+		})
+	}
+	if req.MinLength > 0 || req.MaxLength > 0 {
+		filters = append(filters, func(move *TileMove) bool {
+			length := utf8.RuneCountInString(move.CleanWord())
+			return length >= req.MinLength && (req.MaxLength <= 0 || length <= req.MaxLength)
+		})
+	}
+	if sq := req.MustIncludeSquare; sq != nil {
+		if state.Board.Sq(sq.Row, sq.Col) == nil {
+			msg := fmt.Sprintf("Invalid square at row %v, column %v.\n", sq.Row, sq.Col)
+			http.Error(w, msg, http.StatusBadRequest)
+			return nil, false
+		}
+		coord := Coordinate{sq.Row, sq.Col}
+		filters = append(filters, func(move *TileMove) bool {
+			return move.spans(coord)
+		})
+	}
+	if req.OnlyBingos {
+		filters = append(filters, func(move *TileMove) bool {
+			return len(move.Covers) == state.RackSize()
+		})
+	}
+	if req.MinScore > 0 {
+		filters = append(filters, func(move *TileMove) bool {
+			return move.Score(state) >= req.MinScore
+		})
+	}
+	if len(filters) == 0 {
+		return nil, true
+	}
+	return func(move Move) bool {
+		tileMove, ok := move.(*TileMove)
+		if !ok {
+			return false
+		}
+		for _, filter := range filters {
+			if !filter(tileMove) {
+				return false
+			}
+		}
+		return true
+	}, true
+}
+
+// A class describing incoming /exchange-analysis requests,
+// optionally with a custom leave table
+type ExchangeRequest struct {
+	MovesRequest
+	Leaves LeaveTable `json:"leaves"`
+}
+
+// The JSON response to an /exchange-analysis request
+type ExchangeHeaderJson struct {
+	Version   string           `json:"version"`
+	Count     int              `json:"count"`
+	Exchanges []ExchangeOption `json:"exchanges"`
+}
+
+// Handle an incoming /exchange-analysis request
+func HandleExchangeRequest(w http.ResponseWriter, req ExchangeRequest) {
+	state := stateFromRequest(w, req.MovesRequest)
+	if state == nil {
+		return
+	}
+
+	// Rank the possible exchanges by the value of their leaves.
+	// If an exchange is not allowed, the list is empty.
+	options := state.RankExchangeMoves(req.Leaves)
+	if req.Limit > 0 {
+		options = options[0:min(req.Limit, len(options))]
+	}
+
+	result := ExchangeHeaderJson{
+		Version:   "1.0",
+		Count:     len(options),
+		Exchanges: options,
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// A class describing incoming /bestmove requests. The strategy is
+// "highscore" (the default), "oneofnbest" (where Limit is N, with a
+// default of 10) or "sim" (cf. SimRobot).
+type BestMoveRequest struct {
+	MovesRequest
+	Strategy string `json:"strategy"`
+}
+
+// The best move in the JSON response to a /bestmove request. The kind
+// is "tile", "exchange" or "pass". Tiles are the tiles used from the
+// rack, in word order, or the exchanged tiles in an exchange move.
+type BestMoveJson struct {
+	Kind       string `json:"kind"`
+	Coordinate string `json:"co,omitempty"`
+	Word       string `json:"w,omitempty"`
+	Score      int    `json:"sc"`
+	Tiles      string `json:"tiles,omitempty"`
+	Bingo      bool   `json:"bingo"`
+}
+
+// The JSON response to a /bestmove request, where Count is the
+// total number of legal tile moves
+type BestMoveHeaderJson struct {
+	Version  string       `json:"version"`
+	Count    int          `json:"count"`
+	Strategy string       `json:"strategy"`
+	Move     BestMoveJson `json:"move"`
+}
+
+// Return the robot implementing the given /bestmove strategy,
+// or nil if the strategy is not recognized
+func robotForStrategy(strategy string, limit int) *RobotWrapper {
+	switch strategy {
+	case "highscore":
+		return NewHighScoreRobot()
+	case "oneofnbest":
+		if limit <= 0 {
+			limit = 10
+		}
+		return NewOneOfNBestRobot(limit)
+	case "sim":
+		return NewSimRobot(8, 50, 2*time.Second)
+	}
+	return nil
+}
+
+// Describe a move picked by a robot in a /bestmove response
+func bestMoveJson(state *GameState, move Move) BestMoveJson {
+	switch m := move.(type) {
+	case *TileMove:
+		coords := make([]Coordinate, 0, len(m.Covers))
+		for coord := range m.Covers {
+			coords = append(coords, coord)
+		}
+		// The covers of a move are in a single row or column,
+		// so this sorts them in word order
+		sort.Slice(coords, func(i, j int) bool {
+			if coords[i].Row != coords[j].Row {
+				return coords[i].Row < coords[j].Row
+			}
+			return coords[i].Col < coords[j].Col
+		})
+		tiles := make([]rune, len(coords))
+		for i, coord := range coords {
+			tiles[i] = m.Covers[coord].Letter
+		}
+		return BestMoveJson{
+			Kind:       "tile",
+			Coordinate: m.Coordinate(),
+			Word:       m.Word,
+			Score:      m.Score(state),
+			Tiles:      string(tiles),
+			Bingo:      len(m.Covers) == state.RackSize(),
+		}
+	case *ExchangeMove:
+		return BestMoveJson{Kind: "exchange", Tiles: m.Letters}
+	}
+	return BestMoveJson{Kind: "pass"}
+}
+
+// Handle an incoming /bestmove request
+func HandleBestMoveRequest(w http.ResponseWriter, req BestMoveRequest) {
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = "highscore"
+	}
+	robot := robotForStrategy(strategy, req.Limit)
+	if robot == nil {
+		msg := "Invalid strategy. Must be 'highscore', 'oneofnbest' or 'sim'.\n"
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	state := stateFromRequest(w, req.MovesRequest)
+	if state == nil {
+		return
+	}
+
+	// Generate the valid moves once and let the robot pick one of
+	// them, or recommend an exchange or a pass if there are none
+	moves := state.GenerateMoves()
+	count := len(moves)
+	move := robot.PickMove(state, moves)
+
+	result := BestMoveHeaderJson{
+		Version:  "1.0",
+		Count:    count,
+		Strategy: strategy,
+		Move:     bestMoveJson(state, move),
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// HintsHeaderJson is the response to a /hints request, listing the
+// letters that may be placed on each anchor square of the board
+type HintsHeaderJson struct {
+	Version string       `json:"version"`
+	Count   int          `json:"count"`
+	Hints   []HintSquare `json:"hints"`
+}
+
+// HandleHintsRequest handles a /hints request, returning the cross-check
+// letters for each anchor square, given the board and the rack
+func HandleHintsRequest(w http.ResponseWriter, req MovesRequest) {
+	state := stateFromRequest(w, req)
+	if state == nil {
+		return
+	}
+	hints := make([]HintSquare, 0)
+	for _, row := range state.CrossCheckLetters() {
+		for _, hint := range row {
+			if hint.IsAnchor {
+				hints = append(hints, hint)
+			}
+		}
+	}
+	result := HintsHeaderJson{
+		Version: "1.0",
+		Count:   len(hints),
+		Hints:   hints,
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AnalyzeRequest describes an incoming /analyze request, asking for an
+// evaluation of a proposed tile move on the given board with the given
+// rack. The move is given by a coordinate, as in TileMove.Coordinate(),
+// where "H8" denotes a horizontal and "8H" a vertical move, and a word,
+// as accepted by Game.ParseMove().
+type AnalyzeRequest struct {
+	MovesRequest
+	Coordinate string `json:"co"`
+	Word       string `json:"w"`
+}
+
+// AnalyzedWord is a word formed by an analyzed move, along
+// with its validity
+type AnalyzedWord struct {
+	Word  string `json:"word"`
+	Valid bool   `json:"valid"`
+}
+
+// AnalyzeHeaderJson is the response to an /analyze request. Words
+// contains the main word and the cross words formed by the move,
+// Count is the total number of legal tile moves, and Rank is the
+// 1-based rank of the move's score among them, or 0 if the move is
+// not valid. If the move could not be parsed, Error describes why.
+type AnalyzeHeaderJson struct {
+	Version string         `json:"version"`
+	Valid   bool           `json:"valid"`
+	Score   int            `json:"score"`
+	Words   []AnalyzedWord `json:"words"`
+	Count   int            `json:"count"`
+	Rank    int            `json:"rank"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// HandleAnalyzeRequest handles an /analyze request, returning the
+// score and validity of the proposed move, the words that it forms,
+// and its rank among all legal moves
+func HandleAnalyzeRequest(w http.ResponseWriter, req AnalyzeRequest) {
+	state := stateFromRequest(w, req.MovesRequest)
+	if state == nil {
+		return
+	}
+	result := AnalyzeHeaderJson{
+		Version: "1.0",
+		Words:   make([]AnalyzedWord, 0),
+	}
+	move, err := state.ParseMove(req.Coordinate + " " + req.Word)
+	if err == nil {
+		if tileMove, ok := move.(*TileMove); !ok {
+			err = fmt.Errorf("only tile moves can be analyzed")
+		} else if letter, found := tileMove.unknownLetter(state.TileSet); found {
+			// Reject letters that are not in the tile set up front,
+			// instead of scoring them as zero
+			msg := fmt.Sprintf("Word contains invalid letter '%c'.\n", letter)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else if tileMove := move.(*TileMove); tileMove.Word == IllegalMoveWord {
+		result.Error = "the tiles do not form a single word"
+	} else {
+		// List the words formed by the move, noting which are
+		// missing from the dictionary
+		invalid := tileMove.InvalidWords(state.Board, state.Dawg)
+		words := append([]string{tileMove.CleanWord()}, tileMove.crossWords(state.Board)...)
+		for _, word := range words {
+			valid := !slices.Contains(invalid, word)
+			result.Words = append(result.Words, AnalyzedWord{word, valid})
+		}
+		result.Score = tileMove.Score(state)
+		result.Valid = state.IsValidTileMove(tileMove)
+	}
+	moves := state.GenerateMoves()
+	result.Count = len(moves)
+	if result.Valid {
+		// The rank is one more than the number of
+		// legal moves with a higher score
+		result.Rank = 1
+		for _, m := range moves {
+			if m.Score(state) > result.Score {
+				result.Rank++
+			}
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ValidateRequest describes an incoming /validate request, proposing
+// a tile move on the given board with the given rack. The squares
+// covered by the move are given as in the "covers" of tile moves in
+// /moves responses. The meaning of a tile other than a blank may be
+// omitted, and must otherwise be the tile's own letter.
+type ValidateRequest struct {
+	MovesRequest
+	Covers []CoverJson `json:"covers"`
+}
+
+// ValidateHeaderJson is the response to a /validate request. If the
+// move is valid, Ok is true and Score is its score; otherwise, Error
+// describes why the move is not valid.
+type ValidateHeaderJson struct {
+	Version string     `json:"version"`
+	Ok      bool       `json:"ok"`
+	Score   int        `json:"score"`
+	Error   *MoveError `json:"error,omitempty"`
+}
+
+// coversFromRequest converts the covers in an incoming request to
+// the Covers of a tile move, or writes an error response and returns
+// nil if a cover is invalid or duplicated. Only a blank tile may have
+// a meaning other than its letter.
+func coversFromRequest(w http.ResponseWriter, coversJson []CoverJson) Covers {
+	covers := make(Covers, len(coversJson))
+	for _, cj := range coversJson {
+		letter, meaning := []rune(cj.Letter), []rune(cj.Meaning)
+		if len(meaning) == 0 && len(letter) == 1 && letter[0] != '?' {
+			meaning = letter
+		}
+		coord := Coordinate{cj.Row, cj.Col}
+		if _, duplicate := covers[coord]; duplicate || len(letter) != 1 || len(meaning) != 1 ||
+			(letter[0] != '?' && meaning[0] != letter[0]) {
+			msg := fmt.Sprintf("Invalid cover at row %v, column %v.\n", cj.Row, cj.Col)
+			http.Error(w, msg, http.StatusBadRequest)
+			return nil
+		}
+		covers[coord] = Cover{letter[0], meaning[0]}
+	}
+	return covers
+}
+
+// HandleValidateRequest handles a /validate request, returning
+// the score of the proposed move if it is valid, or the reason
+// why it is not
+func HandleValidateRequest(w http.ResponseWriter, req ValidateRequest) {
+	state := stateFromRequest(w, req.MovesRequest)
+	if state == nil {
+		return
+	}
+	covers := coversFromRequest(w, req.Covers)
+	if covers == nil {
+		return
+	}
+	result := ValidateHeaderJson{Version: "1.0"}
+	move := NewTileMove(state.Board, covers)
+	if err := state.ValidateTileMove(move); err != nil {
+		result.Error = err
+	} else {
+		result.Ok = true
+		result.Score = move.Score(state)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ApplyRequest describes an incoming /apply request, proposing a
+// tile move on the given board with the given rack, as in a
+// /validate request
+type ApplyRequest struct {
+	MovesRequest
+	Covers []CoverJson `json:"covers"`
+}
+
+// ApplyHeaderJson is the response to an /apply request. If the move
+// is valid, Ok is true, Score is its score, Words contains the main
+// word followed by the cross words that it forms, Bingo is true if
+// the move lays down a full rack, and Board contains the rows of the
+// board after the move, in the same format as in the request.
+// Otherwise, Error describes why the move is not valid.
+type ApplyHeaderJson struct {
+	Version string     `json:"version"`
+	Ok      bool       `json:"ok"`
+	Score   int        `json:"score"`
+	Words   []string   `json:"words,omitempty"`
+	Bingo   bool       `json:"bingo"`
+	Board   []string   `json:"board,omitempty"`
+	Error   *MoveError `json:"error,omitempty"`
+}
+
+// HandleApplyRequest handles an /apply request, validating the
+// proposed move and, if it is valid, returning its score, the
+// words that it forms and the resulting board
+func HandleApplyRequest(w http.ResponseWriter, req ApplyRequest) {
+	state := stateFromRequest(w, req.MovesRequest)
+	if state == nil {
+		return
+	}
+	covers := coversFromRequest(w, req.Covers)
+	if covers == nil {
+		return
+	}
+	result := ApplyHeaderJson{Version: "1.0"}
+	move := NewTileMove(state.Board, covers)
+	if err := state.ValidateTileMove(move); err != nil {
+		result.Error = err
+	} else {
+		// Score the move and find its words before placing its tiles
+		result.Ok = true
+		result.Score = move.Score(state)
+		result.Words = append([]string{move.CleanWord()}, move.crossWords(state.Board)...)
+		result.Bingo = len(move.Covers) == state.RackSize()
+		for coord, cover := range move.Covers {
+			score, _ := state.TileSet.Score(cover.Letter)
+			tile := &Tile{Letter: cover.Letter, Meaning: cover.Meaning, Score: score}
+			state.Board.PlaceTile(coord.Row, coord.Col, tile)
+		}
+		result.Board = state.Board.ToStrings()
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CheckRequest describes an incoming /riddle/check request, which
+// grades a tile move submitted as the answer to a riddle, i.e. to
+// the question of the best move with the given board and rack
+type CheckRequest struct {
+	MovesRequest
+	Move CheckMoveJson `json:"move"`
+}
+
+// CheckMoveJson is a tile move in a /riddle/check request, given by
+// the coordinate of its first square, such as "H8" for a horizontal
+// move and "8H" for a vertical one, and its word, including any tiles
+// that are already on the board, in the format of Game.ParseMove()
+type CheckMoveJson struct {
+	Coord string `json:"coord"`
+	Word  string `json:"word"`
+}
+
+// CheckHeaderJson is the response to a /riddle/check request.
+// BestScore is the score of the best move in the position. If the
+// submitted move is valid, Score is its score, Rank is its position
+// in the list of valid moves sorted by descending score, counting
+// from 1, with moves of equal score sharing a rank, and Correct is
+// true if the rank is 1. Otherwise, Error describes why the move
+// is not valid, and Rank is 0.
+type CheckHeaderJson struct {
+	Version   string     `json:"version"`
+	Correct   bool       `json:"correct"`
+	Score     int        `json:"score"`
+	BestScore int        `json:"best_score"`
+	Rank      int        `json:"rank"`
+	Error     *MoveError `json:"error,omitempty"`
+}
+
+// HandleCheckRequest handles a /riddle/check request, generating the
+// valid moves in the position to grade the submitted move against
+// them, so that the client does not need the full move list
+func HandleCheckRequest(w http.ResponseWriter, req CheckRequest) {
+	state := stateFromRequest(w, req.MovesRequest)
+	if state == nil {
+		return
+	}
+	result := CheckHeaderJson{Version: "1.0"}
+	scores := make([]int, 0)
+	for _, move := range state.GenerateMoves() {
+		score := move.Score(state)
+		scores = append(scores, score)
+		result.BestScore = max(result.BestScore, score)
+	}
+	word := normalizeForLocale(req.Move.Word)
+	move, err := state.ParseMove(req.Move.Coord + " " + word)
+	tileMove, ok := move.(*TileMove)
+	if err != nil {
+		result.Error = newMoveError(InvalidMove, "%v", err)
+	} else if !ok {
+		result.Error = newMoveError(InvalidMove, "not a tile move")
+	} else if moveErr := state.ValidateTileMove(tileMove); moveErr != nil {
+		result.Error = moveErr
+	} else {
+		result.Score = tileMove.Score(state)
+		result.Rank = 1
+		for _, score := range scores {
+			if score > result.Score {
+				result.Rank++
+			}
+		}
+		result.Correct = result.Rank == 1
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		// Unable to generate valid JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// defaultAnagramLimit is the maximum number of words returned
+// from an /anagram request that does not specify a limit
+const defaultAnagramLimit = 100
+
+// AnagramRequest describes an incoming /anagram request. If Pattern
+// is given, the words matching it are returned, where '?' matches any
+// single letter and '*' any sequence of letters; the rack is then only
+// validated. Otherwise, the words of at least MinLength letters
+// (default 2) that can be formed from the rack, where '?' denotes a
+// blank tile, are returned.
+type AnagramRequest struct {
+	Locale    string `json:"locale"`
+	Rack      string `json:"rack"`
+	MinLength int    `json:"min_length"`
+	Pattern   string `json:"pattern"`
+	Limit     int    `json:"limit"`
+}
+
+// AnagramWord is a word in an /anagram response, along with the
+// sum of the scores of its letters in the locale's tile set
+type AnagramWord struct {
+	Word  string `json:"w"`
+	Score int    `json:"sc"`
+}
+
+// AnagramGroup contains the words of a given length
+// in an /anagram response
+type AnagramGroup struct {
+	Length int           `json:"length"`
+	Words  []AnagramWord `json:"words"`
+}
+
+// AnagramHeaderJson is the response to an /anagram request. The
+// words are grouped by length, longest first, and sorted by descending
+// score within each group. Truncated is true if words were omitted
+// because of the limit.
+type AnagramHeaderJson struct {
+	Version   string         `json:"version"`
+	Count     int            `json:"count"`
+	Truncated bool           `json:"truncated"`
+	Groups    []AnagramGroup `json:"groups"`
+}
+
+// HandleAnagramRequest handles an /anagram request, returning the
+// words that can be formed from a rack or that match a pattern
+func HandleAnagramRequest(w http.ResponseWriter, req AnagramRequest) {
+	dawg, tileSet := localeFromRequest(w, req.Locale, "standard")
+	if dawg == nil {
+		return
+	}
+	validLetters := func(letters []rune, wildcards string) bool {
+		for _, letter := range letters {
+			if !strings.ContainsRune(wildcards, letter) && !dawg.alphabet.Contains(letter) {
+				return false
+			}
+		}
+		return true
+	}
+	rackRunes := []rune(normalizeForLocale(req.Rack))
+	if len(rackRunes) > RackSize || (req.Pattern == "" && len(rackRunes) == 0) ||
+		!validLetters(rackRunes, "?") {
+		msg := "Invalid rack.\n"
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	patternRunes := []rune(normalizeForLocale(req.Pattern))
+	if len(patternRunes) > MaxBoardSize || !validLetters(patternRunes, "?*") {
+		msg := "Invalid pattern.\n"
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	var words []string
+	if len(patternRunes) > 0 {
+		words = dawg.MatchRunes(patternRunes)
+	} else {
+		minLength := req.MinLength
+		if minLength <= 0 {
+			minLength = 2
+		}
+		words = dawg.Permute(string(rackRunes), minLength)
+	}
+	results := make([]AnagramWord, len(words))
+	for i, word := range words {
+		score := 0
+		for _, letter := range word {
+			score += tileSet.Scores[letter]
+		}
+		results[i] = AnagramWord{word, score}
+	}
+	// Longest words first, then by descending score
+	sort.SliceStable(results, func(i, j int) bool {
+		li, lj := len([]rune(results[i].Word)), len([]rune(results[j].Word))
+		if li != lj {
+			return li > lj
+		}
+		return results[i].Score > results[j].Score
+	})
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultAnagramLimit
+	}
+	result := AnagramHeaderJson{
+		Version: "1.0",
+		Groups:  make([]AnagramGroup, 0),
+	}
+	if len(results) > limit {
+		results = results[:limit]
+		result.Truncated = true
+	}
+	result.Count = len(results)
+	for _, word := range results {
+		length := len([]rune(word.Word))
+		if n := len(result.Groups); n == 0 || result.Groups[n-1].Length != length {
+			result.Groups = append(result.Groups, AnagramGroup{Length: length})
+		}
+		group := &result.Groups[len(result.Groups)-1]
+		group.Words = append(group.Words, word)
 	}
 	if err := json.NewEncoder(w).Encode(result); err != nil {
 		// Unable to generate valid JSON
@@ -245,40 +968,68 @@ func HandleMovesRequest(w http.ResponseWriter, req MovesRequest) {
 // Prepare an error/false response
 var OK_FALSE_RESPONSE = map[string]bool{"ok": false}
 
+// A class describing incoming /wordcheck requests. If IncludeAnagrams
+// or IncludeHooks is true, and Word (or the first word in Words, if Word
+// is empty) is valid, the response also includes its anagrams and/or
+// the words formed by adding a single letter to its front or back.
+// If Definitions is true, the response includes the definition of each
+// valid word, as found by the registered DefinitionProvider.
 type WordCheckRequest struct {
-	Locale string   `json:"locale"`
-	Word   string   `json:"word"`
-	Words  []string `json:"words"`
+	Locale          string   `json:"locale"`
+	Word            string   `json:"word"`
+	Words           []string `json:"words"`
+	IncludeAnagrams bool     `json:"include_anagrams"`
+	IncludeHooks    bool     `json:"include_hooks"`
+	Definitions     bool     `json:"definitions"`
 }
 
 type WordCheckResultPair [2]interface{}
 
+// A checked word in a /wordcheck response that asks for definitions,
+// in place of a WordCheckResultPair. A valid word carries its
+// definition, which is empty if none was found.
+type WordCheckResult struct {
+	Word  string  `json:"word"`
+	Valid bool    `json:"valid"`
+	Def   *string `json:"def,omitempty"`
+}
+
 // Handle a /wordcheck request
 func HandleWordCheckRequest(w http.ResponseWriter, req WordCheckRequest) {
 	words := req.Words
 
 	// Sanity check the word list: we should never need to
-	// check more than 16 words (major-axis word plus
-	// up to 15 cross-axis words)
-	if len(words) == 0 || len(words) > BoardSize+1 {
+	// check more than MaxBoardSize+1 words (major-axis word plus
+	// up to MaxBoardSize cross-axis words)
+	if len(words) == 0 || len(words) > MaxBoardSize+1 {
 		json.NewEncoder(w).Encode(OK_FALSE_RESPONSE)
 		return
 	}
 
 	// Obtain the correct DAWG for the given locale
-	dawg, _ := decodeLocale(req.Locale, "explo")
+	dawg, _ := localeFromRequest(w, req.Locale, "explo")
+	if dawg == nil {
+		return
+	}
 
-	// Check the words against the dictionary
+	// Check the words against the dictionary, after normalizing
+	// them to lowercase and NFC form. The words are returned in
+	// normalized form, or as given if they contain runes that are
+	// not in the alphabet, in which case they are invalid.
 	allValid := true
 	valid := make([]WordCheckResultPair, len(words))
 	for i, word := range words {
 		wordLen := len([]rune(word))
-		if wordLen == 0 || wordLen > BoardSize {
+		if wordLen == 0 || wordLen > MaxBoardSize {
 			// This word is empty or too long, something is wrong
 			json.NewEncoder(w).Encode(OK_FALSE_RESPONSE)
 			return
 		}
-		found := dawg.Find(word)
+		found := false
+		if normalized, err := dawg.Alphabet().Normalize(word); err == nil {
+			word = normalized
+			found = dawg.FindRaw(word)
+		}
 		valid[i] = WordCheckResultPair{word, found}
 		if !found {
 			allValid = false
@@ -286,9 +1037,56 @@ func HandleWordCheckRequest(w http.ResponseWriter, req WordCheckRequest) {
 	}
 
 	result := map[string]interface{}{
-		"word":  req.Word, // Presently not used
+		"word":  req.Word,
 		"ok":    allValid,
 		"valid": valid,
 	}
+	if req.Definitions {
+		// Look up the definitions of the valid words, once per word
+		validWords := make([]string, 0, len(words))
+		for _, pair := range valid {
+			if word := pair[0].(string); pair[1].(bool) && !slices.Contains(validWords, word) {
+				validWords = append(validWords, word)
+			}
+		}
+		defs := lookupDefinitions(req.Locale, validWords)
+		results := make([]WordCheckResult, len(valid))
+		for i, pair := range valid {
+			results[i] = WordCheckResult{Word: pair[0].(string), Valid: pair[1].(bool)}
+			if results[i].Valid {
+				def := defs[results[i].Word]
+				results[i].Def = &def
+			}
+		}
+		result["valid"] = results
+	}
+	if req.IncludeAnagrams || req.IncludeHooks {
+		word := req.Word
+		if word == "" {
+			word = words[0]
+		}
+		word, err := dawg.Alphabet().Normalize(word)
+		found := err == nil && dawg.FindRaw(word)
+		if req.IncludeAnagrams {
+			anagrams := make([]string, 0)
+			if found {
+				for _, anagram := range dawg.Permute(word, len([]rune(word))) {
+					if anagram != word {
+						anagrams = append(anagrams, anagram)
+					}
+				}
+			}
+			result["anagrams"] = anagrams
+		}
+		if req.IncludeHooks {
+			hooks := make([]string, 0)
+			if found {
+				// Front hooks first, then back hooks
+				hooks = append(hooks, dawg.Match("?"+word)...)
+				hooks = append(hooks, dawg.Match(word+"?")...)
+			}
+			result["hooks"] = hooks
+		}
+	}
 	json.NewEncoder(w).Encode(result)
 }
@@ -0,0 +1,273 @@
+// sim.go
+//
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+//
+// This file implements a robot that picks its move by
+// simulating the opponent's possible responses.
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+	"time"
+)
+
+// SimRobot picks a move by Monte Carlo simulation. For each of the
+// TopK highest-scoring moves, it plays a number of rollouts where the
+// opponent is dealt a random rack from the unseen tiles and responds
+// with its highest-scoring move. If Playout is set, the rollouts then
+// continue, with the bag shuffled and both players playing as a
+// HighScoreRobot, which is most useful in the endgame and pre-endgame.
+// The move with the best average score differential is picked. The
+// simulation requires the GameState to carry the unseen tiles
+// (cf. Game.State()); if it does not, the robot falls back to picking
+// the highest-scoring move.
+type SimRobot struct {
+	// The number of candidate moves to simulate
+	TopK int
+	// The maximum number of rollouts per candidate move
+	Rollouts int
+	// The maximum time to spend on simulation, or 0 for no limit.
+	// At least one rollout is always completed.
+	TimeBudget time.Duration
+	// The number of further moves to play out after the opponent's
+	// response to each candidate move, or PlayToEnd to play out
+	// the entire game. With 0, only the response is simulated.
+	Playout int
+	rng     *rand.Rand
+}
+
+// PlayToEnd is the SimRobot.Playout value that plays
+// out the entire game in each rollout
+const PlayToEnd = -1
+
+// NewSimRobot returns a fresh instance of a SimRobot, simulating the
+// topK highest-scoring moves with up to the given number of rollouts
+// each, within the given time budget (0 meaning no limit)
+func NewSimRobot(topK, rollouts int, timeBudget time.Duration) *RobotWrapper {
+	source := rand.NewSource(time.Now().UnixNano())
+	return NewSimRobotWithSource(topK, rollouts, timeBudget, source)
+}
+
+// NewSimRobotWithSource returns a fresh instance of a SimRobot that
+// draws the opponent's racks using the given random source. Given the
+// same source and no time budget, the robot's moves are deterministic.
+func NewSimRobotWithSource(topK, rollouts int, timeBudget time.Duration, source rand.Source) *RobotWrapper {
+	return &RobotWrapper{Robot: &SimRobot{
+		TopK:       topK,
+		Rollouts:   rollouts,
+		TimeBudget: timeBudget,
+		rng:        rand.New(source),
+	}}
+}
+
+// NewSimulationRobot returns a fresh instance of a SimRobot that plays
+// out the entire game in each rollout, simulating the topK
+// highest-scoring moves with the given number of rollouts each
+func NewSimulationRobot(topK, rollouts int) *RobotWrapper {
+	source := rand.NewSource(time.Now().UnixNano())
+	return NewSimulationRobotWithSource(topK, rollouts, source)
+}
+
+// NewSimulationRobotWithSource returns a fresh instance of a SimRobot
+// that plays out the entire game in each rollout, dealing the
+// opponent's racks and shuffling the bag using the given random
+// source, making its moves deterministic
+func NewSimulationRobotWithSource(topK, rollouts int, source rand.Source) *RobotWrapper {
+	return &RobotWrapper{Robot: &SimRobot{
+		TopK:     topK,
+		Rollouts: rollouts,
+		Playout:  PlayToEnd,
+		rng:      rand.New(source),
+	}}
+}
+
+// simBoard returns a copy of the board with the
+// tiles of the given move placed on it
+func simBoard(state *GameState, move Move) *Board {
+	board := state.Board
+	sim := NewBoard(board.Type)
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			if tile := board.TileAt(row, col); tile != nil {
+				sim.PlaceTile(row, col, tile)
+			}
+		}
+	}
+	if tileMove, ok := move.(*TileMove); ok {
+		for coord, cover := range tileMove.Covers {
+			sim.PlaceTile(coord.Row, coord.Col, &Tile{
+				Letter:  cover.Letter,
+				Meaning: cover.Meaning,
+				Score:   state.TileSet.Scores[cover.Letter],
+			})
+		}
+	}
+	return sim
+}
+
+// bestResponse returns the score of the highest-scoring
+// tile move that can be made with the given rack on the board
+func bestResponse(state *GameState, board *Board, letters []rune) int {
+	rack := NewRack(letters, state.TileSet)
+	if rack == nil {
+		return 0
+	}
+	response := NewState(state.Dawg, state.TileSet, board, rack, true)
+	response.Rules = state.Rules
+	best := 0
+	for _, move := range response.GenerateMoves() {
+		if score := move.Score(response); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// PickMove for a SimRobot selects the candidate move with the best
+// average score differential over the simulated rollouts, or an
+// exchange move, or a pass move as a last resort
+func (robot *SimRobot) PickMove(state *GameState, moves []Move) Move {
+	if len(moves) == 0 {
+		// No valid tile moves: do as the HighScoreRobot does
+		return (&HighScoreRobot{}).PickMove(state, moves)
+	}
+	// Sort by score and cut the list down to the candidates
+	sort.Sort(byScore{state, moves})
+	candidates := moves
+	if robot.TopK > 0 && len(candidates) > robot.TopK {
+		candidates = candidates[:robot.TopK]
+	}
+	if len(candidates) == 1 || len(state.Unseen) == 0 || robot.Rollouts <= 0 {
+		return candidates[0]
+	}
+	var boards []*Board
+	if robot.Playout == 0 {
+		boards = make([]*Board, len(candidates))
+		for i, move := range candidates {
+			boards[i] = simBoard(state, move)
+		}
+	}
+	rollouts := robot.Rollouts
+	if len(state.Unseen) <= state.RackSize() {
+		// The opponent's rack is known, so one rollout is enough
+		rollouts = 1
+	}
+	var deadline time.Time
+	if robot.TimeBudget > 0 {
+		deadline = time.Now().Add(robot.TimeBudget)
+	}
+	if robot.rng == nil {
+		robot.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	unseen := slices.Clone(state.Unseen)
+	totals := make([]int, len(candidates))
+	for n := 0; n < rollouts; n++ {
+		if n > 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		// Deal the same random opponent rack for all candidates
+		robot.rng.Shuffle(len(unseen), func(i, j int) {
+			unseen[i], unseen[j] = unseen[j], unseen[i]
+		})
+		if robot.Playout == 0 {
+			rack := unseen[:min(state.RackSize(), len(unseen))]
+			for i, move := range candidates {
+				totals[i] += move.Score(state) - bestResponse(state, boards[i], rack)
+			}
+			continue
+		}
+		// Play out each candidate from the same random deal
+		base := gameFromState(state, unseen)
+		for i, move := range candidates {
+			totals[i] += robot.playout(base, move)
+		}
+	}
+	// Pick the best candidate, preferring higher-scoring ones on ties
+	best := 0
+	for i := 1; i < len(candidates); i++ {
+		if totals[i] > totals[best] {
+			best = i
+		}
+	}
+	return candidates[best]
+}
+
+// gameFromState creates a Game from the GameState, where the player
+// to move is player 0 and the opponent is dealt the first tiles of
+// the given unseen tiles. The remaining unseen tiles are drawn
+// from the bag in order.
+func gameFromState(state *GameState, unseen []rune) *Game {
+	game := &Game{
+		Dawg:          state.Dawg,
+		TileSet:       state.TileSet,
+		ValidateWords: true,
+		MoveList:      make([]*MoveItem, 0, 30),
+		RackSize:      state.RackSize(),
+		Rules:         state.Rules,
+	}
+	game.Board.Init(state.Board.Type)
+	for row := 0; row < state.Board.Size; row++ {
+		for col := 0; col < state.Board.Size; col++ {
+			if tile := state.Board.TileAt(row, col); tile != nil {
+				t := *tile
+				game.Board.PlaceTile(row, col, &t)
+			}
+		}
+	}
+	rack := state.Rack.AsRunes()
+	// Put all tiles that are not on the board in the bag
+	// and draw the racks from it
+	letters := append(slices.Clone(rack), unseen...)
+	bag := &Bag{Tiles: make([]Tile, len(letters))}
+	bag.Contents = make([]*Tile, len(letters))
+	for i, letter := range letters {
+		bag.Tiles[i] = Tile{Letter: letter, Meaning: letter, Score: state.TileSet.Scores[letter]}
+		bag.Contents[i] = &bag.Tiles[i]
+	}
+	game.Bag = bag
+	game.Racks[0].InitWithSize(game.RackSize)
+	game.Racks[1].InitWithSize(game.RackSize)
+	numOpp := min(game.RackSize, len(unseen))
+	game.Racks[0].FillByLetters(bag, rack)
+	game.Racks[1].FillByLetters(bag, unseen[:numOpp])
+	bag.forced = slices.Clone(unseen[numOpp:])
+	return game
+}
+
+// playout makes the given move in a clone of the base Game, and then
+// plays out the opponent's response and up to Playout further moves,
+// or the entire game, with both players playing as a HighScoreRobot.
+// It returns the resulting score differential.
+func (robot *SimRobot) playout(base *Game, move Move) int {
+	game := base.Clone()
+	if !game.ApplyValid(move) {
+		// Should not happen
+		return 0
+	}
+	opponent := &HighScoreRobot{}
+	for ply := 0; !game.IsOver() && (robot.Playout < 0 || ply <= robot.Playout); ply++ {
+		state := game.State()
+		game.ApplyValid(opponent.PickMove(state, state.GenerateMoves()))
+	}
+	return game.Scores[0] - game.Scores[1]
+}
@@ -1,6 +1,10 @@
+//go:build !skrafl_slim
+
 // skrafl_test.go
 // Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
-// This file contains tests for the skrafl package
+// This file contains tests for the skrafl package. They need the
+// full set of built-in dictionaries, and are therefore not built
+// with the skrafl_slim tag (cf. slim_test.go).
 
 /*
 
@@ -22,7 +26,25 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package skrafl
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestIcelandicDawg(t *testing.T) {
@@ -739,3 +761,6091 @@ func TestRobot(t *testing.T) {
 		}
 	}
 }
+
+func TestGaddag(t *testing.T) {
+	// Compare the moves generated using a Gaddag with the moves
+	// generated by the standard Dawg-based move generator
+	moveStrings := func(moves []Move) []string {
+		result := make([]string, len(moves))
+		for i, move := range moves {
+			result[i] = move.(*TileMove).String()
+		}
+		sort.Strings(result)
+		return result
+	}
+	runTest := func(ctor func(boardType string) *Game) {
+		game := ctor("standard")
+		if game == nil {
+			t.Errorf("Unable to create a new game")
+			return
+		}
+		robot := NewHighScoreRobot()
+		for i := 0; i < 6 && !game.IsOver(); i++ {
+			state := game.State()
+			dawgMoves := moveStrings(state.GenerateMoves())
+			// The moves are compared as sorted strings, so that
+			// the order in which they are generated does not matter
+			gaddagMoves := moveStrings(state.GenerateMovesGaddag(NewGaddagFromState(state)))
+			if len(dawgMoves) != len(gaddagMoves) {
+				t.Errorf(
+					"Gaddag generated %v moves, expected %v",
+					len(gaddagMoves), len(dawgMoves),
+				)
+				return
+			}
+			for j := range dawgMoves {
+				if dawgMoves[j] != gaddagMoves[j] {
+					t.Errorf(
+						"Gaddag move '%v' differs from '%v'",
+						gaddagMoves[j], dawgMoves[j],
+					)
+					return
+				}
+			}
+			game.ApplyValid(robot.GenerateMove(state))
+		}
+	}
+	runTest(NewIcelandicGame)
+	runTest(NewOtcwlGame)
+	runTest(NewSowpodsGame)
+	runTest(NewOspsGame)
+	runTest(NewNorwegianBokmålGame)
+}
+
+func TestSerializeGame(t *testing.T) {
+	moveStrings := func(state *GameState) []string {
+		moves := state.GenerateMoves()
+		result := make([]string, len(moves))
+		for i, move := range moves {
+			result[i] = move.(*TileMove).String()
+		}
+		sort.Strings(result)
+		return result
+	}
+	runTest := func(boardType string, ctor func(boardType string) *Game) {
+		game := ctor(boardType)
+		if game == nil {
+			t.Errorf("Unable to create a new game")
+			return
+		}
+		game.SetPlayerNames("Villi", "Gopher")
+		robot := NewHighScoreRobot()
+		for i := 0; i < 8 && !game.IsOver(); i++ {
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		data, err := game.Serialize()
+		if err != nil {
+			t.Errorf("Unable to serialize game: %v", err)
+			return
+		}
+		restored, err := DeserializeGame(data)
+		if err != nil {
+			t.Errorf("Unable to deserialize game: %v", err)
+			return
+		}
+		if restored.String() != game.String() {
+			t.Errorf("Restored game differs from the original")
+		}
+		state, restoredState := game.State(), restored.State()
+		if state.Dawg != restoredState.Dawg || state.TileSet != restoredState.TileSet {
+			t.Errorf("Restored game has a different dictionary or tile set")
+		}
+		if state.Rack.AsString() != restoredState.Rack.AsString() ||
+			state.exchangeForbidden != restoredState.exchangeForbidden {
+			t.Errorf("Restored game has a different state")
+		}
+		moves, restoredMoves := moveStrings(state), moveStrings(restoredState)
+		if len(moves) != len(restoredMoves) {
+			t.Errorf("Restored game generates a different number of moves")
+			return
+		}
+		for i := range moves {
+			if moves[i] != restoredMoves[i] {
+				t.Errorf("Restored game generates different moves")
+				return
+			}
+		}
+		// The restored game should support undo
+		if !restored.UndoLastMove() {
+			t.Errorf("Unable to undo move in restored game")
+		}
+		// The restored game should be playable to the end
+		for !restored.IsOver() {
+			if !restored.ApplyValid(robot.GenerateMove(restored.State())) {
+				t.Errorf("Unable to apply move in restored game")
+				return
+			}
+		}
+	}
+	for _, boardType := range []string{"standard", "explo"} {
+		runTest(boardType, NewIcelandicGame)
+		runTest(boardType, NewOtcwlGame)
+		runTest(boardType, NewSowpodsGame)
+		runTest(boardType, NewOspsGame)
+		runTest(boardType, NewNorwegianBokmålGame)
+		runTest(boardType, NewNorwegianNynorskGame)
+	}
+	if _, err := DeserializeGame([]byte("{\"board_type\": \"round\"}")); err == nil {
+		t.Errorf("Invalid board type should not deserialize")
+	}
+}
+
+func TestUndoLastMove(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	if game == nil {
+		t.Errorf("Unable to create a new Icelandic game")
+		return
+	}
+	if game.UndoLastMove() {
+		t.Errorf("Undo should fail when there are no moves")
+	}
+	robot := NewHighScoreRobot()
+	// Make sure that the robot has a tile move available
+	game.ForceRack(1, "")
+	if !game.ForceRack(0, "prófaðu") || !game.Racks[1].Fill(game.Bag) {
+		t.Errorf("Unable to force racks")
+		return
+	}
+	// Undo a tile move
+	rackBefore := game.Racks[0].AsString()
+	if !game.ApplyValid(robot.GenerateMove(game.State())) {
+		t.Errorf("Unable to apply robot move")
+	}
+	if game.TilesOnBoard() == 0 {
+		t.Errorf("Robot should have made a tile move")
+	}
+	if !game.UndoLastMove() {
+		t.Errorf("Unable to undo tile move")
+	}
+	if game.TilesOnBoard() != 0 || len(game.MoveList) != 0 || game.Scores[0] != 0 {
+		t.Errorf("Tile move not properly undone")
+	}
+	if game.Racks[0].AsString() != rackBefore {
+		t.Errorf("Rack not restored after undoing tile move")
+	}
+	if game.Bag.TileCount() != game.TileSet.Size-2*RackSize {
+		t.Errorf("Bag not restored after undoing tile move")
+	}
+	// Undo an exchange move
+	if !game.ApplyValid(NewExchangeMove(string([]rune(rackBefore)[0:3]))) {
+		t.Errorf("Unable to apply exchange move")
+	}
+	if game.NumPassMoves != 1 {
+		t.Errorf("Exchange move should count as a zero-point move")
+	}
+	if !game.UndoLastMove() {
+		t.Errorf("Unable to undo exchange move")
+	}
+	if game.Racks[0].AsString() != rackBefore || game.NumPassMoves != 0 {
+		t.Errorf("Exchange move not properly undone")
+	}
+	if game.Bag.TileCount() != game.TileSet.Size-2*RackSize {
+		t.Errorf("Bag not restored after undoing exchange move")
+	}
+	// Undo a pass move
+	game.MakePassMove()
+	if game.PlayerToMove() != 1 || game.NumPassMoves != 1 {
+		t.Errorf("Pass move not applied")
+	}
+	if !game.UndoLastMove() {
+		t.Errorf("Unable to undo pass move")
+	}
+	if game.PlayerToMove() != 0 || game.NumPassMoves != 0 {
+		t.Errorf("Pass move not properly undone")
+	}
+	// Play the game to its end, then undo the last move
+	for !game.IsOver() {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	numMoves := len(game.MoveList)
+	if !game.UndoLastMove() {
+		t.Errorf("Unable to undo last move of the game")
+	}
+	if game.IsOver() {
+		t.Errorf("Game should not be over after undoing its last move")
+	}
+	if len(game.MoveList) != numMoves-3 {
+		t.Errorf("Final moves not removed after undoing last move")
+	}
+	// Undo all the remaining moves
+	for game.UndoLastMove() {
+	}
+	if game.TilesOnBoard() != 0 || game.Scores != [2]int{0, 0} {
+		t.Errorf("Game not restored to its initial state")
+	}
+	if game.Bag.TileCount() != game.TileSet.Size-2*RackSize {
+		t.Errorf("Bag not restored to its initial state")
+	}
+	if game.Racks[0].AsString() != rackBefore {
+		t.Errorf("Rack not restored to its initial state")
+	}
+}
+
+func TestUndoRobotMoves(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	game.Seed(17)
+	racks := [2]string{game.Racks[0].AsString(), game.Racks[1].AsString()}
+	bagLetters := func() map[rune]int {
+		counts := make(map[rune]int)
+		for _, tile := range game.Bag.Contents {
+			counts[tile.Letter]++
+		}
+		return counts
+	}
+	initialBag := bagLetters()
+	robot := NewHighScoreRobot()
+	numMoves := 0
+	for ; numMoves < 10 && !game.IsOver(); numMoves++ {
+		if !game.ApplyValid(robot.GenerateMove(game.State())) {
+			t.Errorf("Unable to apply robot move")
+			return
+		}
+	}
+	for i := 0; i < numMoves; i++ {
+		if !game.UndoLastMove() {
+			t.Errorf("Unable to undo move #%v", numMoves-i)
+		}
+	}
+	if game.UndoLastMove() || len(game.MoveList) != 0 {
+		t.Errorf("All moves should have been undone")
+	}
+	if game.TilesOnBoard() != 0 || game.Scores != [2]int{0, 0} || game.PlayerToMove() != 0 {
+		t.Errorf("Board and scores not restored to their initial state")
+	}
+	if game.Racks[0].AsString() != racks[0] || game.Racks[1].AsString() != racks[1] {
+		t.Errorf("Racks not restored to their initial state")
+	}
+	if game.Bag.TileCount() != 86 || !maps.Equal(bagLetters(), initialBag) {
+		t.Errorf("Bag not restored to its initial state: %v", game.Bag)
+	}
+}
+
+func TestDawgFromFile(t *testing.T) {
+	dawg, err := NewDawgFromFile("testdata/test.bin.dawg", EnglishAlphabet)
+	if err != nil {
+		t.Errorf("Unable to load test DAWG: %v", err)
+		return
+	}
+	positiveCases := []string{
+		"act", "arc", "acre", "car", "care", "cares", "cars", "cat",
+		"cats", "dog", "dogs", "god", "gods", "race", "races", "scar", "scare",
+	}
+	negativeCases := []string{
+		"ca", "ac", "do", "cast", "scars", "dogg", "x", "",
+	}
+	for _, word := range positiveCases {
+		if !dawg.Find(word) {
+			t.Errorf("Did not find word '%v' that should be in the DAWG", word)
+		}
+	}
+	for _, word := range negativeCases {
+		if dawg.Find(word) {
+			t.Errorf("Found word '%v' that should not be in the DAWG", word)
+		}
+	}
+	compareResults := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i, s := range a {
+			if s != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	results := dawg.Permute("acres", 4)
+	if !compareResults(results, []string{"acre", "care", "cares", "cars", "race", "races", "scar", "scare"}) {
+		t.Errorf("Permute() returns incorrect result: %v", results)
+	}
+	results = dawg.Match("?a?s")
+	if !compareResults(results, []string{"cars", "cats"}) {
+		t.Errorf("Match() returns incorrect result: %v", results)
+	}
+	// Truncated and corrupt DAWGs should be rejected
+	data, _ := os.ReadFile("testdata/test.bin.dawg")
+	if _, err := NewDawgFromReader(bytes.NewReader(data[0:len(data)-3]), EnglishAlphabet); err == nil {
+		t.Errorf("Truncated DAWG should be rejected")
+	}
+	corrupt := bytes.Clone(data)
+	// Make the first edge of the root node point outside the DAWG
+	corrupt[5] = 0x7f
+	if _, err := NewDawgFromReader(bytes.NewReader(corrupt), EnglishAlphabet); err == nil {
+		t.Errorf("Corrupt DAWG should be rejected")
+	}
+	if _, err := NewDawgFromReader(bytes.NewReader(nil), EnglishAlphabet); err == nil {
+		t.Errorf("Empty DAWG should be rejected")
+	}
+	if _, err := NewDawgFromFile("testdata/nonexistent.bin.dawg", EnglishAlphabet); err == nil {
+		t.Errorf("Nonexistent DAWG file should be rejected")
+	}
+	// An invalid alphabet should be rejected
+	if _, err := LoadDawgFromBytes(data, ""); err == nil {
+		t.Errorf("Empty alphabet should be rejected")
+	}
+	if _, err := LoadDawgFromBytes(data, strings.Repeat("a", 100)); err == nil {
+		t.Errorf("Overlong alphabet should be rejected")
+	}
+	// Loading an embedded DAWG from disk should give the same results
+	otcwl, err := LoadDawg("dicts/otcwl2014.bin.dawg", EnglishAlphabet)
+	if err != nil {
+		t.Errorf("Unable to load DAWG from disk: %v", err)
+		return
+	}
+	for _, word := range []string{"quixotic", "zax", "aa", "retains", "qzx", "xylophon", ""} {
+		if otcwl.Find(word) != OtcwlDictionary.Find(word) {
+			t.Errorf("Find('%v') differs between the loaded and embedded DAWGs", word)
+		}
+	}
+	if !compareResults(otcwl.Permute("retains", 7), OtcwlDictionary.Permute("retains", 7)) {
+		t.Errorf("Permute() differs between the loaded and embedded DAWGs")
+	}
+	// Register the DAWG for a locale and create a game for it
+	RegisterDictionary("xx", dawg, EnglishTileSet)
+	defer RegisterDictionary("xx", nil, nil)
+	game := NewGameForLocale("xx_YY", "standard")
+	if game == nil || game.Dawg != dawg || game.TileSet != EnglishTileSet {
+		t.Errorf("Unable to create a game for a registered locale")
+	}
+	if game = NewGameForLocale("is", "standard"); game == nil || game.Dawg != IcelandicDictionary {
+		t.Errorf("Unable to create a game for a built-in locale")
+	}
+}
+
+func TestEquityRobot(t *testing.T) {
+	leaves, err := ReadLeaveTable(strings.NewReader("# Test leaves\n? 25.0\nq -7.5\n\nes 3.0\n"))
+	if err != nil {
+		t.Errorf("Unable to read leave table: %v", err)
+		return
+	}
+	if leaves.Value([]rune("se")) != 3.0 || leaves.Value([]rune("q?")) != 17.5 ||
+		leaves.Value([]rune("xy")) != 0.0 || leaves.Value(nil) != 0.0 {
+		t.Errorf("Incorrect leave values")
+	}
+	if _, err := ReadLeaveTable(strings.NewReader("? abc\n")); err == nil {
+		t.Errorf("Invalid leave table should be rejected")
+	}
+	board := NewBoard("standard")
+	rack := NewRack([]rune("?eqzxrt"), EnglishTileSet)
+	state := NewState(OtcwlDictionary, EnglishTileSet, board, rack, false)
+	moves := state.GenerateMoves()
+	highScore := NewHighScoreRobot().PickMove(state, moves)
+	usesBlank := func(move Move) bool {
+		for _, cover := range move.(*TileMove).Covers {
+			if cover.Letter == '?' {
+				return true
+			}
+		}
+		return false
+	}
+	if !usesBlank(highScore) {
+		t.Errorf("High-score move should use the blank: %v", highScore)
+	}
+	// The equity robot should prefer a lower-scoring move
+	// that keeps the blank in the rack
+	equity := NewEquityRobot(leaves).PickMove(state, moves)
+	if usesBlank(equity) {
+		t.Errorf("Equity move should not use the blank: %v", equity)
+	}
+	if equity.Score(state) >= highScore.Score(state) {
+		t.Errorf("Equity move should score lower than the high-score move")
+	}
+}
+
+func TestReplayGame(t *testing.T) {
+	runTest := func(boardType string, ctor func(boardType string) *Game) {
+		game := ctor(boardType)
+		if game == nil {
+			t.Errorf("Unable to create a new game")
+			return
+		}
+		robot := NewHighScoreRobot()
+		for !game.IsOver() {
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		data, err := game.Serialize()
+		if err != nil {
+			t.Errorf("Unable to serialize game: %v", err)
+			return
+		}
+		replayed, err := ReplayGame(data)
+		if err != nil {
+			t.Errorf("Unable to replay game: %v", err)
+			return
+		}
+		// The bag contents may be in a different order, but
+		// everything else should be identical
+		if replayed.Board.String() != game.Board.String() ||
+			replayed.Racks[0].AsString() != game.Racks[0].AsString() ||
+			replayed.Racks[1].AsString() != game.Racks[1].AsString() ||
+			replayed.Bag.TileCount() != game.Bag.TileCount() ||
+			replayed.Scores != game.Scores {
+			t.Errorf("Replayed game differs from the original")
+		}
+		// Tamper with the score of a move, and with the rack
+		// drawn after a move: the replay should then fail
+		var gj gameJson
+		json.Unmarshal(data, &gj)
+		gj.Moves[2].Score++
+		data, _ = json.Marshal(gj)
+		if _, err := ReplayGame(data); err == nil || !strings.Contains(err.Error(), "move #2") {
+			t.Errorf("Replay with incorrect score should fail for move #2: %v", err)
+		}
+		gj.Moves[2].Score--
+		gj.Moves[0].Drawn = ""
+		data, _ = json.Marshal(gj)
+		if _, err := ReplayGame(data); err == nil {
+			t.Errorf("Replay with incorrect drawn tiles should fail")
+		}
+	}
+	for _, boardType := range []string{"standard", "explo"} {
+		runTest(boardType, NewIcelandicGame)
+		runTest(boardType, NewOtcwlGame)
+		runTest(boardType, NewSowpodsGame)
+		runTest(boardType, NewOspsGame)
+		runTest(boardType, NewNorwegianBokmålGame)
+		runTest(boardType, NewNorwegianNynorskGame)
+	}
+	// Games on the mini and super boards can be replayed as well
+	runTest("mini", NewIcelandicGame)
+	runTest("mini", NewOtcwlGame)
+	runTest("super", NewOtcwlGame)
+}
+
+func TestExchangeMoves(t *testing.T) {
+	board := NewBoard("standard")
+	countExchanges := func(rackLetters string, exchangeForbidden bool) int {
+		rack := NewRack([]rune(rackLetters), NewEnglishTileSet)
+		state := NewState(OtcwlDictionary, NewEnglishTileSet, board, rack, exchangeForbidden)
+		return len(state.GenerateExchangeMoves())
+	}
+	if n := countExchanges("abcdefg", false); n != 127 {
+		t.Errorf("Expected 127 exchanges, got %v", n)
+	}
+	if n := countExchanges("aabbcc?", false); n != 53 {
+		t.Errorf("Expected 53 exchanges, got %v", n)
+	}
+	if n := countExchanges("abcdefg", true); n != 0 {
+		t.Errorf("Exchanges should not be generated when forbidden")
+	}
+	rack := NewRack([]rune("?qvuuws"), NewEnglishTileSet)
+	state := NewState(OtcwlDictionary, NewEnglishTileSet, board, rack, false)
+	options := state.RankExchangeMoves(nil)
+	if len(options) == 0 || options[0].Letters != "qvuuw" || options[0].Leave != "?s" {
+		t.Errorf("Best exchange should keep the blank and the s")
+	}
+	// A custom leave table that favors keeping the q
+	options = state.RankExchangeMoves(LeaveTable{
+		"q": 10.0, "?": -1.0, "s": -1.0, "u": -1.0, "v": -1.0, "w": -1.0,
+	})
+	if len(options) == 0 || options[0].Leave != "q" {
+		t.Errorf("Custom leave table not respected")
+	}
+	// The same via the HTTP handler
+	boardRows := make([]string, BoardSize)
+	for i := range boardRows {
+		boardRows[i] = strings.Repeat(".", BoardSize)
+	}
+	req := ExchangeRequest{
+		MovesRequest: MovesRequest{
+			Locale:    "en_US",
+			BoardType: "explo",
+			Board:     boardRows,
+			Rack:      "?qvuuws",
+			Limit:     5,
+		},
+	}
+	w := httptest.NewRecorder()
+	HandleExchangeRequest(w, req)
+	var result ExchangeHeaderJson
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to decode exchange response: %v", err)
+		return
+	}
+	if result.Count != 5 || result.Exchanges[0].Letters != "qvuuw" {
+		t.Errorf("Unexpected exchange response: %+v", result)
+	}
+}
+
+func TestGenerateExchanges(t *testing.T) {
+	board := NewBoard("standard")
+	countExchanges := func(rackLetters string, exchangeForbidden bool) int {
+		rack := NewRack([]rune(rackLetters), NewEnglishTileSet)
+		state := NewState(OtcwlDictionary, NewEnglishTileSet, board, rack, exchangeForbidden)
+		return len(state.GenerateExchanges())
+	}
+	if n := countExchanges("abcdefg", false); n != 64 {
+		t.Errorf("Expected 64 exchanges, got %v", n)
+	}
+	if n := countExchanges("aaaaaaa", false); n != 4 {
+		t.Errorf("Expected 4 exchanges, got %v", n)
+	}
+	if n := countExchanges("abc", false); n != 7 {
+		t.Errorf("Expected 7 exchanges, got %v", n)
+	}
+	if n := countExchanges("abcdefg", true); n != 0 {
+		t.Errorf("Exchanges should not be generated when forbidden")
+	}
+	// Every generated exchange must be valid in an actual game
+	game := NewOtcwlGame("standard")
+	robot := NewHighScoreRobot()
+	for i := 0; i < 4 && !game.IsOver(); i++ {
+		state := game.State()
+		exchanges := state.GenerateExchanges()
+		if len(exchanges) == 0 {
+			t.Errorf("No exchanges generated")
+		}
+		for _, exchange := range exchanges {
+			if n := len([]rune(exchange.Letters)); n > maxPartialExchange && n != RackSize {
+				t.Errorf("Unexpected exchange size: %v", exchange)
+			}
+			if !exchange.IsValid(game) {
+				t.Errorf("Generated exchange is not valid: %v", exchange)
+			}
+		}
+		game.ApplyValid(robot.GenerateMove(state))
+	}
+	// With a poor rack, the equity robot should prefer to exchange
+	// the worst tiles over playing a low-scoring tile move
+	rack := NewRack([]rune("?quuvvw"), NewEnglishTileSet)
+	state := NewState(OtcwlDictionary, NewEnglishTileSet, board, rack, false)
+	moves := state.GenerateMoves()
+	if len(moves) == 0 {
+		t.Errorf("Expected some tile moves")
+		return
+	}
+	move := NewEquityRobot(EnglishLeaveTable).PickMove(state, moves)
+	if exchange, ok := move.(*ExchangeMove); !ok || strings.ContainsRune(exchange.Letters, '?') {
+		t.Errorf("Expected an exchange that keeps the blank, got %v", move)
+	}
+	// When exchanges are forbidden, a tile move must be played
+	state = NewState(OtcwlDictionary, NewEnglishTileSet, board, rack, true)
+	if _, ok := NewEquityRobot(EnglishLeaveTable).PickMove(state, moves).(*TileMove); !ok {
+		t.Errorf("Expected a tile move when exchanges are forbidden")
+	}
+}
+
+// benchmarkState returns a GameState with an Icelandic board
+// in the middle of a game, for use in benchmarks
+func benchmarkState() *GameState {
+	rows := []string{
+		"...............",
+		".ásaumaði......",
+		".......s.......",
+		".......t.......",
+		"skurslna.sói...",
+		"æ......r.ýk....",
+		"l.....háfluginn",
+		"u.kotrað....r..",
+		"e...r.gimb..r..",
+		"y...ú.......i..",
+		"....ð.......n..",
+		"vílxi.stórfenga",
+		"....n...péa.ó..",
+		"....u..........",
+		".frumtana......",
+	}
+	tileSet := NewIcelandicTileSet
+	board := NewBoard("standard")
+	for r, row := range rows {
+		for c, letter := range []rune(row) {
+			if letter != '.' {
+				tile := &Tile{Letter: letter, Meaning: letter, Score: tileSet.Scores[letter]}
+				board.PlaceTile(r, c, tile)
+			}
+		}
+	}
+	rack := NewRack([]rune("aeinrs?"), tileSet)
+	return NewState(IcelandicDictionary, tileSet, board, rack, false)
+}
+
+func BenchmarkGenerateMoves(b *testing.B) {
+	state := benchmarkState()
+	var moves []Move
+	for i := 0; i < b.N; i++ {
+		moves = state.GenerateMoves()
+	}
+	// Guard against optimizations that change the generated moves
+	b.StopTimer()
+	if digest := moveListDigest(moves); digest != moveListDigests["aeinrs?"] {
+		b.Errorf("The moves generated have changed (digest %v)", digest)
+	}
+}
+
+// moveListDigests contains digests of the lists of moves generated in
+// benchmarkState() for a few racks, and on an empty board (""), as they
+// were before the allocations in move generation were reduced
+var moveListDigests = map[string]string{
+	"aeinrs?": "9d2ecc743e509814",
+	"??ástúð": "5a2beb6fb9ce3ee9",
+	"eeiiaau": "6ec0e76efff06f53",
+	"þxyæöoé": "ceff933541a9dce6",
+	"":        "417ab343e2fb8ee3",
+}
+
+// moveListDigest returns a digest of a list of tile moves and
+// their scores, independent of the order of the list
+func moveListDigest(moves []Move) string {
+	lines := make([]string, len(moves))
+	for i, move := range moves {
+		lines[i] = fmt.Sprintf("%v %v", move, *move.(*TileMove).CachedScore)
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		fmt.Fprintln(h, line)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+func TestMoveListDigests(t *testing.T) {
+	state := benchmarkState()
+	empty := NewState(
+		IcelandicDictionary, NewIcelandicTileSet, NewBoard("standard"),
+		NewRack([]rune("aeinrs?"), NewIcelandicTileSet), false,
+	)
+	check := func() {
+		for rack, expected := range moveListDigests {
+			if rack == "" {
+				if digest := moveListDigest(empty.GenerateMoves()); digest != expected {
+					t.Errorf("Unexpected moves on an empty board (digest %v)", digest)
+				}
+				continue
+			}
+			state := *state
+			state.Rack = NewRack([]rune(rack), state.TileSet)
+			if digest := moveListDigest(state.GenerateMoves()); digest != expected {
+				t.Errorf("Unexpected moves for rack %v (digest %v)", rack, digest)
+			}
+		}
+	}
+	// Check repeatedly and concurrently, so that pooled navigators
+	// and buffers are reused across racks and boards
+	check()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check()
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkGenerateMovesGaddag(b *testing.B) {
+	state := benchmarkState()
+	gaddag := NewGaddagFromState(state)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state.GenerateMovesGaddag(gaddag)
+	}
+}
+
+func BenchmarkGenerateMovesParallel(b *testing.B) {
+	state := benchmarkState()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			state.GenerateMoves()
+		}
+	})
+}
+
+func TestMoveGenerationBaseline(t *testing.T) {
+	// Lock in the output of the move generator for a fixed
+	// mid-game position, so that refactoring of the generator
+	// can be shown to preserve its behavior
+	state := benchmarkState()
+	runTest := func(rack string, count int, best string, score int) {
+		state.Rack = NewRack([]rune(rack), state.TileSet)
+		if n := len(state.GenerateMoves()); n != count {
+			t.Errorf("Rack %v: expected %v moves, got %v", rack, count, n)
+		}
+		moves := state.BestMoves(1)
+		if len(moves) != 1 {
+			t.Errorf("Rack %v: no best move found", rack)
+			return
+		}
+		if s := moves[0].Move.(*TileMove).String(); s != best || moves[0].Score != score {
+			t.Errorf(
+				"Rack %v: expected best move %v (%v), got %v (%v)",
+				rack, best, score, s, moves[0].Score,
+			)
+		}
+	}
+	runTest("aeinrs?", 10035, "15A arsenin?u", 158)
+	runTest("kettir?", 5797, "15A k?átertni", 185)
+}
+
+func TestDawgCaches(t *testing.T) {
+	// Use a private Dawg instance, so that the shared
+	// dictionaries are not affected by the cache limits
+	dawg := makeDawg("ordalisti.bin.dawg", IcelandicAlphabet)
+	stats := dawg.Stats()
+	if stats.CrossSets.Size != 0 || stats.Nodes.Size != 0 || stats.Nodes.Hits != 0 {
+		t.Errorf("Expected empty caches, got %+v", stats)
+	}
+	reference := benchmarkState()
+	expected := len(reference.GenerateMoves())
+	state := benchmarkState()
+	state.Dawg = dawg
+	if n := len(state.GenerateMoves()); n != expected {
+		t.Errorf("Expected %v moves, got %v", expected, n)
+	}
+	stats = dawg.Stats()
+	if stats.CrossSets.Misses == 0 || stats.Nodes.Misses == 0 || stats.Nodes.Hits == 0 {
+		t.Errorf("Expected cache activity, got %+v", stats)
+	}
+	if stats.CrossSets.Size > DefaultCrossCacheSize {
+		t.Errorf("Cross-set cache too large: %+v", stats.CrossSets)
+	}
+	// Shrink both caches and generate concurrently: the results
+	// must be unchanged and the caches must respect their limits
+	dawg.SetCrossCacheSize(cacheShards)
+	dawg.SetNodeCacheLimit(10 * cacheShards)
+	if stats = dawg.Stats(); stats.CrossSets.Misses != 0 || stats.Nodes.Size != 0 {
+		t.Errorf("Expected reset caches, got %+v", stats)
+	}
+	var wg sync.WaitGroup
+	counts := make([]int, 8)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i] = len(state.GenerateMoves())
+		}(i)
+	}
+	wg.Wait()
+	for _, n := range counts {
+		if n != expected {
+			t.Errorf("Expected %v moves with small caches, got %v", expected, n)
+		}
+	}
+	stats = dawg.Stats()
+	if stats.CrossSets.Size > cacheShards || stats.CrossSets.Evictions == 0 {
+		t.Errorf("Unexpected cross-set cache stats: %+v", stats.CrossSets)
+	}
+	if stats.Nodes.Size > 10*cacheShards {
+		t.Errorf("Node cache exceeds its limit: %+v", stats.Nodes)
+	}
+}
+
+func TestGCG(t *testing.T) {
+	runTest := func(locale string) {
+		game := NewGameForLocale(locale, "standard")
+		game.SetPlayerNames("Robot A", "Robot B")
+		robot := NewHighScoreRobot()
+		for !game.IsOver() {
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		var buf bytes.Buffer
+		if err := game.WriteGCG(&buf); err != nil {
+			t.Errorf("Unable to write GCG: %v", err)
+			return
+		}
+		loaded, err := LoadGCG(bytes.NewReader(buf.Bytes()), locale)
+		if err != nil {
+			t.Errorf("Unable to load GCG: %v\n%v", err, buf.String())
+			return
+		}
+		if loaded.Board.String() != game.Board.String() ||
+			loaded.Scores != game.Scores ||
+			loaded.PlayerNames != game.PlayerNames ||
+			len(loaded.MoveList) != len(game.MoveList) {
+			t.Errorf("Loaded GCG game differs from the original")
+		}
+	}
+	runTest("is")
+	runTest("en_US")
+	runTest("pl")
+
+	gcg := "#player1 alice Alice\n" +
+		"#player2 bob Bob\n" +
+		">alice: AEINRT? H4 sTAINER +68 68\n" +
+		">bob: AOMXYÞÆ 5G A.OM +%v %v\n"
+	game, err := LoadGCG(strings.NewReader(strings.ReplaceAll(gcg, "%v", "10")), "is")
+	if err != nil {
+		t.Errorf("Unable to load GCG: %v", err)
+		return
+	}
+	if game.PlayerNames != [2]string{"Alice", "Bob"} || game.Scores != [2]int{68, 10} {
+		t.Errorf("Unexpected result from GCG: %v %v", game.PlayerNames, game.Scores)
+	}
+	if tile := game.TileAt(7, 3); tile == nil || tile.Letter != '?' || tile.Meaning != 's' {
+		t.Errorf("Blank tile not placed correctly")
+	}
+	// An incorrect score should be reported, with the line number
+	_, err = LoadGCG(strings.NewReader(strings.ReplaceAll(gcg, "%v", "11")), "is")
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Incorrect score not reported: %v", err)
+	}
+}
+
+func TestGenerateMovesCtx(t *testing.T) {
+	state := benchmarkState()
+	moveStrings := func(moves []Move) []string {
+		result := make([]string, len(moves))
+		for i, move := range moves {
+			result[i] = move.(*TileMove).String()
+		}
+		sort.Strings(result)
+		return result
+	}
+	expected := moveStrings(state.GenerateMoves())
+	// A limited number of workers should find the same moves
+	for _, workers := range []int{1, 4, 100} {
+		moves, err := state.GenerateMovesCtx(context.Background(), workers)
+		if err != nil || !slices.Equal(moveStrings(moves), expected) {
+			t.Errorf("Moves generated by %v workers differ", workers)
+		}
+	}
+	// An already cancelled context should result in no moves
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if moves, err := state.GenerateMovesCtx(ctx, 2); err != context.Canceled || len(moves) != 0 {
+		t.Errorf("Cancelled generation should return no moves")
+	}
+	// Cancellation in the middle of generation should neither
+	// deadlock nor return more moves than are available
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), time.Duration(i)*time.Millisecond,
+		)
+		moves, err := state.GenerateMovesCtx(ctx, 1+i%3)
+		cancel()
+		if len(moves) > len(expected) || (err == nil && len(moves) != len(expected)) {
+			t.Errorf("Unexpected result from interrupted generation")
+		}
+	}
+}
+
+func TestBoardSizes(t *testing.T) {
+	for boardType, size := range map[string]int{
+		"standard": 15, "explo": 15, "mini": 11, "super": 21,
+	} {
+		board := NewBoard(boardType)
+		if board.Size != size {
+			t.Errorf("Board type %v should have size %v", boardType, size)
+		}
+		if board.Sq(size-1, size-1) == nil || board.Sq(size, 0) != nil {
+			t.Errorf("Incorrect bounds for board type %v", boardType)
+		}
+	}
+	runTest := func(boardType string) {
+		game := NewIcelandicGame(boardType)
+		robot := NewHighScoreRobot()
+		for !game.IsOver() {
+			if !game.ApplyValid(robot.GenerateMove(game.State())) {
+				t.Errorf("Unable to apply robot move on %v board", boardType)
+				return
+			}
+		}
+		if game.Board.NumTiles == 0 || !game.Board.HasStartTile() {
+			t.Errorf("No tiles played on %v board", boardType)
+		}
+		for _, item := range game.MoveList {
+			if move, ok := item.Move.(*TileMove); ok {
+				if move.BottomRight.Row >= game.Board.Size ||
+					move.BottomRight.Col >= game.Board.Size {
+					t.Errorf("Move %v is off the %v board", move, boardType)
+				}
+			}
+		}
+	}
+	runTest("mini")
+	runTest("super")
+}
+
+func TestParseMove(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	// Empty the opponent's rack first, so that the tiles are in the bag
+	game.ForceRack(1, "")
+	if !game.ForceRack(-1, "pr?faðu") {
+		t.Errorf("Unable to force rack")
+		return
+	}
+	if _, err := game.ParseMove("8F PRÓFAÐU"); err == nil {
+		t.Errorf("Move with tiles not in the rack should be rejected")
+	}
+	for _, s := range []string{"8F prÓfaðu", "8f pr?ófaðu"} {
+		move, err := game.ParseMove(s)
+		if err != nil {
+			t.Errorf("Unable to parse move '%v': %v", s, err)
+			return
+		}
+		covers := move.(*TileMove).Covers
+		if len(covers) != 7 || covers[Coordinate{7, 7}] != (Cover{'?', 'ó'}) {
+			t.Errorf("Blank tile not parsed correctly in '%v'", s)
+		}
+	}
+	move, _ := game.ParseMove("8F prÓfaðu")
+	if !game.Apply(move) {
+		t.Errorf("Parsed move could not be applied")
+		return
+	}
+	game.ForceRack(0, "")
+	game.ForceRack(-1, "aeiklns")
+	// A single tile can be placed in either direction,
+	// extending the word on the board or crossing it
+	for s, coord := range map[string]Coordinate{
+		"8L ua": {12, 7},
+		"L8 Ua": {11, 8},
+		"L8 .a": {11, 8},
+	} {
+		move, err := game.ParseMove(s)
+		if err != nil {
+			t.Errorf("Unable to parse move '%v': %v", s, err)
+			continue
+		}
+		covers := move.(*TileMove).Covers
+		if len(covers) != 1 || covers[coord] != (Cover{'a', 'a'}) {
+			t.Errorf("Single tile not placed correctly by '%v'", s)
+		}
+	}
+	for _, s := range []string{"L8 xa", "8L ux", "L9 .a", "Z1 ab", "pass x", "exch xyz", ""} {
+		if _, err := game.ParseMove(s); err == nil {
+			t.Errorf("Invalid move '%v' should be rejected", s)
+		}
+	}
+	if move, err := game.ParseMove("exch aei"); err != nil || move.(*ExchangeMove).Letters != "aei" {
+		t.Errorf("Unable to parse an exchange move")
+	}
+	if move, err := game.ParseMove("PASS"); err != nil || !game.Apply(move) {
+		t.Errorf("Unable to parse and apply a pass move")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// Set up a game in the given mode, where the first player
+	// attempts the given move
+	playFirst := func(mode ChallengeMode, move string) *Game {
+		game := NewIcelandicGame("standard")
+		game.SetChallengeMode(mode)
+		game.ForceRack(1, "")
+		if !game.ForceRack(0, "prófaðu") || !game.Racks[1].Fill(game.Bag) {
+			t.Errorf("Unable to force racks")
+			return nil
+		}
+		m, err := game.ParseMove(move)
+		if err != nil {
+			t.Errorf("Unable to parse move: %v", err)
+			return nil
+		}
+		// The move is rejected if it is invalid in this mode
+		game.Apply(m)
+		return game
+	}
+	if IcelandicDictionary.Find("paðfóru") {
+		t.Errorf("The test needs a word that is not in the dictionary")
+		return
+	}
+	// VoidInvalid: invalid words are rejected and there is nothing to challenge
+	game := playFirst(VoidInvalid, "8F paðfóru")
+	if game == nil || len(game.MoveList) != 0 {
+		t.Errorf("Invalid word should be rejected in VoidInvalid mode")
+		return
+	}
+	game = playFirst(VoidInvalid, "8F prófaðu")
+	if game.Challenge() || len(game.MoveList) != 1 {
+		t.Errorf("Challenges should have no effect in VoidInvalid mode")
+	}
+	for _, mode := range []ChallengeMode{DoubleChallenge, SingleChallenge} {
+		// An invalid word is accepted, and stays on the board if unchallenged
+		game = playFirst(mode, "8F paðfóru")
+		if len(game.MoveList) != 1 || game.TilesOnBoard() != 7 {
+			t.Errorf("Invalid word should be accepted in mode %v", mode)
+			return
+		}
+		game.MakePassMove()
+		if game.Challenge() || game.TilesOnBoard() != 7 {
+			t.Errorf("Unchallenged invalid word should stay on the board")
+		}
+		// An invalid word is taken off the board when challenged
+		game = playFirst(mode, "8F paðfóru")
+		rackBefore := game.MoveList[0].RackBefore
+		if !game.Challenge() {
+			t.Errorf("Challenge of an invalid word should be upheld")
+		}
+		if game.TilesOnBoard() != 0 || game.Scores[0] != 0 ||
+			game.Racks[0].AsString() != rackBefore || game.PlayerToMove() != 1 {
+			t.Errorf("Invalid word not properly taken back")
+		}
+		if _, ok := game.MoveList[0].Move.(*VoidMove); !ok {
+			t.Errorf("Player should lose the turn after an upheld challenge")
+		}
+		// A valid word stays on the board when challenged
+		game = playFirst(mode, "8F prófaðu")
+		score, drawn := game.Scores[0], game.MoveList[0].Drawn
+		if game.Challenge() {
+			t.Errorf("Challenge of a valid word should not be upheld")
+		}
+		if game.TilesOnBoard() != 7 || game.Scores[0] != score ||
+			game.MoveList[0].Drawn != drawn {
+			t.Errorf("Valid word should remain after a challenge")
+		}
+		if mode == DoubleChallenge {
+			// The challenger loses the turn
+			if game.PlayerToMove() != 0 || len(game.MoveList) != 2 {
+				t.Errorf("Challenger should lose the turn in DoubleChallenge mode")
+			}
+		} else if game.PlayerToMove() != 1 || len(game.MoveList) != 1 {
+			t.Errorf("Challenger should not lose the turn in SingleChallenge mode")
+		}
+		// The challenge can be undone like any other move
+		for game.UndoLastMove() {
+		}
+		if game.TilesOnBoard() != 0 || game.Racks[0].AsString() != "prófaðu" {
+			t.Errorf("Unable to undo the challenge")
+		}
+	}
+}
+
+func TestSimRobot(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	robot := NewHighScoreRobot()
+	for i := 0; i < 4 && !game.IsOver(); i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	state := game.State()
+	if len(state.Unseen) != game.Bag.TileCount()+len(game.Racks[1-game.PlayerToMove()].AsRunes()) {
+		t.Errorf("Incorrect number of unseen tiles: %v", len(state.Unseen))
+	}
+	moves := state.GenerateMoves()
+	if len(moves) < 2 {
+		// Nothing to simulate
+		return
+	}
+	// Robots with the same random source should pick the same move
+	pick := func() Move {
+		sim := NewSimRobotWithSource(4, 3, 0, rand.NewSource(42))
+		return sim.PickMove(state, slices.Clone(moves))
+	}
+	first, second := pick(), pick()
+	if first != second {
+		t.Errorf("Simulation is not deterministic: %v vs. %v", first, second)
+	}
+	// The picked move should be one of the candidates
+	sort.Sort(byScore{state, moves})
+	if !slices.Contains(moves[:4], first) {
+		t.Errorf("Picked move %v is not among the candidates", first)
+	}
+	// Without the unseen tiles, the highest-scoring move is picked
+	state.Unseen = nil
+	if move := NewSimRobot(4, 3, 0).PickMove(state, moves); move.Score(state) != moves[0].Score(state) {
+		t.Errorf("Expected the highest-scoring move, got %v", move)
+	}
+}
+
+func BenchmarkSimRobot(b *testing.B) {
+	// Play games between a SimRobot and a HighScoreRobot, alternating
+	// who starts, and report the SimRobot's win rate. Run with e.g.
+	// -benchtime 100x to play a given number of games.
+	sim := NewSimRobotWithSource(5, 10, 0, rand.NewSource(31743))
+	highScore := NewHighScoreRobot()
+	wins := 0.0
+	for i := 0; i < b.N; i++ {
+		game := NewIcelandicGame("standard")
+		robots := [2]*RobotWrapper{sim, highScore}
+		simPlayer := i % 2
+		if simPlayer == 1 {
+			robots[0], robots[1] = highScore, sim
+		}
+		for !game.IsOver() {
+			state := game.State()
+			game.ApplyValid(robots[game.PlayerToMove()].GenerateMove(state))
+		}
+		switch own, other := game.Scores[simPlayer], game.Scores[1-simPlayer]; {
+		case own > other:
+			wins += 1.0
+		case own == other:
+			wins += 0.5
+		}
+	}
+	b.ReportMetric(wins/float64(b.N), "winrate")
+}
+
+func TestBestMove(t *testing.T) {
+	emptyBoard := make([]string, BoardSize)
+	for i := range emptyBoard {
+		emptyBoard[i] = strings.Repeat(".", BoardSize)
+	}
+	request := func(rack, strategy string) (int, BestMoveHeaderJson) {
+		req := BestMoveRequest{
+			MovesRequest: MovesRequest{
+				Locale:    "en_US",
+				BoardType: "standard",
+				Board:     emptyBoard,
+				Rack:      rack,
+			},
+			Strategy: strategy,
+		}
+		w := httptest.NewRecorder()
+		HandleBestMoveRequest(w, req)
+		var result BestMoveHeaderJson
+		if w.Code == 200 {
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Unable to decode best move response: %v", err)
+			}
+		}
+		return w.Code, result
+	}
+	code, result := request("aeinrst", "")
+	if code != 200 || result.Strategy != "highscore" || result.Count < 2 {
+		t.Errorf("Unexpected best move response: %v %+v", code, result)
+	}
+	move := result.Move
+	if move.Kind != "tile" || !move.Bingo || len([]rune(move.Tiles)) != RackSize || move.Score < 50 {
+		t.Errorf("Expected a bingo: %+v", move)
+	}
+	code, result = request("aeinrst", "oneofnbest")
+	if code != 200 || result.Move.Kind != "tile" {
+		t.Errorf("Unexpected best move response: %v %+v", code, result)
+	}
+	// No tile moves: an exchange of the whole rack is recommended
+	code, result = request("xxxxxxx", "highscore")
+	if code != 200 || result.Count != 0 || result.Move.Kind != "exchange" || result.Move.Tiles != "xxxxxxx" {
+		t.Errorf("Expected an exchange: %v %+v", code, result)
+	}
+	if code, _ = request("aeinrst", "greedy"); code != 400 {
+		t.Errorf("Invalid strategy should be rejected")
+	}
+}
+
+func TestCustomTileSet(t *testing.T) {
+	scores := map[rune]int{'a': 1, 'b': 3, 'c': 3, 'e': 1, 'r': 1, 's': 1, 't': 1, '?': 0}
+	counts := map[rune]int{'a': 6, 'b': 2, 'c': 2, 'e': 8, 'r': 4, 's': 4, 't': 4, '?': 2}
+	tileSet, err := NewTileSet(scores, counts)
+	if err != nil {
+		t.Errorf("Unable to create tile set: %v", err)
+		return
+	}
+	if tileSet.Size != 32 || len(tileSet.Tiles) != 32 {
+		t.Errorf("Incorrect tile set size: %v", tileSet.Size)
+	}
+	tally := make(map[rune]int)
+	for _, tile := range tileSet.Tiles {
+		tally[tile.Letter]++
+		if tile.Score != scores[tile.Letter] {
+			t.Errorf("Incorrect score for tile '%c'", tile.Letter)
+		}
+	}
+	for letter, count := range counts {
+		if tally[letter] != count {
+			t.Errorf("Expected %v tiles of '%c', got %v", count, letter, tally[letter])
+		}
+	}
+	// Invalid tile sets
+	noBlank := map[rune]int{'a': 10, 'e': 10}
+	if _, err := NewTileSet(scores, noBlank); err == nil {
+		t.Errorf("Tile set without blanks should be rejected")
+	}
+	noBlank['?'] = 0
+	if _, err := NewTileSet(scores, noBlank); err != nil {
+		t.Errorf("Tile set explicitly without blanks should be allowed: %v", err)
+	}
+	if _, err := NewTileSet(scores, map[rune]int{'a': 10, 'z': 5, '?': 2}); err == nil {
+		t.Errorf("Letter without a score should be rejected")
+	}
+	// A custom game pairing the tile set with the U.S. English dictionary
+	game, err := NewCustomGame("standard", OtcwlDictionary, tileSet)
+	if err != nil {
+		t.Errorf("Unable to create custom game: %v", err)
+		return
+	}
+	if game.Bag.TileCount() != 32-2*RackSize {
+		t.Errorf("Incorrect number of tiles in the bag: %v", game.Bag.TileCount())
+	}
+	robot := NewHighScoreRobot()
+	for !game.IsOver() {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	if _, err := NewCustomGame("huge", OtcwlDictionary, tileSet); err == nil {
+		t.Errorf("Invalid board type should be rejected")
+	}
+}
+
+func TestResignation(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	robot := NewHighScoreRobot()
+	for i := 0; i < 3; i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	if game.OverReason() != NotOver {
+		t.Errorf("Game should not be over")
+	}
+	if _, ok := game.Winner(); ok {
+		t.Errorf("Game in progress should not have a winner")
+	}
+	// Player 1 resigns
+	resigner := game.PlayerToMove()
+	scores := game.Scores
+	rackValue := 0
+	for _, letter := range game.Racks[resigner].AsRunes() {
+		rackValue += game.TileSet.Scores[letter]
+	}
+	if !game.Apply(NewResignMove()) || !game.IsOver() || game.OverReason() != Resignation {
+		t.Errorf("Game should be over by resignation")
+	}
+	if game.Scores[1-resigner] != scores[1-resigner] || game.Scores[resigner] != scores[resigner]-rackValue {
+		t.Errorf("Incorrect scores after resignation: %v, expected %v and penalty %v",
+			game.Scores, scores, rackValue)
+	}
+	// The opponent wins, even when behind on points
+	game.Scores[resigner] += 1000
+	if winner, ok := game.Winner(); !ok || winner != 1-resigner {
+		t.Errorf("The resigner's opponent should win")
+	}
+	game.Scores[resigner] -= 1000
+	if !strings.Contains(game.String(), "Resign") {
+		t.Errorf("Move list should show the resignation")
+	}
+	// The resignation survives serialization
+	data, err := game.Serialize()
+	if err != nil {
+		t.Errorf("Unable to serialize game: %v", err)
+		return
+	}
+	restored, err := DeserializeGame(data)
+	if err != nil || !restored.IsOver() || restored.Resigner != resigner || restored.Scores != game.Scores {
+		t.Errorf("Resignation not restored by deserialization: %v", err)
+	}
+	replayed, err := ReplayGame(data)
+	if err != nil || replayed.OverReason() != Resignation || replayed.Scores != game.Scores {
+		t.Errorf("Resignation not restored by replay: %v", err)
+	}
+	// Taking back the resignation resumes the game
+	if !game.UndoLastMove() || game.IsOver() || game.Scores != scores {
+		t.Errorf("Unable to take back resignation")
+	}
+	if !game.Apply(NewTimeForfeitMove()) || game.OverReason() != TimeForfeit {
+		t.Errorf("Game should be over by time forfeit")
+	}
+	var sb strings.Builder
+	mws := MoveWithScore{Move: NewTimeForfeitMove(), Score: 0}
+	if err := json.NewEncoder(&sb).Encode(&mws); err != nil || !strings.Contains(sb.String(), `"TIME"`) {
+		t.Errorf("Unable to marshal time forfeit: %v %v", err, sb.String())
+	}
+}
+
+func TestResign(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	robot := NewHighScoreRobot()
+	for i := 0; i < 4; i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	// Player 0 resigns and player 1 wins
+	if game.PlayerToMove() != 0 || !game.Resign() {
+		t.Errorf("Player 0 should be able to resign")
+	}
+	if winner, ok := game.Winner(); !game.IsOver() || !ok || winner != 1 {
+		t.Errorf("Player 1 should win after player 0 resigns")
+	}
+	// No further moves can be applied
+	numMoves := len(game.MoveList)
+	if game.Resign() || game.MakePassMove() || game.Apply(NewExchangeMove("a")) {
+		t.Errorf("Moves should not be applied after resignation")
+	}
+	if move := robot.GenerateMove(game.State()); move != nil && game.Apply(move) {
+		t.Errorf("Robot move should not be applied after resignation")
+	}
+	if len(game.MoveList) != numMoves {
+		t.Errorf("Move list should not change after resignation")
+	}
+}
+
+func TestBestMoves(t *testing.T) {
+	stateFor := func(rack string) *GameState {
+		board := NewBoard("standard")
+		for i, letter := range "cat" {
+			tile := &Tile{Letter: letter, Meaning: letter, Score: EnglishTileSet.Scores[letter]}
+			board.PlaceTile(7, 7+i, tile)
+		}
+		return NewState(OtcwlDictionary, EnglishTileSet, board, NewRack([]rune(rack), EnglishTileSet), false)
+	}
+	// SCAT and CATS are tied as the best moves
+	state := stateFor("s")
+	best := state.BestMoves(3)
+	if len(best) != 3 || best[0].Score != 6 || best[1].Score != 6 || best[2].Score >= 6 {
+		t.Errorf("Unexpected best moves: %v", best)
+	}
+	if state.HasUniqueBest() {
+		t.Errorf("Tied best moves should not be unique")
+	}
+	all := state.BestMoves(0)
+	if len(all) != len(state.GenerateMoves()) {
+		t.Errorf("BestMoves(0) should return all moves")
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Score > all[i-1].Score {
+			t.Errorf("Best moves are not sorted by score")
+		}
+	}
+	// ZA is the unique best move
+	state = stateFor("zy")
+	best = state.BestMoves(1)
+	if len(best) != 1 || best[0].Score != 21 || !state.HasUniqueBest() {
+		t.Errorf("Expected a unique best move: %v", best)
+	}
+	// No moves at all
+	state = stateFor("q")
+	if len(state.BestMoves(5)) != 0 || state.HasUniqueBest() {
+		t.Errorf("Expected no best moves")
+	}
+	// On an empty board, every move is tied with its transposition
+	state = NewState(OtcwlDictionary, EnglishTileSet, NewBoard("standard"),
+		NewRack([]rune("quizbag"), EnglishTileSet), false)
+	if state.HasUniqueBest() {
+		t.Errorf("Best move on an empty board should not be unique")
+	}
+}
+
+// recomputeScore calculates the score of a tile move from scratch,
+// independently of TileMove.Score(), using the multiplier grids of the
+// board. It reports an error if the move covers a square that already
+// has a tile on it, whose premium would then be counted twice.
+func recomputeScore(t *testing.T, state *GameState, move *TileMove) int {
+	t.Helper()
+	board := state.Board
+	wordMult, letterMult := board.Multipliers()
+	for coord := range move.Covers {
+		if board.TileAt(coord.Row, coord.Col) != nil {
+			t.Errorf("Move %v covers the occupied square %v%v",
+				move, rowIds[coord.Row], colIds[coord.Col])
+		}
+	}
+	occupied := func(row, col int) bool {
+		if row < 0 || col < 0 || row >= board.Size || col >= board.Size {
+			return false
+		}
+		_, covered := move.Covers[Coordinate{row, col}]
+		return covered || board.TileAt(row, col) != nil
+	}
+	// wordScore returns the score and length of the word through
+	// the given square, in the given direction
+	wordScore := func(row, col, dRow, dCol int) (score, length int) {
+		for occupied(row-dRow, col-dCol) {
+			row, col = row-dRow, col-dCol
+		}
+		multiplier := 1
+		for ; occupied(row, col); row, col = row+dRow, col+dCol {
+			if cover, covered := move.Covers[Coordinate{row, col}]; covered {
+				letterScore, _ := state.TileSet.Score(cover.Letter)
+				score += letterScore * letterMult[row][col]
+				multiplier *= wordMult[row][col]
+			} else {
+				score += board.TileAt(row, col).Score
+			}
+			length++
+		}
+		return score * multiplier, length
+	}
+	dRow, dCol := 0, 1
+	if !move.Horizontal {
+		dRow, dCol = 1, 0
+	}
+	score, _ := wordScore(move.TopLeft.Row, move.TopLeft.Col, dRow, dCol)
+	for coord := range move.Covers {
+		if crossScore, length := wordScore(coord.Row, coord.Col, dCol, dRow); length > 1 {
+			score += crossScore
+		}
+	}
+	if len(move.Covers) == state.RackSize() {
+		score += scoringRules(state.Rules).BingoBonus
+	}
+	return score
+}
+
+func TestPremiumsCountedOnce(t *testing.T) {
+	// The scores of all generated moves, throughout robot games,
+	// agree with scores recalculated from the multiplier grids,
+	// where only the squares covered by a move count their premiums
+	for seed, locale := range []string{"en_US", "is"} {
+		for _, boardType := range []string{"standard", "explo"} {
+			game := NewGameForLocaleWithOptions(locale, boardType,
+				GameOptions{RandSource: rand.NewSource(int64(seed))})
+			robot := NewHighScoreRobot()
+			for !game.IsOver() {
+				state := game.State()
+				for _, move := range state.GenerateMoves() {
+					tileMove := *move.(*TileMove)
+					tileMove.CachedScore = nil
+					if score, expected := tileMove.Score(state), recomputeScore(t, state, &tileMove); score != expected {
+						t.Fatalf("%v %v: move %v scores %v, expected %v",
+							locale, boardType, &tileMove, score, expected)
+					}
+				}
+				game.ApplyValid(robot.GenerateMove(state))
+			}
+		}
+	}
+}
+
+func TestPremiums(t *testing.T) {
+	board := NewBoard("standard")
+	word, letter := board.Multipliers()
+	if len(word) != BoardSize || len(letter[0]) != BoardSize {
+		t.Errorf("Incorrect multiplier grid size")
+	}
+	// Triple word score in the corner, double word score in the center
+	if word[0][0] != 3 || word[7][7] != 2 || letter[0][0] != 1 {
+		t.Errorf("Incorrect multipliers")
+	}
+	numPremiums := 0
+	for row := range word {
+		for col := range word[row] {
+			if word[row][col] > 1 || letter[row][col] > 1 {
+				numPremiums++
+			}
+		}
+	}
+	if len(board.ActivePremiums()) != numPremiums {
+		t.Errorf("All premiums should be active on an empty board")
+	}
+	// Playing on the center square consumes its premium
+	game := NewOtcwlGame("standard")
+	game.ForceRack(1, "")
+	game.ForceRack(0, "cat")
+	move, err := game.ParseMove("H7 cat")
+	if err != nil || !game.Apply(move) {
+		t.Errorf("Unable to make tile move: %v", err)
+		return
+	}
+	if !game.Board.PremiumUsed(7, 7) || game.Board.PremiumUsed(7, 6) || game.Board.PremiumUsed(0, 0) {
+		t.Errorf("Incorrect premium usage")
+	}
+	active := game.Board.ActivePremiums()
+	if len(active) != numPremiums-1 || slices.Contains(active, Coordinate{7, 7}) {
+		t.Errorf("The center square should no longer be an active premium")
+	}
+	mini := NewBoard("mini")
+	if word, _ := mini.Multipliers(); len(word) != mini.Size {
+		t.Errorf("Incorrect multiplier grid size for the mini board")
+	}
+}
+
+func TestRackStats(t *testing.T) {
+	stats := OtcwlDictionary.RackStats("retains")
+	if stats.Bingos != 9 || stats.Words != 274 || stats.Longest != "anestri" {
+		t.Errorf("Incorrect rack statistics: %+v", stats)
+	}
+	if !slices.Equal(stats.ByLength, []int{0, 0, 20, 56, 80, 77, 32, 9}) {
+		t.Errorf("Incorrect word counts by length: %v", stats.ByLength)
+	}
+	// The statistics should agree with Permute()
+	if words := OtcwlDictionary.Permute("satire?", 2); len(words) != OtcwlDictionary.RackStats("satire?").Words {
+		t.Errorf("Word count differs from Permute()")
+	}
+	if stats := OtcwlDictionary.RackStats("qzxjkvw"); stats.Words != 0 || stats.Longest != "" {
+		t.Errorf("Expected no words: %+v", stats)
+	}
+	// A bag containing one S, one Q and one Z: only the S
+	// turns RETAIN into a bingo
+	makeBag := func(letters string) *Bag {
+		bag := &Bag{}
+		for _, letter := range letters {
+			bag.Contents = append(bag.Contents, &Tile{Letter: letter, Meaning: letter})
+		}
+		return bag
+	}
+	if p := OtcwlDictionary.BingoProbability("retain", makeBag("sqz"), 1); p < 0.333 || p > 0.334 {
+		t.Errorf("Incorrect bingo probability: %v", p)
+	}
+	// Of the six possible draws of two tiles, only N and S
+	// make a bingo (RETAINS and its anagrams)
+	if p := OtcwlDictionary.BingoProbability("retai", makeBag("nsqz"), 2); p < 1.0/6-1e-9 || p > 1.0/6+1e-9 {
+		t.Errorf("Incorrect bingo probability: %v", p)
+	}
+	if p := OtcwlDictionary.BingoProbability("satire?", makeBag(""), 1); p != 1.0 {
+		t.Errorf("Incorrect bingo probability for a full rack: %v", p)
+	}
+	// A large draw is sampled
+	game := NewOtcwlGame("standard")
+	p := OtcwlDictionary.BingoProbability("", game.Bag, RackSize)
+	if p <= 0.0 || p >= 0.5 {
+		t.Errorf("Implausible bingo probability: %v", p)
+	}
+	// The sampling uses a source derived from that of the bag,
+	// so that seeding the bag makes the estimate reproducible,
+	// without affecting the tiles subsequently drawn from the bag
+	seeded := func() *Bag {
+		game := NewOtcwlGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(1234)})
+		return game.Bag
+	}
+	draws := func(bag *Bag) string {
+		var sb strings.Builder
+		for bag.TileCount() > 0 {
+			sb.WriteRune(bag.DrawTile().Letter)
+		}
+		return sb.String()
+	}
+	bag := seeded()
+	first := OtcwlDictionary.BingoProbability("", bag, RackSize)
+	if second := OtcwlDictionary.BingoProbability("", seeded(), RackSize); first != second {
+		t.Errorf("Bingo probability estimates with the same seed differ: %v vs. %v", first, second)
+	}
+	if draws(bag) != draws(seeded()) {
+		t.Errorf("Estimating the bingo probability should not affect the draws from the bag")
+	}
+}
+
+func TestSimRobotPlayout(t *testing.T) {
+	game := NewOtcwlGame("standard")
+	robot := NewHighScoreRobot()
+	// Play until the pre-endgame
+	for !game.IsOver() && game.Bag.TileCount() > 10 {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	if game.IsOver() {
+		return
+	}
+	// A clone is independent of the original
+	clone := game.Clone()
+	board, scores, bagCount := game.Board.String(), game.Scores, game.Bag.TileCount()
+	clone.ApplyValid(robot.GenerateMove(clone.State()))
+	if game.Board.String() != board || game.Scores != scores || game.Bag.TileCount() != bagCount {
+		t.Errorf("Moving in a clone should not affect the original game")
+	}
+	if !clone.UndoLastMove() || clone.Board.String() != board || clone.Scores != scores ||
+		clone.Bag.TileCount() != bagCount {
+		t.Errorf("Unable to undo a move in a clone")
+	}
+	// Robots with the same random source pick the same move
+	state := game.State()
+	moves := state.GenerateMoves()
+	if len(moves) < 2 {
+		return
+	}
+	for _, sim := range []func() *RobotWrapper{
+		func() *RobotWrapper {
+			return NewSimulationRobotWithSource(3, 2, rand.NewSource(1729))
+		},
+		func() *RobotWrapper {
+			return &RobotWrapper{Robot: &SimRobot{
+				TopK: 3, Rollouts: 2, Playout: 2, rng: rand.New(rand.NewSource(1729)),
+			}}
+		},
+	} {
+		pick := func() Move {
+			return sim().PickMove(state, slices.Clone(moves))
+		}
+		first := pick()
+		if second := pick(); first != second {
+			t.Errorf("Simulation is not deterministic: %v vs. %v", first, second)
+		}
+		sort.Sort(byScore{state, moves})
+		if !slices.Contains(moves[:3], first) {
+			t.Errorf("Picked move %v is not among the candidates", first)
+		}
+	}
+	// The simulation does not disturb the game
+	if game.Board.String() != board || game.Bag.TileCount() != bagCount {
+		t.Errorf("Simulation should not affect the game")
+	}
+}
+
+func TestGameClone(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	robot := NewHighScoreRobot()
+	for i := 0; i < 6 && !game.IsOver(); i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	// A snapshot of the game state, including the order of the bag
+	snapshot := func(game *Game) string {
+		var sb strings.Builder
+		sb.WriteString(game.String())
+		for _, tile := range game.Bag.Contents {
+			sb.WriteRune(tile.Letter)
+		}
+		return sb.String()
+	}
+	original := snapshot(game)
+	clone := game.Clone()
+	if clone.Dawg != game.Dawg || clone.TileSet != game.TileSet {
+		t.Errorf("The clone should share the Dawg and the TileSet")
+	}
+	// All tiles in the clone should belong to its own bag
+	owned := make(map[*Tile]bool)
+	for i := range clone.Bag.Tiles {
+		owned[&clone.Bag.Tiles[i]] = true
+	}
+	for _, tile := range clone.Bag.Contents {
+		if !owned[tile] {
+			t.Errorf("Bag tile not owned by the clone")
+		}
+	}
+	for row := 0; row < clone.Board.Size; row++ {
+		for col := 0; col < clone.Board.Size; col++ {
+			if tile := clone.Board.TileAt(row, col); tile != nil && !owned[tile] {
+				t.Errorf("Board tile at %v,%v not owned by the clone", row, col)
+			}
+			if adj := clone.Board.Adjacents[row][col][RIGHT]; adj != nil && adj != clone.Board.Sq(row, col+1) {
+				t.Errorf("Adjacent square not within the clone's board")
+			}
+		}
+	}
+	for player := 0; player < 2; player++ {
+		for _, sq := range clone.Racks[player].Slots {
+			if sq.Tile != nil && !owned[sq.Tile] {
+				t.Errorf("Rack tile not owned by the clone")
+			}
+		}
+	}
+	// The clone is identical to the original, including the bag order
+	if snapshot(clone) != original {
+		t.Errorf("The clone should be identical to the original")
+	}
+	// Moves in the clone do not affect the original
+	for i := 0; i < 4 && !clone.IsOver(); i++ {
+		clone.ApplyValid(robot.GenerateMove(clone.State()))
+	}
+	if snapshot(game) != original || len(game.MoveList) != 6 {
+		t.Errorf("Moving in the clone should not affect the original")
+	}
+	// Cloning a seeded game does not change the original's draws.
+	// A clone draws independently of the original, but clones made
+	// at the same point draw the same tiles, and CloneWithSameDraws()
+	// gives a clone that draws the same tiles as the original.
+	draws := func(game *Game) string {
+		var sb strings.Builder
+		for game.Bag.TileCount() > 0 {
+			sb.WriteRune(game.Bag.DrawTile().Letter)
+		}
+		return sb.String()
+	}
+	seeded := func() *Game {
+		game := NewIcelandicGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(42)})
+		for i := 0; i < 4 && !game.IsOver(); i++ {
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		return game
+	}
+	uncloned := draws(seeded())
+	game = seeded()
+	clone = game.Clone()
+	same := game.CloneWithSameDraws()
+	cloned := draws(clone)
+	if d := draws(game); d != uncloned {
+		t.Errorf("Cloning should not change the original's draws: %v vs. %v", d, uncloned)
+	}
+	if cloned == uncloned {
+		t.Errorf("The clone should draw independently of the original")
+	}
+	if d := draws(seeded().Clone()); d != cloned {
+		t.Errorf("Clones of a seeded game should draw the same tiles: %v vs. %v", d, cloned)
+	}
+	if d := draws(same); d != uncloned {
+		t.Errorf("CloneWithSameDraws() should draw the same tiles as the original: %v vs. %v", d, uncloned)
+	}
+}
+
+func TestBlankMeanings(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	game.ValidateWords = false
+	rack := &game.Racks[0]
+	rack.ReturnToBag(game.Bag)
+	if ok := rack.FillByLetters(game.Bag, []rune("?aðinrs")); !ok {
+		t.Errorf("Unable to fill rack with the requested letters")
+		return
+	}
+	board := &game.Board
+	play := func(meaning rune) bool {
+		return game.Apply(NewUncheckedTileMove(board,
+			Covers{
+				{7, 7}: Cover{'?', meaning},
+				{7, 8}: Cover{'a', 'a'},
+			},
+		))
+	}
+	// An emoji and a Latin 'q' are not in the Icelandic alphabet
+	if play('😀') {
+		t.Errorf("Accepted a blank tile meaning an emoji")
+	}
+	if play('q') {
+		t.Errorf("Accepted a blank tile meaning 'q' in an Icelandic game")
+	}
+	// A non-blank letter must be in the tile set
+	if game.Apply(NewUncheckedTileMove(board, Covers{{7, 7}: Cover{'q', 'q'}, {7, 8}: Cover{'a', 'a'}})) {
+		t.Errorf("Accepted a 'q' tile in an Icelandic game")
+	}
+	// A non-blank tile can only mean its own letter
+	mismatch := NewUncheckedTileMove(board, Covers{{7, 7}: Cover{'a', 'r'}, {7, 8}: Cover{'s', 's'}})
+	if err := game.ValidateMove(mismatch); err == nil || err.Code != InvalidLetter ||
+		!strings.Contains(err.Message, "'r' is not a valid meaning of the tile 'a'") {
+		t.Errorf("Expected InvalidLetter for an 'a' tile meaning 'r', got %v", err)
+	}
+	if game.Apply(mismatch) {
+		t.Errorf("Accepted an 'a' tile meaning 'r'")
+	}
+	// The same applies to Game.PlayTile
+	blank := rack.FindTile('?')
+	blank.Meaning = '😀'
+	if game.PlayTile(blank, 7, 7) {
+		t.Errorf("PlayTile accepted a blank tile meaning an emoji")
+	}
+	if !rack.HasTile(blank) {
+		t.Errorf("A rejected tile should remain in the rack")
+	}
+	blank.Meaning = '?'
+	if !play('þ') || game.TilesOnBoard() != 2 {
+		t.Errorf("Rejected a blank tile meaning 'þ'")
+	}
+	// The HTTP handler rejects blanks whose meaning is not in the tile set
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".......Qa......"
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, MovesRequest{
+		Locale:    "is_IS",
+		BoardType: "standard",
+		Board:     rows,
+		Rack:      "aeinrst",
+	})
+	if w.Code != 400 {
+		t.Errorf("Board with a blank meaning 'q' should be rejected, got %v", w.Code)
+	}
+}
+
+func TestScoreBreakdown(t *testing.T) {
+	check := func(state *GameState) int {
+		count := 0
+		for _, move := range state.GenerateMoves() {
+			tileMove, ok := move.(*TileMove)
+			if !ok {
+				continue
+			}
+			breakdown := tileMove.ScoreBreakdown(state)
+			sum := breakdown.MainWord.Score + breakdown.BingoBonus
+			for _, crossWord := range breakdown.CrossWords {
+				sum += crossWord.Score
+				if strings.ContainsRune(crossWord.Word, '?') || !state.Dawg.Find(crossWord.Word) {
+					t.Errorf("Invalid cross-word %v in move %v", crossWord.Word, tileMove)
+				}
+			}
+			score := tileMove.Score(state)
+			if breakdown.Total != score || sum != score {
+				t.Errorf("Breakdown of %v sums to %v (total %v), but the score is %v",
+					tileMove, sum, breakdown.Total, score)
+			}
+			if strings.ContainsRune(breakdown.MainWord.Word, '?') {
+				t.Errorf("Blank not rendered in main word %v", breakdown.MainWord.Word)
+			}
+			count++
+		}
+		return count
+	}
+	count := check(benchmarkState())
+	// Also check the moves of a few positions in a robot game
+	game := NewIcelandicGame("standard")
+	robot := NewHighScoreRobot()
+	for i := 0; i < 10 && !game.IsOver(); i++ {
+		count += check(game.State())
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	if count < 300 {
+		t.Errorf("Expected to check at least 300 moves, checked %v", count)
+	}
+	// The breakdown is included in the /moves response on request
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, MovesRequest{
+		Locale:    "en_US",
+		BoardType: "standard",
+		Board:     rows,
+		Rack:      "aeinrst",
+		Limit:     20,
+		Detail:    true,
+	})
+	var result struct {
+		Count int `json:"count"`
+		Moves []struct {
+			Score  int            `json:"sc"`
+			Detail ScoreBreakdown `json:"detail"`
+		} `json:"moves"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to decode moves response: %v", err)
+		return
+	}
+	if len(result.Moves) != 20 || result.Count < 20 {
+		t.Errorf("Expected 20 of %v moves, got %v", result.Count, len(result.Moves))
+	}
+	for _, move := range result.Moves {
+		if move.Detail.Total != move.Score || move.Detail.MainWord.Word == "" {
+			t.Errorf("Unexpected score breakdown: %+v", move)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	draws := func(seed int64) string {
+		game := NewIcelandicGame("standard")
+		game.Seed(seed)
+		var sb strings.Builder
+		sb.WriteString(game.Racks[0].AsString())
+		sb.WriteString(game.Racks[1].AsString())
+		for tile := game.Bag.DrawTile(); tile != nil; tile = game.Bag.DrawTile() {
+			sb.WriteRune(tile.Letter)
+		}
+		return sb.String()
+	}
+	first := draws(42)
+	if len([]rune(first)) != NewIcelandicTileSet.Size {
+		t.Errorf("Expected to draw the entire tile set, got %v", first)
+	}
+	if second := draws(42); second != first {
+		t.Errorf("Games with the same seed should have identical draws:\n%v\n%v", first, second)
+	}
+	if draws(43) == first {
+		t.Errorf("Games with different seeds should have different draws")
+	}
+}
+
+func TestWordCheckRequest(t *testing.T) {
+	request := func(req WordCheckRequest) map[string]interface{} {
+		w := httptest.NewRecorder()
+		HandleWordCheckRequest(w, req)
+		var result map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Errorf("Unable to decode wordcheck response: %v", err)
+		}
+		return result
+	}
+	toStrings := func(v interface{}) []string {
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		result := make([]string, len(list))
+		for i, s := range list {
+			result[i] = s.(string)
+		}
+		return result
+	}
+	// By default, there are no anagrams or hooks in the response
+	result := request(WordCheckRequest{Locale: "en_US", Word: "rat", Words: []string{"rat"}})
+	if result["ok"] != true {
+		t.Errorf("Expected 'rat' to be valid: %v", result)
+	}
+	if _, ok := result["anagrams"]; ok {
+		t.Errorf("Anagrams should not be included by default")
+	}
+	if _, ok := result["hooks"]; ok {
+		t.Errorf("Hooks should not be included by default")
+	}
+	result = request(WordCheckRequest{
+		Locale:          "en_US",
+		Words:           []string{"rat"},
+		IncludeAnagrams: true,
+	})
+	if anagrams := toStrings(result["anagrams"]); !slices.Equal(anagrams, []string{"art", "tar"}) {
+		t.Errorf("Unexpected anagrams of 'rat': %v", anagrams)
+	}
+	if _, ok := result["hooks"]; ok {
+		t.Errorf("Hooks should only be included on request")
+	}
+	result = request(WordCheckRequest{
+		Locale:       "en_US",
+		Word:         "rat",
+		Words:        []string{"rat"},
+		IncludeHooks: true,
+	})
+	hooks := toStrings(result["hooks"])
+	if !slices.Contains(hooks, "brat") || !slices.Contains(hooks, "rats") || slices.Contains(hooks, "rat") {
+		t.Errorf("Unexpected hooks of 'rat': %v", hooks)
+	}
+	// An invalid word has no anagrams or hooks
+	result = request(WordCheckRequest{
+		Locale:          "en_US",
+		Word:            "tra",
+		Words:           []string{"tra"},
+		IncludeAnagrams: true,
+		IncludeHooks:    true,
+	})
+	if len(toStrings(result["anagrams"])) != 0 || len(toStrings(result["hooks"])) != 0 {
+		t.Errorf("An invalid word should have no anagrams or hooks: %v", result)
+	}
+}
+
+func TestLocaleRegistry(t *testing.T) {
+	// The dictionaries and tile sets of all supported locale strings
+	type expected struct {
+		dawg         *Dawg
+		tileSet      *TileSet
+		exploTileSet *TileSet
+	}
+	otcwl := expected{OtcwlDictionary, EnglishTileSet, NewEnglishTileSet}
+	sowpods := expected{SowpodsDictionary, EnglishTileSet, NewEnglishTileSet}
+	icelandic := expected{IcelandicDictionary, NewIcelandicTileSet, NewIcelandicTileSet}
+	polish := expected{OspsDictionary, PolishTileSet, PolishTileSet}
+	bokmål := expected{NorwegianBokmålDictionary, NorwegianTileSet, NorwegianTileSet}
+	nynorsk := expected{NorwegianNynorskDictionary, NorwegianTileSet, NorwegianTileSet}
+	cases := map[string]expected{
+		"":      otcwl,
+		"en_US": otcwl,
+		"en-US": otcwl,
+		"en":    sowpods,
+		"en_GB": sowpods,
+		"en-AU": sowpods,
+		"is":    icelandic,
+		"is_IS": icelandic,
+		"is-IS": icelandic,
+		"pl":    polish,
+		"pl_PL": polish,
+		"nb":    bokmål,
+		"nb_NO": bokmål,
+		"no":    bokmål,
+		"no-NO": bokmål,
+		"nn":    nynorsk,
+		"nn_NO": nynorsk,
+		"de":    otcwl,
+		"fr_FR": otcwl,
+		"isl":   otcwl,
+	}
+	for locale, exp := range cases {
+		for _, boardType := range []string{"standard", "explo"} {
+			dawg, tileSet := decodeLocale(locale, boardType)
+			expTileSet := exp.tileSet
+			if boardType == "explo" {
+				expTileSet = exp.exploTileSet
+			}
+			if dawg != exp.dawg || tileSet != expTileSet {
+				t.Errorf("Locale '%v' with board type %v resolves incorrectly", locale, boardType)
+			}
+			game := NewGameForLocale(locale, boardType)
+			if game == nil || game.Dawg != exp.dawg || game.TileSet != expTileSet {
+				t.Errorf("Game for locale '%v' with board type %v is incorrect", locale, boardType)
+			}
+		}
+	}
+	// Register a new locale with an alias and a separate Explo tile set
+	err := Locales.Register("de", LocaleConfig{
+		Dawg:         SowpodsDictionary,
+		TileSet:      EnglishTileSet,
+		ExploTileSet: NewEnglishTileSet,
+		Aliases:      []string{"deu"},
+	})
+	if err != nil {
+		t.Fatalf("Unable to register locale: %v", err)
+	}
+	defer Locales.Register("de", LocaleConfig{Aliases: []string{"deu"}})
+	for _, locale := range []string{"de", "de_AT", "deu"} {
+		if dawg, tileSet := decodeLocale(locale, "standard"); dawg != SowpodsDictionary || tileSet != EnglishTileSet {
+			t.Errorf("Registered locale '%v' resolves incorrectly", locale)
+		}
+		if _, tileSet := decodeLocale(locale, "explo"); tileSet != NewEnglishTileSet {
+			t.Errorf("Registered locale '%v' has an incorrect Explo tile set", locale)
+		}
+	}
+	if config, ok := Locales.Lookup("fr"); ok || config.Dawg != nil {
+		t.Errorf("Lookup of an unregistered locale should fail")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	cases := []struct {
+		dawg        *Dawg
+		word        string
+		front, back string
+	}{
+		{OtcwlDictionary, "rat", "bdfgp", "ehos"},
+		{OtcwlDictionary, "xyzzy", "", ""},
+		{IcelandicDictionary, "ást", "dfhlmns", "au"},
+		{IcelandicDictionary, "kona", "í", "nr"},
+		{IcelandicDictionary, "A\u0301ST", "dfhlmns", "au"},
+	}
+	before := [2]CacheStats{OtcwlDictionary.crossCache.Stats(), IcelandicDictionary.crossCache.Stats()}
+	for _, c := range cases {
+		front := c.dawg.FrontHooks(c.word)
+		back := c.dawg.BackHooks(c.word)
+		if string(front) != c.front {
+			t.Errorf("Front hooks of '%v' are '%v', expected '%v'", c.word, string(front), c.front)
+		}
+		if string(back) != c.back {
+			t.Errorf("Back hooks of '%v' are '%v', expected '%v'", c.word, string(back), c.back)
+		}
+		// All hooks form valid words
+		for _, r := range front {
+			if !c.dawg.Find(string(r) + c.word) {
+				t.Errorf("Invalid front hook '%c' for '%v'", r, c.word)
+			}
+		}
+		for _, r := range back {
+			if !c.dawg.Find(c.word + string(r)) {
+				t.Errorf("Invalid back hook '%c' for '%v'", r, c.word)
+			}
+		}
+	}
+	// The hooks are not stored in the cross-check caches
+	after := [2]CacheStats{OtcwlDictionary.crossCache.Stats(), IcelandicDictionary.crossCache.Stats()}
+	if after != before {
+		t.Errorf("Hook lookups should not use the cross-check caches: %+v, %+v", before, after)
+	}
+}
+
+func TestAnagrams(t *testing.T) {
+	for _, c := range []struct {
+		dawg *Dawg
+		rack string
+	}{
+		{OtcwlDictionary, "aeinrst"},
+		{OtcwlDictionary, "retain?"},
+		{IcelandicDictionary, "ásaumað"},
+		{IcelandicDictionary, "kona??"},
+	} {
+		for length := 2; length <= len([]rune(c.rack)); length++ {
+			anagrams := c.dawg.Anagrams(c.rack, length)
+			// The anagrams are the permutations of the given length
+			expected := make([]string, 0)
+			for _, word := range c.dawg.Permute(c.rack, length) {
+				if len([]rune(word)) == length {
+					expected = append(expected, word)
+				}
+			}
+			if !slices.Equal(anagrams, expected) {
+				t.Errorf("Anagrams of length %v of '%v' differ from permutations", length, c.rack)
+			}
+			for _, word := range anagrams {
+				if len([]rune(word)) != length || !c.dawg.Find(word) {
+					t.Errorf("Invalid anagram '%v' of length %v of '%v'", word, length, c.rack)
+				}
+			}
+		}
+	}
+	bingos := OtcwlDictionary.Anagrams("aeinrst", 7)
+	if !slices.Contains(bingos, "retains") || !slices.Contains(bingos, "stainer") {
+		t.Errorf("Expected bingos of 'aeinrst', got %v", bingos)
+	}
+	if len(OtcwlDictionary.Anagrams("aeinrst", 8)) != 0 {
+		t.Errorf("There should be no anagrams longer than the rack")
+	}
+}
+
+func TestGenerateMovesStream(t *testing.T) {
+	state := benchmarkState()
+	moveStrings := func(moves []Move) []string {
+		result := make([]string, len(moves))
+		for i, move := range moves {
+			result[i] = move.(*TileMove).String()
+		}
+		sort.Strings(result)
+		return result
+	}
+	expected := moveStrings(state.GenerateMoves())
+	// Draining the stream yields the same multiset of moves
+	for i := 0; i < 3; i++ {
+		moves := make([]Move, 0)
+		for move := range state.GenerateMovesStream(context.Background()) {
+			moves = append(moves, move)
+		}
+		if !slices.Equal(moveStrings(moves), expected) {
+			t.Errorf("Moves from the stream differ from GenerateMoves()")
+		}
+	}
+	// The stream is closed when the context is cancelled,
+	// even if nobody reads from it in the meantime
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := state.GenerateMovesStream(ctx)
+	first := <-stream
+	if first == nil {
+		t.Errorf("Expected at least one move in the stream")
+	}
+	cancel()
+	count := 1
+	for range stream {
+		count++
+	}
+	if count > len(expected) {
+		t.Errorf("Cancelled stream returned too many moves")
+	}
+}
+
+func TestMatchStar(t *testing.T) {
+	dawg := OtcwlDictionary
+	// union returns the sorted union of the matches of the pattern,
+	// with '*' replaced by 0..maxLen '?' wildcards
+	union := func(pattern string, maxLen int) []string {
+		result := make([]string, 0)
+		for n := 0; n <= maxLen; n++ {
+			result = append(result, dawg.Match(strings.Replace(pattern, "*", strings.Repeat("?", n), 1))...)
+		}
+		sort.Strings(result)
+		return result
+	}
+	sorted := func(words []string) []string {
+		words = slices.Clone(words)
+		sort.Strings(words)
+		return words
+	}
+	// Prefix
+	prefix := dawg.Match("str*")
+	if !slices.Contains(prefix, "string") {
+		t.Errorf("Expected 'string' among words starting with 'str'")
+	}
+	if !slices.Equal(sorted(prefix), union("str*", BoardSize)) {
+		t.Errorf("Prefix match 'str*' is incorrect")
+	}
+	// Suffix
+	if suffix := dawg.Match("*ing"); !slices.Equal(sorted(suffix), union("*ing", BoardSize)) {
+		t.Errorf("Suffix match '*ing' is incorrect")
+	}
+	// Interior, combined with single letter wildcards
+	interior := dawg.Match("q?*z")
+	if !slices.Equal(sorted(interior), union("q?*z", BoardSize)) || len(interior) == 0 {
+		t.Errorf("Interior match 'q?*z' is incorrect: %v", interior)
+	}
+	// Several stars
+	for _, word := range dawg.Match("*x*y*") {
+		if ix := strings.IndexRune(word, 'x'); ix < 0 || !strings.ContainsRune(word[ix+1:], 'y') {
+			t.Errorf("Word '%v' does not match '*x*y*'", word)
+		}
+	}
+	// A wildcard budget
+	if len(dawg.MatchWithLimit("c??t", 1)) != 0 {
+		t.Errorf("Two wildcards should not fit in a budget of one")
+	}
+	if !slices.Equal(dawg.MatchWithLimit("c??t", 2), dawg.Match("c??t")) {
+		t.Errorf("Wildcard budget should not affect matches within it")
+	}
+	if limited := dawg.MatchWithLimit("*ing", 2); !slices.Equal(sorted(limited), union("*ing", 2)) {
+		t.Errorf("Limited suffix match '*ing' is incorrect: %v", limited)
+	}
+	if !slices.Equal(dawg.MatchWithLimit("cat", 0), []string{"cat"}) {
+		t.Errorf("A pattern without wildcards should match itself")
+	}
+}
+
+func TestBoardFromStrings(t *testing.T) {
+	// Play a few moves, including blanks if the robot uses them
+	game := NewIcelandicGame("standard")
+	game.Seed(7)
+	robot := NewHighScoreRobot()
+	for i := 0; i < 12 && !game.IsOver(); i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	rows := game.Board.ToStrings()
+	board := NewBoard("standard")
+	if err := board.FromStrings(rows, game.TileSet); err != nil {
+		t.Errorf("Unable to import board: %v", err)
+		return
+	}
+	if board.NumTiles != game.Board.NumTiles || !slices.Equal(board.ToStrings(), rows) {
+		t.Errorf("Board not reproduced by FromStrings(ToStrings())")
+	}
+	for row := 0; row < board.Size; row++ {
+		for col := 0; col < board.Size; col++ {
+			orig, tile := game.Board.TileAt(row, col), board.TileAt(row, col)
+			if (orig == nil) != (tile == nil) {
+				t.Errorf("Tile mismatch at %v,%v", row, col)
+			} else if tile != nil && (tile.Letter != orig.Letter ||
+				tile.Meaning != orig.Meaning || tile.Score != orig.Score) {
+				t.Errorf("Tile mismatch at %v,%v: %v vs %v", row, col, tile, orig)
+			}
+		}
+	}
+	// Blank tiles are uppercase, and empty squares can be spaces
+	rows = make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(" ", BoardSize)
+	}
+	rows[7] = "......hÉr......"
+	if err := board.FromStrings(rows, NewIcelandicTileSet); err != nil || board.NumTiles != 3 {
+		t.Errorf("Unable to import board with a blank tile: %v", err)
+	}
+	if tile := board.TileAt(7, 7); tile == nil || tile.Letter != '?' || tile.Meaning != 'é' || tile.Score != 0 {
+		t.Errorf("Blank tile not imported correctly: %v", tile)
+	}
+	// Invalid boards leave the board empty
+	for _, invalid := range [][]string{
+		rows[0:14],
+		append(slices.Clone(rows[0:14]), "......hér"),
+		append(slices.Clone(rows[0:14]), ".......q......."),
+		append(slices.Clone(rows[0:14]), ".......Q......."),
+	} {
+		if err := board.FromStrings(invalid, NewIcelandicTileSet); err == nil || board.NumTiles != 0 {
+			t.Errorf("Invalid board accepted: %v", invalid)
+		}
+	}
+}
+
+// slowDefinitionProvider counts its calls and their concurrency,
+// and takes a given time to return each definition
+type slowDefinitionProvider struct {
+	MapDefinitionProvider
+	delay        time.Duration
+	mux          sync.Mutex
+	calls        map[string]int
+	active, peak int
+}
+
+func (p *slowDefinitionProvider) Lookup(locale, word string) (string, bool) {
+	p.mux.Lock()
+	p.calls[word]++
+	p.active++
+	p.peak = max(p.peak, p.active)
+	p.mux.Unlock()
+	time.Sleep(p.delay)
+	p.mux.Lock()
+	p.active--
+	p.mux.Unlock()
+	return p.MapDefinitionProvider.Lookup(locale, word)
+}
+
+func TestWordCheckDefinitions(t *testing.T) {
+	defs := MapDefinitionProvider{
+		"en_US": {"cat": "a small feline", "at": "in the position of", "tack": "a short nail"},
+	}
+	request := func(req WordCheckRequest) (result struct {
+		Ok    bool              `json:"ok"`
+		Valid []json.RawMessage `json:"valid"`
+	}) {
+		w := httptest.NewRecorder()
+		HandleWordCheckRequest(w, req)
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Errorf("Unable to decode wordcheck response: %v", err)
+		}
+		return
+	}
+	// The checked words, with their definitions
+	checked := func(valid []json.RawMessage) []WordCheckResult {
+		results := make([]WordCheckResult, len(valid))
+		for i, raw := range valid {
+			if err := json.Unmarshal(raw, &results[i]); err != nil {
+				t.Fatalf("Unable to decode checked word %s: %v", raw, err)
+			}
+		}
+		return results
+	}
+	def := func(s string) *string { return &s }
+	RegisterDefinitionProvider(defs)
+	defer RegisterDefinitionProvider(nil)
+	words := []string{"cat", "at", "cat", "xqz", "tacks"}
+	// Without the flag, the words are checked as [word, valid] pairs
+	if result := request(WordCheckRequest{Locale: "en_US", Words: words}); len(result.Valid) != len(words) ||
+		string(result.Valid[0]) != `["cat",true]` {
+		t.Errorf("Definitions should only be included on request: %s", result.Valid)
+	}
+	// With it, each valid word carries its definition, if any
+	result := request(WordCheckRequest{Locale: "en_US", Words: words, Definitions: true})
+	expected := []WordCheckResult{
+		{"cat", true, def("a small feline")},
+		{"at", true, def("in the position of")},
+		{"cat", true, def("a small feline")},
+		{"xqz", false, nil},
+		{"tacks", true, def("")},
+	}
+	results := checked(result.Valid)
+	if result.Ok || len(results) != len(expected) {
+		t.Fatalf("Unexpected definitions: %+v", results)
+	}
+	for i, r := range results {
+		e := expected[i]
+		if r.Word != e.Word || r.Valid != e.Valid || (r.Def == nil) != (e.Def == nil) ||
+			(r.Def != nil && *r.Def != *e.Def) {
+			t.Errorf("Unexpected checked word %+v, expected %+v", r, e)
+		}
+	}
+	if !strings.Contains(string(result.Valid[4]), `"def":""`) || strings.Contains(string(result.Valid[3]), "def") {
+		t.Errorf("Only valid words should carry a definition: %s", result.Valid)
+	}
+	// The provider is called once per word, with bounded concurrency
+	words = []string{"cat", "at", "tack", "tacks", "act", "acts", "cast", "scat", "cat", "at"}
+	slow := &slowDefinitionProvider{
+		MapDefinitionProvider: defs,
+		delay:                 10 * time.Millisecond,
+		calls:                 make(map[string]int),
+	}
+	RegisterDefinitionProvider(slow)
+	result = request(WordCheckRequest{Locale: "en_US", Words: words, Definitions: true})
+	if results := checked(result.Valid); !result.Ok || len(results) != len(words) || *results[2].Def != "a short nail" {
+		t.Errorf("Unexpected definitions: %+v", result)
+	}
+	for word, calls := range slow.calls {
+		if calls != 1 {
+			t.Errorf("Definition of '%v' looked up %v times", word, calls)
+		}
+	}
+	if slow.peak > MaxDefinitionWorkers {
+		t.Errorf("Too many concurrent lookups: %v", slow.peak)
+	}
+	// A slow provider does not stall the request
+	slow.delay = time.Second
+	defer func(timeout time.Duration) { DefinitionTimeout = timeout }(DefinitionTimeout)
+	DefinitionTimeout = 50 * time.Millisecond
+	start := time.Now()
+	result = request(WordCheckRequest{Locale: "en_US", Words: []string{"cat"}, Definitions: true})
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Slow definition provider stalled the request")
+	}
+	if results := checked(result.Valid); len(results) != 1 || results[0].Def == nil || *results[0].Def != "" {
+		t.Errorf("Timed out definitions should be empty: %s", result.Valid)
+	}
+}
+
+func TestCrossCheckLetters(t *testing.T) {
+	state := benchmarkState()
+	hints := state.CrossCheckLetters()
+	for row := 0; row < BoardSize; row++ {
+		for col := 0; col < BoardSize; col++ {
+			hint := hints[row][col]
+			if hint.Row != row || hint.Col != col {
+				t.Errorf("Hint at %v,%v has coordinates %v,%v", row, col, hint.Row, hint.Col)
+			}
+			if state.Board.TileAt(row, col) != nil &&
+				(hint.IsAnchor || hint.HorizontalAllowed != "" || hint.VerticalAllowed != "") {
+				t.Errorf("Occupied square %v,%v should allow no letters", row, col)
+			}
+		}
+	}
+	// Every letter placed by a generated move must be allowed on its
+	// square, in the direction of the move. (The converse does not hold,
+	// since the cross-checks don't constrain the main word of the move.)
+	for _, move := range state.GenerateMoves() {
+		tileMove, ok := move.(*TileMove)
+		if !ok {
+			continue
+		}
+		coversAnchor := false
+		for coord, cover := range tileMove.Covers {
+			hint := hints[coord.Row][coord.Col]
+			coversAnchor = coversAnchor || hint.IsAnchor
+			allowed := hint.VerticalAllowed
+			if tileMove.Horizontal {
+				allowed = hint.HorizontalAllowed
+			}
+			if len(tileMove.Covers) == 1 {
+				// A single tile can be read in either direction
+				allowed = hint.HorizontalAllowed + hint.VerticalAllowed
+			}
+			if !strings.ContainsRune(allowed, cover.Meaning) {
+				t.Errorf("Move %v places '%c' at %v,%v, which allows only '%v'",
+					tileMove, cover.Meaning, coord.Row, coord.Col, allowed)
+			}
+		}
+		if !coversAnchor {
+			t.Errorf("Move %v covers no anchor square", tileMove)
+		}
+	}
+	// On an empty board, the center square is the only anchor
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	w := httptest.NewRecorder()
+	HandleHintsRequest(w, MovesRequest{
+		Locale:    "en_US",
+		BoardType: "standard",
+		Board:     rows,
+		Rack:      "tsaenri",
+	})
+	var result HintsHeaderJson
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to decode hints response: %v", err)
+		return
+	}
+	expected := HintSquare{Row: 7, Col: 7, HorizontalAllowed: "aeinrst", VerticalAllowed: "aeinrst", IsAnchor: true}
+	if result.Count != 1 || result.Hints[0] != expected {
+		t.Errorf("Unexpected hints response: %+v", result)
+	}
+}
+
+func TestGameOptions(t *testing.T) {
+	play := func(seed int64) (string, string) {
+		options := GameOptions{RandSource: rand.NewSource(seed)}
+		game := NewSowpodsGameWithOptions("standard", options)
+		bag := game.Racks[0].AsString() + game.Racks[1].AsString() + game.Bag.String()
+		robotA := NewOneOfNBestRobotWithSource(5, rand.NewSource(seed+1))
+		robotB := NewOneOfNBestRobotWithSource(5, rand.NewSource(seed+2))
+		var sb strings.Builder
+		for i := 0; !game.IsOver(); i++ {
+			robot := robotA
+			if i%2 == 1 {
+				robot = robotB
+			}
+			move := robot.GenerateMove(game.State())
+			if !game.ApplyValid(move) {
+				t.Errorf("Robot generated an invalid move %v", move)
+				break
+			}
+			fmt.Fprintf(&sb, "%v ", move)
+			sb.WriteString(game.MoveList[len(game.MoveList)-1].Drawn)
+			sb.WriteRune('\n')
+		}
+		fmt.Fprintf(&sb, "%v:%v", game.Scores[0], game.Scores[1])
+		return bag, sb.String()
+	}
+	bag1, transcript1 := play(17)
+	bag2, transcript2 := play(17)
+	if bag1 != bag2 {
+		t.Errorf("Games with the same seed should have identical bags:\n%v\n%v", bag1, bag2)
+	}
+	if transcript1 != transcript2 {
+		t.Errorf("Games with the same seed should be identical:\n%v\n\n%v", transcript1, transcript2)
+	}
+	if bag3, _ := play(18); bag3 == bag1 {
+		t.Errorf("Games with different seeds should have different bags")
+	}
+}
+
+func TestClock(t *testing.T) {
+	// A game without a clock ignores turn timing
+	game := NewSowpodsGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(3)})
+	game.StartTurn()
+	game.EndTurn()
+	if game.Clock != nil || game.Clock.OvertimePenalty(0) != 0 {
+		t.Errorf("A game without a clock should have no penalties")
+	}
+	untimed := game.Clone()
+	// Time the same game with a mock time source
+	current := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := game.SetClock(ClockOvertimePenalty{Limit: time.Minute, PointsPerMinute: 10})
+	clock.Now = func() time.Time { return current }
+	turns := []time.Duration{50, 20, 50, 20, 50, 30}
+	for i, seconds := range turns {
+		game.StartTurn()
+		current = current.Add(seconds * time.Second)
+		if i < len(turns)-1 {
+			game.EndTurn()
+		}
+		// The last turn ends automatically when the game is over
+		game.ApplyValid(NewPassMove())
+		untimed.ApplyValid(NewPassMove())
+	}
+	if !game.IsOver() || clock.Elapsed != [2]time.Duration{150 * time.Second, 70 * time.Second} {
+		t.Errorf("Unexpected elapsed time: %v", clock.Elapsed)
+	}
+	// Player 0 is 90 seconds over the limit, player 1 is 10 seconds over
+	if game.Scores[0] != untimed.Scores[0]-20 || game.Scores[1] != untimed.Scores[1]-10 {
+		t.Errorf("Expected penalties of 20 and 10 points, got scores %v vs. %v",
+			game.Scores, untimed.Scores)
+	}
+	// The penalties survive serialization
+	data, err := game.Serialize()
+	if err != nil {
+		t.Errorf("Unable to serialize game: %v", err)
+		return
+	}
+	restored, err := DeserializeGame(data)
+	if err != nil || restored.Scores != game.Scores {
+		t.Errorf("Unexpected deserialized scores: %v (%v)", restored, err)
+	}
+	// Undoing the last move also undoes the penalties
+	game.UndoLastMove()
+	untimed.UndoLastMove()
+	if game.Scores != untimed.Scores {
+		t.Errorf("Undo should remove the penalties, got scores %v vs. %v",
+			game.Scores, untimed.Scores)
+	}
+}
+
+func TestBoardLayouts(t *testing.T) {
+	for boardType, layout := range boardLayouts {
+		size := layout.size
+		if size > MaxBoardSize || len(layout.wordMultipliers) != size ||
+			len(layout.letterMultipliers) != size {
+			t.Errorf("Layout of %v board has inconsistent size", boardType)
+			continue
+		}
+		for i, multipliers := range [][]string{layout.wordMultipliers, layout.letterMultipliers} {
+			for row := 0; row < size; row++ {
+				if len(multipliers[row]) != size {
+					t.Errorf("Row %v of %v board layout %v has length %v",
+						row, boardType, i, len(multipliers[row]))
+					continue
+				}
+				for col := 0; col < size; col++ {
+					// The layouts are symmetric around both diagonals
+					if multipliers[row][col] != multipliers[col][row] ||
+						multipliers[row][col] != multipliers[size-1-col][size-1-row] {
+						t.Errorf("Layout %v of %v board is not symmetric at %v,%v",
+							i, boardType, row, col)
+					}
+				}
+			}
+		}
+	}
+	// Moves can be requested on a super board
+	rows := make([]string, MaxBoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", MaxBoardSize)
+	}
+	rows[10] = "........hestur......."
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, MovesRequest{
+		Locale:    "is_IS",
+		BoardType: "super",
+		Board:     rows,
+		Rack:      "aeinrst",
+		Limit:     10,
+	})
+	var result HeaderJson
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil || result.Count == 0 {
+		t.Errorf("Unexpected response on super board: %v (%v)", result, err)
+	}
+}
+
+func TestBalancedRobot(t *testing.T) {
+	// TilesUsed reports blanks, explicit or not, as '?'
+	board := NewBoard("standard")
+	rack := NewRack([]rune("ca??tle"), EnglishTileSet)
+	move := NewUncheckedTileMove(board, Covers{
+		Coordinate{7, 7}: Cover{'c', 'c'},
+		Coordinate{7, 8}: Cover{'?', 'a'},
+		Coordinate{7, 9}: Cover{'b', 'b'},
+	})
+	used := move.TilesUsed(rack)
+	slices.Sort(used)
+	if string(used) != "??c" {
+		t.Errorf("Unexpected tiles used: %v", string(used))
+	}
+	// Balanced leaves are preferred to unbalanced ones
+	evaluator := EnglishLeaveEvaluator
+	if evaluator.Evaluate([]rune("aeio")) >= evaluator.Evaluate([]rune("aeil")) {
+		t.Errorf("A vowel-heavy leave should be penalized")
+	}
+	if evaluator.Evaluate([]rune("rr")) >= evaluator.Evaluate([]rune("rd")) {
+		t.Errorf("Duplicate tiles should be penalized")
+	}
+	for locale, expected := range map[string]*StaticLeaveEvaluator{
+		"is":    IcelandicLeaveEvaluator,
+		"is_IS": IcelandicLeaveEvaluator,
+		"is-IS": IcelandicLeaveEvaluator,
+		"en_GB": EnglishLeaveEvaluator,
+		"xx":    EnglishLeaveEvaluator,
+	} {
+		if LeaveEvaluatorForLocale(locale) != expected {
+			t.Errorf("Unexpected leave evaluator for locale %v", locale)
+		}
+	}
+	if testing.Short() {
+		return
+	}
+	// Over a number of seeded games, with each robot starting every
+	// other game, the BalancedRobot beats the HighScoreRobot
+	const numGames = 100
+	wins, losses, spread := 0, 0, 0
+	for seed := int64(0); seed < numGames; seed++ {
+		game := NewSowpodsGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(seed)})
+		balanced := NewBalancedRobot(EnglishLeaveEvaluator, 1.0)
+		highScore := NewHighScoreRobot()
+		first := int(seed % 2)
+		for i := 0; !game.IsOver(); i++ {
+			robot := highScore
+			if i%2 == first {
+				robot = balanced
+			}
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		margin := game.Scores[first] - game.Scores[1-first]
+		spread += margin
+		if margin > 0 {
+			wins++
+		} else if margin < 0 {
+			losses++
+		}
+	}
+	if wins <= losses || spread <= 0 {
+		t.Errorf("BalancedRobot won %v and lost %v games, with a total spread of %v",
+			wins, losses, spread)
+	}
+}
+
+func TestInvalidWords(t *testing.T) {
+	game := NewOtcwlGame("standard")
+	board := &game.Board
+	board.PlaceTile(7, 7, &Tile{Letter: 'a', Meaning: 'a', Score: 1})
+	board.PlaceTile(7, 8, &Tile{Letter: 't', Meaning: 't', Score: 1})
+	makeMove := func(first, second rune) *TileMove {
+		move := NewUncheckedTileMove(board, Covers{
+			Coordinate{8, 8}: Cover{first, first},
+			Coordinate{8, 9}: Cover{second, second},
+		})
+		move.ValidateWords = true
+		return move
+	}
+	// 'of' is fine, and so is 'to' across it
+	if invalid := makeMove('o', 'f').InvalidWords(board, game.Dawg); len(invalid) != 0 {
+		t.Errorf("Expected no invalid words, got %v", invalid)
+	}
+	// 'xi' is fine, but 'tx' across it is not
+	move := makeMove('x', 'i')
+	if invalid := move.InvalidWords(board, game.Dawg); !slices.Equal(invalid, []string{"tx"}) {
+		t.Errorf("Expected 'tx' to be invalid, got %v", invalid)
+	}
+	if move.IsValid(game) {
+		t.Errorf("Move with an invalid cross word should not be valid")
+	}
+	// Both the main word and the cross word can be invalid
+	if invalid := makeMove('x', 'x').InvalidWords(board, game.Dawg); !slices.Equal(invalid, []string{"xx", "tx"}) {
+		t.Errorf("Expected 'xx' and 'tx' to be invalid, got %v", invalid)
+	}
+}
+
+func TestDawgIteration(t *testing.T) {
+	dawg := OtcwlDictionary
+	words := make(map[string]bool)
+	dawg.Iterate(func(word string) bool {
+		if words[word] || !dawg.Find(word) {
+			t.Errorf("Iterated word '%v' is a duplicate or not found", word)
+		}
+		words[word] = true
+		return true
+	})
+	count := dawg.WordCount()
+	if count != len(words) || dawg.WordCount() != count {
+		t.Errorf("Word count %v does not match %v iterated words", count, len(words))
+	}
+	// Every permutation of a rack is among the iterated words
+	for _, rack := range []string{"aeinrst", "quizzes", "??xyz"} {
+		permutations := dawg.Permute(rack, 2)
+		if count < len(permutations) {
+			t.Errorf("Word count %v is lower than the %v permutations of '%v'",
+				count, len(permutations), rack)
+		}
+		for _, word := range permutations {
+			if !words[word] {
+				t.Errorf("Permutation '%v' of '%v' was not iterated", word, rack)
+			}
+		}
+	}
+	// The iteration stops when the callback returns false
+	visited := 0
+	dawg.Iterate(func(word string) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Errorf("Iteration should stop after 10 words, visited %v", visited)
+	}
+	// Words with a prefix, with and without a limit
+	expected := make([]string, 0)
+	for word := range words {
+		if strings.HasPrefix(word, "quiz") {
+			expected = append(expected, word)
+		}
+	}
+	slices.Sort(expected)
+	prefixed := dawg.WordsWithPrefix("quiz", 0)
+	slices.Sort(prefixed)
+	if !slices.Equal(prefixed, expected) || !slices.Contains(prefixed, "quiz") {
+		t.Errorf("Unexpected words with prefix 'quiz': %v", prefixed)
+	}
+	if limited := dawg.WordsWithPrefix("quiz", 3); len(limited) != 3 {
+		t.Errorf("Expected 3 words with prefix 'quiz', got %v", limited)
+	}
+	if none := dawg.WordsWithPrefix("qxz", 0); len(none) != 0 {
+		t.Errorf("Expected no words with prefix 'qxz', got %v", none)
+	}
+	// Multi-letter edge prefixes with finality markers are handled
+	// in the Icelandic dictionary as well
+	for _, word := range IcelandicDictionary.WordsWithPrefix("hest", 50) {
+		if !strings.HasPrefix(word, "hest") || !IcelandicDictionary.Find(word) {
+			t.Errorf("Unexpected word with prefix 'hest': %v", word)
+		}
+	}
+}
+
+func TestChallengeLastMove(t *testing.T) {
+	playFirst := func(rack, move string, penalty int) *Game {
+		game := NewIcelandicGame("standard")
+		game.SetChallengeMode(DoubleChallenge)
+		game.ChallengePenalty = penalty
+		game.ForceRack(1, "")
+		if !game.ForceRack(0, rack) || !game.Racks[1].Fill(game.Bag) {
+			t.Errorf("Unable to force racks")
+			return nil
+		}
+		if _, err := game.ChallengeLastMove(1); err == nil {
+			t.Errorf("There should be nothing to challenge before the first move")
+		}
+		m, err := game.ParseMove(move)
+		if err != nil || !game.Apply(m) {
+			t.Errorf("Unable to play %v: %v", move, err)
+			return nil
+		}
+		return game
+	}
+	replay := func(game *Game) {
+		data, err := game.Serialize()
+		if err != nil {
+			t.Errorf("Unable to serialize game: %v", err)
+			return
+		}
+		replayed, err := ReplayGame(data)
+		// The bags may be in a different order, but the moves are the same
+		moves := func(g *Game) string {
+			_, list, _ := strings.Cut(g.String(), "Moves:")
+			return list
+		}
+		if err != nil || replayed.Scores != game.Scores || moves(replayed) != moves(game) {
+			t.Errorf("Replayed game differs from the original: %v", err)
+		}
+	}
+	// A phony with a blank tile is taken back
+	game := playFirst("pr?faðu", "8F paðf?óru", 0)
+	if game == nil {
+		return
+	}
+	if _, err := game.ChallengeLastMove(0); err == nil {
+		t.Errorf("A player should not be able to challenge its own move")
+	}
+	result, err := game.ChallengeLastMove(1)
+	if err != nil || !result.Upheld || !slices.Equal(result.InvalidWords, []string{"paðfóru"}) {
+		t.Errorf("Unexpected challenge result: %+v (%v)", result, err)
+	}
+	if game.TilesOnBoard() != 0 || game.Scores != [2]int{0, 0} ||
+		game.Racks[0].AsString() != game.MoveList[0].RackBefore || game.PlayerToMove() != 1 {
+		t.Errorf("Phony not properly taken back")
+	}
+	if _, ok := game.MoveList[0].Move.(*VoidMove); !ok || !strings.Contains(game.String(), "Void 8F paðf?óru") {
+		t.Errorf("Phony should be recorded as a VoidMove:\n%v", game)
+	}
+	if _, err := game.ChallengeLastMove(1); err == nil {
+		t.Errorf("A VoidMove should not be challengeable")
+	}
+	replay(game)
+	var buf bytes.Buffer
+	if err := game.WriteGCG(&buf); err != nil {
+		t.Errorf("Unable to write GCG: %v", err)
+	} else if loaded, err := LoadGCG(&buf, "is"); err != nil || len(loaded.MoveList) != 1 {
+		t.Errorf("Unable to load GCG with a withdrawn phony: %v", err)
+	} else if _, ok := loaded.MoveList[0].Move.(*VoidMove); !ok {
+		t.Errorf("Withdrawn phony should be loaded as a VoidMove")
+	}
+	// An unsuccessful challenge costs the challenger points
+	game = playFirst("prófaðu", "8F prófaðu", 10)
+	if game == nil {
+		return
+	}
+	score := game.Scores[0]
+	result, err = game.ChallengeLastMove(1)
+	if err != nil || result.Upheld || len(result.InvalidWords) != 0 || result.Penalty != 10 {
+		t.Errorf("Unexpected challenge result: %+v (%v)", result, err)
+	}
+	if game.Scores != [2]int{score, -10} || game.PlayerToMove() != 1 || game.TilesOnBoard() != 7 {
+		t.Errorf("Challenger should lose 10 points but keep the turn: %v", game.Scores)
+	}
+	if _, err := game.ChallengeLastMove(1); err == nil {
+		t.Errorf("A move should only be challenged once")
+	}
+	if !strings.Contains(game.String(), "(challenged)") {
+		t.Errorf("The challenge should be shown in the move list:\n%v", game)
+	}
+	replay(game)
+	if !game.UndoLastMove() || game.Scores != [2]int{0, 0} {
+		t.Errorf("Undo should restore the challenger's points: %v", game.Scores)
+	}
+}
+
+func TestCrossWordCoordinates(t *testing.T) {
+	// The cross word of a cover off the diagonal must be looked
+	// up at (row, col), not (col, row), where there is nothing
+	game := NewOtcwlGame("standard")
+	board := &game.Board
+	for i, letter := range "cat" {
+		board.PlaceTile(7, 7+i, &Tile{Letter: letter, Meaning: letter, Score: 1})
+	}
+	game.ForceRack(0, "xi")
+	move := NewUncheckedTileMove(board, Covers{
+		Coordinate{8, 9}:  Cover{'x', 'x'},
+		Coordinate{8, 10}: Cover{'i', 'i'},
+	})
+	move.ValidateWords = true
+	if move.IsValid(game) {
+		t.Errorf("Move forming the invalid cross word 'tx' should be rejected")
+	}
+	if invalid := move.InvalidWords(board, game.Dawg); !slices.Equal(invalid, []string{"tx"}) {
+		t.Errorf("Expected 'tx' to be invalid, got %v", invalid)
+	}
+	if left, right := board.CrossWords(9, 8, false); len(left) != 0 || len(right) != 0 {
+		t.Errorf("There should be no cross word at the transposed coordinate")
+	}
+}
+
+func TestRackSize(t *testing.T) {
+	runTest := func(locale string, seed int64) {
+		options := GameOptions{RandSource: rand.NewSource(seed), RackSize: 8}
+		game := NewGameForLocaleWithOptions(locale, "standard", options)
+		if game.RackSize != 8 || game.Racks[0].Size() != 8 || len(game.Racks[1].AsRunes()) != 8 {
+			t.Errorf("Expected racks of 8 tiles, got %v", game.Racks[1].AsString())
+			return
+		}
+		robot := NewHighScoreRobot()
+		bingos := 0
+		for !game.IsOver() {
+			state := game.State()
+			if state.RackSize() != 8 || len(state.Rack.AsRunes()) > 8 {
+				t.Errorf("Invalid rack in state: %v", state.Rack.AsString())
+				return
+			}
+			move := robot.GenerateMove(state)
+			if !move.IsValid(game) {
+				t.Errorf("Robot generated an invalid move %v", move)
+				return
+			}
+			if tileMove, ok := move.(*TileMove); ok {
+				// The bingo bonus is only awarded for playing all 8 tiles
+				bonus := tileMove.ScoreBreakdown(state).BingoBonus
+				if (bonus == BingoBonus) != (len(tileMove.Covers) == 8) {
+					t.Errorf("Incorrect bingo bonus %v for %v", bonus, move)
+				}
+				if bonus > 0 {
+					bingos++
+				}
+			}
+			game.ApplyValid(move)
+		}
+		if len(game.MoveList) < 10 {
+			t.Errorf("Game ended prematurely after %v moves", len(game.MoveList))
+		}
+		// The rack size must survive serialization
+		data, err := game.Serialize()
+		if err != nil {
+			t.Errorf("Unable to serialize game: %v", err)
+			return
+		}
+		restored, err := DeserializeGame(data)
+		if err != nil || restored.RackSize != 8 || restored.Racks[0].Size() != 8 {
+			t.Errorf("Rack size not restored: %v", err)
+			return
+		}
+		replayed, err := ReplayGame(data)
+		if err != nil {
+			t.Errorf("Unable to replay game: %v", err)
+			return
+		}
+		if replayed.Scores != game.Scores {
+			t.Errorf("Replayed scores %v differ from %v", replayed.Scores, game.Scores)
+		}
+		t.Logf("Locale %v: %v moves, %v bingos, scores %v", locale, len(game.MoveList), bingos, game.Scores)
+	}
+	for _, locale := range []string{"en_US", "is_IS", "pl_PL"} {
+		runTest(locale, 11)
+	}
+	// A standard game still uses racks of 7 tiles
+	game := NewOtcwlGame("standard")
+	if game.RackSize != RackSize || game.Racks[0].Size() != RackSize {
+		t.Errorf("Expected the default rack size")
+	}
+	// A rack of 8 tiles is only accepted by the server
+	// if the request specifies the rack size
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	req := MovesRequest{
+		Locale:    "en_US",
+		BoardType: "standard",
+		Board:     rows,
+		Rack:      "aeilnrst",
+		Limit:     5,
+	}
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, req)
+	if w.Code != 400 {
+		t.Errorf("A rack of 8 tiles should be rejected by default, got %v", w.Code)
+	}
+	req.RackSize = 8
+	w = httptest.NewRecorder()
+	HandleMovesRequest(w, req)
+	var result struct {
+		Count int `json:"count"`
+		Moves []struct {
+			Score int `json:"sc"`
+		} `json:"moves"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to decode moves response: %v", err)
+		return
+	}
+	// The best move plays all 8 tiles and earns the bingo bonus
+	if result.Count == 0 || result.Moves[0].Score <= BingoBonus {
+		t.Errorf("Expected a bingo with a rack of 8 tiles: %+v", result)
+	}
+}
+
+func TestAnalyzeRequest(t *testing.T) {
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	analyze := func(coordinate, word string) AnalyzeHeaderJson {
+		w := httptest.NewRecorder()
+		HandleAnalyzeRequest(w, AnalyzeRequest{
+			MovesRequest: MovesRequest{
+				Locale:    "en_US",
+				BoardType: "standard",
+				Board:     rows,
+				Rack:      "aeinrst",
+			},
+			Coordinate: coordinate,
+			Word:       word,
+		})
+		var result AnalyzeHeaderJson
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Errorf("Unable to decode analyze response: %v", err)
+		}
+		return result
+	}
+	// The best move, a bingo
+	result := analyze("5E", "retsina")
+	if !result.Valid || result.Score != 84 || result.Rank != 1 || result.Count == 0 {
+		t.Errorf("Unexpected analysis of the best move: %+v", result)
+	}
+	if len(result.Words) != 2 || result.Words[0] != (AnalyzedWord{"retsina", true}) ||
+		result.Words[1] != (AnalyzedWord{"scat", true}) {
+		t.Errorf("Unexpected words: %+v", result.Words)
+	}
+	// A move through the 't' on the board, outscored by three others
+	result = analyze("8H", "tertians")
+	if !result.Valid || result.Score != 77 || result.Rank != 4 {
+		t.Errorf("Unexpected analysis of a high-ranking move: %+v", result)
+	}
+	// A move forming invalid cross words
+	result = analyze("I2", "retains")
+	if result.Valid || result.Rank != 0 || result.Score != 68 {
+		t.Errorf("Move forming invalid cross words should be invalid: %+v", result)
+	}
+	invalid := make([]string, 0)
+	for _, word := range result.Words {
+		if !word.Valid {
+			invalid = append(invalid, word.Word)
+		}
+	}
+	if len(result.Words) != 4 || !slices.Equal(invalid, []string{"ci", "ts"}) {
+		t.Errorf("Unexpected words: %+v", result.Words)
+	}
+	// Moves that cannot be parsed
+	for _, move := range [][2]string{{"I6", "xq"}, {"H4", "retains"}, {"Z9", "at"}} {
+		if result = analyze(move[0], move[1]); result.Valid || result.Error == "" {
+			t.Errorf("Move %v should be rejected: %+v", move, result)
+		}
+	}
+}
+
+func TestAnagramRequest(t *testing.T) {
+	anagram := func(req AnagramRequest) (int, AnagramHeaderJson) {
+		w := httptest.NewRecorder()
+		HandleAnagramRequest(w, req)
+		var result AnagramHeaderJson
+		if w.Code == 200 {
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Unable to decode anagram response: %v", err)
+			}
+		}
+		return w.Code, result
+	}
+	// Permutations of a rack, grouped by length, longest first
+	var req AnagramRequest
+	raw := `{"locale": "en_US", "rack": "aeinrst", "min_length": 6, "limit": 1000}`
+	if err := json.Unmarshal([]byte(raw), &req); err != nil || req.MinLength != 6 {
+		t.Fatalf("Unable to decode request: %v %+v", err, req)
+	}
+	code, result := anagram(req)
+	if code != 200 || result.Truncated || len(result.Groups) != 2 {
+		t.Errorf("Unexpected anagram response: %v %+v", code, result)
+		return
+	}
+	count := 0
+	for i, group := range result.Groups {
+		if group.Length != 7-i {
+			t.Errorf("Unexpected group length %v", group.Length)
+		}
+		for _, word := range group.Words {
+			if len([]rune(word.Word)) != group.Length || !OtcwlDictionary.Find(word.Word) {
+				t.Errorf("Unexpected word %v in group %v", word.Word, group.Length)
+			}
+		}
+		count += len(group.Words)
+	}
+	if count != result.Count || !slices.Contains(result.Groups[0].Words, AnagramWord{"retains", 7}) {
+		t.Errorf("Expected 'retains' among %v words", result.Count)
+	}
+	// The limit truncates the results, keeping the longest words
+	code, result = anagram(AnagramRequest{Locale: "en_US", Rack: "aeinrst", Limit: 5})
+	if code != 200 || !result.Truncated || result.Count != 5 ||
+		len(result.Groups) != 1 || result.Groups[0].Length != 7 {
+		t.Errorf("Unexpected truncated response: %v %+v", code, result)
+	}
+	// Pattern matching, with scores from the tile set
+	code, result = anagram(AnagramRequest{Locale: "en_US", Pattern: "op???nal"})
+	if code != 200 || result.Count != 1 ||
+		result.Groups[0].Words[0] != (AnagramWord{"optional", 10}) {
+		t.Errorf("Unexpected pattern response: %v %+v", code, result)
+	}
+	// Invalid requests
+	for _, req := range []AnagramRequest{
+		{Locale: "en_US"},
+		{Locale: "en_US", Rack: "aeinrstl"},
+		{Locale: "en_US", Rack: "ae1"},
+		{Locale: "is_IS", Rack: "cqw"},
+		{Locale: "en_US", Pattern: "op#"},
+	} {
+		if code, _ := anagram(req); code != 400 {
+			t.Errorf("Request %+v should be rejected, got %v", req, code)
+		}
+	}
+}
+
+func TestMoveCache(t *testing.T) {
+	cache := NewMoveCache(8)
+	state := benchmarkState()
+	expected := state.GenerateMovesCached(nil)
+	moves := state.GenerateMovesCached(cache)
+	if len(moves) != len(expected) || moves[0].Score(state) != expected[0].Score(state) {
+		t.Errorf("Cached move generation differs from uncached")
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Hits != 0 || stats.Size != 1 {
+		t.Errorf("Expected a cache miss, got %+v", stats)
+	}
+	// An equivalent state, with its own board and a
+	// rack in a different order, hits the cache
+	other := benchmarkState()
+	other.Rack = NewRack([]rune("?srniea"), other.TileSet)
+	cached := other.GenerateMovesCached(cache)
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected a cache hit, got %+v", stats)
+	}
+	if len(cached) != len(moves) || cached[0] != moves[0] {
+		t.Errorf("Expected the cached move list")
+	}
+	// A different rack misses the cache
+	other.Rack = NewRack([]rune("?srniee"), other.TileSet)
+	other.GenerateMovesCached(cache)
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Expected a cache miss for a different rack, got %+v", stats)
+	}
+	// A different meaning of a blank tile on the board misses the cache
+	other = benchmarkState()
+	other.Board.TileAt(1, 1).Letter = '?'
+	first := other.signature()
+	other.Board.TileAt(1, 1).Meaning = 'a'
+	if other.signature() == first || other.signature() == state.signature() {
+		t.Errorf("Blank tiles and their meanings should affect the signature")
+	}
+	// So does the locale
+	other = benchmarkState()
+	other.Dawg = OtcwlDictionary
+	if other.signature() == state.signature() {
+		t.Errorf("The dictionary should affect the signature")
+	}
+}
+
+func BenchmarkGenerateMovesCached(b *testing.B) {
+	cache := NewMoveCache(16)
+	state := benchmarkState()
+	for i := 0; i < b.N; i++ {
+		state.GenerateMovesCached(cache)
+	}
+}
+
+func TestGenStats(t *testing.T) {
+	state := benchmarkState()
+	if moves := state.GenerateMovesWithStats(nil); len(moves) != len(state.GenerateMoves()) {
+		t.Errorf("Generating moves without stats should work as usual")
+	}
+	var stats GenStats
+	moves := state.GenerateMovesWithStats(&stats)
+	if stats.MovesGenerated != len(moves) || stats.NodesVisited == 0 ||
+		stats.AnchorsProcessed == 0 || stats.Duration <= 0 ||
+		stats.CrossCacheHits+stats.CrossCacheMisses == 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	// On an empty board, the start square is the only anchor
+	rack := NewRack([]rune("aeinrst"), EnglishTileSet)
+	empty := NewState(OtcwlDictionary, EnglishTileSet, NewBoard("standard"), rack, false)
+	empty.GenerateMovesWithStats(&stats)
+	if stats.AnchorsProcessed != 1 || stats.CrossCacheHits+stats.CrossCacheMisses != 0 {
+		t.Errorf("Unexpected stats for an empty board: %+v", stats)
+	}
+	// The stats are only included in a /moves response on request
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	for _, withStats := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, MovesRequest{
+			Locale:    "en_US",
+			BoardType: "standard",
+			Board:     rows,
+			Rack:      "aeinrst",
+			Limit:     5,
+			Stats:     withStats,
+		})
+		var result struct {
+			Stats *GenStats `json:"stats"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Errorf("Unable to decode moves response: %v", err)
+			return
+		}
+		if (result.Stats != nil) != withStats {
+			t.Errorf("Unexpected stats in response: %+v", result.Stats)
+		} else if withStats && (result.Stats.MovesGenerated == 0 || result.Stats.NodesVisited == 0) {
+			t.Errorf("Unexpected stats in response: %+v", *result.Stats)
+		}
+	}
+}
+
+func BenchmarkGenerateMovesWithStats(b *testing.B) {
+	// Compare with BenchmarkGenerateMoves, which does not collect stats
+	state := benchmarkState()
+	var stats GenStats
+	for i := 0; i < b.N; i++ {
+		state.GenerateMovesWithStats(&stats)
+	}
+}
+
+func TestUnseenTiles(t *testing.T) {
+	game := NewIcelandicGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(5)})
+	robot := NewHighScoreRobot()
+	for i := 0; i < 8 && !game.IsOver(); i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	for player := 0; player < 2; player++ {
+		unseen := game.UnseenTiles(player)
+		// The unseen tiles are exactly those in the bag
+		// and in the opponent's rack
+		expected := make(map[rune]int)
+		for _, tile := range game.Bag.Contents {
+			expected[tile.Letter]++
+		}
+		for _, letter := range game.Racks[1-player].AsRunes() {
+			expected[letter]++
+		}
+		if !maps.Equal(unseen, expected) {
+			t.Errorf("Unseen tiles for player %v differ from the bag and rack", player)
+		}
+		total := 0
+		for _, count := range unseen {
+			total += count
+		}
+		opp := len(game.Racks[1-player].AsRunes())
+		if total != game.Bag.TileCount()+opp ||
+			total != game.TileSet.Size-game.Board.NumTiles-len(game.Racks[player].AsRunes()) {
+			t.Errorf("Unexpected number of unseen tiles: %v", total)
+		}
+	}
+}
+
+func TestDuplicateGame(t *testing.T) {
+	for _, playBest := range []bool{false, true} {
+		game := NewDuplicateGame("is_IS", "standard", GameOptions{RandSource: rand.NewSource(11)})
+		game.PlayBestMove = playBest
+		game.SetPlayerNames("HighScore", "OneOfNBest")
+		robots := [2]*RobotWrapper{
+			NewHighScoreRobot(),
+			NewOneOfNBestRobotWithSource(10, rand.NewSource(7)),
+		}
+		for !game.IsOver() {
+			if len(game.Rounds) > 100 {
+				t.Fatalf("Duplicate game does not finish")
+			}
+			for player, robot := range robots {
+				if err := game.Submit(player, robot.GenerateMove(game.State())); err != nil {
+					t.Fatalf("Robot move rejected: %v", err)
+				}
+			}
+		}
+		if game.Bag.TileCount() != 0 {
+			t.Errorf("Duplicate game over with %v tiles in the bag", game.Bag.TileCount())
+		}
+		var totals [2]int
+		boardTotal := 0
+		for _, round := range game.Rounds {
+			totals[0] += round.Scores[0]
+			totals[1] += round.Scores[1]
+			boardTotal += round.PlayedScore
+			// The board advances with the top-scoring move, and the
+			// high-score robot always finds the engine's best move
+			if round.PlayedScore != round.Scores[0] || round.Scores[1] > round.Scores[0] {
+				t.Errorf("Unexpected round scores: %v, played %v", round.Scores, round.PlayedScore)
+			}
+		}
+		if totals != game.Scores || boardTotal != game.Scores[0] {
+			t.Errorf("Cumulative scores %v do not add up: %v", game.Scores, totals)
+		}
+		if game.Scores[1] <= 0 || game.Scores[1] > game.Scores[0] {
+			t.Errorf("Unexpected duplicate scores: %v", game.Scores)
+		}
+		if game.Submit(0, NewPassMove()) == nil {
+			t.Errorf("Submission accepted after the game is over")
+		}
+		if !strings.Contains(game.String(), "Rounds:") {
+			t.Errorf("Duplicate game string lacks the rounds")
+		}
+	}
+	// Moves using tiles that are not in the rack are rejected,
+	// as are moves submitted twice by the same player
+	game := NewDuplicateGame("en_US", "standard", GameOptions{RandSource: rand.NewSource(3)})
+	move := game.moves[0].(*TileMove)
+	if err := game.Submit(0, move); err != nil {
+		t.Errorf("Best move rejected: %v", err)
+	}
+	if game.Submit(0, move) == nil {
+		t.Errorf("Second submission accepted")
+	}
+	letter := 'a'
+	for slices.Contains(game.Rack.AsRunes(), letter) {
+		letter++
+	}
+	bogus := &TileMove{Covers: Covers{Coordinate{7, 7}: Cover{letter, letter}}}
+	if game.Submit(1, bogus) == nil {
+		t.Errorf("Move with tiles not in the rack accepted")
+	}
+}
+
+func TestBoardDiff(t *testing.T) {
+	game := NewGameForLocaleWithOptions("en_US", "standard", GameOptions{RandSource: rand.NewSource(17)})
+	robot := NewHighScoreRobot()
+	// Accumulate the changes of each move into a grid of runes
+	grid := make([][]rune, game.Board.Size)
+	for row := range grid {
+		grid[row] = []rune(strings.Repeat(".", game.Board.Size))
+	}
+	prev := game.Clone()
+	for !game.IsOver() {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+		changes, err := prev.Board.Diff(&game.Board)
+		if err != nil {
+			t.Fatalf("Unable to diff boards: %v", err)
+		}
+		last := game.LastMoveChanges()
+		if _, ok := game.MoveList[game.lastMoveIndex()].Move.(*TileMove); ok &&
+			!slices.Equal(changes, last) {
+			t.Errorf("Board diff %v differs from last move changes %v", changes, last)
+		}
+		for _, change := range changes {
+			if grid[change.Row][change.Col] != change.Before {
+				t.Errorf("Change %v does not match the previous board", change)
+			}
+			grid[change.Row][change.Col] = change.After
+		}
+		prev = game.Clone()
+	}
+	rows := game.Board.ToStrings()
+	for row := range grid {
+		if string(grid[row]) != rows[row] {
+			t.Errorf("Accumulated row %v is %v, expected %v", row, string(grid[row]), rows[row])
+		}
+	}
+	// Blank tiles compare by meaning, not by letter
+	var a, b Board
+	a.Init("standard")
+	b.Init("standard")
+	a.PlaceTile(7, 7, &Tile{Letter: '?', Meaning: 'x'})
+	b.PlaceTile(7, 7, &Tile{Letter: '?', Meaning: 'y'})
+	changes, err := a.Diff(&b)
+	if err != nil || len(changes) != 1 || changes[0] != (SquareChange{7, 7, 'X', 'Y'}) {
+		t.Errorf("Unexpected diff of blank tiles: %v, %v", changes, err)
+	}
+	// The compact JSON form round-trips
+	j, _ := json.Marshal(changes)
+	if string(j) != `[{"r":7,"c":7,"b":"X","a":"Y"}]` {
+		t.Errorf("Unexpected JSON for square changes: %v", string(j))
+	}
+	var decoded []SquareChange
+	if err := json.Unmarshal(j, &decoded); err != nil || !slices.Equal(decoded, changes) {
+		t.Errorf("Square changes do not round-trip: %v, %v", decoded, err)
+	}
+	// Boards of different types cannot be compared
+	b.Init("explo")
+	if _, err := a.Diff(&b); err == nil {
+		t.Errorf("Boards of different types compared without error")
+	}
+	if game := NewGameForLocale("en_US", "standard"); game.LastMoveChanges() != nil {
+		t.Errorf("Changes reported for a game without moves")
+	}
+}
+
+func TestScoringRules(t *testing.T) {
+	rules := &ScoringRules{BingoBonus: 40, FinalRackDoubling: false}
+	// The bingo bonus is read from the rules of the game
+	bingo := func(rules *ScoringRules) int {
+		game := NewGameForLocaleWithOptions("en_US", "standard", GameOptions{Rules: rules})
+		game.ForceRack(0, "aeinrst")
+		move, err := game.ParseMove("8H retains")
+		if err != nil {
+			t.Fatalf("Unable to parse bingo move: %v", err)
+		}
+		return move.Score(game.State())
+	}
+	if diff := bingo(nil) - bingo(rules); diff != BingoBonus-40 {
+		t.Errorf("Bingo bonus differs by %v between rulesets", diff)
+	}
+	// Play games to completion under each ruleset, checking the final moves
+	for _, r := range []*ScoringRules{nil, rules} {
+		game := NewGameForLocaleWithOptions("en_US", "standard",
+			GameOptions{RandSource: rand.NewSource(23), Rules: r})
+		robot := NewHighScoreRobot()
+		for !game.IsOver() {
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		if game.OverReason() != RackEmpty {
+			t.Fatalf("Game did not end with an empty rack")
+		}
+		// The last two items are the final moves of the
+		// opponent and of the finishing player, respectively
+		n := len(game.MoveList)
+		final := game.MoveList[n-1].Move.(*FinalMove)
+		rackOpp := 0
+		for _, letter := range final.OpponentRack {
+			rackOpp += game.TileSet.Scores[letter]
+		}
+		expected := 2 * rackOpp
+		if r != nil {
+			expected = rackOpp
+		}
+		if game.MoveList[n-1].Score != expected {
+			t.Errorf("Final score of finishing player is %v, expected %v",
+				game.MoveList[n-1].Score, expected)
+		}
+		var totals [2]int
+		for i, item := range game.MoveList {
+			totals[i%2] += item.Score
+		}
+		if totals != game.Scores {
+			t.Errorf("End scores %v differ from the move scores %v", game.Scores, totals)
+		}
+		// The rules survive serialization
+		data, err := game.Serialize()
+		if err != nil {
+			t.Fatalf("Unable to serialize game: %v", err)
+		}
+		restored, err := ReplayGame(data)
+		if err != nil {
+			t.Fatalf("Unable to replay game: %v", err)
+		}
+		if !reflect.DeepEqual(restored.Rules, r) || restored.Scores != game.Scores {
+			t.Errorf("Scoring rules not restored: %v", restored.Rules)
+		}
+	}
+}
+
+func TestMovesResponseTiles(t *testing.T) {
+	// The board has a blank tile meaning 'c' on it
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....Cat......."
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, MovesRequest{
+		Locale:    "en_US",
+		BoardType: "standard",
+		Board:     rows,
+		Rack:      "aeinrs?",
+		Limit:     200,
+	})
+	var result struct {
+		Version string `json:"version"`
+		Moves   []struct {
+			Coordinate string `json:"co"`
+			Word       string `json:"w"`
+			Score      int    `json:"sc"`
+			Tiles      string `json:"tiles"`
+			Covers     []struct {
+				Row     int    `json:"row"`
+				Col     int    `json:"col"`
+				Letter  string `json:"letter"`
+				Meaning string `json:"meaning"`
+			} `json:"covers"`
+		} `json:"moves"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Unable to decode moves response: %v", err)
+	}
+	if result.Version != "1.3" || len(result.Moves) != 200 {
+		t.Errorf("Unexpected moves response: version %v, %v moves",
+			result.Version, len(result.Moves))
+	}
+	blanks := 0
+	for _, move := range result.Moves {
+		if move.Coordinate == "" || move.Word == "" || len(move.Covers) == 0 {
+			t.Errorf("Tile move fields missing: %+v", move)
+			continue
+		}
+		var tiles strings.Builder
+		rack := []rune("aeinrs?")
+		for i, cover := range move.Covers {
+			if i > 0 {
+				prev := move.Covers[i-1]
+				if cover.Row < prev.Row || (cover.Row == prev.Row && cover.Col <= prev.Col) {
+					t.Errorf("Covers of %v are not in board order", move.Word)
+				}
+			}
+			if rows[cover.Row][cover.Col] != '.' {
+				t.Errorf("Move %v covers an occupied square", move.Word)
+			}
+			letter := []rune(cover.Letter)[0]
+			if !ContainsRune(rack, letter) {
+				t.Errorf("Move %v uses tiles not in the rack", move.Word)
+			}
+			rack = RemoveRune(rack, letter)
+			tiles.WriteString(cover.Letter)
+			if letter == '?' {
+				tiles.WriteString(strings.ToUpper(cover.Meaning))
+				blanks++
+			} else if cover.Meaning != cover.Letter {
+				t.Errorf("Tile %v has meaning %v", cover.Letter, cover.Meaning)
+			}
+		}
+		if move.Tiles != tiles.String() {
+			t.Errorf("Tiles %v do not match the covers %v", move.Tiles, tiles.String())
+		}
+	}
+	if blanks == 0 {
+		t.Errorf("No move uses the blank tile in the rack")
+	}
+}
+
+func TestPlayOut(t *testing.T) {
+	// Checks that the letter counts of a rack match its slots
+	checkContent := func(rack *Rack) {
+		counts := make(map[rune]int)
+		for _, letter := range rack.AsRunes() {
+			counts[letter]++
+		}
+		for letter, count := range rack.Content.Tiles {
+			if count != counts[letter] {
+				t.Errorf("Rack %v has count %v for '%c'", rack, count, letter)
+			}
+		}
+	}
+	for seed := int64(1); seed <= 5; seed++ {
+		game := NewGameForLocaleWithOptions("en_US", "standard", GameOptions{RandSource: rand.NewSource(seed)})
+		robot := NewHighScoreRobot()
+		partial := false
+		for !game.IsOver() {
+			player := game.PlayerToMove()
+			game.ApplyValid(robot.GenerateMove(game.State()))
+			rack := &game.Racks[player]
+			checkContent(rack)
+			if n := len(rack.AsRunes()); n > 0 && n < game.RackSize {
+				// The bag ran out before the rack could be refilled:
+				// the game goes on with a partial rack
+				partial = true
+				if game.Bag.TileCount() != 0 || (game.IsOver() && game.OverReason() == RackEmpty) {
+					t.Errorf("Unexpected state with a partial rack %v", rack)
+				}
+			}
+		}
+		if !partial {
+			t.Errorf("Game %v never had a partial rack", seed)
+		}
+		if game.OverReason() != RackEmpty {
+			continue
+		}
+		// The finishing player emptied the rack and gets
+		// double the tile scores left in the opponent's rack
+		n := len(game.MoveList)
+		finisher := (n - 1) % 2
+		if !game.Racks[finisher].IsEmpty() || game.Racks[1-finisher].IsEmpty() {
+			t.Errorf("Unexpected racks at the end of game %v", seed)
+		}
+		leave := 0
+		for _, letter := range game.Racks[1-finisher].AsRunes() {
+			leave += game.TileSet.Scores[letter]
+		}
+		if game.MoveList[n-1].Score != 2*leave || game.MoveList[n-2].Score != 0 {
+			t.Errorf("Final moves score %v and %v, expected %v and 0",
+				game.MoveList[n-1].Score, game.MoveList[n-2].Score, 2*leave)
+		}
+	}
+}
+
+func TestBestBlankAssignment(t *testing.T) {
+	game := NewGameForLocale("en_US", "standard")
+	state := game.State()
+	// Many meanings are valid for "?at": the first one in the
+	// alphabet, 'b', wins the tie
+	covers := Covers{
+		{7, 7}: Cover{'?', '?'},
+		{7, 8}: Cover{'a', 'a'},
+		{7, 9}: Cover{'t', 't'},
+	}
+	meaning, score := state.BestBlankAssignment(covers)
+	if meaning != 'b' || score != 2*(1+1) {
+		t.Errorf("Unexpected assignment for ?at: '%c', %v", meaning, score)
+	}
+	if covers[Coordinate{7, 7}].Meaning != '?' {
+		t.Errorf("Covers modified by BestBlankAssignment")
+	}
+	// Only 'u' is valid for "q?iz"
+	covers = Covers{
+		{7, 6}: Cover{'q', 'q'},
+		{7, 7}: Cover{'?', '?'},
+		{7, 8}: Cover{'i', 'i'},
+		{7, 9}: Cover{'z', 'z'},
+	}
+	if meaning, score := state.BestBlankAssignment(covers); meaning != 'u' || score != 2*(10+1+10) {
+		t.Errorf("Unexpected assignment for q?iz: '%c', %v", meaning, score)
+	}
+	// A cross word on the board constrains the meaning: with "ox" in
+	// row 7, a blank below the 'o' must form both "a?" across and
+	// "o?" down, which rules out 'b' and leaves 'd' first
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".......ox......"
+	if err := game.Board.FromStrings(rows, game.TileSet); err != nil {
+		t.Fatalf("Unable to set up board: %v", err)
+	}
+	covers = Covers{
+		{8, 6}: Cover{'a', 'a'},
+		{8, 7}: Cover{'?', '?'},
+	}
+	meaning, score = state.BestBlankAssignment(covers)
+	move := NewTileMove(state.Board, Covers{
+		{8, 6}: Cover{'a', 'a'},
+		{8, 7}: Cover{'?', meaning},
+	})
+	if meaning != 'd' || !state.IsValidTileMove(move) || move.Score(state) != score {
+		t.Errorf("Unexpected assignment for a? below ox: '%c', %v", meaning, score)
+	}
+	// No valid meaning, and more than one blank
+	if meaning, score := state.BestBlankAssignment(Covers{
+		{8, 7}: Cover{'?', '?'},
+		{8, 8}: Cover{'q', 'q'},
+	}); meaning != 0 || score != 0 {
+		t.Errorf("Unexpected assignment for ?q: '%c', %v", meaning, score)
+	}
+	if meaning, _ := state.BestBlankAssignment(Covers{
+		{8, 7}: Cover{'?', '?'},
+		{8, 8}: Cover{'?', '?'},
+	}); meaning != 0 {
+		t.Errorf("Assignment found for two blanks")
+	}
+}
+
+func TestConcurrentGames(t *testing.T) {
+	// Robot games and /moves requests share the same dictionaries,
+	// including the caches of each Dawg. Run with -race to detect
+	// any unsynchronized shared state.
+	const numWorkers = 8
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	// A move that is scored for the first time by all workers at once
+	state := benchmarkState()
+	shared := NewTileMove(state.Board, state.GenerateMoves()[0].(*TileMove).Covers)
+	var wg sync.WaitGroup
+	scores := make([][2]int, numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			game := NewGameForLocaleWithOptions("en_US", "standard",
+				GameOptions{RandSource: rand.NewSource(int64(i))})
+			robots := [2]*RobotWrapper{
+				NewHighScoreRobot(),
+				NewOneOfNBestRobotWithSource(5, rand.NewSource(int64(i))),
+			}
+			for !game.IsOver() {
+				game.ApplyValid(robots[game.PlayerToMove()].GenerateMove(game.State()))
+			}
+			scores[i] = game.Scores
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			shared.Score(state)
+			w := httptest.NewRecorder()
+			HandleMovesRequest(w, MovesRequest{
+				Locale:    "en_US",
+				BoardType: "standard",
+				Board:     rows,
+				Rack:      "aeinrst",
+				Limit:     10,
+			})
+			if w.Code != 200 {
+				t.Errorf("Moves request %v failed with status %v", i, w.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// The games are deterministic: replaying one sequentially
+	// gives the same result
+	game := NewGameForLocaleWithOptions("en_US", "standard",
+		GameOptions{RandSource: rand.NewSource(3)})
+	robots := [2]*RobotWrapper{
+		NewHighScoreRobot(),
+		NewOneOfNBestRobotWithSource(5, rand.NewSource(3)),
+	}
+	for !game.IsOver() {
+		game.ApplyValid(robots[game.PlayerToMove()].GenerateMove(game.State()))
+	}
+	if game.Scores != scores[3] {
+		t.Errorf("Concurrent game scored %v, sequential %v", scores[3], game.Scores)
+	}
+}
+
+func TestMarshalMoveList(t *testing.T) {
+	game := NewGameForLocaleWithOptions("en_US", "standard", GameOptions{RandSource: rand.NewSource(29)})
+	robot := NewHighScoreRobot()
+	game.ApplyValid(robot.GenerateMove(game.State()))
+	game.ApplyValid(NewPassMove())
+	for i := 0; i < 6 && !game.IsOver(); i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	data, err := game.MarshalMoveList()
+	if err != nil {
+		t.Fatalf("Unable to marshal move list: %v", err)
+	}
+	var items []struct {
+		Player     int    `json:"player"`
+		RackBefore string `json:"rack"`
+		Type       string `json:"type"`
+		Coordinate string `json:"co"`
+		Word       string `json:"w"`
+		Tiles      string `json:"tiles"`
+		Score      int    `json:"sc"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		t.Fatalf("Unable to decode move list: %v", err)
+	}
+	if len(items) != len(game.MoveList) {
+		t.Fatalf("Move list has %v items, expected %v", len(items), len(game.MoveList))
+	}
+	var totals [2]int
+	for i, item := range items {
+		if item.Player != i%2 || item.RackBefore != game.MoveList[i].RackBefore {
+			t.Errorf("Unexpected context of move %v: %+v", i, item)
+		}
+		switch item.Type {
+		case "tile":
+			if item.Coordinate == "" || item.Word == "" || item.Tiles == "" || item.Score <= 0 {
+				t.Errorf("Unexpected tile move %v: %+v", i, item)
+			}
+		case "pass":
+			if i != 1 || item.Word != "PASS" || item.Score != 0 {
+				t.Errorf("Unexpected pass move %v: %+v", i, item)
+			}
+		default:
+			t.Errorf("Unexpected type of move %v: %v", i, item.Type)
+		}
+		totals[item.Player] += item.Score
+	}
+	if totals != game.Scores {
+		t.Errorf("Move list scores %v differ from the game scores %v", totals, game.Scores)
+	}
+}
+
+func TestPolishLetterValidation(t *testing.T) {
+	tileSet := PolishTileSet
+	for _, letter := range "óźż?" {
+		if _, ok := tileSet.Score(letter); !ok {
+			t.Errorf("Letter '%c' not found in the Polish tile set", letter)
+		}
+	}
+	if score, ok := tileSet.Score('q'); ok || score != 0 {
+		t.Errorf("Letter 'q' found in the Polish tile set")
+	}
+	emptyRows := func() []string {
+		rows := make([]string, BoardSize)
+		for i := range rows {
+			rows[i] = strings.Repeat(".", BoardSize)
+		}
+		return rows
+	}
+	post := func(rows []string, rack string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, MovesRequest{
+			Locale:    "pl_PL",
+			BoardType: "standard",
+			Board:     rows,
+			Rack:      rack,
+			Limit:     10,
+		})
+		return w
+	}
+	// A board with ó, ł, ź and ż tiles, including a blank 'ź'
+	rows := emptyRows()
+	rows[6] = ".......Ź......."
+	rows[7] = ".......żółw...."
+	if w := post(rows, "aeilnoż"); w.Code != 200 {
+		t.Errorf("Valid Polish board rejected: %v", w.Body.String())
+	}
+	// Invalid runes on the board, as a blank meaning, or in the rack
+	for _, test := range []struct {
+		row, rack, message string
+	}{
+		{".......żółq....", "aeilnoż", "invalid letter 'q'"},
+		{".......żółwX...", "aeilnoż", "invalid letter 'X'"},
+		{".......żółw....", "aeilnox", "invalid letter 'x'"},
+	} {
+		rows := emptyRows()
+		rows[7] = test.row
+		w := post(rows, test.rack)
+		if w.Code != 400 || !strings.Contains(w.Body.String(), test.message) {
+			t.Errorf("Expected 400 with %q, got %v: %v", test.message, w.Code, w.Body.String())
+		}
+	}
+	// Analyzing a word with a blank meaning that is not a Polish letter
+	rows = emptyRows()
+	rows[7] = ".......żółw...."
+	analyze := func(word string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandleAnalyzeRequest(w, AnalyzeRequest{
+			MovesRequest: MovesRequest{
+				Locale:    "pl_PL",
+				BoardType: "standard",
+				Board:     rows,
+				Rack:      "aei?",
+			},
+			Coordinate: "H8",
+			Word:       word,
+		})
+		return w
+	}
+	if w := analyze("żółwQ"); w.Code != 400 || !strings.Contains(w.Body.String(), "invalid letter 'q'") {
+		t.Errorf("Expected 400 for a blank meaning 'q', got %v: %v", w.Code, w.Body.String())
+	}
+	w := analyze("żółwie")
+	var result AnalyzeHeaderJson
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil || !result.Valid || result.Score != 17 {
+		t.Errorf("Unexpected analysis of żółwie: %+v, %v", result, err)
+	}
+}
+
+func TestNynorskGame(t *testing.T) {
+	game := NewGameForLocaleWithOptions("nn", "standard", GameOptions{RandSource: rand.NewSource(31)})
+	if game == nil || game.Dawg == nil {
+		t.Fatalf("Unable to create a Nynorsk game")
+	}
+	if game.Dawg != NorwegianNynorskDictionary || game.TileSet != NorwegianTileSet || game.Locale != "nn" {
+		t.Errorf("Nynorsk game has the wrong dictionary, tile set or locale")
+	}
+	robot := NewHighScoreRobot()
+	move, ok := robot.GenerateMove(game.State()).(*TileMove)
+	if !ok {
+		t.Fatalf("No tile move generated in a Nynorsk game")
+	}
+	if !game.Dawg.Find(move.CleanWord()) || !game.ApplyValid(move) {
+		t.Errorf("Invalid first move in a Nynorsk game: %v", move)
+	}
+	if game := NewNorwegianNynorskGame("standard"); game == nil || game.Dawg != NorwegianNynorskDictionary {
+		t.Errorf("NewNorwegianNynorskGame does not use the Nynorsk dictionary")
+	}
+}
+
+func TestOpeningCache(t *testing.T) {
+	defer SetOpeningCacheSize(0)
+	describe := func(state *GameState, moves []Move) []string {
+		result := make([]string, len(moves))
+		for i, move := range moves {
+			result[i] = fmt.Sprintf("%v %v", move, move.Score(state))
+		}
+		sort.Strings(result)
+		return result
+	}
+	for _, boardType := range []string{"standard", "explo"} {
+		for _, locale := range []string{"en_US", "is_IS"} {
+			dawg, tileSet := decodeLocale(locale, boardType)
+			board := NewBoard(boardType)
+			start := board.StartSquare()
+			for _, rack := range []string{"aeinrst", "ketti?r", "??abdei"} {
+				state := NewState(dawg, tileSet, board, NewRack([]rune(rack), tileSet), false)
+				SetOpeningCacheSize(0)
+				fresh := state.GenerateMoves()
+				// All opening moves are horizontal and cover the start square
+				for _, move := range fresh {
+					tileMove := move.(*TileMove)
+					if _, covered := tileMove.Covers[start]; !covered || !tileMove.Horizontal {
+						t.Errorf("Unexpected opening move %v on %v board", move, boardType)
+					}
+				}
+				SetOpeningCacheSize(16)
+				missed := state.GenerateMoves()
+				hit := state.GenerateMoves()
+				expected := describe(state, fresh)
+				if !slices.Equal(describe(state, missed), expected) ||
+					!slices.Equal(describe(state, hit), expected) {
+					t.Errorf("Cached opening moves for %v differ on %v %v board", rack, locale, boardType)
+				}
+				if stats := OpeningCacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+					t.Errorf("Unexpected opening cache statistics: %+v", stats)
+				}
+			}
+		}
+	}
+	// Boards with tiles on them are not cached
+	SetOpeningCacheSize(16)
+	state := benchmarkState()
+	state.GenerateMoves()
+	if stats := OpeningCacheStats(); stats.Hits+stats.Misses != 0 {
+		t.Errorf("Position with tiles on the board was cached: %+v", stats)
+	}
+}
+
+func BenchmarkGenerateMovesOpening(b *testing.B) {
+	state := NewState(OtcwlDictionary, EnglishTileSet, NewBoard("standard"),
+		NewRack([]rune("aeinrs?"), EnglishTileSet), false)
+	for i := 0; i < b.N; i++ {
+		state.GenerateMoves()
+	}
+}
+
+func BenchmarkGenerateMovesOpeningCached(b *testing.B) {
+	SetOpeningCacheSize(16)
+	defer SetOpeningCacheSize(0)
+	state := NewState(OtcwlDictionary, EnglishTileSet, NewBoard("standard"),
+		NewRack([]rune("aeinrs?"), EnglishTileSet), false)
+	for i := 0; i < b.N; i++ {
+		state.GenerateMoves()
+	}
+}
+
+// concurrentPositions returns mid-game positions of several
+// seeded Icelandic robot games that share the given Dawg
+func concurrentPositions(dawg *Dawg, n int) []*GameState {
+	states := make([]*GameState, n)
+	for i := range states {
+		game, _ := NewCustomGameWithOptions("standard", dawg, NewIcelandicTileSet,
+			GameOptions{RandSource: rand.NewSource(int64(i))})
+		robot := NewHighScoreRobot()
+		for j := 0; j < 2+i%5 && !game.IsOver(); j++ {
+			game.ApplyValid(robot.GenerateMove(game.State()))
+		}
+		states[i] = game.State()
+	}
+	return states
+}
+
+func TestConcurrentScoring(t *testing.T) {
+	// Moves that have not been scored are scored by several
+	// goroutines at once, which must agree (and, under -race,
+	// not race) with each other and with the precomputed scores
+	state := benchmarkState()
+	generated := state.GenerateMoves()
+	moves := make([]*TileMove, len(generated))
+	for i, move := range generated {
+		moves[i] = NewTileMove(state.Board, move.(*TileMove).Covers)
+	}
+	const numWorkers = 4
+	scores := make([][]int, numWorkers)
+	var wg sync.WaitGroup
+	for w := range scores {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			scores[w] = make([]int, len(moves))
+			for i, move := range moves {
+				scores[w][i] = move.Score(state)
+			}
+		}(w)
+	}
+	wg.Wait()
+	for i, move := range generated {
+		expected := move.Score(state)
+		for w := range scores {
+			if scores[w][i] != expected {
+				t.Fatalf("Worker %v scored %v as %v, expected %v", w, move, scores[w][i], expected)
+			}
+		}
+		if moves[i].CachedScore != nil {
+			t.Fatalf("Score() should not set CachedScore of %v", moves[i])
+		}
+	}
+}
+
+func TestConcurrentMoveGeneration(t *testing.T) {
+	// Several games share a fresh Dawg, whose caches are filled
+	// concurrently. Run with -race to detect any data races.
+	const numGames = 8
+	describe := func(state *GameState) string {
+		moves := state.GenerateMoves()
+		result := make([]string, len(moves))
+		for i, move := range moves {
+			result[i] = fmt.Sprintf("%v %v", move, move.Score(state))
+		}
+		sort.Strings(result)
+		return strings.Join(result, "|")
+	}
+	states := concurrentPositions(makeDawg("ordalisti.bin.dawg", IcelandicAlphabet), numGames)
+	results := make([]string, numGames)
+	var wg sync.WaitGroup
+	for i, state := range states {
+		wg.Add(1)
+		go func(i int, state *GameState) {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				result := describe(state)
+				if j > 0 && result != results[i] {
+					t.Errorf("Game %v: concurrent move generation is not repeatable", i)
+				}
+				results[i] = result
+			}
+		}(i, state)
+	}
+	wg.Wait()
+	// Generating sequentially, with the caches filled, gives the same moves
+	for i, state := range states {
+		if describe(state) != results[i] {
+			t.Errorf("Game %v: concurrent and sequential move generation differ", i)
+		}
+	}
+}
+
+func BenchmarkGenerateMovesConcurrentGames(b *testing.B) {
+	states := concurrentPositions(IcelandicDictionary, 8)
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			states[next.Add(1)%int64(len(states))].GenerateMoves()
+		}
+	})
+}
+
+func TestTileSetFromJSON(t *testing.T) {
+	kids := `{
+		"name": "kids",
+		"scores": {"a": 1, "e": 1, "i": 1, "o": 1, "s": 1, "t": 1, "r": 1,
+			"n": 1, "d": 2, "l": 2, "c": 3, "m": 3, "p": 3, "?": 0},
+		"counts": {"a": 5, "e": 6, "i": 4, "o": 4, "s": 4, "t": 4, "r": 4,
+			"n": 4, "d": 2, "l": 2, "c": 2, "m": 2, "p": 2, "?": 1}
+	}`
+	tileSet, err := NewTileSetFromJSON([]byte(kids))
+	if err != nil {
+		t.Fatalf("Unable to load tile set: %v", err)
+	}
+	if tileSet.Name != "kids" || tileSet.Size != 46 || tileSet.Scores['c'] != 3 {
+		t.Errorf("Tile set loaded incorrectly: %v %v", tileSet.Name, tileSet.Size)
+	}
+	invalid := []string{
+		`{"scores": {"a": 1}, "counts": {"a": 30}}`,
+		`{"scores": {"a": 1, "?": 0}, "counts": {"a": 30, "b": 2, "?": 2}}`,
+		`{"scores": {"a": 1, "?": 0}, "counts": {"a": 10, "?": 2}}`,
+		`{"scores": {"a": 1, "?": 0}, "counts": {"a": 250, "?": 2}}`,
+		`{"scores": {"ab": 1, "?": 0}, "counts": {"ab": 30, "?": 2}}`,
+		`{"scores": {"a": 1, "?": 0}, "counts": {"a": -1, "?": 30}}`,
+		`{"scores": [1, 2]}`,
+	}
+	for _, data := range invalid {
+		if _, err := NewTileSetFromJSON([]byte(data)); err == nil {
+			t.Errorf("Invalid tile set should be rejected: %v", data)
+		}
+	}
+	// A tile set without blanks is allowed if explicitly specified
+	if _, err := NewTileSetFromJSON([]byte(`{"scores": {"a": 1}, "counts": {"a": 30, "?": 0}}`)); err != nil {
+		t.Errorf("Tile set without blanks should be accepted: %v", err)
+	}
+	// The built-in locales have matching tile sets and dictionaries
+	for _, locale := range []string{"en_US", "en", "is", "pl", "nb", "nn"} {
+		config, _ := Locales.Lookup(locale)
+		for _, ts := range []*TileSet{config.TileSet, config.ExploTileSet} {
+			if ts != nil {
+				if err := ts.Validate(&config.Dawg.alphabet); err != nil {
+					t.Errorf("Built-in locale %v: %v", locale, err)
+				}
+			}
+		}
+	}
+	// A mismatched dictionary and tile set are caught at registration
+	if err := RegisterDictionary("xx", IcelandicDictionary, EnglishTileSet); err == nil {
+		t.Errorf("Mismatched tile set should not be registered")
+	}
+	if _, ok := Locales.Lookup("xx"); ok {
+		t.Errorf("Mismatched locale should not be registered")
+	}
+	// Register the custom tile set and play a robot game with it
+	if err := RegisterDictionary("xx", OtcwlDictionary, tileSet); err != nil {
+		t.Fatalf("Unable to register custom tile set: %v", err)
+	}
+	defer RegisterDictionary("xx", nil, nil)
+	game := NewGameForLocaleWithOptions("xx", "standard", GameOptions{RandSource: rand.NewSource(11)})
+	if game == nil || game.TileSet != tileSet {
+		t.Fatalf("Unable to create a game with the custom tile set")
+	}
+	robot := NewHighScoreRobot()
+	for !game.IsOver() {
+		if !game.ApplyValid(robot.GenerateMove(game.State())) {
+			t.Fatalf("Robot move rejected in custom tile set game")
+		}
+	}
+	// Blanks are shown in uppercase and may have any meaning
+	for _, row := range game.Board.ToStrings() {
+		for _, r := range row {
+			if r >= 'a' && r <= 'z' && !strings.ContainsRune("aeiostrndlcmp", r) {
+				t.Errorf("Unexpected letter on board: %c", r)
+			}
+		}
+	}
+}
+
+// endgamePosition returns a game where both players have two tiles
+// left and the bag is empty. The greedy M3 oof scores the most, but
+// leaves an 'o' that the opponent punishes by going out with 'un'.
+// Going out with 9K coo scores less, but wins the game.
+func endgamePosition(t *testing.T) *Game {
+	t.Helper()
+	game := NewOtcwlGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(58)})
+	rows := []string{
+		"s..titis...p...",
+		"t....r..a.qi...",
+		"e.ba.o..v.a.c..",
+		"e.um.u.polity..",
+		"luring..waded..",
+		"i.g..holey.weft",
+		"e.hm..kadi..ree",
+		"r..annas.n...el",
+		"...r......z..be",
+		"...er....jatos.",
+		"...ne...coxa...",
+		"...gi......vid.",
+		"...of..........",
+		"...............",
+		"...............",
+	}
+	if err := game.Board.FromStrings(rows, game.TileSet); err != nil {
+		t.Fatalf("Unable to set up board: %v", err)
+	}
+	if !game.ForceRack(0, "oo") || !game.ForceRack(1, "un") {
+		t.Fatalf("Unable to set up racks")
+	}
+	game.Bag.Contents = game.Bag.Contents[:0]
+	game.Scores = [2]int{330, 333}
+	return game
+}
+
+func TestEndgameSolver(t *testing.T) {
+	game := endgamePosition(t)
+	greedy := NewHighScoreRobot().GenerateMove(game.State())
+	if fmt.Sprint(greedy) != "M3 oof" {
+		t.Fatalf("Unexpected greedy move: %v", greedy)
+	}
+	// After the greedy move, the opponent's best reply wins the game
+	afterGreedy := game.Clone()
+	afterGreedy.ApplyValid(greedy)
+	if reply, value := SolveEndgame(afterGreedy, 0); reply == nil || value <= 0 {
+		t.Errorf("Opponent should win after the greedy move: %v %v", reply, value)
+	}
+	move, value := SolveEndgame(game, 0)
+	if move == nil || fmt.Sprint(move) != "9K coo" || value != 7 {
+		t.Fatalf("Solver should find the out play: %v %v", move, value)
+	}
+	if game.Scores != [2]int{330, 333} || len(game.MoveList) != 0 {
+		t.Errorf("Solving should not modify the game")
+	}
+	robotMove := NewEndgameAwareRobot(0).GenerateMove(game.State())
+	if fmt.Sprint(robotMove) != fmt.Sprint(move) {
+		t.Errorf("EndgameAwareRobot should play the out play, not %v", robotMove)
+	}
+	if !game.ApplyValid(move) || !game.IsOver() || game.Scores[0]-game.Scores[1] != value {
+		t.Errorf("Out play should win the game by %v: %v", value, game.Scores)
+	}
+	// The solver does not apply while there are tiles in the bag
+	game = NewOtcwlGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(58)})
+	if move, _ := SolveEndgame(game, 0); move != nil {
+		t.Errorf("Solver should not apply with tiles in the bag: %v", move)
+	}
+	// Play out a game, where the robot switches to the
+	// time-limited solver once the bag is empty
+	robot := NewEndgameAwareRobot(50 * time.Millisecond)
+	for !game.IsOver() {
+		if !game.Apply(robot.GenerateMove(game.State())) {
+			t.Fatalf("EndgameAwareRobot made an invalid move")
+		}
+	}
+}
+
+func TestGameSolveEndgame(t *testing.T) {
+	game := endgamePosition(t)
+	// A full search finds the out play
+	if move, value := game.SolveEndgame(0); fmt.Sprint(move) != "9K coo" || value != 7 {
+		t.Errorf("Expected 9K coo with a value of 7, got %v %v", move, value)
+	}
+	// A search of one ply does not see the opponent's reply, and
+	// values the greedy move by the tiles left in the racks
+	if move, value := game.SolveEndgame(1); fmt.Sprint(move) != "M3 oof" || value != 10 {
+		t.Errorf("Expected M3 oof with a value of 10, got %v %v", move, value)
+	}
+	if move, value := game.SolveEndgame(2); fmt.Sprint(move) != "9K coo" || value != 7 {
+		t.Errorf("Expected 9K coo with a value of 7 at two plies, got %v %v", move, value)
+	}
+	if game.Scores != [2]int{330, 333} || len(game.MoveList) != 0 {
+		t.Errorf("Solving should not modify the game")
+	}
+	// The out play is the third highest scoring move, so it is
+	// missed if only the two highest scoring moves are considered
+	solver := EndgameSolver{MaxMoves: 2}
+	if move, value := solver.Solve(game); fmt.Sprint(move) != "M3 oof" || value != -3 {
+		t.Errorf("Expected M3 oof with a value of -3, got %v %v", move, value)
+	}
+	solver.MaxMoves = 3
+	if move, value := solver.Solve(game); fmt.Sprint(move) != "9K coo" || value != 7 {
+		t.Errorf("Expected 9K coo with a value of 7, got %v %v", move, value)
+	}
+}
+
+func TestNodeCacheConcurrent(t *testing.T) {
+	const numOffsets = 5000
+	decode := func(offset uint32) navStates {
+		return navStates{{nextNode: offset}}
+	}
+	for _, limit := range []int{0, 40 * cacheShards} {
+		var nc nodeCache
+		nc.Init(limit)
+		var wg sync.WaitGroup
+		results := make([][]*navStates, 8)
+		for g := range results {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				rng := rand.New(rand.NewSource(int64(g)))
+				results[g] = make([]*navStates, numOffsets)
+				for i := 0; i < 4*numOffsets; i++ {
+					offset := uint32(rng.Intn(numOffsets))
+					states := nc.Lookup(offset, decode)
+					if len(*states) != 1 || (*states)[0].nextNode != offset {
+						t.Errorf("Incorrect node for offset %v", offset)
+						return
+					}
+					results[g][offset] = states
+				}
+			}(g)
+		}
+		wg.Wait()
+		stats := nc.Stats()
+		if limit > 0 && stats.Size > limit {
+			t.Errorf("Node cache exceeds its limit: %+v", stats)
+		}
+		if limit == 0 {
+			if stats.Size > numOffsets || stats.Hits == 0 {
+				t.Errorf("Unexpected node cache stats: %+v", stats)
+			}
+			// Once cached, all goroutines see the same node
+			for offset := uint32(0); offset < numOffsets; offset++ {
+				cached := nc.Lookup(offset, decode)
+				for g := range results {
+					if states := results[g][offset]; states != nil && states != cached {
+						t.Errorf("Goroutine %v saw a different node for offset %v", g, offset)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkNodeCacheLookup(b *testing.B) {
+	var nc nodeCache
+	nc.Init(0)
+	decode := func(offset uint32) navStates {
+		return navStates{{nextNode: offset}}
+	}
+	for offset := uint32(0); offset < 1024; offset++ {
+		nc.Lookup(offset, decode)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		offset := uint32(0)
+		for pb.Next() {
+			nc.Lookup(offset%1024, decode)
+			offset++
+		}
+	})
+}
+
+func TestOpeningBook(t *testing.T) {
+	book := BuildOpeningBook(OtcwlDictionary, EnglishTileSet)
+	// A strong opening rack, which makes a bingo
+	move := book.BestMove("standard", "aeinrst")
+	state := NewState(OtcwlDictionary, EnglishTileSet, NewBoard("standard"),
+		NewRack([]rune("aeinrst"), EnglishTileSet), false)
+	moves := state.GenerateMoves()
+	sort.Sort(byScore{state, moves})
+	if move == nil || fmt.Sprint(move) != fmt.Sprint(moves[0]) || move.Score(state) != moves[0].Score(state) {
+		t.Fatalf("Book move %v differs from the best generated move %v", move, moves[0])
+	}
+	if len(move.(*TileMove).Covers) != RackSize {
+		t.Errorf("Expected a bingo, got %v", move)
+	}
+	// The order of the tiles in the rack does not matter
+	if again := book.BestMove("standard", "tsrniea"); again != move {
+		t.Errorf("Book should return the stored move, got %v", again)
+	}
+	if stats := book.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("Unexpected opening book stats: %+v", stats)
+	}
+	// The board type is part of the key
+	if explo := book.BestMove("explo", "aeinrst"); explo == nil || book.Stats().Size != 2 {
+		t.Errorf("Explo opening should be stored separately: %v", explo)
+	}
+	// The book does not apply to other dictionaries or to a non-empty board
+	if other := book.Lookup(NewState(SowpodsDictionary, EnglishTileSet, NewBoard("standard"),
+		NewRack([]rune("aeinrst"), EnglishTileSet), false)); other != nil {
+		t.Errorf("Book should not apply to another dictionary: %v", other)
+	}
+	if book.BestMove("standard", "qqqqqqq") != nil || book.BestMove("standard", "þ") != nil {
+		t.Errorf("Book should have no move for unplayable racks")
+	}
+	// A robot that uses the book plays as a HighScoreRobot does
+	robot := NewHighScoreRobotWithBook(book)
+	reference := NewHighScoreRobot()
+	for seed := int64(1); seed <= 4; seed++ {
+		game := NewOtcwlGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(seed)})
+		for i := 0; i < 3 && !game.IsOver(); i++ {
+			state := game.State()
+			move := robot.GenerateMove(state)
+			if fmt.Sprint(move) != fmt.Sprint(reference.GenerateMove(state)) {
+				t.Errorf("Robot with book played %v differently", move)
+			}
+			if !game.Apply(move) {
+				t.Fatalf("Robot with book made an invalid move: %v", move)
+			}
+		}
+	}
+	// Three racks were looked up above, and one opening per game
+	if book.Stats().Misses != 3+4 {
+		t.Errorf("Expected the book to be consulted for the openings: %+v", book.Stats())
+	}
+}
+
+func TestValidateMove(t *testing.T) {
+	game := NewOtcwlGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(7)})
+	game.ForceRack(0, "aeinrst")
+	check := func(covers Covers, code MoveErrorCode) *MoveError {
+		t.Helper()
+		move := NewTileMove(&game.Board, covers)
+		err := game.ValidateMove(move)
+		if code == "" {
+			if err != nil {
+				t.Errorf("Expected a valid move, got %v: %v", err.Code, err)
+			}
+			return nil
+		}
+		if err == nil || err.Code != code {
+			t.Errorf("Expected %v, got %+v", code, err)
+			return err
+		}
+		// The bool-returning API agrees, apart from the rack check
+		if code != TileNotInRack && move.IsValid(game) {
+			t.Errorf("IsValid() should reject a move with error %v", code)
+		}
+		return err
+	}
+	err := check(Covers{{0, 0}: Cover{'a', 'a'}, {0, 1}: Cover{'t', 't'}}, FirstMoveMustCoverStart)
+	if err != nil && (err.Row != 7 || err.Col != 7 || err.Message != "the first move must cover the start square H8") {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+	check(Covers{{7, 7}: Cover{'a', 'a'}, {8, 8}: Cover{'t', 't'}}, NonLinear)
+	if err := check(Covers{{7, 7}: Cover{'a', 'a'}, {7, 9}: Cover{'t', 't'}}, Gap); err != nil && err.Col != 8 {
+		t.Errorf("Gap should be reported at H9: %+v", err)
+	}
+	check(Covers{{7, 7}: Cover{'q', 'q'}, {7, 8}: Cover{'i', 'i'}}, TileNotInRack)
+	check(Covers{{7, 7}: Cover{'a', 'a'}, {7, 8}: Cover{'a', 'a'}}, TileNotInRack)
+	check(Covers{{7, 7}: Cover{'a', 'a'}, {7, 15}: Cover{'t', 't'}}, OffBoard)
+	if err := check(Covers{{7, 7}: Cover{'t', 't'}, {7, 8}: Cover{'n', 'n'}}, WordNotInDictionary); err != nil && err.Word != "tn" {
+		t.Errorf("Expected 'tn' to be reported: %+v", err)
+	}
+	check(Covers{{7, 7}: Cover{'a', 'a'}, {7, 8}: Cover{'t', 't'}}, "")
+	if !game.Apply(NewTileMove(&game.Board, Covers{{7, 7}: Cover{'a', 'a'}, {7, 8}: Cover{'t', 't'}})) {
+		t.Fatalf("Unable to apply a valid move")
+	}
+	game.ForceRack(1, "xiaeiou")
+	if err := check(Covers{{7, 7}: Cover{'x', 'x'}}, SquareOccupied); err != nil && (err.Row != 7 || err.Col != 7) {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+	check(Covers{{0, 0}: Cover{'x', 'x'}, {0, 1}: Cover{'i', 'i'}}, NotConnected)
+	check(Covers{}, InvalidTileCount)
+	// Placing "xi" below "at" forms the cross word "tx"
+	err = check(Covers{{8, 8}: Cover{'x', 'x'}, {8, 9}: Cover{'i', 'i'}}, CrossWordInvalid)
+	if err != nil {
+		data, _ := json.Marshal(err)
+		expected := `{"code":"CrossWordInvalid","message":"the cross word 'tx' at I9 is not in the dictionary","word":"tx","row":8,"col":8}`
+		if string(data) != expected {
+			t.Errorf("Unexpected JSON for a cross word error: %s", data)
+		}
+	}
+	if data, _ := json.Marshal(newMoveError(NonLinear, "x")); string(data) != `{"code":"NonLinear","message":"x"}` {
+		t.Errorf("Unexpected JSON for an error without a square: %s", data)
+	}
+	// Exchanges
+	if err := game.ValidateMove(NewExchangeMove("xq")); err == nil || err.Code != TileNotInRack {
+		t.Errorf("Expected TileNotInRack for an exchange, got %+v", err)
+	}
+	if err := game.ValidateMove(NewExchangeMove("xi")); err != nil {
+		t.Errorf("Expected a valid exchange, got %+v", err)
+	}
+	bag := game.Bag.Contents
+	game.Bag.Contents = bag[:RackSize-1]
+	if err := game.ValidateMove(NewExchangeMove("xi")); err == nil || err.Code != ExchangeNotAllowed {
+		t.Errorf("Expected ExchangeNotAllowed, got %+v", err)
+	}
+	if NewExchangeMove("xi").IsValid(game) {
+		t.Errorf("IsValid() should reject an exchange when the bag is low")
+	}
+	game.Bag.Contents = bag
+	if err := game.ValidateMove(NewPassMove()); err != nil {
+		t.Errorf("A pass should be valid: %+v", err)
+	}
+	game.Resign()
+	if err := game.ValidateMove(NewPassMove()); err == nil || err.Code != GameOver {
+		t.Errorf("Expected GameOver, got %+v", err)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	validate := func(covers []CoverJson) (*httptest.ResponseRecorder, ValidateHeaderJson) {
+		w := httptest.NewRecorder()
+		HandleValidateRequest(w, ValidateRequest{
+			MovesRequest: MovesRequest{
+				Locale:    "en_US",
+				BoardType: "standard",
+				Board:     rows,
+				Rack:      "aeinrs?",
+			},
+			Covers: covers,
+		})
+		var result ValidateHeaderJson
+		if w.Code == 200 {
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Unable to decode validate response: %v", err)
+			}
+		}
+		return w, result
+	}
+	// retsina down from E5, with a blank as the 't', forming "scat"
+	covers := make([]CoverJson, 0, RackSize)
+	for i, letter := range "re?sina" {
+		cj := CoverJson{Row: 4 + i, Col: 4, Letter: string(letter)}
+		if letter == '?' {
+			cj.Meaning = "t"
+		}
+		covers = append(covers, cj)
+	}
+	if _, result := validate(covers); !result.Ok || result.Score != 80 || result.Error != nil {
+		t.Errorf("Unexpected result for a valid move: %+v", result)
+	}
+	// The same tiles in the wrong place
+	covers[0].Row = 3
+	if _, result := validate(covers); result.Ok || result.Error == nil || result.Error.Code != Gap {
+		t.Errorf("Expected a gap error: %+v", result)
+	}
+	if _, result := validate([]CoverJson{{Row: 8, Col: 5, Letter: "t"}}); result.Ok || result.Error.Code != TileNotInRack {
+		t.Errorf("Expected a tile not in rack error: %+v", result)
+	}
+	if w, _ := validate([]CoverJson{{Row: 8, Col: 5, Letter: "a"}, {Row: 8, Col: 5, Letter: "a"}}); w.Code != 400 {
+		t.Errorf("Expected 400 for duplicate covers, got %v", w.Code)
+	}
+	if w, _ := validate([]CoverJson{{Row: 8, Col: 5, Letter: "?"}}); w.Code != 400 {
+		t.Errorf("Expected 400 for a blank without a meaning, got %v", w.Code)
+	}
+}
+
+func TestDealPlausibleRack(t *testing.T) {
+	game := NewIcelandicGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(5)})
+	robot := NewHighScoreRobot()
+	for i := 0; i < 6; i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	player := game.PlayerToMove()
+	unseen := game.UnseenTiles(player)
+	racks := [2]string{game.Racks[0].AsString(), game.Racks[1].AsString()}
+	bagSize := game.Bag.TileCount()
+	for seed := int64(0); seed < 20; seed++ {
+		rack := game.DealPlausibleRack(player, rand.New(rand.NewSource(seed)))
+		letters := rack.AsRunes()
+		if len(letters) != game.RackSize {
+			t.Fatalf("Expected a full rack, got %v", rack.AsString())
+		}
+		counts := make(map[rune]int)
+		for _, letter := range letters {
+			counts[letter]++
+			if counts[letter] > unseen[letter] {
+				t.Errorf("Rack %v has more '%c' tiles than are unseen", rack.AsString(), letter)
+			}
+		}
+	}
+	// The same source deals the same rack
+	rack1 := game.DealPlausibleRack(player, rand.New(rand.NewSource(42)))
+	rack2 := game.DealPlausibleRack(player, rand.New(rand.NewSource(42)))
+	if rack1.AsString() != rack2.AsString() {
+		t.Errorf("Deals from the same source differ: %v, %v", rack1.AsString(), rack2.AsString())
+	}
+	if game.DealPlausibleRack(player, nil) == nil {
+		t.Errorf("Unable to deal a rack from the global source")
+	}
+	// The game is not modified
+	if game.Racks[0].AsString() != racks[0] || game.Racks[1].AsString() != racks[1] ||
+		game.Bag.TileCount() != bagSize {
+		t.Errorf("Dealing a plausible rack modified the game")
+	}
+	// Once the bag is empty, the unseen tiles are those of the
+	// opponent's rack, and all of them are dealt
+	for game.Bag.TileCount() > 0 && !game.IsOver() {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	if !game.IsOver() {
+		player = game.PlayerToMove()
+		expected := game.Racks[1-player].AsRunes()
+		dealt := game.DealPlausibleRack(player, nil).AsRunes()
+		slices.Sort(expected)
+		slices.Sort(dealt)
+		if !slices.Equal(dealt, expected) {
+			t.Errorf("Expected the opponent's rack %v to be dealt, got %v", string(expected), string(dealt))
+		}
+	}
+}
+
+func TestReturnedBlankIsFresh(t *testing.T) {
+	game := NewIcelandicGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(11)})
+	if !game.ForceRack(0, "?") || !game.Racks[0].Fill(game.Bag) {
+		t.Fatalf("Unable to force rack")
+	}
+	blank := game.Racks[0].FindTile('?')
+	// Simulate a blank that has been assigned a meaning while in the rack
+	blank.Meaning = 'a'
+	blank.PlayedBy = 1
+	if !game.ApplyValid(NewExchangeMove("?")) {
+		t.Fatalf("Unable to exchange the blank")
+	}
+	if !slices.Contains(game.Bag.Contents, blank) {
+		t.Fatalf("Exchanged blank not found in the bag")
+	}
+	if blank.Meaning != '?' || blank.PlayedBy != 0 {
+		t.Errorf("Exchanged blank not reset: meaning '%c', played by %v", blank.Meaning, blank.PlayedBy)
+	}
+	// Draw both blanks, so that the exchanged one is among them
+	if !game.ForceRack(1, "??") || !game.Racks[1].Fill(game.Bag) {
+		t.Fatalf("Unable to force rack")
+	}
+	if !game.Racks[1].HasTile(blank) {
+		t.Fatalf("Exchanged blank not drawn")
+	}
+	state := game.State()
+	var played *TileMove
+	meanings := make(map[rune]bool)
+	for _, move := range state.GenerateMoves() {
+		tileMove := move.(*TileMove)
+		for _, cover := range tileMove.Covers {
+			if cover.Letter == '?' {
+				meanings[cover.Meaning] = true
+				if played == nil && cover.Meaning != 'a' {
+					played = tileMove
+				}
+			}
+		}
+	}
+	if len(meanings) < 2 || played == nil {
+		t.Fatalf("Blanks should be able to stand for any letter, got %v", meanings)
+	}
+	score := played.Score(state)
+	if !game.ApplyValid(played) || game.Scores[1] != score {
+		t.Fatalf("Unable to apply move %v", played)
+	}
+	for coord, cover := range played.Covers {
+		tile := game.TileAt(coord.Row, coord.Col)
+		if tile.Letter == '?' && (tile.Meaning != cover.Meaning || tile.Score != 0 || tile.PlayedBy != 1) {
+			t.Errorf("Blank at %v is %c (%v points) played by %v, expected %c",
+				squareName(coord), tile.Meaning, tile.Score, tile.PlayedBy, cover.Meaning)
+		}
+	}
+}
+
+func TestRemainingTileScore(t *testing.T) {
+	if total := NewEnglishTileSet.TotalScore(); total != 187 {
+		t.Errorf("Expected a total score of 187 for the English tile set, got %v", total)
+	}
+	game := NewIcelandicGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(3)})
+	if game.RemainingTileScore() != game.TileSet.TotalScore() {
+		t.Errorf("Remaining tile score %v differs from the total score %v at the start of the game",
+			game.RemainingTileScore(), game.TileSet.TotalScore())
+	}
+	robot := NewHighScoreRobot()
+	for i := 0; i < 10 && !game.IsOver(); i++ {
+		before := game.RemainingTileScore()
+		move := robot.GenerateMove(game.State())
+		game.ApplyValid(move)
+		onBoard := 0
+		if tileMove, ok := move.(*TileMove); ok {
+			for _, cover := range tileMove.Covers {
+				if cover.Letter != '?' {
+					onBoard += game.TileSet.Scores[cover.Letter]
+				}
+			}
+		}
+		if game.RemainingTileScore() != before-onBoard {
+			t.Errorf("Remaining tile score should be %v after %v, got %v",
+				before-onBoard, move, game.RemainingTileScore())
+		}
+	}
+	if game.RemainingTileScore() >= game.TileSet.TotalScore() {
+		t.Errorf("Remaining tile score should decrease as tiles are played")
+	}
+}
+
+func TestParseMoveNotation(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	game.ForceRack(1, "")
+	if !game.ForceRack(0, "ílarnt?") || !game.Racks[1].Fill(game.Bag) {
+		t.Fatalf("Unable to force racks")
+	}
+	move, err := ParseMoveNotation(game, "H4 bÍLAR")
+	if err != nil {
+		t.Fatalf("Unable to parse move: %v", err)
+	}
+	tileMove := move.(*TileMove)
+	if tileMove.String() != "H4 ?bílar" || tileMove.Covers[Coordinate{7, 3}] != (Cover{'?', 'b'}) {
+		t.Errorf("Move not parsed correctly: %v", tileMove)
+	}
+	// Blank tiles are in lowercase, unlike in Game.ParseMove()
+	if move, err := game.ParseMove("H4 Bílar"); err != nil || move.(*TileMove).String() != tileMove.String() {
+		t.Errorf("Game.ParseMove() should parse the same move: %v, %v", move, err)
+	}
+	for _, s := range []string{"H4 BÍLAR", "H4 bílar", "Z1 AB", "H4", "--", "- x", "EXCH Þ", "-Þ", ""} {
+		if _, err := ParseMoveNotation(game, s); err == nil {
+			t.Errorf("Invalid move '%v' should be rejected", s)
+		}
+	}
+	if move, err := ParseMoveNotation(game, "EXCH ar?"); err != nil || move.(*ExchangeMove).Letters != "ar?" {
+		t.Errorf("Unable to parse an exchange move: %v", err)
+	}
+	if move, err := ParseMoveNotation(game, "-ÍT"); err != nil || move.(*ExchangeMove).Letters != "ít" {
+		t.Errorf("Unable to parse a GCG exchange move: %v", err)
+	}
+	if move, err := ParseMoveNotation(game, "-"); err != nil || fmt.Sprint(move) != "Pass" {
+		t.Errorf("Unable to parse a pass move: %v", err)
+	}
+	// The notation of the moves in a game, as written to a GCG file,
+	// parses to the same moves
+	for _, locale := range []string{"is", "en_US"} {
+		game := NewGameForLocale(locale, "standard")
+		robot := NewHighScoreRobot()
+		for !game.IsOver() {
+			move := robot.GenerateMove(game.State())
+			if tileMove, ok := move.(*TileMove); ok {
+				notation := tileMove.Coordinate() + " " + game.gcgWord(tileMove)
+				parsed, err := ParseMoveNotation(game, notation)
+				if err != nil {
+					t.Fatalf("Unable to parse '%v': %v", notation, err)
+				}
+				if parsed.(*TileMove).String() != tileMove.String() ||
+					parsed.(*TileMove).Coordinate() != tileMove.Coordinate() ||
+					parsed.Score(game.State()) != tileMove.Score(game.State()) {
+					t.Errorf("Move %v parsed from '%v' as %v", tileMove, notation, parsed)
+				}
+			}
+			game.ApplyValid(move)
+		}
+	}
+}
+
+func TestLoadGCGGames(t *testing.T) {
+	english := "#character-encoding UTF-8\n" +
+		"#player1 alice Alice\n" +
+		"#player2 bob Bob\n" +
+		">alice: AEHLLOX H4 HELLO +24 24\n" +
+		">bob: AEIQRTU 8F QU.TA +14 14\n" +
+		">alice: AEFIRST - +0 24\n" +
+		">bob: AAIRTUZ -AAZ +0 14\n" +
+		">alice: EFILRST J6 FR(A)ILEST +71 95\n" +
+		">bob: BIORTUW 5E TUB. +12 26\n"
+	icelandic := "#character-encoding UTF-8\n" +
+		"#player1 anna Anna Jónsdóttir\n" +
+		"#player2 bjarni Bjarni\n" +
+		">anna: ÍLARNT? H4 bÍLAR +16 16\n" +
+		">bjarni: EHSTURÆ 8C HESTU. +16 16\n" +
+		">anna: DGKNSÐ? - +0 16\n" +
+		">bjarni: ÆXÖYÞAR -ÆÖ +0 16\n" +
+		">anna: DGKNSÐ? D6 SK.iÐ +8 24\n"
+	for _, test := range []struct {
+		locale, gcg string
+		names       [2]string
+		scores      [2]int
+		words       []string
+	}{
+		{"en_US", english, [2]string{"Alice", "Bob"}, [2]int{95, 26},
+			[]string{"hello", "quota", "frailest", "tube"}},
+		{"is", icelandic, [2]string{"Anna Jónsdóttir", "Bjarni"}, [2]int{24, 16},
+			[]string{"?bílar", "hestur", "ske?ið"}},
+	} {
+		game := NewGameForLocale(test.locale, "standard")
+		if err := game.LoadGCG(strings.NewReader(test.gcg)); err != nil {
+			t.Errorf("Unable to load the %v game: %v", test.locale, err)
+			continue
+		}
+		if game.PlayerNames != test.names || game.Scores != test.scores {
+			t.Errorf("Unexpected result from the %v game: %v %v", test.locale, game.PlayerNames, game.Scores)
+		}
+		words := make([]string, 0, len(test.words))
+		for _, item := range game.MoveList {
+			if tileMove, ok := item.Move.(*TileMove); ok {
+				words = append(words, tileMove.Word)
+			}
+		}
+		if !slices.Equal(words, test.words) {
+			t.Errorf("Expected the words %v in the %v game, got %v", test.words, test.locale, words)
+		}
+		// A game that already has moves cannot be loaded into
+		if err := game.LoadGCG(strings.NewReader(test.gcg)); err == nil {
+			t.Errorf("Loading into a game with moves should fail")
+		}
+	}
+}
+
+func TestDefensiveRobot(t *testing.T) {
+	game := NewGameForLocale("en_US", "standard")
+	for _, play := range [][2]string{
+		{"oylanef", "H4 FELONY"},
+		{"siebepi", "I7 PEES"},
+		{"ehearww", "G7 HAW"},
+		{"aigbsui", "10D GABS"},
+		{"eieorew", "11D OWIE"},
+		{"tibaoui", ""},
+	} {
+		player := game.PlayerToMove()
+		game.ForceRack(1-player, "")
+		if !game.ForceRack(player, play[0]) || !game.Racks[1-player].Fill(game.Bag) {
+			t.Fatalf("Unable to force rack %v", play[0])
+		}
+		if play[1] == "" {
+			break
+		}
+		move, err := ParseMoveNotation(game, play[1])
+		if err != nil || !game.Apply(move) {
+			t.Fatalf("Unable to play %v: %v", play[1], err)
+		}
+	}
+	state := game.State()
+	// The highest-scoring move reaches within two squares
+	// of the triple word square at A15
+	greedy := NewHighScoreRobot().GenerateMove(state).(*TileMove)
+	if greedy.String() != "12A biota" || greedy.Score(state) != 34 {
+		t.Fatalf("Expected the greedy move 12A biota (34), got %v (%v)", greedy, greedy.Score(state))
+	}
+	if penalty := openedPremiumPenalty(state.Board, greedy); penalty < 2*openedPremiumPoints {
+		t.Errorf("Opening a triple word square should be penalized, got %v", penalty)
+	}
+	defensive := NewDefensiveRobot(5).GenerateMove(state).(*TileMove)
+	if defensive.String() != "12D bat" || defensive.Score(state) != 33 ||
+		openedPremiumPenalty(state.Board, defensive) != 0 {
+		t.Errorf("Expected the defensive move 12D bat (33), got %v (%v)", defensive, defensive.Score(state))
+	}
+	// Without a score window, the defensive robot plays greedily
+	if move := NewDefensiveRobot(0).GenerateMove(state); move.(*TileMove).String() != greedy.String() {
+		t.Errorf("Expected the greedy move with no score window, got %v", move)
+	}
+}
+
+func TestWordLists(t *testing.T) {
+	twoLetterWords := OtcwlDictionary.WordsOfLength(2)
+	count := 0
+	OtcwlDictionary.Iterate(func(word string) bool {
+		if len([]rune(word)) == 2 {
+			count++
+		}
+		return true
+	})
+	if len(twoLetterWords) != count || count == 0 {
+		t.Errorf("Expected %v two-letter words, got %v", count, len(twoLetterWords))
+	}
+	for _, word := range twoLetterWords {
+		if len([]rune(word)) != 2 || !OtcwlDictionary.Find(word) {
+			t.Errorf("Unexpected two-letter word '%v'", word)
+		}
+	}
+	if !slices.IsSorted(twoLetterWords) {
+		t.Errorf("Two-letter words should be in alphabetical order")
+	}
+	if words := IcelandicDictionary.WordsOfLength(0); len(words) != 0 {
+		t.Errorf("Expected no words of length 0, got %v", words)
+	}
+	// Icelandic words of length 3 with a limit on the number of results
+	var ln LengthNavigator
+	ln.Init(3, 10)
+	IcelandicDictionary.Navigate(&ln)
+	if !slices.Equal(ln.results, IcelandicDictionary.WordsOfLength(3)[:10]) {
+		t.Errorf("Limited results differ: %v", ln.results)
+	}
+	// Words using 'q' without 'u'
+	qWords := OtcwlDictionary.WordsContaining([]rune("q"))
+	var qNoU []string
+	for _, word := range qWords {
+		if !strings.ContainsRune(word, 'q') || !OtcwlDictionary.Find(word) {
+			t.Errorf("Unexpected word '%v' containing 'q'", word)
+		}
+		if !strings.ContainsRune(word, 'u') {
+			qNoU = append(qNoU, word)
+		}
+	}
+	for _, word := range []string{"qi", "qat", "qoph", "faqir"} {
+		if !slices.Contains(qNoU, word) {
+			t.Errorf("Expected '%v' among the words with 'q' but no 'u'", word)
+		}
+	}
+	// Repeated letters must occur at least as many times
+	for _, word := range OtcwlDictionary.WordsContaining([]rune("zzz")) {
+		if strings.Count(word, "z") < 3 {
+			t.Errorf("Word '%v' should contain three z's", word)
+		}
+	}
+	var cn ContainingNavigator
+	cn.Init([]rune("xj"), 2)
+	OtcwlDictionary.Navigate(&cn)
+	if len(cn.results) != 2 {
+		t.Errorf("Expected 2 words with the limit, got %v", cn.results)
+	}
+}
+
+func BenchmarkGenerateAndScoreMoves(b *testing.B) {
+	state := benchmarkState()
+	for i := 0; i < b.N; i++ {
+		moves := state.GenerateMoves()
+		sort.Sort(byScore{state, moves})
+	}
+}
+
+func TestPrecomputedMoveScores(t *testing.T) {
+	// The scores stamped on generated moves must match
+	// the scores calculated by TileMove.Score()
+	check := func(state *GameState, moves []Move, generator string) {
+		for _, move := range moves {
+			tileMove := move.(*TileMove)
+			cached := tileMove.CachedScore
+			if cached == nil {
+				t.Fatalf("No precomputed score for %v", tileMove)
+			}
+			tileMove.CachedScore = nil
+			if score := tileMove.Score(state); score != *cached {
+				t.Fatalf("Precomputed score %v of %v (%v) differs from %v",
+					*cached, tileMove, generator, score)
+			}
+		}
+	}
+	state := benchmarkState()
+	check(state, state.GenerateMoves(), "dawg")
+	check(state, state.GenerateMovesGaddag(NewGaddagFromState(state)), "gaddag")
+	for seed, locale := range []string{"is", "en_US", "pl", "nb"} {
+		for _, boardType := range []string{"standard", "explo", "mini"} {
+			game := NewGameForLocaleWithOptions(locale, boardType,
+				GameOptions{RandSource: rand.NewSource(int64(seed))})
+			robot := NewHighScoreRobot()
+			for !game.IsOver() {
+				state := game.State()
+				check(state, state.GenerateMoves(), "dawg")
+				game.ApplyValid(robot.GenerateMove(state))
+			}
+		}
+	}
+}
+
+func TestTileMoveApplyIsTransactional(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	game.ForceRack(1, "")
+	if !game.ForceRack(0, "?abdefg") || !game.Racks[1].Fill(game.Bag) {
+		t.Fatalf("Unable to force racks")
+	}
+	rackBefore := game.Racks[0].AsString()
+	unchanged := func(what string) {
+		t.Helper()
+		if game.TilesOnBoard() != 0 || game.Racks[0].AsString() != rackBefore || len(game.MoveList) != 0 {
+			t.Errorf("%v: the board or rack was modified (%v tiles on board, rack %v)",
+				what, game.TilesOnBoard(), game.Racks[0].AsString())
+		}
+		if blank := game.Racks[0].FindTile('?'); blank == nil || blank.Meaning != '?' {
+			t.Errorf("%v: the blank tile was modified", what)
+		}
+	}
+	// A move that needs two blanks, while the rack only has one
+	move := NewUncheckedTileMove(&game.Board, Covers{
+		{7, 6}: {'a', 'a'},
+		{7, 7}: {'?', 'b'},
+		{7, 8}: {'?', 'd'},
+	})
+	if !move.IsValid(game) {
+		t.Fatalf("The move should be valid on the board")
+	}
+	if game.Apply(move) {
+		t.Errorf("A move needing two blanks should not be applied")
+	}
+	unchanged("two blanks")
+	// A blank with a meaning outside the alphabet, applied directly
+	move = NewUncheckedTileMove(&game.Board, Covers{
+		{7, 7}: {'d', 'd'},
+		{7, 8}: {'?', 'q'},
+	})
+	if move.Apply(game) {
+		t.Errorf("A blank meaning outside the alphabet should not be applied")
+	}
+	unchanged("invalid meaning")
+	// The same blank tile passed twice to MakeTileMove
+	blank := game.Racks[0].FindTile('?')
+	if game.MakeTileMove(7, 7, true, []*Tile{game.Racks[0].FindTile('a'), blank, blank}) {
+		t.Errorf("A tile passed twice to MakeTileMove should be rejected")
+	}
+	blank.Meaning = '?'
+	unchanged("duplicate tile")
+	// The move is fine with distinct tiles
+	blank.Meaning = 'ð'
+	if !game.MakeTileMove(7, 7, true, []*Tile{game.Racks[0].FindTile('a'), blank}) {
+		t.Errorf("Unable to make a tile move")
+	}
+}
+
+func TestMovesRequestAnchor(t *testing.T) {
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	moves := func(anchor string) (int, int, [][]CoverJson) {
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, MovesRequest{
+			Locale:    "en_US",
+			BoardType: "standard",
+			Board:     rows,
+			Rack:      "aeinrst",
+			Anchor:    anchor,
+		})
+		if w.Code != 200 {
+			return w.Code, 0, nil
+		}
+		var result struct {
+			Count int `json:"count"`
+			Moves []struct {
+				Covers []CoverJson `json:"covers"`
+			} `json:"moves"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Errorf("Unable to decode moves response: %v", err)
+			return w.Code, 0, nil
+		}
+		covers := make([][]CoverJson, 0, len(result.Moves))
+		for _, m := range result.Moves {
+			covers = append(covers, m.Covers)
+		}
+		return w.Code, result.Count, covers
+	}
+	_, all, _ := moves("")
+	// I6 is the square just below the 'c' of "cat"
+	code, count, covers := moves("I6")
+	if code != 200 || count == 0 || count >= all {
+		t.Errorf("Expected a subset of the %v moves through I6, got %v (code %v)", all, count, code)
+	}
+	for _, c := range covers {
+		found := false
+		for _, cover := range c {
+			if cover.Row == 8 && cover.Col == 5 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Move does not cover I6: %+v", c)
+		}
+	}
+	// A square that is occupied already is covered by no move
+	if code, count, _ := moves("H6"); code != 200 || count != 0 {
+		t.Errorf("Expected no moves through an occupied square, got %v (code %v)", count, code)
+	}
+	if code, _, _ := moves("Z99"); code != 400 {
+		t.Errorf("An invalid anchor square should be rejected, got %v", code)
+	}
+}
+
+func TestNormalizedLookups(t *testing.T) {
+	cases := []struct {
+		dawg  *Dawg
+		word  string
+		found string
+	}{
+		{IcelandicDictionary, "Hús", "hús"},
+		{IcelandicDictionary, "HU\u0301S", "hús"},
+		{OspsDictionary, "ŻÓŁW", "żółw"},
+		{OspsDictionary, "z\u0307o\u0301łw", "żółw"},
+		{OspsDictionary, "GE\u0328Ś", "gęś"},
+		{NorwegianBokmålDictionary, "BLÅBÆR", "blåbær"},
+		{NorwegianBokmålDictionary, "bla\u030Abær", "blåbær"},
+		{NorwegianBokmålDictionary, "Ørret", "ørret"},
+	}
+	for _, c := range cases {
+		normalized, err := c.dawg.Alphabet().Normalize(c.word)
+		if err != nil || normalized != c.found {
+			t.Errorf("Normalize(%q) returned %q, %v; expected %q", c.word, normalized, err, c.found)
+		}
+		if !c.dawg.Find(c.word) {
+			t.Errorf("Did not find %q", c.word)
+		}
+		// FindRaw does not normalize
+		if c.dawg.FindRaw(c.word) {
+			t.Errorf("FindRaw should not find %q", c.word)
+		}
+	}
+	// Runes outside the alphabet are rejected
+	for _, word := range []string{"hús1", "wax", "a?"} {
+		if _, err := IcelandicDictionary.Alphabet().Normalize(word); err == nil {
+			t.Errorf("Normalize(%q) should fail", word)
+		}
+	}
+	if IcelandicDictionary.Find("CAT") {
+		t.Errorf("Found a word with letters outside the alphabet")
+	}
+	// Patterns and racks are normalized, keeping their wildcards
+	if words := IcelandicDictionary.Match("HU\u0301?"); !slices.Contains(words, "hús") {
+		t.Errorf("Match of a decomposed pattern did not find 'hús': %v", words)
+	}
+	if words := IcelandicDictionary.MatchWithLimit("HU\u0301?", 1); !slices.Contains(words, "hús") {
+		t.Errorf("MatchWithLimit of a decomposed pattern did not find 'hús': %v", words)
+	}
+	if words := IcelandicDictionary.MatchWithLimit("h1?", 1); len(words) != 0 {
+		t.Errorf("MatchWithLimit of an invalid pattern should find nothing: %v", words)
+	}
+	if words := OspsDictionary.Permute("WŁÓŻ", 4); !slices.Contains(words, "żółw") {
+		t.Errorf("Permute of an uppercase rack did not find 'żółw': %v", words)
+	}
+	if words := OspsDictionary.Anagrams("WŁO\u0301Ż", 4); !slices.Contains(words, "żółw") {
+		t.Errorf("Anagrams of an uppercase, decomposed rack did not find 'żółw': %v", words)
+	}
+	if words := IcelandicDictionary.Anagrams("HU\u0301S", 3); !slices.Equal(words, IcelandicDictionary.Anagrams("hús", 3)) {
+		t.Errorf("Anagrams of a decomposed rack differ: %v", words)
+	}
+	// The /wordcheck endpoint normalizes the words it is given
+	w := httptest.NewRecorder()
+	HandleWordCheckRequest(w, WordCheckRequest{
+		Locale: "nb_NO",
+		Word:   "BLÅBÆR",
+		Words:  []string{"BLÅBÆR", "bla\u030Abær"},
+	})
+	var result struct {
+		Ok    bool             `json:"ok"`
+		Valid [][2]interface{} `json:"valid"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to decode wordcheck response: %v", err)
+		return
+	}
+	if !result.Ok || len(result.Valid) != 2 || result.Valid[1][0] != "blåbær" {
+		t.Errorf("Unexpected wordcheck response: %+v", result)
+	}
+}
+
+func TestRackOrderPreserved(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	game.ForceRack(1, "")
+	if !game.ForceRack(0, "keirásn") || !game.Racks[1].Fill(game.Bag) {
+		t.Fatalf("Unable to force racks")
+	}
+	// Rearrange the rack as a player might do
+	if !game.Racks[0].MoveTile(6, 0) || game.Racks[0].MoveTile(7, 0) {
+		t.Errorf("MoveTile did not check its slot indices")
+	}
+	if layout := string(game.RackLayout(0)); layout != "neirásk" {
+		t.Errorf("Unexpected rack layout after MoveTile: %v", layout)
+	}
+	move, err := ParseMoveNotation(game, "H7 RÁS")
+	if err != nil {
+		t.Fatalf("Unable to parse move: %v", err)
+	}
+	// Applying the move leaves gaps in the rack where the tiles were
+	clone := game.Clone()
+	if !move.Apply(clone) {
+		t.Fatalf("Unable to apply move")
+	}
+	if layout := clone.RackLayout(0); !slices.Equal(layout, []rune{'n', 'e', 'i', 0, 0, 0, 'k'}) {
+		t.Errorf("Unexpected rack layout after the move: %q", layout)
+	}
+	if !slices.Equal(clone.Racks[0].Emptied, []int{3, 4, 5}) {
+		t.Errorf("Unexpected emptied slots: %v", clone.Racks[0].Emptied)
+	}
+	// ...which are refilled, while the 4 other tiles stay in their slots
+	if !game.Apply(move) {
+		t.Fatalf("Unable to apply move")
+	}
+	layout := game.RackLayout(0)
+	for i, r := range map[int]rune{0: 'n', 1: 'e', 2: 'i', 6: 'k'} {
+		if layout[i] != r {
+			t.Errorf("Expected '%c' in slot %v, got %q", r, i, layout)
+		}
+	}
+	if slices.Contains(layout, 0) || len(game.Racks[0].Emptied) != 0 {
+		t.Errorf("The rack was not refilled: %q", layout)
+	}
+	// An exchange also keeps the untouched tiles in their slots
+	if !game.Apply(NewPassMove()) {
+		t.Fatalf("Unable to pass")
+	}
+	// Exchange two tiles whose letters occur only once in the rack
+	kept := make([]int, 0, len(layout))
+	exchanged := make([]rune, 0, 2)
+	for i, r := range layout {
+		if len(exchanged) < 2 && strings.Count(string(layout), string(r)) == 1 {
+			exchanged = append(exchanged, r)
+		} else {
+			kept = append(kept, i)
+		}
+	}
+	if !game.Apply(NewExchangeMove(string(exchanged))) {
+		t.Fatalf("Unable to exchange %v", string(exchanged))
+	}
+	after := game.RackLayout(0)
+	for _, i := range kept {
+		if after[i] != layout[i] {
+			t.Errorf("Slot %v changed in an exchange: %q -> %q", i, layout, after)
+		}
+	}
+	// Shuffling keeps the tiles and the gaps
+	rack := NewRack([]rune("abd"), game.TileSet)
+	rack.Shuffle(rand.New(rand.NewSource(1)))
+	shuffled := rack.Layout()
+	if !slices.Equal(shuffled[3:], []rune{0, 0, 0, 0}) {
+		t.Errorf("Shuffle moved the gaps: %q", shuffled)
+	}
+	slices.Sort(shuffled)
+	if string(shuffled[4:]) != "abd" {
+		t.Errorf("Shuffle changed the tiles: %q", shuffled)
+	}
+}
+
+func TestDeterministicMoveOrder(t *testing.T) {
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	rows[8] = ".......o......."
+	respond := func() []byte {
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, MovesRequest{
+			Locale:    "en_US",
+			BoardType: "standard",
+			Board:     rows,
+			Rack:      "aeeinst",
+		})
+		if w.Code != 200 {
+			t.Fatalf("Moves request failed with code %v", w.Code)
+		}
+		return w.Body.Bytes()
+	}
+	first := respond()
+	for i := 0; i < 3; i++ {
+		if !bytes.Equal(respond(), first) {
+			t.Fatalf("The moves came out in a different order on repeated requests")
+		}
+	}
+	// Sorting the generated moves with byScore gives the same order
+	// regardless of the order in which they were generated
+	game := NewOtcwlGame("standard")
+	game.ForceRack(0, "aeeinst")
+	state := game.State()
+	sorted := func(moves []Move) string {
+		sort.Sort(byScore{state, moves})
+		var sb strings.Builder
+		for _, move := range moves {
+			sb.WriteString(fmt.Sprintf("%v ", move))
+		}
+		return sb.String()
+	}
+	moves := state.GenerateMoves()
+	expected := sorted(slices.Clone(moves))
+	rand.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+	if sorted(moves) != expected {
+		t.Errorf("The order of equal-scoring moves depends on the order of generation")
+	}
+}
+
+func TestBoardValidate(t *testing.T) {
+	validate := func(rows ...string) (bool, []string) {
+		t.Helper()
+		board := make([]string, BoardSize)
+		for i := range board {
+			board[i] = strings.Repeat(".", BoardSize)
+		}
+		copy(board[6:], rows)
+		var b Board
+		b.Init("standard")
+		if err := b.FromStrings(board, NewEnglishTileSet); err != nil {
+			t.Fatalf("Unable to set up board: %v", err)
+		}
+		return b.Validate(OtcwlDictionary)
+	}
+	if valid, invalid := validate(); !valid || len(invalid) != 0 {
+		t.Errorf("An empty board should be valid")
+	}
+	// A good board, including a blank tile
+	if valid, invalid := validate(
+		".......a.......",
+		".....cAt.......",
+		".......e.......",
+	); !valid || len(invalid) != 0 {
+		t.Errorf("Expected a valid board, got %v", invalid)
+	}
+	// A disconnected board, where all the words are valid
+	if valid, invalid := validate(
+		"...........ox..",
+		".....cat.......",
+	); valid || len(invalid) != 0 {
+		t.Errorf("A disconnected board should be invalid, got %v %v", valid, invalid)
+	}
+	// A board that does not cover the start square
+	if valid, _ := validate(
+		"...............",
+		"........cat....",
+	); valid {
+		t.Errorf("A board not covering the start square should be invalid")
+	}
+	// A single tile on the start square is not a word
+	if valid, _ := validate(
+		"...............",
+		".......a.......",
+	); valid {
+		t.Errorf("A single tile should be invalid")
+	}
+	// A board with bogus words in both directions
+	valid, invalid := validate(
+		".......x.......",
+		".....cqt.......",
+	)
+	if valid || !slices.Equal(invalid, []string{"cqt", "xt"}) {
+		t.Errorf("Expected bogus words to be found, got %v %v", valid, invalid)
+	}
+}
+
+func TestApplyRequest(t *testing.T) {
+	empty := make([]string, BoardSize)
+	for i := range empty {
+		empty[i] = strings.Repeat(".", BoardSize)
+	}
+	rows := slices.Clone(empty)
+	rows[7] = ".....cat......."
+	apply := func(board []string, covers []CoverJson) (*httptest.ResponseRecorder, ApplyHeaderJson) {
+		w := httptest.NewRecorder()
+		HandleApplyRequest(w, ApplyRequest{
+			MovesRequest: MovesRequest{
+				Locale:    "en_US",
+				BoardType: "standard",
+				Board:     board,
+				Rack:      "aeinrs?",
+			},
+			Covers: covers,
+		})
+		var result ApplyHeaderJson
+		if w.Code == 200 {
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Unable to decode apply response: %v", err)
+			}
+		}
+		return w, result
+	}
+	// retsina down from E5, with a blank as the 't', forming "scat"
+	covers := make([]CoverJson, 0, RackSize)
+	for i, letter := range "re?sina" {
+		cj := CoverJson{Row: 4 + i, Col: 4, Letter: string(letter)}
+		if letter == '?' {
+			cj.Meaning = "t"
+		}
+		covers = append(covers, cj)
+	}
+	_, result := apply(rows, covers)
+	if !result.Ok || result.Score != 80 || !result.Bingo ||
+		!slices.Equal(result.Words, []string{"retsina", "scat"}) {
+		t.Errorf("Unexpected result for a valid move: %+v", result)
+	}
+	if len(result.Board) != BoardSize || result.Board[6] != "....T.........." ||
+		result.Board[7] != "....scat......." {
+		t.Errorf("Unexpected board after the move: %v", result.Board)
+	}
+	// A first move on an empty board must cover the start square
+	first := []CoverJson{{Row: 7, Col: 7, Letter: "a"}, {Row: 7, Col: 8, Letter: "s"}}
+	if _, result := apply(empty, first); !result.Ok || result.Bingo || result.Score != 4 ||
+		result.Board[7] != ".......as......" {
+		t.Errorf("Unexpected result for a valid first move: %+v", result)
+	}
+	first[0].Col, first[1].Col = 9, 10
+	if _, result := apply(empty, first); result.Ok || result.Error == nil ||
+		result.Error.Code != FirstMoveMustCoverStart || result.Board != nil {
+		t.Errorf("Expected a start square error: %+v", result)
+	}
+	// A word that is not in the dictionary
+	bogus := []CoverJson{{Row: 8, Col: 5, Letter: "n"}, {Row: 8, Col: 6, Letter: "r"}}
+	if _, result := apply(rows, bogus); result.Ok || result.Error == nil ||
+		result.Error.Code != WordNotInDictionary {
+		t.Errorf("Expected an invalid word error: %+v", result)
+	}
+	// A move that does not touch the tiles on the board
+	disconnected := []CoverJson{{Row: 1, Col: 1, Letter: "a"}, {Row: 1, Col: 2, Letter: "s"}}
+	if _, result := apply(rows, disconnected); result.Ok || result.Error == nil ||
+		result.Error.Code != NotConnected {
+		t.Errorf("Expected a connection error: %+v", result)
+	}
+	// A cover on an occupied square
+	occupied := []CoverJson{{Row: 7, Col: 5, Letter: "a"}, {Row: 7, Col: 4, Letter: "s"}}
+	if _, result := apply(rows, occupied); result.Ok || result.Error == nil ||
+		result.Error.Code != SquareOccupied {
+		t.Errorf("Expected an occupied square error: %+v", result)
+	}
+	// Only a blank tile may be given a meaning other than its letter
+	mismatch := []CoverJson{{Row: 7, Col: 7, Letter: "s", Meaning: "a"}, {Row: 7, Col: 8, Letter: "n", Meaning: "t"}}
+	if w, _ := apply(empty, mismatch); w.Code != 400 {
+		t.Errorf("Expected 400 for tiles meaning other letters, got %v", w.Code)
+	}
+	// A meaning that repeats the letter, as in /moves responses, is accepted
+	first = []CoverJson{{Row: 7, Col: 7, Letter: "a", Meaning: "a"}, {Row: 7, Col: 8, Letter: "s", Meaning: "s"}}
+	if _, result := apply(empty, first); !result.Ok || result.Score != 4 {
+		t.Errorf("Unexpected result for covers with their meanings: %+v", result)
+	}
+}
+
+func TestDecomposedInput(t *testing.T) {
+	if s := normalizeForLocale("A\u030Are og he\u0301r"); s != "Åre og hér" {
+		t.Errorf("Unexpected normalization: %q", s)
+	}
+	if s := normalizeForLocale("plain"); s != "plain" {
+		t.Errorf("Unexpected normalization: %q", s)
+	}
+	// A rack with a decomposed 'å'
+	rack := NewRack([]rune("bla\u030Abær"), NorwegianTileSet)
+	if rack == nil || rack.AsString() != "blåbær" {
+		t.Errorf("Unexpected rack from decomposed letters: %v", rack)
+	}
+	// A moves request with a decomposed rack finds the composed word
+	empty := make([]string, BoardSize)
+	for i := range empty {
+		empty[i] = strings.Repeat(".", BoardSize)
+	}
+	found := func(req MovesRequest, word string) bool {
+		t.Helper()
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, req)
+		if w.Code != 200 {
+			t.Errorf("Moves request failed with code %v: %v", w.Code, w.Body.String())
+			return false
+		}
+		var result struct {
+			Moves []struct {
+				Word string `json:"w"`
+			} `json:"moves"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Errorf("Unable to decode moves response: %v", err)
+			return false
+		}
+		for _, move := range result.Moves {
+			if move.Word == word {
+				return true
+			}
+		}
+		return false
+	}
+	if !found(MovesRequest{
+		Locale:    "nb_NO",
+		BoardType: "standard",
+		Board:     empty,
+		Rack:      "bla\u030Abær",
+	}, "blåbær") {
+		t.Errorf("Did not find 'blåbær' with a decomposed rack")
+	}
+	// ...and a board with a decomposed 'é'
+	rows := slices.Clone(empty)
+	rows[7] = "......he\u0301r......"
+	if !found(MovesRequest{
+		Locale:    "is_IS",
+		BoardType: "standard",
+		Board:     rows,
+		Rack:      "e\u0301gfæst",
+	}, "ég") {
+		t.Errorf("Did not find 'ég' with a decomposed rack and board")
+	}
+	// The /wordcheck endpoint accepts decomposed words
+	w := httptest.NewRecorder()
+	HandleWordCheckRequest(w, WordCheckRequest{
+		Locale: "is_IS",
+		Word:   "he\u0301r",
+		Words:  []string{"he\u0301r", "e\u0301g"},
+	})
+	var result struct {
+		Ok bool `json:"ok"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil || !result.Ok {
+		t.Errorf("Expected decomposed words to be valid: %v %v", result, err)
+	}
+}
+
+func TestLazyDictionaries(t *testing.T) {
+	dawg := makeDawg("otcwl2014.bin.dawg", EnglishAlphabet)
+	if dawg.b != nil {
+		t.Errorf("The dictionary should not be loaded before it is used")
+	}
+	if !dawg.Find("cat") || dawg.b == nil {
+		t.Errorf("The dictionary should be loaded on first use")
+	}
+	// Iteration loads a dictionary on first use as well
+	if words := makeDawg("otcwl2014.bin.dawg", EnglishAlphabet).WordsWithPrefix("zyz", 0); len(words) == 0 {
+		t.Errorf("Expected words from a dictionary that was not loaded")
+	}
+	if GetOspsDictionary().b == nil {
+		t.Errorf("GetOspsDictionary() should load the dictionary")
+	}
+	if err := PreloadLocales([]string{"nn", "xx"}); err == nil {
+		t.Errorf("Expected an error for an unknown locale")
+	}
+	if NorwegianNynorskDictionary.b == nil {
+		t.Errorf("PreloadLocales() should load the dictionary")
+	}
+	// A dictionary backed by a memory-mapped file
+	mapped, err := NewDawgFromMappedFile(filepath.Join("dicts", "otcwl2014.bin.dawg"), EnglishAlphabet)
+	if err != nil {
+		t.Fatalf("Unable to map dictionary: %v", err)
+	}
+	if !mapped.Find("cat") || mapped.Find("cxt") || mapped.WordCount() != OtcwlDictionary.WordCount() {
+		t.Errorf("The mapped dictionary does not match the embedded one")
+	}
+	if _, err := NewDawgFromMappedFile("no-such-file.dawg", EnglishAlphabet); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func BenchmarkLoadDictionaries(b *testing.B) {
+	files := map[string]string{
+		"ordalisti.bin.dawg":   IcelandicAlphabet,
+		"otcwl2014.bin.dawg":   EnglishAlphabet,
+		"sowpods.bin.dawg":     EnglishAlphabet,
+		"osps37.bin.dawg":      PolishAlphabet,
+		"nsf2023.bin.dawg":     NorwegianAlphabet,
+		"nynorsk2024.bin.dawg": NorwegianAlphabet,
+	}
+	// Loading all the dictionaries, as was done at startup
+	b.Run("Eager", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for fileName, alphabet := range files {
+				makeDawg(fileName, alphabet).bytes()
+			}
+		}
+	})
+	// Creating the dictionaries, to be loaded on first use
+	b.Run("Lazy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for fileName, alphabet := range files {
+				makeDawg(fileName, alphabet)
+			}
+		}
+	})
+}
+
+func TestMovesRequestFilters(t *testing.T) {
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	type moveJson struct {
+		Word   string      `json:"w"`
+		Score  int         `json:"sc"`
+		Covers []CoverJson `json:"covers"`
+	}
+	// Returns the status code, the moves and the count of the response
+	moves := func(req MovesRequest) (int, []moveJson, int) {
+		t.Helper()
+		req.Locale = "en_US"
+		req.BoardType = "standard"
+		req.Board = rows
+		req.Rack = "aeinrst"
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, req)
+		if w.Code != 200 {
+			return w.Code, nil, 0
+		}
+		var result struct {
+			Count int        `json:"count"`
+			Moves []moveJson `json:"moves"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Unable to decode moves response: %v", err)
+		}
+		if req.Limit == 0 && result.Count != len(result.Moves) {
+			t.Errorf("Count %v does not match the %v moves", result.Count, len(result.Moves))
+		}
+		return w.Code, result.Moves, result.Count
+	}
+	_, all, _ := moves(MovesRequest{})
+	check := func(name string, req MovesRequest, pass func(m moveJson) bool) int {
+		t.Helper()
+		code, filtered, _ := moves(req)
+		if code != 200 || len(filtered) == 0 || len(filtered) >= len(all) {
+			t.Errorf("%v: expected a subset of the %v moves, got %v (code %v)",
+				name, len(all), len(filtered), code)
+		}
+		for _, m := range filtered {
+			if !pass(m) {
+				t.Errorf("%v: move %v should have been filtered out", name, m.Word)
+			}
+		}
+		return len(filtered)
+	}
+	length := func(m moveJson) int { return len([]rune(m.Word)) }
+	check("min_length", MovesRequest{MinLength: 5}, func(m moveJson) bool {
+		return length(m) >= 5
+	})
+	check("max_length", MovesRequest{MaxLength: 3}, func(m moveJson) bool {
+		return length(m) <= 3
+	})
+	check("length range", MovesRequest{MinLength: 4, MaxLength: 5}, func(m moveJson) bool {
+		return length(m) >= 4 && length(m) <= 5
+	})
+	// The 'a' of "cat" is at row 7, column 6: moves through it play
+	// tiles both above and below it, or extend "cat"
+	check("must_include_square", MovesRequest{MustIncludeSquare: &SquareJson{7, 6}},
+		func(m moveJson) bool {
+			top, left, bottom, right := BoardSize, BoardSize, -1, -1
+			for _, c := range m.Covers {
+				top, left = min(top, c.Row), min(left, c.Col)
+				bottom, right = max(bottom, c.Row), max(right, c.Col)
+			}
+			return top <= 7 && bottom >= 7 && left <= 6 && right >= 6
+		})
+	bingos := check("only_bingos", MovesRequest{OnlyBingos: true}, func(m moveJson) bool {
+		return len(m.Covers) == RackSize
+	})
+	check("min_score", MovesRequest{MinScore: 30}, func(m moveJson) bool {
+		return m.Score >= 30
+	})
+	// All the filters at once
+	combined := check("combined", MovesRequest{
+		OnlyBingos:        true,
+		MinLength:         8,
+		MaxLength:         BoardSize,
+		MinScore:          60,
+		MustIncludeSquare: &SquareJson{7, 5},
+	}, func(m moveJson) bool {
+		return len(m.Covers) == RackSize && length(m) >= 8 && m.Score >= 60
+	})
+	if combined > bingos {
+		t.Errorf("Combining filters should not add moves")
+	}
+	// The same filters, decoded from a request in its JSON form
+	var req MovesRequest
+	raw := `{"only_bingos": true, "min_length": 8, "max_length": 15,
+		"min_score": 60, "must_include_square": {"row": 7, "col": 5}}`
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		t.Fatalf("Unable to decode request: %v", err)
+	}
+	if !req.OnlyBingos || req.MinLength != 8 || req.MaxLength != 15 || req.MinScore != 60 ||
+		req.MustIncludeSquare == nil || *req.MustIncludeSquare != (SquareJson{7, 5}) {
+		t.Errorf("Filters not decoded from JSON: %+v", req)
+	}
+	if _, decoded, _ := moves(req); len(decoded) != combined {
+		t.Errorf("Expected %v moves from the decoded request, got %v", combined, len(decoded))
+	}
+	// The limit applies after the filters, and the count
+	// is the total number of moves passing the filters
+	if _, limited, count := moves(MovesRequest{OnlyBingos: true, Limit: 2}); len(limited) != 2 ||
+		len(limited[1].Covers) != RackSize || count != bingos {
+		t.Errorf("Expected the two best of %v bingos, got %v of %v", bingos, limited, count)
+	}
+	if _, limited, count := moves(MovesRequest{Limit: 2}); len(limited) != 2 || count != len(all) {
+		t.Errorf("Expected two of %v moves, got %v of %v", len(all), len(limited), count)
+	}
+	if code, _, _ := moves(MovesRequest{MustIncludeSquare: &SquareJson{BoardSize, 0}}); code != 400 {
+		t.Errorf("An invalid square should be rejected, got %v", code)
+	}
+}
+
+func TestDecodeEmbeddingRequests(t *testing.T) {
+	// The request types that embed MovesRequest are decoded from raw
+	// JSON bodies, as the HTTP handlers in main do, and must keep
+	// their own fields as well as the embedded ones
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	board, _ := json.Marshal(rows)
+	common := fmt.Sprintf(`"locale": "en_US", "board_type": "standard",
+		"board": %s, "rack": "aeinrst", "min_score": 5`, board)
+	decode := func(body string, req interface{}) {
+		t.Helper()
+		if err := json.NewDecoder(strings.NewReader("{" + common + ", " + body + "}")).Decode(req); err != nil {
+			t.Fatalf("Unable to decode request: %v", err)
+		}
+	}
+	checkEmbedded := func(name string, req MovesRequest) {
+		t.Helper()
+		if req.Locale != "en_US" || req.BoardType != "standard" || len(req.Board) != BoardSize ||
+			req.Rack != "aeinrst" || req.MinScore != 5 {
+			t.Errorf("%v: embedded fields not decoded: %+v", name, req)
+		}
+	}
+	handle := func(name string, handler func(w http.ResponseWriter), result interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler(w)
+		if w.Code != 200 {
+			t.Errorf("%v: unexpected status %v: %v", name, w.Code, w.Body.String())
+			return
+		}
+		if err := json.NewDecoder(w.Body).Decode(result); err != nil {
+			t.Errorf("%v: unable to decode response: %v", name, err)
+		}
+	}
+	// The covers of the move H5 scat
+	const covers = `"covers": [{"row": 7, "col": 4, "letter": "s"}]`
+
+	var exchange ExchangeRequest
+	decode(`"leaves": {"s": 8.5}`, &exchange)
+	checkEmbedded("exchange", exchange.MovesRequest)
+	if exchange.Leaves["s"] != 8.5 {
+		t.Errorf("exchange: leaves not decoded: %+v", exchange.Leaves)
+	}
+	var exchangeResult ExchangeHeaderJson
+	handle("exchange", func(w http.ResponseWriter) { HandleExchangeRequest(w, exchange) }, &exchangeResult)
+	if exchangeResult.Count == 0 {
+		t.Errorf("exchange: expected exchanges, got %+v", exchangeResult)
+	}
+
+	var bestMove BestMoveRequest
+	decode(`"strategy": "oneofnbest"`, &bestMove)
+	checkEmbedded("bestmove", bestMove.MovesRequest)
+	var bestMoveResult BestMoveHeaderJson
+	handle("bestmove", func(w http.ResponseWriter) { HandleBestMoveRequest(w, bestMove) }, &bestMoveResult)
+	if bestMoveResult.Strategy != "oneofnbest" || bestMoveResult.Move.Kind != "tile" {
+		t.Errorf("bestmove: unexpected response %+v", bestMoveResult)
+	}
+
+	var analyze AnalyzeRequest
+	decode(`"co": "H5", "w": "scat"`, &analyze)
+	checkEmbedded("analyze", analyze.MovesRequest)
+	var analyzeResult AnalyzeHeaderJson
+	handle("analyze", func(w http.ResponseWriter) { HandleAnalyzeRequest(w, analyze) }, &analyzeResult)
+	if !analyzeResult.Valid || analyzeResult.Score != 6 {
+		t.Errorf("analyze: unexpected response %+v", analyzeResult)
+	}
+
+	var validate ValidateRequest
+	decode(covers, &validate)
+	checkEmbedded("validate", validate.MovesRequest)
+	var validateResult ValidateHeaderJson
+	handle("validate", func(w http.ResponseWriter) { HandleValidateRequest(w, validate) }, &validateResult)
+	if !validateResult.Ok || validateResult.Score != 6 {
+		t.Errorf("validate: unexpected response %+v", validateResult)
+	}
+
+	var apply ApplyRequest
+	decode(covers, &apply)
+	checkEmbedded("apply", apply.MovesRequest)
+	var applyResult ApplyHeaderJson
+	handle("apply", func(w http.ResponseWriter) { HandleApplyRequest(w, apply) }, &applyResult)
+	if !applyResult.Ok || len(applyResult.Board) != BoardSize || applyResult.Board[7] != "....scat......." {
+		t.Errorf("apply: unexpected response %+v", applyResult)
+	}
+
+	var check CheckRequest
+	decode(`"move": {"coord": "H5", "word": "scat"}`, &check)
+	checkEmbedded("check", check.MovesRequest)
+	var checkResult CheckHeaderJson
+	handle("check", func(w http.ResponseWriter) { HandleCheckRequest(w, check) }, &checkResult)
+	if checkResult.Error != nil || checkResult.Score != 6 || checkResult.Rank == 0 {
+		t.Errorf("check: unexpected response %+v", checkResult)
+	}
+}
+
+func TestSetBagContents(t *testing.T) {
+	game := NewIcelandicGame("standard")
+	// Return the racks to the bag, then set up the bag
+	// and deal the racks from it
+	game.ForceRack(0, "")
+	game.ForceRack(1, "")
+	if err := game.SetBagContents("aaábdðeéfgrst??"); err != nil {
+		t.Fatalf("Unable to set the bag contents: %v", err)
+	}
+	if game.Bag.TileCount() != 15 {
+		t.Errorf("Expected 15 tiles in the bag, got %v", game.Bag.TileCount())
+	}
+	if !game.ForceRack(0, "aábdðe?") || !game.ForceRack(1, "aéfgrs?") {
+		t.Fatalf("Unable to force the racks from the bag")
+	}
+	expected := map[rune]int{'a': 1, 'é': 1, 'f': 1, 'g': 1, 'r': 1, 's': 1, 't': 1, '?': 1}
+	if unseen := game.UnseenTiles(0); !maps.Equal(unseen, expected) {
+		t.Errorf("Unexpected unseen tiles for player 0: %v", unseen)
+	}
+	expected = map[rune]int{'a': 1, 'á': 1, 'b': 1, 'd': 1, 'ð': 1, 'e': 1, 't': 1, '?': 1}
+	if unseen := game.UnseenTiles(1); !maps.Equal(unseen, expected) {
+		t.Errorf("Unexpected unseen tiles for player 1: %v", unseen)
+	}
+	// The next draw can only be the tile left in the bag
+	if tile := game.Bag.DrawTile(); tile == nil || tile.Letter != 't' || game.Bag.TileCount() != 0 {
+		t.Errorf("Expected to draw the last tile 't', got %v", tile)
+	}
+	// Invalid contents leave the bag unchanged
+	if err := game.SetBagContents("abc"); err == nil {
+		t.Errorf("Expected an error for a letter not in the tile set")
+	}
+	if err := game.SetBagContents("?"); err == nil {
+		t.Errorf("Expected an error for a blank, as both are in the racks")
+	}
+	if game.Bag.TileCount() != 0 {
+		t.Errorf("The bag should be unchanged after an error")
+	}
+	// There are 11 tiles of 'a' in the Icelandic tile set, two
+	// of which are in the racks
+	if err := game.SetBagContents(strings.Repeat("a", 9)); err != nil {
+		t.Errorf("Unable to put the remaining 'a' tiles in the bag: %v", err)
+	}
+	if err := game.SetBagContents(strings.Repeat("a", 10)); err == nil {
+		t.Errorf("Expected an error for too many 'a' tiles")
+	}
+}
+
+func TestCrossWordScoring(t *testing.T) {
+	// Lay out words at the given coordinates in parseMove notation,
+	// i.e. "H8" is horizontal and "8H" vertical. A '?' makes the
+	// following letter a blank.
+	layout := func(coord, word string, f func(row, col int, letter, meaning rune)) {
+		row, col, horizontal, ok := parseCoordinate(coord)
+		if !ok {
+			t.Fatalf("Invalid coordinate %v", coord)
+		}
+		runes := []rune(word)
+		for i := 0; i < len(runes); i++ {
+			letter, meaning := runes[i], runes[i]
+			if letter == '?' {
+				i++
+				meaning = runes[i]
+			}
+			f(row, col, letter, meaning)
+			if horizontal {
+				col++
+			} else {
+				row++
+			}
+		}
+	}
+	tileSet := EnglishTileSet
+	cases := []struct {
+		boardType string
+		board     []string // Words already on the board
+		move      string   // Letters already on the board are not covered
+		expected  int
+	}{
+		// No premiums in play: cats (3+1+1+1) and ads (a on a TL: 3+2+1)
+		{"standard", []string{"H7 cat"}, "10F ads", 12},
+		// The existing word covers the center DW, which does not count
+		// again: s+cat+ter with the r on a DL, and re as a cross word
+		{"standard", []string{"H7 cat", "I12 e"}, "H6 scatter", 13},
+		// A cover on a DW that also forms a cross word, fox:
+		// (1+4)*2 for if, and (4+1+8)*2 for fox
+		{"standard", []string{"5F ox"}, "E4 if", 36},
+		// A cover on a TL that also forms a cross word, ad:
+		// 10+1*3 for za, and 1*3+2 for ad
+		{"standard", []string{"G6 do"}, "F5 za", 18},
+		// As above, with a blank z
+		{"standard", []string{"G6 do"}, "F5 ?za", 8},
+		// A first-move bingo over the center DW, with the i on a DL:
+		// (1+1+1+1+1*2+1+1)*2 + 50
+		{"standard", nil, "H8 retains", 66},
+		// The existing word covers the center DW: cats (3+1+1+1)
+		{"explo", []string{"H7 cat"}, "H7 cats", 6},
+		// A cover on a TL, and ex as a cross word: 1*3+8 for ax,
+		// and 1+8 for ex
+		{"explo", []string{"F4 e"}, "G3 ax", 20},
+		// A cover on a DW that also forms a cross word, it:
+		// (10+1)*2 for qi, and (1+1)*2 for it
+		{"explo", []string{"F7 t"}, "6E qi", 26},
+		// Covers on a DL and a DW in the same word, the latter also
+		// forming a cross word: (3*2+1+8+1+1)*2 for boxes, (1+1)*2 for as
+		{"explo", []string{"F5 a"}, "6B boxes", 38},
+	}
+	for _, c := range cases {
+		board := NewBoard(c.boardType)
+		for _, word := range c.board {
+			fields := strings.Fields(word)
+			layout(fields[0], fields[1], func(row, col int, letter, meaning rune) {
+				score, _ := tileSet.Score(letter)
+				board.PlaceTile(row, col, &Tile{Letter: letter, Meaning: meaning, Score: score})
+			})
+		}
+		covers := Covers{}
+		fields := strings.Fields(c.move)
+		layout(fields[0], fields[1], func(row, col int, letter, meaning rune) {
+			if sq := board.Sq(row, col); sq.Tile == nil {
+				covers[Coordinate{row, col}] = Cover{letter, meaning}
+			} else if sq.Tile.Meaning != meaning {
+				t.Fatalf("Move %v does not match the board at %v,%v", c.move, row, col)
+			}
+		})
+		state := NewState(GetOtcwlDictionary(), tileSet, board, NewRack([]rune("aeinrst"), tileSet), false)
+		move := NewUncheckedTileMove(board, covers)
+		if score := move.Score(state); score != c.expected {
+			t.Errorf("Expected %v on the %v board to score %v, got %v",
+				c.move, c.boardType, c.expected, score)
+		}
+		if total := move.ScoreBreakdown(state).Total; total != c.expected {
+			t.Errorf("Expected the breakdown of %v on the %v board to total %v, got %v",
+				c.move, c.boardType, c.expected, total)
+		}
+	}
+}
+
+func TestBoardAudit(t *testing.T) {
+	makeRows := func(rows ...string) []string {
+		board := make([]string, BoardSize)
+		for i := range board {
+			board[i] = strings.Repeat(".", BoardSize)
+		}
+		copy(board[6:], rows)
+		return board
+	}
+	audit := func(rows ...string) []BoardIssue {
+		t.Helper()
+		var b Board
+		b.Init("standard")
+		if err := b.FromStrings(makeRows(rows...), NewEnglishTileSet); err != nil {
+			t.Fatalf("Unable to set up board: %v", err)
+		}
+		return b.Audit(OtcwlDictionary, NewEnglishTileSet)
+	}
+	// A good board, including a blank tile
+	if issues := audit(
+		".......a.......",
+		".....cAt.......",
+		".......e.......",
+	); len(issues) != 0 {
+		t.Errorf("Expected no issues, got %v", issues)
+	}
+	// An island of tiles
+	issues := audit(
+		"...........ox..",
+		".....cat.......",
+	)
+	if len(issues) != 1 || issues[0].Kind != Disconnected ||
+		!slices.Equal(issues[0].Squares, []string{"G12", "G13"}) {
+		t.Errorf("Expected the group at G12 to be disconnected, got %v", issues)
+	}
+	// No tile on the start square: all groups are disconnected
+	issues = audit(
+		"..cat..........",
+		"...........ox..",
+	)
+	if len(issues) != 2 || issues[0].Kind != Disconnected || len(issues[0].Squares) != 3 ||
+		issues[1].Kind != Disconnected || len(issues[1].Squares) != 2 {
+		t.Errorf("Expected two disconnected groups, got %v", issues)
+	}
+	// A word that is not in the dictionary
+	issues = audit(
+		".......a.......",
+		".....cxt.......",
+	)
+	if len(issues) != 1 || issues[0].Kind != UnknownWord || issues[0].Word != "cxt" ||
+		!slices.Equal(issues[0].Squares, []string{"H6", "H7", "H8"}) {
+		t.Errorf("Expected cxt to be an unknown word, got %v", issues)
+	}
+	// More tiles of a letter than the tile set has,
+	// in a word that is in the dictionary
+	issues = audit("...............", ".......zzz.....")
+	if len(issues) != 1 || issues[0].Kind != TooManyTiles || issues[0].Letter != "z" {
+		t.Errorf("Expected too many z tiles, got %v", issues)
+	}
+	// Blank tiles count as '?', not as the letter they stand for
+	issues = audit("...............", ".......ZZZ.....")
+	if len(issues) != 1 || issues[0].Kind != TooManyTiles || issues[0].Letter != "?" {
+		t.Errorf("Expected too many blank tiles, got %v", issues)
+	}
+	// All kinds of issues at once
+	issues = audit(
+		"zz.............",
+		".......zqz.....",
+	)
+	kinds := make([]BoardIssueKind, len(issues))
+	for i, issue := range issues {
+		kinds[i] = issue.Kind
+	}
+	if !slices.Equal(kinds, []BoardIssueKind{Disconnected, UnknownWord, UnknownWord, TooManyTiles}) {
+		t.Errorf("Unexpected issues: %v", issues)
+	}
+	// The /moves service rejects a board that fails the audit,
+	// but only if the request asks for the audit
+	request := func(audit bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, MovesRequest{
+			Locale:    "en_US",
+			BoardType: "standard",
+			Board:     makeRows(".......a.......", ".....cxt......."),
+			Rack:      "aeinrst",
+			Audit:     audit,
+		})
+		return w
+	}
+	if w := request(false); w.Code != 200 {
+		t.Errorf("Expected status 200 without an audit, got %v", w.Code)
+	}
+	w := request(true)
+	var result AuditJson
+	if w.Code != 400 {
+		t.Errorf("Expected status 400 with an audit, got %v", w.Code)
+	} else if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Errorf("Unable to decode the audit response: %v", err)
+	} else if len(result.Issues) != 1 || result.Issues[0].Word != "cxt" {
+		t.Errorf("Unexpected audit issues: %v", result.Issues)
+	}
+}
+
+func TestRackLeaveAndContains(t *testing.T) {
+	rack := NewRack([]rune("essat?s"), NewEnglishTileSet)
+	for _, test := range []struct {
+		letters  string
+		contains bool
+		leave    string
+	}{
+		{"", true, "?aessst"},
+		{"sat", true, "?ess"},
+		{"sss", true, "?aet"},
+		// Only three s tiles, and the blank does not stand in for a fourth
+		{"ssss", false, "?aet"},
+		{"x", false, "?aessst"},
+		{"?", true, "aessst"},
+		{"s?e", true, "asst"},
+		{"??", false, "aessst"},
+		{"essat?s", true, ""},
+	} {
+		letters := []rune(test.letters)
+		if contains := rack.Contains(letters); contains != test.contains {
+			t.Errorf("Expected Contains(%v) to be %v", test.letters, test.contains)
+		}
+		if leave := rack.Leave(letters); leave != test.leave {
+			t.Errorf("Expected Leave(%v) to be '%v', got '%v'", test.letters, test.leave, leave)
+		}
+	}
+	// The leave is a LeaveTable key
+	if leave := rack.Leave([]rune("sat")); leave != LeaveKey([]rune("s?se")) {
+		t.Errorf("Expected the leave to be a LeaveTable key, got '%v'", leave)
+	}
+	// The rack is not modified
+	if rack.AsString() != "essat?s" {
+		t.Errorf("The rack should be unchanged, got %v", rack.AsString())
+	}
+}
+
+func TestCheckRequest(t *testing.T) {
+	rows := make([]string, BoardSize)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", BoardSize)
+	}
+	rows[7] = ".....cat......."
+	check := func(coord, word string) CheckHeaderJson {
+		t.Helper()
+		w := httptest.NewRecorder()
+		HandleCheckRequest(w, CheckRequest{
+			MovesRequest: MovesRequest{
+				Locale:    "en_US",
+				BoardType: "standard",
+				Board:     rows,
+				Rack:      "aeinrst",
+			},
+			Move: CheckMoveJson{Coord: coord, Word: word},
+		})
+		var result CheckHeaderJson
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Unable to decode the check response: %v", err)
+		}
+		return result
+	}
+	// Find the best move with the dictionary and tile set of the locale
+	dawg, tileSet := decodeLocale("en_US", "standard")
+	state := NewState(
+		dawg, tileSet, NewBoard("standard"),
+		NewRack([]rune("aeinrst"), tileSet), false,
+	)
+	if err := state.Board.FromStrings(rows, tileSet); err != nil {
+		t.Fatalf("Unable to set up board: %v", err)
+	}
+	best := state.BestMoves(1)[0]
+	// The best move is correct
+	fields := strings.Fields(fmt.Sprint(best.Move))
+	result := check(fields[0], fields[1])
+	if !result.Correct || result.Rank != 1 || result.Score != best.Score ||
+		result.BestScore != best.Score || result.Error != nil {
+		t.Errorf("Expected %v to be correct, got %+v", best.Move, result)
+	}
+	// A valid move that is not the best one: 1 for the a on the board,
+	// and 1*2 for the t on a DL
+	result = check("7H", "at")
+	if result.Correct || result.Rank <= 1 || result.Score != 3 ||
+		result.BestScore != best.Score || result.Error != nil {
+		t.Errorf("Expected 7H at to be valid but not correct, got %+v", result)
+	}
+	// Moves that are not valid
+	for _, move := range [][2]string{
+		{"7H", "arst"}, // Not a word
+		{"7H", "az"},   // Not in the rack
+		{"Q7", "at"},   // Not a coordinate
+	} {
+		result = check(move[0], move[1])
+		if result.Correct || result.Rank != 0 || result.Error == nil || result.BestScore != best.Score {
+			t.Errorf("Expected %v %v to be invalid, got %+v", move[0], move[1], result)
+		}
+	}
+}
+
+func TestUnseenTilesStateless(t *testing.T) {
+	// Bag.Distribution() counts blank tiles as '?'
+	game := NewIcelandicGameWithOptions("standard", GameOptions{RandSource: rand.NewSource(17)})
+	distribution := game.Bag.Distribution()
+	total := 0
+	for _, count := range distribution {
+		total += count
+	}
+	if total != game.Bag.TileCount() {
+		t.Errorf("The distribution has %v tiles, the bag %v", total, game.Bag.TileCount())
+	}
+	blanks := distribution['?']
+	for _, rack := range game.Racks {
+		blanks += strings.Count(rack.AsString(), "?")
+	}
+	if blanks != 2 {
+		t.Errorf("Expected 2 blank tiles in the bag and racks, got %v", blanks)
+	}
+	// Compare the unseen tiles of the stateful game with those
+	// returned by the stateless /moves service, in each position of
+	// a robot game, including positions with blank tiles on the board
+	robot := NewHighScoreRobot()
+	blankOnBoard := false
+	for !game.IsOver() {
+		player := game.PlayerToMove()
+		w := httptest.NewRecorder()
+		HandleMovesRequest(w, MovesRequest{
+			Locale:    "is",
+			BoardType: "standard",
+			Board:     game.Board.ToStrings(),
+			Rack:      game.Racks[player].AsString(),
+			Limit:     1,
+			Unseen:    true,
+		})
+		var result HeaderJson
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Unable to decode the moves response: %v", err)
+		}
+		expected := make(map[string]int)
+		for letter, count := range game.UnseenTiles(player) {
+			expected[string(letter)] = count
+		}
+		if !maps.Equal(result.Unseen, expected) {
+			t.Fatalf("Unseen tiles differ after %v moves: %v, expected %v",
+				len(game.MoveList), result.Unseen, expected)
+		}
+		for _, row := range game.Board.ToStrings() {
+			blankOnBoard = blankOnBoard || strings.ToLower(row) != row
+		}
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	if !blankOnBoard {
+		t.Errorf("Expected a blank tile on the board at some point in the game")
+	}
+}
+
+func TestLocaleFallback(t *testing.T) {
+	for locale, want := range map[string]*Dawg{
+		"nb":    NorwegianBokmålDictionary,
+		"no":    NorwegianBokmålDictionary,
+		"no-NO": NorwegianBokmålDictionary,
+		"nn":    NorwegianNynorskDictionary,
+		"nn_NO": NorwegianNynorskDictionary,
+	} {
+		if dawg, _ := decodeLocale(locale, "standard"); dawg != want {
+			t.Errorf("Locale %v resolves to the wrong dictionary", locale)
+		}
+	}
+	data, err := NewGameForLocale("is", "standard").Serialize()
+	if err != nil {
+		t.Fatalf("Unable to serialize game: %v", err)
+	}
+
+	// Rebuild the built-in locales as if the Nynorsk and Icelandic
+	// dictionaries were excluded from the build
+	savedLocales, savedNynorsk, savedIcelandic := Locales, NorwegianNynorskDictionary, IcelandicDictionary
+	defer func() {
+		Locales, NorwegianNynorskDictionary, IcelandicDictionary = savedLocales, savedNynorsk, savedIcelandic
+	}()
+	NorwegianNynorskDictionary, IcelandicDictionary = nil, nil
+	Locales = newBuiltinLocales()
+
+	// Nynorsk falls back to Bokmål, in decodeLocale() and
+	// NewGameForLocale() alike
+	for _, locale := range []string{"nn", "nn-NO"} {
+		if dawg, tileSet := decodeLocale(locale, "standard"); dawg != NorwegianBokmålDictionary || tileSet != NorwegianTileSet {
+			t.Errorf("Locale %v does not fall back to Bokmål", locale)
+		}
+	}
+	game := NewGameForLocale("nn", "standard")
+	if game == nil || game.Dawg != NorwegianBokmålDictionary || game.Locale != "nn" {
+		t.Errorf("NewGameForLocale() does not fall back to Bokmål for nn")
+	}
+
+	// Icelandic has no fallback, and is reported as excluded
+	if _, err := LookupDictionary("is_IS"); err == nil || !strings.Contains(err.Error(), "Icelandic") {
+		t.Errorf("Expected an error for an excluded dictionary, got %v", err)
+	}
+	if NewGameForLocale("is", "standard") != nil {
+		t.Errorf("Expected no game for an excluded dictionary")
+	}
+	if _, err := DeserializeGame(data); err == nil {
+		t.Errorf("Expected an error deserializing a game with an excluded dictionary")
+	}
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, MovesRequest{
+		Locale:    "is",
+		BoardType: "standard",
+		Board:     make([]string, BoardSize),
+		Rack:      "abc",
+	})
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "Icelandic") {
+		t.Errorf("Expected a bad request for an excluded dictionary, got %v: %v", w.Code, w.Body.String())
+	}
+	// Unknown locales still default to U.S. English
+	if dawg, err := LookupDictionary("xx"); err != nil || dawg != OtcwlDictionary {
+		t.Errorf("Expected the default dictionary for an unknown locale, got %v", err)
+	}
+}
+
+func TestSerializeDeterministic(t *testing.T) {
+	game := NewOtcwlGame("standard")
+	game.Seed(11)
+	robot := NewHighScoreRobot()
+	for i := 0; i < 6 && !game.IsOver(); i++ {
+		game.ApplyValid(robot.GenerateMove(game.State()))
+	}
+	data, err := game.Serialize()
+	if err != nil {
+		t.Fatalf("Unable to serialize game: %v", err)
+	}
+	// Covers are written in board order, so the output does not
+	// depend on map iteration order
+	for i := 0; i < 5; i++ {
+		again, _ := game.Serialize()
+		if !bytes.Equal(again, data) {
+			t.Fatalf("Serialize() output differs between calls")
+		}
+	}
+	restored, err := DeserializeGame(data)
+	if err != nil {
+		t.Fatalf("Unable to deserialize game: %v", err)
+	}
+	if again, _ := restored.Serialize(); !bytes.Equal(again, data) {
+		t.Errorf("Restored game serializes differently")
+	}
+	// Move scores are calculated on load, not taken from the input
+	tampered := bytes.Replace(data, []byte(`"type":"tile",`), []byte(`"type":"tile","cached_score":999,`), -1)
+	if bytes.Equal(tampered, data) {
+		t.Fatalf("Test data contains no tile moves")
+	}
+	restored, err = DeserializeGame(tampered)
+	if err != nil {
+		t.Fatalf("Unable to deserialize game: %v", err)
+	}
+	state := restored.State()
+	for i, item := range restored.MoveList {
+		if move, ok := item.Move.(*TileMove); ok && move.Score(state) != game.MoveList[i].Score {
+			t.Errorf("Move #%v scores %v, expected %v", i, move.Score(state), game.MoveList[i].Score)
+		}
+	}
+}
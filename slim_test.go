@@ -0,0 +1,96 @@
+//go:build skrafl_slim
+
+// slim_test.go
+// Copyright (C) 2024 Vilhjálmur Þorsteinsson / Miðeind ehf.
+// This file contains tests for builds with the skrafl_slim tag,
+// which leaves the larger dictionaries out (cf. dicts_slim.go)
+
+/*
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+
+package skrafl
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlimExcludedDictionaries(t *testing.T) {
+	if IcelandicDictionary != nil || OspsDictionary != nil || NorwegianBokmålDictionary != nil {
+		t.Errorf("The larger dictionaries should be excluded")
+	}
+	if GetIcelandicDictionary() != nil || GetOspsDictionary() != nil || GetNorwegianBokmålDictionary() != nil {
+		t.Errorf("The getters should return nil for excluded dictionaries")
+	}
+	for locale, name := range map[string]string{
+		"is":    "Icelandic",
+		"is-IS": "Icelandic",
+		"pl":    "Polish",
+		"nb":    "Norwegian (Bokmål)",
+		"no-NO": "Norwegian (Bokmål)",
+	} {
+		dawg, err := LookupDictionary(locale)
+		if dawg != nil || err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected an error for locale %v, got %v", locale, err)
+		}
+		if NewGameForLocale(locale, "standard") != nil {
+			t.Errorf("Expected no game for locale %v", locale)
+		}
+	}
+	if NewIcelandicGame("standard") != nil {
+		t.Errorf("Expected no Icelandic game")
+	}
+	if err := PreloadLocales([]string{"is"}); err == nil {
+		t.Errorf("Expected an error preloading an excluded dictionary")
+	}
+	w := httptest.NewRecorder()
+	HandleMovesRequest(w, MovesRequest{Locale: "is", BoardType: "standard", Rack: "abc"})
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "Icelandic") {
+		t.Errorf("Expected a bad request for an excluded dictionary, got %v: %v", w.Code, w.Body.String())
+	}
+}
+
+func TestSlimIncludedDictionaries(t *testing.T) {
+	for locale, expected := range map[string]*Dawg{
+		"":      OtcwlDictionary,
+		"en_US": OtcwlDictionary,
+		"en_GB": SowpodsDictionary,
+		"nn":    NorwegianNynorskDictionary,
+		"xx":    OtcwlDictionary,
+	} {
+		if dawg, err := LookupDictionary(locale); err != nil || dawg == nil || dawg != expected {
+			t.Errorf("Unexpected dictionary for locale %v: %v", locale, err)
+		}
+	}
+	// A game with an included dictionary can be played to the end
+	for _, locale := range []string{"en_US", "nn"} {
+		game := NewGameForLocale(locale, "standard")
+		if game == nil {
+			t.Fatalf("Unable to create a game for locale %v", locale)
+		}
+		robot := NewHighScoreRobot()
+		for !game.IsOver() {
+			if !game.ApplyValid(robot.GenerateMove(game.State())) {
+				t.Fatalf("Unable to apply a robot move")
+			}
+		}
+		if _, err := game.Serialize(); err != nil {
+			t.Errorf("Unable to serialize game: %v", err)
+		}
+	}
+}